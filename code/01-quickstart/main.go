@@ -2,15 +2,23 @@ package main
 
 import (
 	"gorm-learn/db"
+	"gorm-learn/db/types"
 	"log"
 )
 
 func main() {
-	// 2 自动创建数据库
+	// 2 自动创建数据库, 旧版本中可以为 NULL 的 deleted_at 先迁移为秒级时间戳,
+	// 再把 uint 类型的 price 列迁移为金额 + 币种两列
+	if err := db.MigrateProductSoftDelete(db.DB()); err != nil {
+		log.Fatal("迁移商品删除时间失败: ", err)
+	}
+	if err := db.MigrateProductPrice(db.DB(), "CNY"); err != nil {
+		log.Fatal("迁移商品价格失败: ", err)
+	}
 	db.DB().AutoMigrate(&db.Product{})
 
 	// 3 创建一条记录
-	db.DB().Create(&db.Product{Code: "D42", Price: 100})
+	db.DB().Create(&db.Product{Code: "D42", Price: types.MustMoney("100", "CNY")})
 
 	var product db.Product
 	// 4 根据主键查询数据
@@ -22,17 +30,17 @@ func main() {
 	log.Printf("根据条件 %s 查询到记录: %v\n", "code = D42", product)
 
 	// 6 将当前记录的价格修改为 200
-	db.DB().Model(&product).Update("Price", 200)
+	db.DB().Model(&product).Update("price_amount", types.MustDecimal("200"))
 	db.DB().First(&product, 1)
 	log.Printf("将 Price 修改为 %d: %v\n", 200, product)
 
 	// 7 使用 struct 一次性修改多个字段
-	db.DB().Model(&product).Updates(db.Product{Price: 300, Code: "F42"})
+	db.DB().Model(&product).Updates(db.Product{Price: types.MustMoney("300", "CNY"), Code: "F42"})
 	db.DB().First(&product, 1)
 	log.Printf("使用 struct 一次性修改多个字段: %v\n", product)
 
 	// 8 使用 map 一次性修改多个字段
-	db.DB().Model(&product).Updates(map[string]interface{}{"Price": 400, "Code": "G42"})
+	db.DB().Model(&product).Updates(map[string]interface{}{"price_amount": types.MustDecimal("400"), "Code": "G42"})
 	db.DB().First(&product, 1)
 	log.Printf("使用 map 一次性修改多个字段: %v\n", product)
 
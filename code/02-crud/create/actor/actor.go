@@ -0,0 +1,62 @@
+// 记录操作者: 嵌入 db.AuditModel 后由 actor 插件根据 ctx 填写 CreatedBy、UpdatedBy 与 DeletedBy
+package main
+
+import (
+	"context"
+	"gorm-learn/db"
+	"gorm-learn/db/actor"
+	"gorm-learn/db/types"
+	"log"
+)
+
+func main() {
+	db.Migrate(&db.User{})
+	ctx := actor.With(context.Background(), "alice")
+	d := db.Conn(ctx)
+
+	check := func(name string, id uint, field, want string) {
+		var got string
+		d.Unscoped().Model(&db.User{}).Where("id = ?", id).Pluck(field, &got)
+		log.Printf("%s => %s: %q, 符合预期: %v", name, field, got, got == want)
+	}
+
+	// 1 Create 填写 CreatedBy 与 UpdatedBy, 已经有值的字段保持不变
+	// INSERT INTO `users` (...,`created_by`,`updated_by`,`deleted_by`,...) VALUES (...,'alice','alice','',...)
+	user := db.User{Name: "ZhangSan", Age: 18, Birthday: types.Today()}
+	d.Create(&user)
+	check("Create", user.ID, "created_by", "alice")
+	imported := db.User{Name: "LiSi", Age: 18, Birthday: types.Today(), AuditModel: db.AuditModel{CreatedBy: "importer"}}
+	d.Create(&imported)
+	check("Create 已经有值", imported.ID, "created_by", "importer")
+
+	// 2 CreateInBatches 的每一批、每一条记录都会填写
+	users := []db.User{{Name: "a", Birthday: types.Today()}, {Name: "b", Birthday: types.Today()}, {Name: "c", Birthday: types.Today()}}
+	d.CreateInBatches(&users, 2)
+	for _, u := range users {
+		check("CreateInBatches", u.ID, "created_by", "alice")
+	}
+
+	// 3 使用 map 创建时写入 map, 与 GORM 回填的 @id 一样调用方可以看到
+	// INSERT INTO `users` (`age`,`name`,`created_by`,`updated_by`) VALUES (18,'Johnny','alice','alice')
+	m := map[string]interface{}{"Name": "Johnny", "Age": 18}
+	d.Model(&db.User{}).Create(m)
+	log.Println("map 创建 => map: ", m)
+	ms := []map[string]interface{}{{"Name": "aaa", "Age": 20}, {"Name": "bbb", "Age": 21, "CreatedBy": "system"}}
+	d.Model(&db.User{}).Create(ms)
+	log.Println("[]map 创建 => map: ", ms)
+
+	// 4 Updates 填写 UpdatedBy, 不会修改调用方的 map
+	// UPDATE `users` SET `updated_at`='...',`updated_by`='bob',`name`='王五' WHERE ...
+	bob := db.Conn(actor.With(context.Background(), "bob"))
+	bob.Model(&user).Updates(db.User{Name: "王五"})
+	check("struct Updates", user.ID, "updated_by", "bob")
+	values := map[string]interface{}{"age": 30}
+	db.Conn(actor.With(context.Background(), "carol")).Model(&user).Updates(values)
+	check("map Updates", user.ID, "updated_by", "carol")
+	log.Println("map Updates => 调用方的 map: ", values)
+
+	// 5 软删除在同一条 UPDATE 语句中填写 DeletedBy
+	// UPDATE `users` SET `deleted_at`='...' , `deleted_by` = 'bob' WHERE `users`.`id` = 1 AND `users`.`deleted_at` IS NULL
+	bob.Delete(&user)
+	check("软删除", user.ID, "deleted_by", "bob")
+}
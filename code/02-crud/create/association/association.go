@@ -3,8 +3,8 @@ package main
 
 import (
 	"gorm-learn/db"
+	"gorm-learn/db/types"
 	"log"
-	"time"
 )
 
 func main() {
@@ -15,7 +15,7 @@ func main() {
 	user := db.User{
 		Name:     "张三",
 		Age:      30,
-		Birthday: time.Now(),
+		Birthday: types.Today(),
 		CreditCard: &db.CreditCard{
 			Number: "188282374893789378",
 		},
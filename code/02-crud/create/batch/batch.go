@@ -2,7 +2,9 @@
 package main
 
 import (
+	"context"
 	"gorm-learn/db"
+	"gorm-learn/db/bulk"
 	"log"
 )
 
@@ -22,4 +24,15 @@ func main() {
 	result := d.Omit("Birthday").CreateInBatches(users, 2)
 	log.Println("批量插入数据 => 错误信息: ", result.Error)
 	log.Println("批量插入数据 => 影响行数: ", result.RowsAffected)
+
+	// 导入大量数据时使用 bulk.Load, MySQL 上会使用 LOAD DATA LOCAL INFILE,
+	// 每批 2 条, 2 个 worker 并行导入, 失败的批次会在 report.Errors 中列出
+	more := []db.User{
+		{Name: "SunBa", Age: 23},
+		{Name: "ZhouJiu", Age: 24},
+		{Name: "WuShi", Age: 25},
+	}
+	report, err := bulk.Load(context.Background(), d.Omit("Birthday"), more, bulk.Config{BatchSize: 2, Workers: 2})
+	log.Println("bulk 导入数据 => 错误信息: ", err)
+	log.Printf("bulk 导入数据 => 导入行数: %d, 批次: %d, 耗时: %v", report.Rows, report.Batches, report.Elapsed)
 }
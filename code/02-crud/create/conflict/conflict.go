@@ -2,37 +2,33 @@
 package main
 
 import (
+	"context"
 	"gorm-learn/db"
+	"gorm-learn/db/types"
+	"log"
 
-	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
 func main() {
 	d := db.DB()
 	d.AutoMigrate(&db.User{})
+	d.AutoMigrate(&db.Product{})
 
-	user := db.User{Name: "Sarra", Age: 30}
+	user := db.User{Name: "Sarra", Age: 30, Birthday: types.Today()}
 
 	// 1 忽略冲突
 	d.Clauses(clause.OnConflict{DoNothing: true}).Create(&user)
 
-	// 2 当字段 id 冲突时，修改指定字段为默认值
+	// 2 当字段 id 冲突时，修改指定字段为固定值
 	// MERGE INTO "users" USING *** WHEN NOT MATCHED THEN INSERT *** WHEN MATCHED THEN UPDATE SET ***; SQL Server
-	// INSERT INTO `users` *** ON DUPLICATE KEY UPDATE ***; MySQL
+	// INSERT INTO `users` *** ON DUPLICATE KEY UPDATE `name`='Sarra'; MySQL
 	d.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "id"}},
-		DoUpdates: clause.Assignments(map[string]interface{}{"role": "user"}),
+		DoUpdates: clause.Assignments(map[string]interface{}{"name": "Sarra"}),
 	}).Create(&user)
 
-	// 3 当字段 id 冲突时，使用 SQL 生成指定字段值
-	// INSERT INTO `users` *** ON DUPLICATE KEY UPDATE `count`=GREATEST(count, VALUES(count));
-	d.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "id"}},
-		DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("GREATEST(count, VALUES(count))")}),
-	}).Create(&user)
-
-	// 4 当字段 id 冲突时，将指定字段更新为新值
+	// 3 当字段 id 冲突时，将指定字段更新为新值
 	// MERGE INTO "users" USING *** WHEN NOT MATCHED THEN INSERT *** WHEN MATCHED THEN UPDATE SET "name"="excluded"."name"; SQL Server
 	// INSERT INTO "users" *** ON CONFLICT ("id") DO UPDATE SET "name"="excluded"."name", "age"="excluded"."age"; PostgreSQL
 	// INSERT INTO `users` *** ON DUPLICATE KEY UPDATE `name`=VALUES(name),`age`=VALUES(age); MySQL
@@ -41,10 +37,35 @@ func main() {
 		DoUpdates: clause.AssignmentColumns([]string{"name", "age"}),
 	}).Create(&user)
 
-	// 5 当字段 id 冲突时，将除了主键之外的全部字段进行更新
+	// 4 当字段 id 冲突时，将除了主键之外的全部字段进行更新
 	d.Clauses(clause.OnConflict{
 		UpdateAll: true,
 	}).Create(&user)
 	// INSERT INTO "users" *** ON CONFLICT ("id") DO UPDATE SET "name"="excluded"."name", "age"="excluded"."age", ...;
 	// INSERT INTO `users` *** ON DUPLICATE KEY UPDATE `name`=VALUES(name),`age`=VALUES(age), ...; MySQL
+
+	// 5 clause.OnConflict 在 MySQL 上会生成 8.0.20 起废弃的 VALUES() 函数, 并且不会校验字段,
+	// 使用 db.Upsert 可以校验冲突字段上的唯一索引, 在 MySQL 上改用行别名语法, 并返回插入与更新的数量
+	// INSERT INTO `products` *** AS `new` ON DUPLICATE KEY UPDATE `price_amount`=`new`.`price_amount`, ...; MySQL
+	// INSERT INTO "products" *** ON CONFLICT ("code","deleted_at") DO UPDATE SET "price_amount"="excluded"."price_amount", ...; PostgreSQL / SQLite
+	// 商品的唯一索引为 (code, deleted_at), 新插入的记录 deleted_at 为 0, 只会与未删除的商品冲突
+	products := []db.Product{
+		{Code: "D42", Price: types.MustMoney("100", "CNY")},
+		{Code: "D43", Price: types.MustMoney("200", "CNY")},
+	}
+	ctx := context.Background()
+	result, err := db.Upsert(ctx, &products, db.OnConflict("code", "deleted_at").Update("price_amount", "price_currency"))
+	log.Println("upsert => 错误信息: ", err)
+	log.Println("upsert => 新插入: ", result.Inserted, ", 被更新: ", result.Updated)
+
+	// 6 冲突时累加数值字段
+	// INSERT INTO `users` *** AS `new` ON DUPLICATE KEY UPDATE `name`=`new`.`name`, `age`=`users`.`age`+`new`.`age`, ...; MySQL
+	users := []db.User{{Model: user.Model, Name: "Sarra", Age: 1, Birthday: user.Birthday}}
+	result, err = db.Upsert(ctx, &users, db.OnConflict("id").Update("name").Increment("age"))
+	log.Println("upsert 累加 => 错误信息: ", err)
+	log.Println("upsert 累加 => 新插入: ", result.Inserted, ", 被更新: ", result.Updated)
+
+	// 7 冲突字段上没有唯一索引时直接返回错误
+	_, err = db.Upsert(ctx, &users, db.OnConflict("name").Update("age"))
+	log.Println("upsert 校验 => 错误信息: ", err)
 }
@@ -0,0 +1,61 @@
+// 从 CSV / JSON Lines 导入数据
+package main
+
+import (
+	"context"
+	"errors"
+	"gorm-learn/db"
+	"gorm-learn/db/importer"
+	"gorm-learn/db/types"
+	"log"
+	"os"
+	"strings"
+)
+
+const usersCSV = `姓名,age,birthday,location
+张三,18,2000-01-02,"1,2"
+李四,abc,2000-13-01,1;2
+王五,200,,
+`
+
+const productsJSONL = `{"code":"D42","price_amount":"19.90","price_currency":"CNY"}
+{"code":"D43","price_amount":"abc","price_currency":"CNY"}
+`
+
+func main() {
+	db.Migrate(&db.User{}, &db.Product{})
+	ctx := context.Background()
+
+	// 1 列名映射、类型转换以及校验, 除了模型的 validate 标签, 还可以通过 Validate 增加规则,
+	// 被拒绝的行连同原因输出到标准输出
+	report, err := importer.Import(ctx, strings.NewReader(usersCSV), importer.Options[db.User]{
+		Mapping: map[string]string{"姓名": "Name"},
+		Validate: func(u *db.User) error {
+			if u.Birthday.After(types.Today()) {
+				return errors.New("birthday 不能晚于今天")
+			}
+			return nil
+		},
+		Rejects: os.Stdout,
+	})
+	log.Println("导入用户 => 错误信息: ", err)
+	log.Printf("导入用户 => 结果: %+v", report)
+
+	// 2 只校验不写入, 将要写入的记录输出到标准输出
+	report, err = importer.Import(ctx, strings.NewReader(usersCSV), importer.Options[db.User]{
+		Mapping:      map[string]string{"姓名": "Name"},
+		DryRun:       true,
+		DryRunOutput: os.Stdout,
+	})
+	log.Println("试运行 => 错误信息: ", err)
+	log.Printf("试运行 => 结果: %+v", report)
+
+	// 3 按 code 进行 upsert, 已存在的商品更新价格
+	report, err = importer.Import(ctx, strings.NewReader(productsJSONL), importer.Options[db.Product]{
+		Format:   importer.JSONL,
+		Conflict: db.OnConflict("code").Update("price_amount", "price_currency"),
+		Rejects:  os.Stdout,
+	})
+	log.Println("导入商品 => 错误信息: ", err)
+	log.Printf("导入商品 => 结果: %+v", report)
+}
@@ -4,16 +4,16 @@ package main
 import (
 	"fmt"
 	"gorm-learn/db"
+	"gorm-learn/db/types"
 	"log"
 	"strings"
-	"time"
 )
 
 func main() {
 	db.DB().AutoMigrate(&db.User{})
 
 	// 1 创建 user, 获取主键以及操作结果
-	user := db.User{Name: "Jinzhu", Age: 18, Birthday: time.Now()}
+	user := db.User{Name: "Jinzhu", Age: 18, Birthday: types.Today()}
 	result := db.DB().Create(&user)
 	log.Println("新增用户的 ID: ", user.ID)
 	log.Println("新增时的错误: ", result.Error)
@@ -21,8 +21,8 @@ func main() {
 
 	// 2 批量新增 user
 	users := []*db.User{
-		{Name: "Jinzhu", Age: 18, Birthday: time.Now()},
-		{Name: "Jackson", Age: 19, Birthday: time.Now()},
+		{Name: "Jinzhu", Age: 18, Birthday: types.Today()},
+		{Name: "Jackson", Age: 19, Birthday: types.Today()},
 	}
 	result = db.DB().Create(users)
 	ids := []string{}
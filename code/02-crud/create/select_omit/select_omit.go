@@ -3,8 +3,8 @@ package main
 
 import (
 	"gorm-learn/db"
+	"gorm-learn/db/types"
 	"log"
-	"time"
 )
 
 func main() {
@@ -15,7 +15,7 @@ func main() {
 
 	// 1 指定插入特定的字段
 	// INSERT INTO `users` (`name`,`age`,`created_at`) VALUES ("jinzhu", 18, "2020-07-04 11:05:21.775")
-	user := db.User{Name: "John", Age: 19, Birthday: time.Now()}
+	user := db.User{Name: "John", Age: 19, Birthday: types.Today()}
 	result := d.Select("Name", "Age", "CreatedAt").Create(&user)
 	log.Println("指定插入特定字段 => 错误信息: ", result.Error)
 	log.Println("指定插入特定字段 => 影响行数: ", result.RowsAffected)
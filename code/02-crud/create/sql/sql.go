@@ -3,8 +3,8 @@ package main
 
 import (
 	"gorm-learn/db"
+	"gorm-learn/db/types"
 	"log"
-	"time"
 )
 
 func main() {
@@ -15,7 +15,7 @@ func main() {
 	user := db.User{
 		Name:     "Haha",
 		Age:      30,
-		Birthday: time.Now(),
+		Birthday: types.Today(),
 		Location: &db.Location{X: 33, Y: 44},
 	}
 	result := d.Create(&user)
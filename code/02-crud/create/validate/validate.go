@@ -0,0 +1,52 @@
+// 创建与更新之前按 validate 标签校验模型
+package main
+
+import (
+	"context"
+	"errors"
+	"gorm-learn/db"
+	"gorm-learn/db/validate"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+func main() {
+	d := db.DB()
+	db.Migrate(&db.User{})
+
+	// 1 创建时校验全部字段, 失败时返回 validate.FieldErrors, 不会执行 INSERT
+	result := d.Create(&db.User{Age: -5})
+	log.Println("创建非法用户 => 错误信息: ", result.Error)
+	log.Println("创建非法用户 => 是否为校验错误: ", errors.Is(result.Error, validate.ErrInvalid))
+
+	// 2 逐个字段读取错误
+	var fieldErrs validate.FieldErrors
+	if errors.As(result.Error, &fieldErrs) {
+		for _, fe := range fieldErrs {
+			log.Printf("字段错误 => 字段: %s, 规则: %s, 值: %v, 英文: %s", fe.Field, fe.Rule, fe.Value, fe.Message(validate.English))
+		}
+	}
+
+	// 3 通过 ctx 指定错误信息的语言
+	ctx := validate.WithLang(context.Background(), validate.English)
+	result = d.WithContext(ctx).Create(&[]db.User{{Name: "Johnny", Age: 18}, {Name: "Tom", Age: 200}})
+	log.Println("批量创建 => 错误信息: ", result.Error)
+
+	user := db.User{Name: "Johnny", Age: 18}
+	d.Create(&user)
+
+	// 4 使用 map 部分更新时只校验 map 中的字段, name 的 required 规则不会生效
+	result = d.Model(&user).Updates(map[string]interface{}{"age": 20})
+	log.Println("map 部分更新 => 错误信息: ", result.Error)
+	result = d.Model(&user).Update("age", 151)
+	log.Println("更新为非法年龄 => 错误信息: ", result.Error)
+
+	// 5 SQL 表达式不做校验
+	result = d.Model(&user).Update("age", gorm.Expr("age + ?", 1))
+	log.Println("表达式更新 => 错误信息: ", result.Error)
+
+	// 6 使用结构体更新时只校验非零字段, Select 选中的字段即使是零值也会校验
+	result = d.Model(&user).Select("Name", "Age").Updates(db.User{Age: 30})
+	log.Println("Select 更新 => 错误信息: ", result.Error)
+}
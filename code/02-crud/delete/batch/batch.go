@@ -11,6 +11,7 @@ func main() {
 	d.AutoMigrate(&db.User{})
 
 	// 传递一个不包含主键的实体，自动执行批量删除
+	// 需要删除的记录很多时, 一条 DELETE 会长时间持有锁, 参考 delete/chunk 分批删除
 	result := d.Delete(&db.User{}, "name like ?", "%Haha%")
 	log.Println("批量删除 => 错误信息: ", result.Error)
 	log.Println("批量删除 => 影响行数: ", result.RowsAffected)
@@ -0,0 +1,87 @@
+// 级联软删除: 按关联上的 cascade 标签软删除、恢复与物理删除关联的记录
+package main
+
+import (
+	"gorm-learn/db"
+	"gorm-learn/db/softdelete"
+	"gorm-learn/db/types"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Author 作者, 删除时级联删除文章
+type Author struct {
+	gorm.Model
+	Name  string
+	Posts []Post `cascade:"all"`
+}
+
+// Post 文章, 删除时级联删除标签, 仍然被其他文章使用的标签保留
+type Post struct {
+	ID        uint
+	Title     string
+	DeletedAt softdelete.Milli `gorm:"not null;default:0"`
+	AuthorID  uint
+	Tags      []Tag `gorm:"many2many:post_tags" cascade:"all"`
+}
+
+// Tag 标签
+type Tag struct {
+	gorm.Model
+	Name string
+}
+
+func main() {
+	d := db.DB()
+	db.Migrate(&db.User{}, &db.CreditCard{}, &Author{}, &Post{}, &Tag{})
+
+	// 1 has one: 软删除用户时一起软删除信用卡, 恢复时一起恢复
+	// UPDATE `credit_cards` SET `deleted_at`='...' WHERE `credit_cards`.`user_id` IN (1) AND `credit_cards`.`deleted_at` IS NULL
+	user := db.User{Name: "cascade", Age: 18, Birthday: types.Today(), CreditCard: &db.CreditCard{Number: "4111 1111 1111 1111"}}
+	d.Create(&user)
+	result := d.Delete(&user)
+	var cards int64
+	d.Scopes(softdelete.OnlyTrashed).Model(&db.CreditCard{}).Where("user_id = ?", user.ID).Count(&cards)
+	log.Println("软删除用户 => 错误信息: ", result.Error, ", 已删除的信用卡: ", cards)
+	result = softdelete.Restore(d, &user)
+	d.Model(&db.CreditCard{}).Where("user_id = ?", user.ID).Count(&cards)
+	log.Println("恢复用户 => 错误信息: ", result.Error, ", 恢复的信用卡: ", cards)
+
+	// 2 has many 与 many to many: 子记录在父记录之前处理, 全部在同一个事务中执行
+	shared := Tag{Name: "shared"}
+	author := Author{Name: "LiSi", Posts: []Post{
+		{Title: "first", Tags: []Tag{{Name: "go"}, shared}},
+		{Title: "second", Tags: []Tag{{Name: "gorm"}}},
+	}}
+	d.Create(&author)
+	other := Author{Name: "WangWu", Posts: []Post{{Title: "other"}}}
+	d.Create(&other)
+	d.Model(&other.Posts[0]).Association("Tags").Append(&author.Posts[0].Tags[1])
+
+	// 先单独删除一篇文章, 恢复作者时它不会被恢复
+	d.Delete(&author.Posts[1])
+	time.Sleep(2 * time.Second)
+
+	result = d.Delete(&author)
+	var posts, tags int64
+	d.Scopes(softdelete.OnlyTrashed).Model(&Post{}).Where("author_id = ?", author.ID).Count(&posts)
+	d.Scopes(softdelete.OnlyTrashed).Model(&Tag{}).Count(&tags)
+	log.Println("软删除作者 => 错误信息: ", result.Error, ", 已删除的文章: ", posts, ", 已删除的标签: ", tags)
+
+	// 3 只恢复与作者一起被删除的文章与标签, 连接表中的记录在软删除时保留
+	result = softdelete.Restore(d, &author)
+	d.Model(&Post{}).Where("author_id = ?", author.ID).Count(&posts)
+	log.Println("恢复作者 => 错误信息: ", result.Error, ", 恢复的文章: ", posts)
+
+	// 4 物理删除: 先删除连接表中的记录, 再删除标签、文章与作者, 被其他文章使用的标签保留
+	// DELETE FROM `post_tags` WHERE `post_tags`.`post_id` IN (1,2)
+	result = d.Unscoped().Delete(&author)
+	d.Unscoped().Model(&Tag{}).Where("name = ?", shared.Name).Count(&tags)
+	log.Println("物理删除作者 => 错误信息: ", result.Error, ", 保留的共享标签: ", tags)
+
+	// 5 级联同样受全局删除的限制
+	result = d.Delete(&Author{})
+	log.Println("没有条件的删除 => 错误信息: ", result.Error)
+}
@@ -0,0 +1,40 @@
+// 分批删除大量记录, 避免长时间持有锁
+package main
+
+import (
+	"context"
+	"gorm-learn/db"
+	"gorm-learn/db/chunk"
+	"log"
+	"time"
+)
+
+func main() {
+	d := db.DB()
+	d.AutoMigrate(&db.User{})
+	ctx := context.Background()
+
+	// 1 每批软删除 500 条, 批与批之间暂停 100 毫秒
+	deleter := chunk.New(d, &db.User{}, chunk.Config{
+		BatchSize: 500,
+		Pause:     100 * time.Millisecond,
+		OnProgress: func(p chunk.Progress) error {
+			log.Printf("分批删除 => 第 %d 批删除 %d 条, 累计 %d 条, 主键已处理到 %v", p.Batch, p.Deleted, p.Total, p.Cursor)
+			return nil
+		},
+	})
+	progress, err := deleter.Delete(ctx, "name like ?", "%Haha%")
+	log.Println("分批删除 => 错误信息: ", err)
+	log.Println("分批删除 => 删除总数: ", progress.Total)
+
+	// 2 中断后从上次处理到的主键继续
+	resumed := chunk.New(d, &db.User{}, chunk.Config{BatchSize: 500, ResumeAfter: progress.Cursor})
+	progress, err = resumed.Delete(ctx, "name like ?", "%Haha%")
+	log.Println("断点继续删除 => 错误信息: ", err, ", 删除总数: ", progress.Total)
+
+	// 3 物理删除 30 天之前被软删除的记录
+	purger := chunk.New(d, &db.User{}, chunk.Config{BatchSize: 1000})
+	progress, err = purger.PurgeSoftDeleted(ctx, time.Now().AddDate(0, 0, -30))
+	log.Println("清理软删除记录 => 错误信息: ", err)
+	log.Println("清理软删除记录 => 删除总数: ", progress.Total)
+}
@@ -2,7 +2,10 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"gorm-learn/db"
+	"gorm-learn/db/firewall"
 	"log"
 
 	"gorm.io/gorm"
@@ -10,13 +13,15 @@ import (
 
 func main() {
 	d := db.DB()
-	d.AutoMigrate(&db.User{})
+	db.Migrate(&db.User{})
 
 	// 调用删除方法时没有指定 where 条件会直接抛出异常
 	result := d.Delete(&db.User{})
 	log.Println("没有指定 where 条件 => 错误信息: ", result.Error)
 	log.Println("没有指定 where 条件 => 影响行数: ", result.RowsAffected)
 
+	// GORM 自带的检查可以被轻易绕过, 以下绕过方式都会被 firewall 插件拦截
+
 	// 绕过方式 1：指定一个永远为真的条件
 	result = d.Where("1 = 1").Delete(&db.User{})
 	log.Println("绕过方式 1 => 错误信息: ", result.Error)
@@ -27,8 +32,19 @@ func main() {
 	log.Println("绕过方式 2 => 错误信息: ", result.Error)
 	log.Println("绕过方式 2 => 影响行数: ", result.RowsAffected)
 
-	// 绕过方式 3：开启 AllowGlobalUpdate
+	// 绕过方式 3：开启 AllowGlobalUpdate, 软删除生成的 WHERE `deleted_at` IS NULL 不算有效条件
 	result = d.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&db.User{})
 	log.Println("绕过方式 3 => 错误信息: ", result.Error)
 	log.Println("绕过方式 3 => 影响行数: ", result.RowsAffected)
+
+	// 绕过方式 4：拼接多条语句
+	result = d.Exec("update users set age = 0 where id = 1; drop table users")
+	log.Println("绕过方式 4 => 错误信息: ", result.Error)
+	log.Println("绕过方式 4 => 是否被拦截: ", errors.Is(result.Error, firewall.ErrBlocked))
+
+	// 确实需要全表删除时, 通过 ctx 显式审批, 执行的语句会记录在审计日志中
+	ctx := firewall.Approve(context.Background(), firewall.NoWhere)
+	result = d.WithContext(ctx).Exec("delete from users")
+	log.Println("审批后删除 => 错误信息: ", result.Error)
+	log.Println("审批后删除 => 影响行数: ", result.RowsAffected)
 }
@@ -3,12 +3,12 @@ package main
 
 import (
 	"gorm-learn/db"
+	"gorm-learn/db/types"
 	"log"
-	"time"
 )
 
 func main() {
-	user := db.User{Name: "ZhangSan", Age: 28, Birthday: time.Now()}
+	user := db.User{Name: "ZhangSan", Age: 28, Birthday: types.Today()}
 
 	d := db.DB()
 	d.AutoMigrate(&user)
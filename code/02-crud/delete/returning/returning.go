@@ -1,10 +1,14 @@
 // 删除记录的时候返回被删除的数据
+//
+// MySQL 本身不支持 RETURNING, db.DB() 中注册的 returning 插件会在删除前
+// 使用 SELECT ... FOR UPDATE 锁定并读取记录, 使得示例在各个数据库上的表现一致
 package main
 
 import (
 	"gorm-learn/db"
 	"log"
 
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
@@ -19,4 +23,13 @@ func main() {
 	log.Println("删除时返回数据 => 错误信息: ", result.Error)
 	log.Println("删除时返回数据 => 影响行数: ", result.RowsAffected)
 	log.Println("删除时返回数据 => users: ", users)
+
+	// 更新时同样可以返回更新后的数据
+	var updated []db.User
+	result = d.Model(&updated).Clauses(clause.Returning{
+		Columns: []clause.Column{{Name: "id"}, {Name: "age"}},
+	}).Where("age < ?", 18).Update("age", gorm.Expr("age + ?", 1))
+	log.Println("更新时返回数据 => 错误信息: ", result.Error)
+	log.Println("更新时返回数据 => 影响行数: ", result.RowsAffected)
+	log.Println("更新时返回数据 => users: ", updated)
 }
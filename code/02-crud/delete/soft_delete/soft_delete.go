@@ -0,0 +1,63 @@
+// 软删除策略: gorm.DeletedAt 与 softdelete 包中的时间戳字段, 以及恢复、查询已删除记录与物理删除
+package main
+
+import (
+	"fmt"
+	"gorm-learn/db"
+	"gorm-learn/db/softdelete"
+	"gorm-learn/db/types"
+	"log"
+	"time"
+)
+
+func main() {
+	d := db.DB()
+	if err := db.MigrateProductSoftDelete(d); err != nil {
+		log.Fatal("迁移商品删除时间失败: ", err)
+	}
+	db.Migrate(&db.User{}, &db.Product{})
+
+	// 1 Product 使用 softdelete.Unix, 删除时写入秒级时间戳
+	// UPDATE `products` SET `deleted_at`=1700000000 WHERE `products`.`id` = 1 AND `products`.`deleted_at` = 0
+	code := fmt.Sprintf("SD-%d", time.Now().UnixNano())
+	product := db.Product{Code: code, Price: types.MustMoney("10", "CNY")}
+	d.Create(&product)
+	result := d.Delete(&product)
+	log.Println("软删除商品 => 错误信息: ", result.Error, ", 删除时间: ", product.DeletedAt.Time())
+
+	// 2 唯一索引为 (code, deleted_at), 删除之后可以再创建相同 Code 的商品
+	again := db.Product{Code: code, Price: types.MustMoney("20", "CNY")}
+	result = d.Create(&again)
+	log.Println("创建同名商品 => 错误信息: ", result.Error)
+
+	// 3 查询时默认排除已删除的记录, OnlyTrashed 只查询已删除的记录, WithTrashed 查询全部记录
+	var products []db.Product
+	d.Where("code = ?", code).Find(&products)
+	log.Println("默认查询 => 数量: ", len(products))
+	d.Scopes(softdelete.OnlyTrashed).Where("code = ?", code).Find(&products)
+	log.Println("OnlyTrashed => 数量: ", len(products))
+	d.Scopes(softdelete.WithTrashed).Where("code = ?", code).Find(&products)
+	log.Println("WithTrashed => 数量: ", len(products))
+
+	// 4 同名的商品未删除时, 恢复会违反唯一索引
+	result = softdelete.Restore(d, &product)
+	log.Println("恢复商品 => 错误信息: ", result.Error)
+	d.Delete(&again)
+	result = softdelete.Restore(d, &product)
+	log.Println("删除同名商品后恢复 => 错误信息: ", result.Error, ", 影响行数: ", result.RowsAffected, ", 是否已删除: ", product.DeletedAt.Deleted())
+
+	// 5 Purge 只物理删除已删除的记录, 未删除的记录不受影响
+	result = softdelete.Purge(d, &db.Product{}, "code = ?", code)
+	log.Println("物理删除商品 => 错误信息: ", result.Error, ", 影响行数: ", result.RowsAffected)
+
+	// 6 同样的 API 也支持 gorm.DeletedAt
+	// SELECT * FROM `users` WHERE name = 'ZhangSan' AND `users`.`deleted_at` IS NOT NULL
+	user := db.User{Name: "ZhangSan", Age: 28, Birthday: types.Today()}
+	d.Create(&user)
+	d.Delete(&user)
+	var users []db.User
+	d.Scopes(softdelete.OnlyTrashed).Where("name = ?", user.Name).Find(&users)
+	log.Println("已删除的用户 => 数量: ", len(users))
+	result = softdelete.Restore(d, &user)
+	log.Println("恢复用户 => 错误信息: ", result.Error, ", 影响行数: ", result.RowsAffected)
+}
@@ -10,6 +10,7 @@ func main() {
 	d := db.DB()
 	d.AutoMigrate(&db.User{})
 
+	// Find 会把全部记录加载到内存中, 导出整张表时使用 export 包或 cmd/export 流式处理
 	var users []db.User
 	result := d.Find(&users)
 	log.Println("查询所有记录 => 错误信息: ", result.Error)
@@ -0,0 +1,46 @@
+// 敏感字段脱敏
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"gorm-learn/db"
+	"gorm-learn/db/mask"
+	"gorm-learn/db/types"
+	"log"
+)
+
+func main() {
+	d := db.DB()
+	d.AutoMigrate(&db.User{})
+	d.AutoMigrate(&db.CreditCard{})
+
+	user := db.User{
+		Name:       "李四",
+		Age:        25,
+		Birthday:   types.Today(),
+		CreditCard: &db.CreditCard{Number: "4111 1111 1111 1111"},
+	}
+	if err := d.Create(&user).Error; err != nil {
+		log.Fatal("创建用户出错: ", err)
+	}
+
+	var findUser = new(db.User)
+	d.Preload("CreditCard").First(findUser, user.ID)
+
+	// 1 String 与 JSON 输出中只包含卡号后四位和卡品牌
+	log.Println("脱敏打印 => 用户信息: ", findUser)
+	data, _ := json.Marshal(findUser)
+	log.Println("脱敏 JSON => ", string(data))
+
+	// 2 调试输出使用 mask.Dump, 按照 mask 标签脱敏
+	log.Println("脱敏调试输出 => ", mask.Dump(*findUser.CreditCard))
+
+	// 3 未授权的上下文无法获取明文
+	_, err := findUser.CreditCard.RevealNumber(context.Background())
+	log.Println("未授权获取明文 => 错误信息: ", err)
+
+	// 4 经过授权的代码路径显式获取明文
+	number, err := findUser.CreditCard.RevealNumber(mask.WithUnmasked(context.Background()))
+	log.Println("授权后获取明文 => ", number, err)
+}
@@ -0,0 +1,58 @@
+// 审计日志: 记录每一次变更的操作者、请求 ID 以及变更前后的值
+package main
+
+import (
+	"context"
+	"gorm-learn/db"
+	"gorm-learn/db/actor"
+	"gorm-learn/db/types"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+func main() {
+	db.Migrate(&db.User{})
+
+	// 操作者与请求 ID 通常由 HTTP 中间件写入 ctx
+	ctx := actor.With(context.Background(), "alice")
+	ctx = actor.WithRequestID(ctx, "req-0001")
+	d := db.Conn(ctx)
+
+	user := db.User{Name: "王五", Age: 22, Birthday: types.Today()}
+	d.Create(&user)
+
+	// 1 struct 与 map 更新, 只记录实际发生变化的列
+	d.Model(&user).Updates(db.User{Name: "赵六", Age: 22})
+	d.Model(&user).Updates(map[string]interface{}{"age": 30})
+
+	// 2 gorm.Expr 由数据库计算新值, 插件在更新之后重新读取记录
+	// SELECT * FROM `users` WHERE `users`.`id` = 1 AND `users`.`deleted_at` IS NULL FOR UPDATE
+	// UPDATE `users` SET `age`=age + 1,`updated_at`='...' WHERE `users`.`deleted_at` IS NULL AND `id` = 1
+	// SELECT * FROM `users` WHERE `users`.`id` IN (1)
+	d.Model(&user).Update("age", gorm.Expr("age + ?", 1))
+
+	// 3 Save 更新全部字段, 软删除与物理删除同样会被记录
+	d.First(&user, user.ID)
+	user.Name = "孙七"
+	d.Save(&user)
+	d.Delete(&user)
+	d.Unscoped().Delete(&user)
+
+	// 4 按主键查询一条记录的全部历史
+	logs, err := db.History(&user)
+	log.Println("变更历史 => 错误信息: ", err, ", 数量: ", len(logs))
+	for _, l := range logs {
+		log.Printf("%s %s by %s (%s): %+v", l.CreatedAt.Format("15:04:05"), l.Operation, l.Actor, l.RequestID, l.Changes.Data)
+	}
+
+	// 5 日志与变更在同一个事务中写入, 事务回滚时日志同样不会保留
+	other := db.User{Name: "回滚", Age: 18, Birthday: types.Today()}
+	d.Create(&other)
+	err = db.WithTx(ctx, func(tx *gorm.DB) error {
+		tx.Model(&other).Update("age", 99)
+		return gorm.ErrInvalidData
+	})
+	logs, _ = db.History(&other)
+	log.Println("回滚之后的历史 => 错误信息: ", err, ", 数量: ", len(logs))
+}
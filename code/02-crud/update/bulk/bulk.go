@@ -0,0 +1,26 @@
+// 一条语句把多条记录更新为各自不同的值
+package main
+
+import (
+	"context"
+	"gorm-learn/db"
+	"log"
+)
+
+func main() {
+	d := db.DB()
+	d.AutoMigrate(&db.User{})
+
+	var users []db.User
+	d.Limit(5).Find(&users)
+	for i := range users {
+		users[i].Age += i + 1
+	}
+
+	// UPDATE `users` SET `age`=CASE `id` WHEN 1 THEN 19 WHEN 2 THEN 21 ELSE `age` END,`updated_at`=***
+	// WHERE `users`.`id` IN (1,2) AND `users`.`deleted_at` IS NULL
+	result, err := db.BulkUpdateInBatches(context.Background(), users, 2, "Age")
+	log.Println("批量更新不同的值 => 错误信息: ", err)
+	log.Println("批量更新不同的值 => 影响行数: ", result.RowsAffected)
+	log.Println("批量更新不同的值 => 每批影响行数: ", result.Batches)
+}
@@ -10,7 +10,7 @@ func main() {
 	d := db.DB()
 	d.AutoMigrate(&db.User{})
 
-	// 更新所有字段
+	// 更新所有字段, User 声明了版本号, 记录被其他请求修改过时返回 optimistic.ErrStaleObject, 参考 optimistic 目录
 	var user = new(db.User)
 	d.First(user, 27)
 	log.Println("更新所有字段 => 查询出的用户原信息: ", *user)
@@ -0,0 +1,56 @@
+// 基于版本号的乐观锁: 更新时检查版本号, 记录已经被修改时返回 optimistic.ErrStaleObject
+package main
+
+import (
+	"context"
+	"errors"
+	"gorm-learn/db"
+	"gorm-learn/db/optimistic"
+	"log"
+)
+
+func main() {
+	d := db.DB()
+	db.Migrate(&db.User{})
+
+	user := db.User{Name: "Johnny", Age: 18}
+	d.Create(&user)
+	log.Println("创建用户 => 版本号: ", user.Version)
+
+	// 1 两个请求读取了同一条记录
+	var a, b db.User
+	d.First(&a, user.ID)
+	d.First(&b, user.ID)
+
+	// 2 第一个请求保存成功, 版本号加 1
+	a.Age = 20
+	result := d.Save(&a)
+	log.Println("请求 A 保存 => 错误信息: ", result.Error, ", 版本号: ", a.Version)
+
+	// 3 第二个请求持有的版本号已过期, 更新不会影响任何行
+	b.Name = "Tom"
+	result = d.Save(&b)
+	log.Println("请求 B 保存 => 错误信息: ", result.Error, ", 影响行数: ", result.RowsAffected)
+	log.Println("请求 B 保存 => 是否为版本冲突: ", errors.Is(result.Error, optimistic.ErrStaleObject))
+	var stale *optimistic.StaleObjectError
+	if errors.As(result.Error, &stale) {
+		log.Printf("请求 B 保存 => 模型: %s, 主键: %v, 过期的版本: %d", stale.Model, stale.PrimaryKey, stale.Version)
+	}
+
+	// 4 使用 Updates 部分更新同样会检查版本号
+	result = d.Model(&b).Updates(map[string]interface{}{"age": 30})
+	log.Println("请求 B 部分更新 => 错误信息: ", result.Error)
+
+	// 5 Retry 在冲突时重新读取最新的记录, 再次应用修改
+	err := optimistic.Retry(context.Background(), d, &b, func(u *db.User) error {
+		u.Name = "Tom"
+		return nil
+	}, 0)
+	log.Println("请求 B 重试 => 错误信息: ", err, ", 记录: ", b)
+
+	// 6 没有持有版本号的批量更新不检查冲突, 版本号在数据库中加 1
+	result = d.Model(&db.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{"age": 40})
+	log.Println("批量更新 => 错误信息: ", result.Error)
+	d.First(&user, user.ID)
+	log.Println("批量更新 => 重新查询的记录: ", user)
+}
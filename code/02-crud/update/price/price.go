@@ -0,0 +1,38 @@
+// 使用 SQL 表达式原子地调整商品价格
+package main
+
+import (
+	"gorm-learn/db"
+	"gorm-learn/db/types"
+	"log"
+)
+
+func main() {
+	d := db.DB()
+	// 先迁移旧的删除时间列, 再迁移旧的价格列
+	if err := db.MigrateProductSoftDelete(d); err != nil {
+		log.Fatal("迁移商品删除时间失败: ", err)
+	}
+	if err := db.MigrateProductPrice(d, "CNY"); err != nil {
+		log.Fatal("迁移商品价格失败: ", err)
+	}
+	d.AutoMigrate(&db.Product{})
+
+	product := db.Product{Code: "P100", Price: types.MustMoney("199.99", "CNY")}
+	d.Create(&product)
+	log.Println("原始价格 => ", product.Price)
+
+	// 1 在应用中计算: 打 85 折
+	discounted, err := product.Price.Discount(types.MustDecimal("15"))
+	log.Println("打 85 折后的价格 => ", discounted, err)
+
+	// 2 在数据库中原子地调整: price = price * 1.1 + 5
+	// UPDATE `products` SET `price_amount`=ROUND(`price_amount` * CAST('1.1000' AS DECIMAL(19,4)) + CAST('5.0000' AS DECIMAL(19,4)), 2) WHERE price_currency = 'CNY' AND `id` = 1
+	err = product.AdjustPrice(d, types.MustDecimal("1.1"), types.MustMoney("5", "CNY"))
+	log.Println("原子调整价格 => 错误信息: ", err)
+	log.Println("原子调整价格 => 调整后的价格: ", product.Price)
+
+	// 3 币种不一致时拒绝调整
+	err = product.AdjustPrice(d, types.MustDecimal("1"), types.MustMoney("5", "USD"))
+	log.Println("币种不一致 => 错误信息: ", err)
+}
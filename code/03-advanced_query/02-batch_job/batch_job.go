@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"gorm-learn/db"
+	"gorm-learn/db/job"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// 使用可恢复的批处理任务回填数据: 每批 100 条, 同时处理 2 批, 每批在事务中执行
+// 中途失败或者进程退出后再次运行, 会从 batch_jobs 表中记录的检查点继续
+func main() {
+	d := db.DB()
+	db.Migrate(&db.User{}, &job.BatchJob{})
+	ctx := context.Background()
+
+	config := job.Config{
+		Name:        "backfill-user-age",
+		BatchSize:   100,
+		Concurrency: 2,
+		Transaction: true,
+		OnProgress: func(p job.Progress) {
+			log.Printf("回填年龄 => 已完成 %d 批, %d 条, 主键已处理到 %d / %d", p.Batches, p.Processed, p.LastID, p.HighWater)
+		},
+	}
+	onlyZeroAge := func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("age = ?", 0)
+	}
+	backfill := func(ctx context.Context, tx *gorm.DB, users []db.User) error {
+		ids := make([]uint, 0, len(users))
+		for _, user := range users {
+			ids = append(ids, user.ID)
+		}
+		return tx.Model(&db.User{}).Where("id IN ?", ids).Update("age", 18).Error
+	}
+
+	// 1 试运行: 处理函数在事务中执行后回滚, 不会保存检查点
+	dryRun := config
+	dryRun.DryRun = true
+	result, err := job.Run(ctx, d, dryRun, onlyZeroAge, backfill)
+	log.Println("试运行 => 错误信息: ", err)
+	log.Printf("试运行 => 结果: %+v", result)
+
+	// 2 正式运行, 已经完成的任务再次运行时直接返回
+	result, err = job.Run(ctx, d, config, onlyZeroAge, backfill)
+	log.Println("回填年龄 => 错误信息: ", err)
+	log.Printf("回填年龄 => 结果: %+v", result)
+}
@@ -0,0 +1,53 @@
+// 由模型生命周期产生的领域事件, 事件在事务提交之后才会发布
+package main
+
+import (
+	"context"
+	"errors"
+	"gorm-learn/db"
+	"gorm-learn/db/event"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+func main() {
+	d := db.DB()
+	db.Migrate(&db.User{})
+
+	// 订阅全部事件
+	unsubscribe := db.Subscribe(func(ctx context.Context, e event.Event) {
+		log.Printf("领域事件 => %s %s, 更新的字段: %v", e.Model, e.Kind, e.Changed)
+	})
+	defer unsubscribe()
+
+	// 只订阅用户的更新事件, user 为更新之后的副本
+	db.On[db.User](event.Updated, func(ctx context.Context, e event.Event, user *db.User) {
+		if user != nil {
+			log.Printf("用户更新 => ID: %d, 年龄: %d", user.ID, user.Age)
+		}
+	})
+
+	// 1 创建、更新、软删除、恢复以及永久删除
+	user := db.User{Name: "Johnny", Age: 18}
+	d.Create(&user)
+	d.Model(&user).Update("age", 20)
+	d.Delete(&user)
+	d.Unscoped().Model(&user).Update("deleted_at", nil)
+	d.Unscoped().Delete(&user)
+
+	// 2 事务中产生的事件在提交之后才会发布
+	err := d.Transaction(func(tx *gorm.DB) error {
+		tx.Create(&db.User{Name: "aaa", Age: 18})
+		log.Println("事务提交之前 => 还没有收到创建事件")
+		return nil
+	})
+	log.Println("事务提交 => 错误信息: ", err)
+
+	// 3 事务回滚时事件被丢弃, 嵌套事务回滚到保存点时同样只丢弃保存点之后的事件
+	err = d.Transaction(func(tx *gorm.DB) error {
+		tx.Create(&db.User{Name: "bbb", Age: 18})
+		return errors.New("回滚")
+	})
+	log.Println("事务回滚 => 错误信息: ", err)
+}
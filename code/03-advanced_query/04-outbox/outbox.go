@@ -0,0 +1,90 @@
+// 事务性发件箱: 领域事件与用户数据在同一个事务中写入 outbox 表, 再由 Dispatcher 投递
+package main
+
+import (
+	"context"
+	"errors"
+	"gorm-learn/db"
+	"gorm-learn/db/outbox"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func main() {
+	d := db.DB()
+	// 迁移 users 时会同时迁移 outbox 表
+	db.Migrate(&db.User{})
+	ctx := context.Background()
+
+	// 1 提交的事务会写入消息, 回滚的事务不会留下任何消息
+	user := db.User{Name: "Johnny", Age: 18}
+	d.Create(&user)
+	d.Model(&user).Update("age", 20)
+	err := d.Transaction(func(tx *gorm.DB) error {
+		tx.Create(&db.User{Name: "aaa", Age: 18})
+		return errors.New("回滚")
+	})
+	log.Println("回滚的事务 => 错误信息: ", err)
+
+	var pending int64
+	d.Model(&outbox.Message{}).Where("status = ?", outbox.Pending).Count(&pending)
+	log.Println("待投递的消息 => 数量: ", pending)
+
+	// 2 投递到本地的 HTTP 服务, 第一次请求失败, 消息会在退避之后重试
+	failed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !failed {
+			failed = true
+			http.Error(w, "暂时不可用", http.StatusServiceUnavailable)
+			return
+		}
+		log.Printf("HTTP 收到消息 => ID: %s, 主题: %s, 内容: %s", r.Header.Get("X-Outbox-Id"), r.Header.Get("X-Outbox-Topic"), body)
+	}))
+	defer server.Close()
+
+	dispatcher := &outbox.Dispatcher{
+		DB:      d,
+		Sink:    &outbox.HTTPSink{URL: server.URL},
+		Backoff: func(int) time.Duration { return 100 * time.Millisecond },
+	}
+	n, err := dispatcher.DispatchOnce(ctx)
+	log.Println("第一次投递 => 领取的消息: ", n, ", 错误信息: ", err)
+	time.Sleep(200 * time.Millisecond)
+	n, err = dispatcher.DispatchOnce(ctx)
+	log.Println("重试投递 => 领取的消息: ", n, ", 错误信息: ", err)
+
+	// 3 持续投递到 channel 与文件, 多个 Dispatcher 通过 SKIP LOCKED 与租约领取不同的消息
+	d.Model(&user).Update("name", "Tom")
+	messages := make(chan outbox.Message, 10)
+	file, err := outbox.NewFileSink(filepath.Join(os.TempDir(), "outbox.jsonl"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	sink := outbox.SinkFunc(func(ctx context.Context, msg outbox.Message) error {
+		if err := file.Send(ctx, msg); err != nil {
+			return err
+		}
+		return outbox.ChanSink(messages).Send(ctx, msg)
+	})
+
+	runCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		go (&outbox.Dispatcher{DB: d, Sink: sink, PollInterval: 100 * time.Millisecond}).Run(runCtx)
+	}
+	select {
+	case msg := <-messages:
+		log.Printf("channel 收到消息 => ID: %d, 主题: %s, 内容: %s", msg.ID, msg.Topic, msg.Payload)
+	case <-runCtx.Done():
+		log.Println("channel 没有收到消息")
+	}
+}
@@ -0,0 +1,70 @@
+// 通过 ctx 传递的事务: 嵌套保存点、提交后回调以及死锁重试
+package main
+
+import (
+	"context"
+	"errors"
+	"gorm-learn/db"
+	"log"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+func main() {
+	d := db.DB()
+	db.Migrate(&db.User{})
+	ctx := context.Background()
+
+	// 1 嵌套的 WithTx 使用保存点, 内层失败只回滚内层的修改
+	err := db.WithTx(ctx, func(tx *gorm.DB) error {
+		ctx := tx.Statement.Context
+		tx.Create(&db.User{Name: "outer", Age: 18})
+		db.AfterCommit(ctx, func() { log.Println("提交之后 => 外层的回调") })
+
+		err := db.WithTx(ctx, func(tx *gorm.DB) error {
+			tx.Create(&db.User{Name: "inner", Age: 18})
+			db.AfterCommit(tx.Statement.Context, func() { log.Println("提交之后 => 内层的回调, 不会执行") })
+			return errors.New("内层失败")
+		})
+		log.Println("嵌套事务 => 错误信息: ", err)
+
+		// 接收 ctx 的函数会加入同一个事务
+		var count int64
+		db.Conn(ctx).Model(&db.User{}).Where("name IN ?", []string{"outer", "inner"}).Count(&count)
+		log.Println("事务中查询 => 数量: ", count)
+		return nil
+	})
+	log.Println("外层事务 => 错误信息: ", err)
+
+	// 2 两个 goroutine 以相反的顺序锁定同一组记录, 第一次执行时必然发生死锁,
+	// MySQL 回滚其中一个事务并返回 1213, WithTx 随机等待之后重新执行整个函数
+	a, b := db.User{Name: "a", Age: 18}, db.User{Name: "b", Age: 18}
+	d.Create(&a)
+	d.Create(&b)
+
+	var locked sync.WaitGroup
+	locked.Add(2)
+	transfer := func(name string, first, second uint) {
+		attempts := 0
+		err := db.WithTx(ctx, func(tx *gorm.DB) error {
+			attempts++
+			if err := tx.Model(&db.User{}).Where("id = ?", first).Update("age", gorm.Expr("age + 1")).Error; err != nil {
+				return err
+			}
+			// 只在第一次执行时等待对方锁定另一条记录, 制造死锁
+			if attempts == 1 {
+				locked.Done()
+				locked.Wait()
+			}
+			return tx.Model(&db.User{}).Where("id = ?", second).Update("age", gorm.Expr("age - 1")).Error
+		})
+		log.Printf("%s => 执行次数: %d, 错误信息: %v", name, attempts, err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); transfer("事务 1", a.ID, b.ID) }()
+	go func() { defer wg.Done(); transfer("事务 2", b.ID, a.ID) }()
+	wg.Wait()
+}
@@ -0,0 +1,95 @@
+// 悲观锁: 在 SELECT ... FOR UPDATE 锁定的行中扣减库存, 以及 NOWAIT、SKIP LOCKED 两种不等待的方式
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm-learn/db"
+	"gorm-learn/db/types"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func main() {
+	d := db.DB()
+	db.Migrate(&db.Product{})
+	ctx := context.Background()
+
+	// 1 200 个 goroutine 同时抢购 100 件库存, 每次购买 3 件, 最多只能成功 33 次
+	product := db.Product{Code: fmt.Sprintf("STOCK-%d", time.Now().UnixNano()), Price: types.MustMoney("9.9", "CNY"), Stock: 100}
+	d.Create(&product)
+
+	var succeeded, insufficient, failed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := db.ReserveStock(ctx, product.ID, 3, db.LockWait)
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case errors.Is(err, db.ErrInsufficientStock):
+				insufficient.Add(1)
+			default:
+				failed.Add(1)
+				log.Println("抢购 => 错误信息: ", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	d.First(&product, product.ID)
+	log.Printf("抢购 => 成功: %d, 库存不足: %d, 其他错误: %d, 剩余库存: %d", succeeded.Load(), insufficient.Load(), failed.Load(), product.Stock)
+	if sold := int(succeeded.Load()) * 3; sold+product.Stock != 100 || product.Stock < 0 {
+		log.Fatalf("抢购 => 发生超卖: 卖出 %d 件, 剩余 %d 件", sold, product.Stock)
+	}
+	log.Println("抢购 => 没有超卖")
+
+	// 2 一个事务持有行锁时, NOWAIT 与 SKIP LOCKED 不等待, 立即返回 ErrLockNotAvailable
+	product = db.Product{Code: fmt.Sprintf("LOCK-%d", time.Now().UnixNano()), Price: types.MustMoney("9.9", "CNY"), Stock: 10}
+	d.Create(&product)
+
+	locked, release := make(chan struct{}), make(chan struct{})
+	go func() {
+		db.WithTx(ctx, func(tx *gorm.DB) error {
+			p := db.Product{ID: product.ID}
+			err := p.Reserve(tx, 1, db.LockWait)
+			close(locked)
+			<-release
+			return err
+		})
+	}()
+	<-locked
+
+	for _, mode := range []db.LockMode{db.LockNoWait, db.LockSkipLocked} {
+		_, err := db.ReserveStock(ctx, product.ID, 1, mode)
+		log.Printf("%s => 错误信息: %v", mode, err)
+		log.Printf("%s => 是否为行被锁定: %v", mode, errors.Is(err, db.ErrLockNotAvailable))
+		var lockErr *db.LockError
+		if errors.As(err, &lockErr) {
+			log.Printf("%s => 表: %s, 主键: %d", mode, lockErr.Table, lockErr.ID)
+		}
+	}
+
+	// 3 默认的方式会等待锁释放, 等待超过 innodb_lock_wait_timeout 时返回 ErrLockTimeout
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		close(release)
+	}()
+	p, err := db.ReserveStock(ctx, product.ID, 1, db.LockWait)
+	if err == nil {
+		log.Println("等待锁释放 => 剩余库存: ", p.Stock)
+	} else {
+		log.Println("等待锁释放 => 错误信息: ", err, ", 是否为锁等待超时: ", errors.Is(err, db.ErrLockTimeout))
+	}
+
+	// 4 库存不足时不修改数据
+	_, err = db.ReserveStock(ctx, product.ID, 100, db.LockWait)
+	log.Println("库存不足 => 错误信息: ", err)
+}
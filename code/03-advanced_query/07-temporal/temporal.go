@@ -0,0 +1,56 @@
+// 历史表: 每次更新与删除之前把商品的当前版本复制到 products_history, 通过 AsOf 查询任意时刻的价格
+package main
+
+import (
+	"fmt"
+	"gorm-learn/db"
+	"gorm-learn/db/temporal"
+	"gorm-learn/db/types"
+	"log"
+	"time"
+)
+
+func main() {
+	d := db.DB()
+	if err := db.MigrateProductSoftDelete(d); err != nil {
+		log.Fatal("迁移商品删除时间失败: ", err)
+	}
+	// 同时创建 products_history 表
+	if err := db.Migrate(&db.Product{}); err != nil {
+		log.Fatal("迁移商品失败: ", err)
+	}
+
+	code := fmt.Sprintf("T-%d", time.Now().UnixNano())
+	product := db.Product{Code: code, Price: types.MustMoney("100", "CNY")}
+	d.Create(&product)
+	created := time.Now()
+	time.Sleep(time.Second)
+
+	// 1 每次调价之前, 插件把当前价格复制到历史表
+	// INSERT INTO `products_history` (`id`,...,`valid_from`,`valid_to`) SELECT `products`.`id`,...,COALESCE(...),'...' FROM `products` WHERE ...
+	// UPDATE `products` SET `price_amount`=120.00,... WHERE ...
+	d.Model(&product).Update("price_amount", types.MustDecimal("120"))
+	raised := time.Now()
+	time.Sleep(time.Second)
+	err := product.AdjustPrice(d, types.MustDecimal("0.5"), types.MustMoney("0", "CNY"))
+	log.Println("调整价格 => 错误信息: ", err, ", 当前价格: ", product.Price)
+
+	// 2 AsOf 查询任意时刻的状态
+	for _, at := range []struct {
+		name string
+		t    time.Time
+	}{{"创建之前", created.Add(-time.Hour)}, {"创建之后", created}, {"第一次调价之后", raised}, {"现在", time.Now()}} {
+		var p db.Product
+		err := d.Scopes(temporal.AsOf(at.t)).Where("code = ?", code).First(&p).Error
+		log.Printf("%s的价格 => %v, 错误信息: %v", at.name, p.Price, err)
+	}
+
+	// 3 删除同样会保存删除之前的版本, 删除之后仍然可以查询删除之前的价格
+	d.Delete(&product)
+	var count int64
+	d.Scopes(temporal.AsOf(time.Now())).Model(&db.Product{}).Where("code = ?", code).Count(&count)
+	log.Println("删除之后 => 数量: ", count)
+	var before db.Product
+	err = d.Scopes(temporal.AsOf(raised)).Where("code = ?", code).First(&before).Error
+	log.Println("删除之后查询调价时的价格 => ", before.Price, ", 错误信息: ", err)
+}
@@ -0,0 +1,75 @@
+// 流式导出已注册的模型, 内存占用与表的大小无关
+//
+//	go run ./cmd/export -model users -format csv -columns id,name,location,credit_card.number -where "age > 18" -o users.csv
+//	go run ./cmd/export -model products -format sql > products.sql
+//
+// 带有 mask 标签的字段默认脱敏, 指定 -unmasked 时输出明文
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gorm-learn/db"
+	"gorm-learn/db/export"
+	"gorm-learn/db/mask"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	model := flag.String("model", "", "导出的模型: "+strings.Join(export.Models(), ", "))
+	format := flag.String("format", "csv", "导出格式: csv, jsonl, sql")
+	columns := flag.String("columns", "", "导出的列, 以逗号分隔, 默认为全部列")
+	where := flag.String("where", "", "过滤条件, 例如 \"age > 18\"")
+	limit := flag.Int("limit", 0, "最多导出的记录数, 0 表示不限制")
+	output := flag.String("o", "", "输出文件, 默认输出到标准输出")
+	unmasked := flag.Bool("unmasked", false, "输出敏感字段的明文")
+	flag.Parse()
+	if *model == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := export.Options{Format: export.Format(*format), Limit: *limit}
+	if *columns != "" {
+		opts.Columns = strings.Split(*columns, ",")
+	}
+	if *where != "" {
+		opts.Where = *where
+	}
+	ctx := context.Background()
+	if *unmasked {
+		ctx = mask.WithUnmasked(ctx)
+	}
+
+	if err := run(ctx, *model, *output, opts); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run 导出到 output 指定的文件或者标准输出, 出错时同样会关闭输出文件
+func run(ctx context.Context, model, output string, opts export.Options) (err error) {
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("创建输出文件失败: %w", err)
+		}
+		defer func() {
+			if closeErr := f.Close(); err == nil && closeErr != nil {
+				err = fmt.Errorf("关闭输出文件失败: %w", closeErr)
+			}
+		}()
+		w = f
+	}
+
+	n, err := export.Export(ctx, db.DB(), w, model, opts)
+	if err != nil {
+		return fmt.Errorf("导出失败, 已导出 %d 条记录: %w", n, err)
+	}
+	log.Printf("导出完成, 共 %d 条记录", n)
+	return nil
+}
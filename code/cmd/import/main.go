@@ -0,0 +1,93 @@
+// 从 CSV / JSON Lines 文件导入用户或商品, 与 cmd/export 导出的文件格式一致
+//
+//	go run ./cmd/import -model users -file users.csv -map "姓名=Name,credit_card.number=-" -rejects rejects.jsonl
+//	go run ./cmd/import -model products -format jsonl -file products.jsonl -conflict code -update price_amount,price_currency
+//	go run ./cmd/import -model users -file users.csv -dry-run
+package main
+
+import (
+	"context"
+	"flag"
+	"gorm-learn/db"
+	"gorm-learn/db/importer"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	model := flag.String("model", "", "导入的模型: users, products")
+	format := flag.String("format", "csv", "文件格式: csv, jsonl")
+	file := flag.String("file", "", "导入的文件, 默认从标准输入读取")
+	mapping := flag.String("map", "", "列名到字段的映射, 例如 \"姓名=Name,备注=-\"")
+	ignoreUnknown := flag.Bool("ignore-unknown", false, "忽略无法匹配到字段的列")
+	batchSize := flag.Int("batch", importer.DefaultBatchSize, "每批写入的记录数")
+	conflict := flag.String("conflict", "", "upsert 的冲突字段, 以逗号分隔, 为空时直接插入")
+	update := flag.String("update", "", "冲突时更新的字段, 以逗号分隔")
+	dryRun := flag.Bool("dry-run", false, "只校验, 将要写入的记录输出到标准输出")
+	rejects := flag.String("rejects", "", "被拒绝的行写入的文件, 默认输出到标准错误")
+	flag.Parse()
+
+	var r io.Reader = os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatal("打开文件失败: ", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var rejectsWriter io.Writer = os.Stderr
+	if *rejects != "" {
+		f, err := os.Create(*rejects)
+		if err != nil {
+			log.Fatal("创建被拒绝行文件失败: ", err)
+		}
+		defer f.Close()
+		rejectsWriter = f
+	}
+
+	db.Migrate(&db.User{}, &db.Product{})
+	var report *importer.Report
+	var err error
+	switch *model {
+	case "users":
+		report, err = importer.Import(context.Background(), r, options[db.User](*format, *mapping, *ignoreUnknown, *batchSize, *conflict, *update, *dryRun, rejectsWriter))
+	case "products":
+		report, err = importer.Import(context.Background(), r, options[db.Product](*format, *mapping, *ignoreUnknown, *batchSize, *conflict, *update, *dryRun, rejectsWriter))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("导入失败: %v, 结果: %+v", err, report)
+	}
+	log.Printf("导入完成: 读取 %d 行, 插入 %d 条, 更新 %d 条, 拒绝 %d 行", report.Read, report.Inserted, report.Updated, report.Rejected)
+}
+
+// options 根据命令行参数生成导入选项
+func options[T any](format, mapping string, ignoreUnknown bool, batchSize int, conflict, update string, dryRun bool, rejects io.Writer) importer.Options[T] {
+	opts := importer.Options[T]{
+		Format:        importer.Format(format),
+		IgnoreUnknown: ignoreUnknown,
+		BatchSize:     batchSize,
+		DryRun:        dryRun,
+		DryRunOutput:  os.Stdout,
+		Rejects:       rejects,
+	}
+	if mapping != "" {
+		opts.Mapping = map[string]string{}
+		for _, pair := range strings.Split(mapping, ",") {
+			column, field, _ := strings.Cut(pair, "=")
+			opts.Mapping[column] = field
+		}
+	}
+	if conflict != "" {
+		opts.Conflict = db.OnConflict(strings.Split(conflict, ",")...)
+		if update != "" {
+			opts.Conflict.Update(strings.Split(update, ",")...)
+		}
+	}
+	return opts
+}
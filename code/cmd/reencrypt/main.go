@@ -0,0 +1,27 @@
+// 使用当前密钥重新加密所有信用卡号, 用于密钥轮换
+//
+//	GORM_LEARN_ENCRYPTION_KEYS="k1:<base64>,k2:<base64>" \
+//	GORM_LEARN_ENCRYPTION_CURRENT=k2 \
+//	GORM_LEARN_BLIND_INDEX_KEY=<base64> \
+//	go run ./cmd/reencrypt -batch 500
+package main
+
+import (
+	"flag"
+	"gorm-learn/db"
+	"log"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 200, "每批处理的记录数")
+	flag.Parse()
+
+	d := db.DB()
+	d.AutoMigrate(&db.CreditCard{})
+
+	rotated, err := db.ReencryptCreditCards(d, *batchSize)
+	if err != nil {
+		log.Fatalf("重新加密失败, 已处理 %d 条记录: %v", rotated, err)
+	}
+	log.Printf("重新加密完成, 共处理 %d 条记录", rotated)
+}
@@ -0,0 +1,43 @@
+// 通过 ctx 传递的操作者与请求 ID
+//
+// 通常在 HTTP 中间件中完成认证之后写入 ctx, 之后的数据库操作通过 db.Conn(ctx) 或者 WithContext 携带 ctx,
+// 由 audit 等插件读取:
+//
+//	ctx = actor.With(ctx, "alice")
+//	ctx = actor.WithRequestID(ctx, r.Header.Get("X-Request-ID"))
+//	db.Conn(ctx).Model(&user).Update("age", 30)
+package actor
+
+import "context"
+
+type actorKey struct{}
+
+type requestIDKey struct{}
+
+// With 返回携带操作者 id 的 ctx
+func With(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, actorKey{}, id)
+}
+
+// From 返回 ctx 中的操作者, 没有时返回空字符串
+func From(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(actorKey{}).(string)
+	return id
+}
+
+// WithRequestID 返回携带请求 ID 的 ctx
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID 返回 ctx 中的请求 ID, 没有时返回空字符串
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
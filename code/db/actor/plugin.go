@@ -0,0 +1,162 @@
+package actor
+
+import (
+	"reflect"
+
+	"gorm-learn/db/internal/callbacks"
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// 由插件填写的字段名, 与 gorm 按字段名识别 CreatedAt、UpdatedAt 的方式相同
+const (
+	CreatedByField = "CreatedBy"
+	UpdatedByField = "UpdatedBy"
+	DeletedByField = "DeletedBy"
+)
+
+// Plugin 根据 ctx 中的操作者填写 CreatedBy、UpdatedBy 与 DeletedBy 字段的 GORM 插件
+//
+//   - 创建时填写 CreatedBy 与 UpdatedBy, 已经有值的记录保持不变
+//   - 更新时填写 UpdatedBy, 与 UpdatedAt 一样会被 Select 自动包含, UpdateColumn 等跳过钩子的更新不会填写
+//   - 软删除时在同一条 UPDATE 语句中填写 DeletedBy, 物理删除不处理; 恢复时 DeletedBy 保持不变, 由 UpdatedBy 记录恢复的操作者
+//
+// ctx 中没有操作者时不做任何处理; map 中已经存在的键保持不变, 使用 map 创建时与 GORM 回填 @id 相同,
+// 直接写入调用方的 map, 使用 map 更新时不会修改调用方的 map
+type Plugin struct{}
+
+// Name 实现 gorm.Plugin 接口
+func (Plugin) Name() string {
+	return "gorm-learn:actor"
+}
+
+// Initialize 实现 gorm.Plugin 接口
+func (Plugin) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().After("gorm:before_create").Before("gorm:create").Register("actor:before_create", beforeCreate); err != nil {
+		return err
+	}
+	if err := callbacks.RegisterBeforeUpdate(db, "actor:before_update", beforeUpdate); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:before_delete").Before("gorm:delete").Register("actor:before_delete", beforeDelete)
+}
+
+// stamped 返回语句的操作者以及模型中名为 name 的字段, 不需要处理时返回 nil
+func stamped(db *gorm.DB, name string) (string, *schema.Field) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil || stmt.SQL.Len() > 0 {
+		return "", nil
+	}
+	id := From(stmt.Context)
+	if id == "" {
+		return "", nil
+	}
+	field := stmt.Schema.LookUpField(name)
+	if field == nil || field.DBName == "" || field.FieldType.Kind() != reflect.String {
+		return "", nil
+	}
+	return id, field
+}
+
+func beforeCreate(db *gorm.DB) {
+	for _, name := range []string{CreatedByField, UpdatedByField} {
+		if id, field := stamped(db, name); field != nil {
+			stampCreate(db.Statement, field, id)
+		}
+	}
+}
+
+// stampCreate 为每条创建的记录填写操作者, 已经有值的记录保持不变
+func stampCreate(stmt *gorm.Statement, field *schema.Field, id string) {
+	switch dest := stmt.Dest.(type) {
+	case map[string]interface{}:
+		setDefault(dest, field, id)
+	case *map[string]interface{}:
+		setDefault(*dest, field, id)
+	case []map[string]interface{}:
+		for _, m := range dest {
+			setDefault(m, field, id)
+		}
+	case *[]map[string]interface{}:
+		for _, m := range *dest {
+			setDefault(m, field, id)
+		}
+	default:
+		set := func(rv reflect.Value) {
+			if _, zero := field.ValueOf(stmt.Context, rv); zero {
+				stmt.AddError(field.Set(stmt.Context, rv, id))
+			}
+		}
+		switch rv := reflect.Indirect(stmt.ReflectValue); rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				if elem := reflect.Indirect(rv.Index(i)); elem.Kind() == reflect.Struct {
+					set(elem)
+				}
+			}
+		case reflect.Struct:
+			set(rv)
+		}
+	}
+}
+
+func beforeUpdate(db *gorm.DB) {
+	id, field := stamped(db, UpdatedByField)
+	stmt := db.Statement
+	if field == nil || stmt.SkipHooks {
+		return
+	}
+	if _, ok := stmt.Clauses["SET"]; ok {
+		return
+	}
+	// 与 UpdatedAt 相同, 只指定了部分字段时同样更新 UpdatedBy, 除非显式 Omit
+	if len(stmt.Selects) > 0 && !callbacks.Contains(stmt.Selects, "*") && !callbacks.Contains(stmt.Selects, field.Name) && !callbacks.Contains(stmt.Selects, field.DBName) {
+		if callbacks.Contains(stmt.Omits, field.Name) || callbacks.Contains(stmt.Omits, field.DBName) {
+			return
+		}
+		stmt.Selects = append(stmt.Selects, field.DBName)
+	}
+	if dest, ok := stmt.Dest.(map[string]interface{}); ok {
+		if !hasKey(dest, field) {
+			stmt.Dest = callbacks.WithValue(dest, field.DBName, id)
+		}
+		return
+	}
+	stmt.SetColumn(field.DBName, id, true)
+}
+
+// beforeDelete 软删除时把 DeletedBy 追加到软删除生成的 SET 子句之后
+//
+// 软删除字段的 DeleteClauses 会用自己的 SET 子句替换已有的 SET 子句, 因此这里把赋值放在
+// 子句的 AfterExpression 中, 替换时会保留下来; 物理删除不会生成 SET 子句
+func beforeDelete(db *gorm.DB) {
+	id, field := stamped(db, DeletedByField)
+	stmt := db.Statement
+	if field == nil || stmt.Unscoped || softdelete.Field(stmt.Schema) == nil {
+		return
+	}
+	c := stmt.Clauses["SET"]
+	c.Name = "SET"
+	c.AfterExpression = clause.Expr{SQL: ", ? = ?", Vars: []interface{}{clause.Column{Name: field.DBName}, id}}
+	stmt.Clauses["SET"] = c
+	if stmt.ReflectValue.CanAddr() {
+		stmt.SetColumn(field.DBName, id, true)
+	}
+}
+
+// setDefault 在 m 中没有 field 对应的键时设置为 value
+func setDefault(m map[string]interface{}, field *schema.Field, value interface{}) {
+	if m != nil && !hasKey(m, field) {
+		m[field.DBName] = value
+	}
+}
+
+// hasKey 判断 m 中是否有 field 对应的键
+func hasKey(m map[string]interface{}, field *schema.Field) bool {
+	_, byName := m[field.Name]
+	_, byDBName := m[field.DBName]
+	return byName || byDBName
+}
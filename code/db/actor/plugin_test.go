@@ -0,0 +1,191 @@
+package actor
+
+import (
+	"context"
+	"testing"
+
+	"gorm-learn/db/internal/dbtest"
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/gorm"
+)
+
+// actorItem 测试使用的模型, 包含插件填写的三个字段
+type actorItem struct {
+	ID        uint
+	Name      string
+	CreatedBy string
+	UpdatedBy string
+	DeletedBy string
+	DeletedAt softdelete.Unix
+}
+
+func (actorItem) TableName() string {
+	return "actor_test_items"
+}
+
+// setup 清空测试表, 返回绑定了操作者 alice 的连接
+func setup(t *testing.T) (*gorm.DB, *gorm.DB) {
+	t.Helper()
+	d := dbtest.Open(t, Plugin{})
+	dbtest.Migrate(t, d, &actorItem{})
+	if err := d.Exec("DELETE FROM actor_test_items").Error; err != nil {
+		t.Fatal(err)
+	}
+	return d, d.WithContext(With(context.Background(), "alice"))
+}
+
+// load 按名称读取记录, 包括已删除的记录
+func load(t *testing.T, d *gorm.DB, name string) actorItem {
+	t.Helper()
+	var item actorItem
+	if err := d.Unscoped().Where("name = ?", name).First(&item).Error; err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return item
+}
+
+// stamps 返回记录的 CreatedBy、UpdatedBy 与 DeletedBy
+func stamps(item actorItem) [3]string {
+	return [3]string{item.CreatedBy, item.UpdatedBy, item.DeletedBy}
+}
+
+func TestCreate(t *testing.T) {
+	d, alice := setup(t)
+
+	item := actorItem{Name: "struct"}
+	if err := alice.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := stamps(item); got != [3]string{"alice", "alice", ""} {
+		t.Errorf("模型中的操作者为 %q", got)
+	}
+	if got := stamps(load(t, d, "struct")); got != [3]string{"alice", "alice", ""} {
+		t.Errorf("数据库中的操作者为 %q", got)
+	}
+
+	// 已经有值的字段保持不变
+	imported := actorItem{Name: "imported", CreatedBy: "bob"}
+	if err := alice.Create(&imported).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := stamps(load(t, d, "imported")); got != [3]string{"bob", "alice", ""} {
+		t.Errorf("已有的 CreatedBy 被覆盖: %q", got)
+	}
+
+	// ctx 中没有操作者时不填写
+	if err := d.Create(&actorItem{Name: "anonymous"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := stamps(load(t, d, "anonymous")); got != [3]string{} {
+		t.Errorf("没有操作者时填写了 %q", got)
+	}
+}
+
+func TestCreateInBatches(t *testing.T) {
+	d, alice := setup(t)
+	items := []actorItem{{Name: "batch-1"}, {Name: "batch-2"}, {Name: "batch-3"}}
+	if err := alice.CreateInBatches(&items, 2).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if got := stamps(load(t, d, item.Name)); got != [3]string{"alice", "alice", ""} {
+			t.Errorf("%s: 数据库中的操作者为 %q", item.Name, got)
+		}
+	}
+}
+
+func TestCreateMap(t *testing.T) {
+	d, alice := setup(t)
+
+	values := map[string]interface{}{"name": "map"}
+	if err := alice.Model(&actorItem{}).Create(values).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := stamps(load(t, d, "map")); got != [3]string{"alice", "alice", ""} {
+		t.Errorf("数据库中的操作者为 %q", got)
+	}
+
+	rows := []map[string]interface{}{{"name": "maps-1"}, {"name": "maps-2", "created_by": "bob"}}
+	if err := alice.Model(&actorItem{}).Create(rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := stamps(load(t, d, "maps-1")); got != [3]string{"alice", "alice", ""} {
+		t.Errorf("maps-1: 数据库中的操作者为 %q", got)
+	}
+	if got := stamps(load(t, d, "maps-2")); got != [3]string{"bob", "alice", ""} {
+		t.Errorf("maps-2: 已有的 created_by 被覆盖: %q", got)
+	}
+}
+
+func TestUpdates(t *testing.T) {
+	d, alice := setup(t)
+	item := actorItem{Name: "update"}
+	if err := alice.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	carol := d.WithContext(With(context.Background(), "carol"))
+
+	if err := carol.Model(&item).Updates(actorItem{Name: "struct-updated"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := stamps(load(t, d, "struct-updated")); got != [3]string{"alice", "carol", ""} {
+		t.Errorf("使用结构体更新之后操作者为 %q", got)
+	}
+
+	// 使用 map 更新时不修改调用方的 map
+	values := map[string]interface{}{"name": "map-updated"}
+	if err := carol.Model(&item).Updates(values).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 {
+		t.Errorf("调用方的 map 被修改为 %v", values)
+	}
+	if got := stamps(load(t, d, "map-updated")); got != [3]string{"alice", "carol", ""} {
+		t.Errorf("使用 map 更新之后操作者为 %q", got)
+	}
+
+	// 只指定了部分字段时同样更新 UpdatedBy
+	dave := d.WithContext(With(context.Background(), "dave"))
+	if err := dave.Model(&item).Select("name").Updates(map[string]interface{}{"name": "selected"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := stamps(load(t, d, "selected")); got != [3]string{"alice", "dave", ""} {
+		t.Errorf("Select 更新之后操作者为 %q", got)
+	}
+
+	// UpdateColumn 跳过钩子, 不更新 UpdatedBy
+	if err := carol.Model(&item).UpdateColumn("name", "column").Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := stamps(load(t, d, "column")); got != [3]string{"alice", "dave", ""} {
+		t.Errorf("UpdateColumn 之后操作者为 %q", got)
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	d, alice := setup(t)
+	item := actorItem{Name: "delete"}
+	if err := alice.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	erin := d.WithContext(With(context.Background(), "erin"))
+	if err := erin.Delete(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if item.DeletedBy != "erin" {
+		t.Errorf("模型中的 DeletedBy 为 %q", item.DeletedBy)
+	}
+	if got := stamps(load(t, d, "delete")); got != [3]string{"alice", "alice", "erin"} {
+		t.Errorf("软删除之后操作者为 %q", got)
+	}
+
+	// 恢复时 DeletedBy 保持不变, 由 UpdatedBy 记录恢复的操作者
+	if err := softdelete.Restore(d.WithContext(With(context.Background(), "frank")), &actorItem{ID: item.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := stamps(load(t, d, "delete")); got != [3]string{"alice", "frank", "erin"} {
+		t.Errorf("恢复之后操作者为 %q", got)
+	}
+}
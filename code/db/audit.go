@@ -0,0 +1,11 @@
+package db
+
+import "gorm-learn/db/audit"
+
+// auditModels 记录审计日志的模型, 变更前后的值写入 audit_logs 表, 通过 audit.History 查询
+var auditModels = []interface{}{&User{}, &CreditCard{}, &Product{}}
+
+// History 返回 value 对应记录的审计日志, 按发生的先后排列, value 为设置了主键的模型
+func History(value interface{}) ([]audit.Log, error) {
+	return audit.History(DB(), value)
+}
@@ -0,0 +1,107 @@
+// 记录每一次变更前后取值的审计日志
+//
+// 插件在创建、更新与删除时把变更的列以及变更前后的值写入 audit_logs 表, 日志与变更在同一个事务中写入,
+// 操作者与请求 ID 从语句的 ctx 中读取, 参考 actor 包:
+//
+//	d.Use(audit.Plugin{Models: []interface{}{&User{}}})
+//
+//	ctx := actor.With(context.Background(), "alice")
+//	d.WithContext(ctx).Model(&user).Update("age", gorm.Expr("age + ?", 8))
+//
+//	logs, err := audit.History(d, &user) // [{Operation: update, Changes: [{age 22 30}], Actor: alice}]
+//
+// 更新与删除之前使用 SELECT ... FOR UPDATE 读取受影响的记录, 执行之后再次读取, 因此 gorm.Expr 等
+// 由数据库计算的新值也能被记录; 按条件批量修改时每条记录各生成一条日志.
+// 代价是每一条被审计的更新都会额外执行两条语句: 之前的 SELECT ... FOR UPDATE 以及之后按主键的 SELECT,
+// 删除同样先执行 SELECT ... FOR UPDATE, 软删除之后还会再读取一次; 写入频繁的表需要考虑这部分开销.
+// 带有 mask 标签的字段记录脱敏之后的值, 声明了 audit:"-" 标签的字段不会被记录
+package audit
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm-learn/db/types"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// TagName 声明字段不记录审计日志的标签, 值为 "-"
+const TagName = "audit"
+
+// Operation 变更的类型
+type Operation string
+
+const (
+	// Create 创建了记录
+	Create Operation = "create"
+	// Update 更新了记录
+	Update Operation = "update"
+	// SoftDelete 软删除了记录
+	SoftDelete Operation = "soft_delete"
+	// Restore 恢复了软删除的记录
+	Restore Operation = "restore"
+	// Delete 物理删除了记录, Changes 为删除之前的全部非零值
+	Delete Operation = "delete"
+)
+
+// Change 一列的变更
+type Change struct {
+	Column string      `json:"column"`
+	Old    interface{} `json:"old"`
+	New    interface{} `json:"new"`
+}
+
+// Log audit_logs 表中的一条日志
+type Log struct {
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// Table 记录所在的表
+	Table string `gorm:"column:table_name;type:varchar(64);not null;index:idx_audit_logs_record,priority:1" json:"table"`
+	// PrimaryKey 记录的主键, 联合主键以逗号分隔
+	PrimaryKey string               `gorm:"type:varchar(64);not null;index:idx_audit_logs_record,priority:2" json:"primary_key"`
+	Operation  Operation            `gorm:"type:varchar(16);not null" json:"operation"`
+	Changes    types.JSON[[]Change] `json:"changes"`
+	Actor      string               `gorm:"type:varchar(64);index" json:"actor,omitempty"`
+	RequestID  string               `gorm:"type:varchar(64);index" json:"request_id,omitempty"`
+	CreatedAt  time.Time            `gorm:"index:idx_audit_logs_record,priority:3" json:"created_at"`
+}
+
+// TableName 实现 schema.Tabler 接口
+func (Log) TableName() string {
+	return "audit_logs"
+}
+
+// History 返回 value 对应记录的审计日志, 按发生的先后排列, value 为设置了主键的模型
+func History(db *gorm.DB, value interface{}) ([]Log, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(value); err != nil {
+		return nil, err
+	}
+	key, ok := primaryKey(db.Statement.Context, stmt.Schema, reflect.Indirect(reflect.ValueOf(value)))
+	if !ok {
+		return nil, fmt.Errorf("audit: %s 没有设置主键", stmt.Schema.Name)
+	}
+	var logs []Log
+	err := db.Where(&Log{Table: stmt.Table, PrimaryKey: key}).Order("id").Find(&logs).Error
+	return logs, err
+}
+
+// primaryKey 返回记录的主键, 联合主键以逗号分隔, 主键为零值时返回 false
+func primaryKey(ctx context.Context, sch *schema.Schema, rv reflect.Value) (string, bool) {
+	if len(sch.PrimaryFields) == 0 {
+		return "", false
+	}
+	parts := make([]string, 0, len(sch.PrimaryFields))
+	for _, field := range sch.PrimaryFields {
+		v, zero := field.ValueOf(ctx, rv)
+		if zero {
+			return "", false
+		}
+		parts = append(parts, fmt.Sprint(v))
+	}
+	return strings.Join(parts, ","), true
+}
@@ -0,0 +1,194 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm-learn/db/actor"
+	"gorm-learn/db/internal/dbtest"
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/gorm"
+)
+
+// testItem 测试使用的模型, Secret 声明了不记录审计日志
+type testItem struct {
+	ID        uint
+	Name      string
+	Age       int
+	Secret    string `audit:"-"`
+	UpdatedAt time.Time
+	DeletedAt softdelete.Unix
+}
+
+func (testItem) TableName() string {
+	return "audit_test_items"
+}
+
+// setup 清空测试表以及它的审计日志, 返回绑定了操作者 alice 与请求 ID 的连接
+func setup(t *testing.T) (*gorm.DB, *gorm.DB) {
+	t.Helper()
+	d := dbtest.Open(t, Plugin{Models: []interface{}{&testItem{}}})
+	dbtest.Migrate(t, d, &testItem{}, &Log{})
+	if err := d.Exec("DELETE FROM audit_test_items").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Where("table_name = ?", "audit_test_items").Delete(&Log{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := actor.WithRequestID(actor.With(context.Background(), "alice"), "req-1")
+	return d, d.WithContext(ctx)
+}
+
+// create 创建一条记录
+func create(t *testing.T, d *gorm.DB, name string, age int) *testItem {
+	t.Helper()
+	item := &testItem{Name: name, Age: age, Secret: "s"}
+	if err := d.Create(item).Error; err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+// history 读取记录的审计日志
+func history(t *testing.T, d *gorm.DB, id uint) []Log {
+	t.Helper()
+	logs, err := History(d, &testItem{ID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logs
+}
+
+// changes 把一条日志中的变更转换为 列名 -> "旧值 -> 新值", 便于比较
+func changes(log Log) map[string]string {
+	m := make(map[string]string, len(log.Changes.Data))
+	for _, c := range log.Changes.Data {
+		m[c.Column] = fmt.Sprintf("%v -> %v", c.Old, c.New)
+	}
+	return m
+}
+
+func TestCreate(t *testing.T) {
+	d, alice := setup(t)
+	item := create(t, alice, "create", 18)
+
+	logs := history(t, d, item.ID)
+	if len(logs) != 1 {
+		t.Fatalf("创建之后有 %d 条日志", len(logs))
+	}
+	log := logs[0]
+	if log.Operation != Create || log.Actor != "alice" || log.RequestID != "req-1" || log.PrimaryKey != fmt.Sprint(item.ID) {
+		t.Errorf("日志为 %+v", log)
+	}
+	got := changes(log)
+	if got["name"] != "<nil> -> create" || got["age"] != "<nil> -> 18" {
+		t.Errorf("创建的变更为 %v", got)
+	}
+	if _, ok := got["secret"]; ok {
+		t.Error("声明了 audit:\"-\" 的字段不应该被记录")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	d, alice := setup(t)
+	item := create(t, alice, "update", 18)
+
+	item.Age = 20
+	if err := alice.Save(item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.Model(item).Updates(testItem{Name: "updated", Secret: "t"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 由数据库计算的新值同样会被记录
+	if err := alice.Model(item).Update("age", gorm.Expr("age + ?", 8)).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 没有实际变更的更新不生成日志
+	if err := alice.Model(item).Update("age", 28).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	logs := history(t, d, item.ID)
+	if len(logs) != 4 {
+		t.Fatalf("有 %d 条日志, 应该为 4 条", len(logs))
+	}
+	want := []map[string]string{
+		{"age": "18 -> 20"},
+		{"name": "update -> updated"},
+		{"age": "20 -> 28"},
+	}
+	for i, w := range want {
+		log := logs[i+1]
+		if got := changes(log); log.Operation != Update || fmt.Sprint(got) != fmt.Sprint(w) {
+			t.Errorf("第 %d 次更新: %s %v, 应该为 %v", i+1, log.Operation, got, w)
+		}
+	}
+}
+
+func TestUpdateByCondition(t *testing.T) {
+	d, alice := setup(t)
+	a := create(t, alice, "batch", 1)
+	b := create(t, alice, "batch", 2)
+
+	// 按条件批量修改时每条记录各生成一条日志
+	if err := alice.Model(&testItem{}).Where("name = ?", "batch").Update("age", 10).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []*testItem{a, b} {
+		logs := history(t, d, item.ID)
+		if len(logs) != 2 || logs[1].Operation != Update {
+			t.Fatalf("记录 %d 有 %d 条日志", item.ID, len(logs))
+		}
+		if got := changes(logs[1])["age"]; got != fmt.Sprintf("%d -> 10", item.Age) {
+			t.Errorf("记录 %d 的变更为 %s", item.ID, got)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	d, alice := setup(t)
+	item := create(t, alice, "delete", 18)
+
+	if err := alice.Delete(item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := softdelete.Restore(alice, &testItem{ID: item.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.Unscoped().Delete(&testItem{ID: item.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	logs := history(t, d, item.ID)
+	ops := make([]Operation, 0, len(logs))
+	for _, log := range logs {
+		ops = append(ops, log.Operation)
+	}
+	if fmt.Sprint(ops) != fmt.Sprint([]Operation{Create, SoftDelete, Restore, Delete}) {
+		t.Fatalf("日志的操作为 %v", ops)
+	}
+	if _, ok := changes(logs[1])["deleted_at"]; !ok {
+		t.Errorf("软删除的变更为 %v", changes(logs[1]))
+	}
+	// 物理删除记录删除之前的全部非零值
+	if got := changes(logs[3]); got["name"] != "delete -> <nil>" || got["age"] != "18 -> <nil>" {
+		t.Errorf("物理删除的变更为 %v", got)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	d, _ := setup(t)
+	if _, err := History(d, &testItem{}); err == nil {
+		t.Error("没有设置主键时应该返回错误")
+	}
+	// 其他记录的日志不会被返回
+	a := create(t, d, "a", 1)
+	create(t, d, "b", 2)
+	if logs := history(t, d, a.ID); len(logs) != 1 || logs[0].Actor != "" {
+		t.Errorf("History 返回 %+v", logs)
+	}
+}
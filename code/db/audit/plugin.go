@@ -0,0 +1,366 @@
+package audit
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm-learn/db/actor"
+	"gorm-learn/db/internal/callbacks"
+	"gorm-learn/db/mask"
+	"gorm-learn/db/softdelete"
+	"gorm-learn/db/types"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Plugin 审计日志插件, 需要在 GORM 默认的事务中执行才能保证日志与变更同时生效
+type Plugin struct {
+	// Models 记录审计日志的模型
+	Models []interface{}
+}
+
+// Name 实现 gorm.Plugin 接口
+func (Plugin) Name() string {
+	return "gorm-learn:audit"
+}
+
+// Initialize 实现 gorm.Plugin 接口
+func (p Plugin) Initialize(db *gorm.DB) error {
+	a := &auditor{models: map[reflect.Type]bool{}}
+	for _, model := range p.Models {
+		t := reflect.TypeOf(model)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		a.models[t] = true
+	}
+
+	create := db.Callback().Create()
+	if err := create.After("gorm:after_create").Before("gorm:commit_or_rollback_transaction").Register("audit:after_create", a.afterCreate); err != nil {
+		return err
+	}
+	update := db.Callback().Update()
+	if err := update.After("gorm:before_update").Before("gorm:update").Register("audit:before_update", a.before); err != nil {
+		return err
+	}
+	if err := update.After("gorm:after_update").Before("gorm:commit_or_rollback_transaction").Register("audit:after_update", a.afterUpdate); err != nil {
+		return err
+	}
+	del := db.Callback().Delete()
+	if err := del.After("gorm:before_delete").Before("gorm:delete").Register("audit:before_delete", a.before); err != nil {
+		return err
+	}
+	return del.After("gorm:after_delete").Before("gorm:commit_or_rollback_transaction").Register("audit:after_delete", a.afterDelete)
+}
+
+// beforeKey 保存变更之前的记录
+const beforeKey = "audit:before"
+
+// snapshot 变更之前读取的记录
+type snapshot struct {
+	// rows 类型为模型的切片
+	rows reflect.Value
+	keys []string
+}
+
+// auditor 生成并写入审计日志
+type auditor struct {
+	models map[reflect.Type]bool
+}
+
+// enabled 判断语句是否需要记录审计日志, DryRun 以及原生 SQL 不会记录
+func (a *auditor) enabled(db *gorm.DB) bool {
+	stmt := db.Statement
+	return db.Error == nil && !db.DryRun && stmt.Schema != nil && a.models[stmt.Schema.ModelType] && stmt.SQL.Len() == 0
+}
+
+func (a *auditor) afterCreate(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || db.Statement.Schema == nil || !a.models[db.Statement.Schema.ModelType] || db.RowsAffected == 0 {
+		return
+	}
+	stmt := db.Statement
+	var logs []Log
+	add := func(key string, changes []Change) {
+		if key != "" && len(changes) > 0 {
+			logs = append(logs, a.newLog(db, key, Create, changes))
+		}
+	}
+	switch dest := stmt.Dest.(type) {
+	case map[string]interface{}:
+		add(mapChanges(stmt, dest))
+	case *map[string]interface{}:
+		add(mapChanges(stmt, *dest))
+	case []map[string]interface{}:
+		for _, m := range dest {
+			add(mapChanges(stmt, m))
+		}
+	case *[]map[string]interface{}:
+		for _, m := range *dest {
+			add(mapChanges(stmt, m))
+		}
+	default:
+		each(stmt, stmt.ReflectValue, func(rv reflect.Value) {
+			key, _ := primaryKey(stmt.Context, stmt.Schema, rv)
+			add(key, diff(stmt, reflect.Value{}, rv, true))
+		})
+	}
+	a.write(db, logs)
+}
+
+// before 在更新与删除之前读取受影响的记录并加锁, 每条语句额外执行一次 SELECT ... FOR UPDATE
+func (a *auditor) before(db *gorm.DB) {
+	if !a.enabled(db) {
+		return
+	}
+	stmt := db.Statement
+	conds := callbacks.Conditions(stmt)
+	if len(conds) == 0 && !db.AllowGlobalUpdate {
+		return
+	}
+	query := db.Session(&gorm.Session{NewDB: true}).Model(reflect.New(stmt.Schema.ModelType).Interface())
+	if stmt.Unscoped {
+		query = query.Unscoped()
+	}
+	if len(conds) > 0 {
+		query = query.Where(clause.And(conds...))
+	}
+	rows := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+	if db.AddError(query.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).Find(rows.Interface()).Error) != nil {
+		return
+	}
+	s := &snapshot{rows: rows.Elem()}
+	for i := 0; i < s.rows.Len(); i++ {
+		key, _ := primaryKey(stmt.Context, stmt.Schema, s.rows.Index(i))
+		s.keys = append(s.keys, key)
+	}
+	if len(s.keys) > 0 {
+		db.InstanceSet(beforeKey, s)
+	}
+}
+
+func (a *auditor) afterUpdate(db *gorm.DB) {
+	s, ok := a.snapshot(db)
+	if !ok {
+		return
+	}
+	after, ok := a.reload(db, s)
+	if !ok {
+		return
+	}
+	stmt := db.Statement
+	field := softdelete.Field(stmt.Schema)
+	var logs []Log
+	for i, key := range s.keys {
+		row, found := after[key]
+		if !found {
+			continue
+		}
+		old := s.rows.Index(i)
+		if changes := diff(stmt, old, row, false); len(changes) > 0 {
+			op := Update
+			if field != nil && deleted(stmt, field, old) && !deleted(stmt, field, row) {
+				op = Restore
+			}
+			logs = append(logs, a.newLog(db, key, op, changes))
+		}
+	}
+	a.write(db, logs)
+}
+
+func (a *auditor) afterDelete(db *gorm.DB) {
+	s, ok := a.snapshot(db)
+	if !ok {
+		return
+	}
+	stmt := db.Statement
+	var logs []Log
+	// 软删除由 DELETE 回调生成 UPDATE 语句
+	if strings.HasPrefix(strings.TrimSpace(stmt.SQL.String()), "UPDATE") {
+		after, ok := a.reload(db, s)
+		if !ok {
+			return
+		}
+		for i, key := range s.keys {
+			if row, found := after[key]; found {
+				if changes := diff(stmt, s.rows.Index(i), row, false); len(changes) > 0 {
+					logs = append(logs, a.newLog(db, key, SoftDelete, changes))
+				}
+			}
+		}
+	} else {
+		for i, key := range s.keys {
+			logs = append(logs, a.newLog(db, key, Delete, diff(stmt, s.rows.Index(i), reflect.Value{}, true)))
+		}
+	}
+	a.write(db, logs)
+}
+
+// snapshot 返回 before 读取的记录, 语句失败或者没有影响任何行时返回 false
+func (a *auditor) snapshot(db *gorm.DB) (*snapshot, bool) {
+	v, ok := db.InstanceGet(beforeKey)
+	if !ok || db.Error != nil || db.RowsAffected == 0 {
+		return nil, false
+	}
+	return v.(*snapshot), true
+}
+
+// reload 按主键重新读取变更之前的记录, 返回主键到记录的映射; 更新与软删除之后额外执行一次 SELECT
+func (a *auditor) reload(db *gorm.DB, s *snapshot) (map[string]reflect.Value, bool) {
+	stmt := db.Statement
+	_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, s.rows, stmt.Schema.PrimaryFields)
+	column, values := schema.ToQueryValues(clause.CurrentTable, stmt.Schema.PrimaryFieldDBNames, queryValues)
+	rows := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+	query := db.Session(&gorm.Session{NewDB: true}).Unscoped().Where(clause.IN{Column: column, Values: values})
+	if db.AddError(query.Find(rows.Interface()).Error) != nil {
+		return nil, false
+	}
+	after := make(map[string]reflect.Value, rows.Elem().Len())
+	for i := 0; i < rows.Elem().Len(); i++ {
+		row := rows.Elem().Index(i)
+		if key, ok := primaryKey(stmt.Context, stmt.Schema, row); ok {
+			after[key] = row
+		}
+	}
+	return after, true
+}
+
+func (a *auditor) newLog(db *gorm.DB, key string, op Operation, changes []Change) Log {
+	ctx := db.Statement.Context
+	return Log{
+		Table:      db.Statement.Table,
+		PrimaryKey: key,
+		Operation:  op,
+		Changes:    types.NewJSON(changes),
+		Actor:      actor.From(ctx),
+		RequestID:  actor.RequestID(ctx),
+	}
+}
+
+// write 在语句所在的事务中写入日志, 失败时事务回滚
+func (a *auditor) write(db *gorm.DB, logs []Log) {
+	if len(logs) == 0 {
+		return
+	}
+	db.AddError(db.Session(&gorm.Session{NewDB: true}).Create(&logs).Error)
+}
+
+// each 对语句中的每条记录执行 fn
+func each(stmt *gorm.Statement, rv reflect.Value, fn func(rv reflect.Value)) {
+	rv = reflect.Indirect(rv)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			each(stmt, rv.Index(i), fn)
+		}
+	case reflect.Struct:
+		if rv.Type() == stmt.Schema.ModelType {
+			fn(rv)
+		}
+	}
+}
+
+// diff 比较记录变更前后的值, old 或者 new 无效时表示记录不存在, 只返回另一边的非零值;
+// all 为 false 时不包含自动更新的时间字段
+func diff(stmt *gorm.Statement, old, new reflect.Value, all bool) []Change {
+	var changes []Change
+	for _, field := range stmt.Schema.Fields {
+		if !audited(field) || (!all && field.AutoUpdateTime > 0) {
+			continue
+		}
+		var before, after interface{}
+		if old.IsValid() {
+			before = valueOf(stmt, field, old)
+		} else if field.ReflectValueOf(stmt.Context, new).IsZero() {
+			continue
+		}
+		if new.IsValid() {
+			after = valueOf(stmt, field, new)
+		} else if field.ReflectValueOf(stmt.Context, old).IsZero() {
+			continue
+		}
+		if !reflect.DeepEqual(before, after) {
+			changes = append(changes, Change{Column: field.DBName, Old: before, New: after})
+		}
+	}
+	return changes
+}
+
+// mapChanges 返回以 map 创建的记录的主键与写入的值, 主键只有在 map 中存在时才能确定
+func mapChanges(stmt *gorm.Statement, m map[string]interface{}) (string, []Change) {
+	var key string
+	if pk := stmt.Schema.PrioritizedPrimaryField; pk != nil {
+		for _, name := range []string{pk.DBName, pk.Name} {
+			if v, ok := m[name]; ok && v != nil {
+				key = toString(v)
+			}
+		}
+	}
+	changes := make([]Change, 0, len(m))
+	for name, v := range m {
+		field := stmt.Schema.LookUpField(name)
+		if field == nil || !audited(field) {
+			continue
+		}
+		changes = append(changes, Change{Column: field.DBName, New: maskValue(field, normalize(v))})
+	}
+	return key, changes
+}
+
+// audited 判断字段是否需要记录
+func audited(field *schema.Field) bool {
+	return field.DBName != "" && field.Readable && field.Tag.Get(TagName) != "-"
+}
+
+// valueOf 返回字段在日志中记录的值: 实现了 driver.Valuer 的类型使用数据库中的取值,
+// 使用序列化器的字段 (例如加密字段) 使用解码之后的值, 带有 mask 标签的字段使用脱敏之后的值
+func valueOf(stmt *gorm.Statement, field *schema.Field, rv reflect.Value) interface{} {
+	v := field.ReflectValueOf(stmt.Context, rv).Interface()
+	if field.Serializer == nil {
+		v = normalize(v)
+	}
+	return maskValue(field, v)
+}
+
+// normalize 把值转换为数据库中的取值, nil 指针为 nil
+func normalize(v interface{}) interface{} {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		if _, ok := v.(driver.Valuer); !ok {
+			v = rv.Elem().Interface()
+		}
+	}
+	if valuer, ok := v.(driver.Valuer); ok {
+		if dv, err := valuer.Value(); err == nil {
+			return dv
+		}
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// maskValue 对带有 mask 标签的字符串字段脱敏
+func maskValue(field *schema.Field, v interface{}) interface{} {
+	strategy, ok := field.Tag.Lookup(mask.TagName)
+	if s, isString := v.(string); ok && isString {
+		return mask.Value(strategy, s)
+	}
+	return v
+}
+
+// deleted 判断记录是否已经被软删除
+func deleted(stmt *gorm.Statement, field *schema.Field, rv reflect.Value) bool {
+	return !field.ReflectValueOf(stmt.Context, rv).IsZero()
+}
+
+// toString 把主键的值转换为字符串
+func toString(v interface{}) string {
+	return fmt.Sprint(normalize(v))
+}
@@ -0,0 +1,197 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm-learn/db/internal/dbtest"
+
+	"gorm.io/gorm"
+)
+
+// benchUser 基准测试使用的模型, 与 db.User 一样带有自动维护的时间字段
+type benchUser struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string `gorm:"type:varchar(64)"`
+	Age       int
+}
+
+func (benchUser) TableName() string {
+	return "bulk_bench_users"
+}
+
+// setup 连接测试数据库并清空 bulk_bench_users 表
+func setup(tb testing.TB) *gorm.DB {
+	tb.Helper()
+	d := dbtest.Open(tb)
+	dbtest.Migrate(tb, d, &benchUser{})
+	if err := d.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&benchUser{}).Error; err != nil {
+		tb.Fatal(err)
+	}
+	return d
+}
+
+func generate(n int) []benchUser {
+	users := make([]benchUser, n)
+	for i := range users {
+		users[i] = benchUser{Name: fmt.Sprintf("bench-%d", i), Age: 18 + i%50}
+	}
+	return users
+}
+
+// localInfile 判断服务端是否开启了 LOAD DATA LOCAL 需要的 local_infile
+func localInfile(d *gorm.DB) bool {
+	var enabled bool
+	return d.Raw("SELECT @@GLOBAL.local_infile").Scan(&enabled).Error == nil && enabled
+}
+
+// requireLocalInfile 服务端没有开启 local_infile 时跳过测试
+func requireLocalInfile(tb testing.TB, d *gorm.DB) {
+	tb.Helper()
+	if !localInfile(d) {
+		tb.Skip("服务端没有开启 local_infile")
+	}
+}
+
+// count 返回 bulk_bench_users 表中的记录数
+func count(tb testing.TB, d *gorm.DB) int64 {
+	tb.Helper()
+	var n int64
+	if err := d.Model(&benchUser{}).Count(&n).Error; err != nil {
+		tb.Fatal(err)
+	}
+	return n
+}
+
+// 以下基准测试的每次操作都是导入一条记录, ns/op 可以直接比较
+
+// BenchmarkCreate 每条记录执行一次 Create, 即一条单行 INSERT
+func BenchmarkCreate(b *testing.B) {
+	d := setup(b)
+	users := generate(b.N)
+	b.ResetTimer()
+	for i := range users {
+		if err := d.Create(&users[i]).Error; err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCreateInBatches 使用 CreateInBatches 执行多行 INSERT
+func BenchmarkCreateInBatches(b *testing.B) {
+	d := setup(b)
+	users := generate(b.N)
+	b.ResetTimer()
+	if err := d.CreateInBatches(&users, DefaultBatchSize).Error; err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkLoad 使用 Load 并行导入, MySQL 服务端需要开启 local_infile
+func BenchmarkLoad(b *testing.B) {
+	d := setup(b)
+	requireLocalInfile(b, d)
+	users := generate(b.N)
+	b.ResetTimer()
+	report, err := Load(context.Background(), d, users, Config{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.StopTimer()
+	if report.Rows != int64(b.N) {
+		b.Fatalf("导入了 %d 条记录, 应该为 %d", report.Rows, b.N)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	d := setup(t)
+	methods := []Method{MultiRow}
+	if localInfile(d) {
+		methods = append(methods, Auto)
+	}
+	for _, method := range methods {
+		if err := d.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&benchUser{}).Error; err != nil {
+			t.Fatal(err)
+		}
+		report, err := Load(context.Background(), d, generate(2500), Config{BatchSize: 1000, Workers: 2, Method: method})
+		if err != nil {
+			t.Fatalf("%q: %v", method, err)
+		}
+		if report.Rows != 2500 || report.Batches != 3 {
+			t.Errorf("%q: Rows = %d, Batches = %d", method, report.Rows, report.Batches)
+		}
+		if n := count(t, d); n != 2500 {
+			t.Errorf("%q: 表中有 %d 条记录", method, n)
+		}
+	}
+}
+
+func TestLoadInTransaction(t *testing.T) {
+	d := setup(t)
+	errRollback := errors.New("rollback")
+	err := d.Transaction(func(tx *gorm.DB) error {
+		// 事务中只使用一个 worker, 批次依次在同一个连接上执行
+		report, err := Load(context.Background(), tx, generate(2500), Config{BatchSize: 1000, Workers: 4, Method: MultiRow})
+		if err != nil {
+			return err
+		}
+		if report.Rows != 2500 || report.Batches != 3 {
+			t.Errorf("Rows = %d, Batches = %d", report.Rows, report.Batches)
+		}
+		if n := count(t, tx); n != 2500 {
+			t.Errorf("事务中表中有 %d 条记录", n)
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatal(err)
+	}
+	if n := count(t, d); n != 0 {
+		t.Errorf("事务回滚之后表中还有 %d 条记录", n)
+	}
+}
+
+func TestLoadDataRejected(t *testing.T) {
+	d := setup(t)
+	requireLocalInfile(t, d)
+	existing := benchUser{Name: "existing"}
+	if err := d.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一条记录与已有记录的主键冲突, LOAD DATA LOCAL 会跳过它并产生警告
+	users := generate(3)
+	for i := range users {
+		users[i].ID = existing.ID + uint(i)
+	}
+	report, err := Load(context.Background(), d, users, Config{Method: LoadData})
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("应该返回 BatchError, 实际为 %v", err)
+	}
+	if !errors.Is(err, ErrRejected) {
+		t.Fatalf("应该返回 ErrRejected, 实际为 %v", err)
+	}
+	var rejected *RejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("应该返回 RejectedError, 实际为 %v", err)
+	}
+	if rejected.Expected != 3 || rejected.Loaded != 2 {
+		t.Errorf("Expected = %d, Loaded = %d", rejected.Expected, rejected.Loaded)
+	}
+	if len(rejected.Warnings) == 0 {
+		t.Error("没有读取到警告")
+	}
+	if report.Rows != 2 || len(report.Errors) != 1 {
+		t.Errorf("Rows = %d, Errors = %d", report.Rows, len(report.Errors))
+	}
+	if n := count(t, d); n != 3 {
+		t.Errorf("表中有 %d 条记录, 应该为 3", n)
+	}
+}
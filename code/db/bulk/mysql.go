@@ -0,0 +1,121 @@
+package bulk
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// readerSeq 用于生成唯一的 Reader 名称
+var readerSeq atomic.Int64
+
+// loadData 使用 LOAD DATA LOCAL INFILE 导入, 数据以制表符分隔的文本从内存中读取
+func loadData(db *gorm.DB, table string, values clause.Values) (int64, error) {
+	loc := time.UTC
+	if dialector, ok := db.Dialector.(*mysql.Dialector); ok && dialector.DSNConfig != nil && dialector.DSNConfig.Loc != nil {
+		loc = dialector.DSNConfig.Loc
+	}
+
+	var buf bytes.Buffer
+	for _, row := range values.Values {
+		for i, v := range row {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			if err := writeMySQLValue(&buf, v, loc); err != nil {
+				return 0, fmt.Errorf("字段 %s: %w", values.Columns[i].Name, err)
+			}
+		}
+		buf.WriteByte('\n')
+	}
+
+	name := fmt.Sprintf("gorm-learn-bulk-%d", readerSeq.Add(1))
+	mysqldriver.RegisterReaderHandler(name, func() io.Reader { return &buf })
+	defer mysqldriver.DeregisterReaderHandler(name)
+
+	var query strings.Builder
+	query.WriteString("LOAD DATA LOCAL INFILE 'Reader::" + name + "' INTO TABLE ")
+	db.Statement.QuoteTo(&query, table)
+	query.WriteString(` CHARACTER SET utf8mb4 FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n' (`)
+	for i, column := range columnNames(values) {
+		if i > 0 {
+			query.WriteByte(',')
+		}
+		db.Statement.QuoteTo(&query, column)
+	}
+	query.WriteByte(')')
+
+	// LOCAL 模式下主键冲突、类型转换失败等错误只会产生警告并跳过该行,
+	// 导入的行数少于提交的行数时读取同一个连接上的警告作为这一批的错误
+	var rows int64
+	err := onConn(db, func(tx *gorm.DB) error {
+		result := tx.Exec(query.String())
+		if result.Error != nil {
+			return result.Error
+		}
+		rows = result.RowsAffected
+		if rows == int64(len(values.Values)) {
+			return nil
+		}
+		rejected := &RejectedError{Expected: int64(len(values.Values)), Loaded: rows}
+		if err := tx.Raw("SHOW WARNINGS").Scan(&rejected.Warnings).Error; err != nil {
+			return fmt.Errorf("%w, 读取警告失败: %v", rejected, err)
+		}
+		return rejected
+	})
+	return rows, err
+}
+
+// onConn 在同一个数据库连接上执行 fc, SHOW WARNINGS 只能读取当前连接上一条语句产生的警告
+func onConn(db *gorm.DB, fc func(tx *gorm.DB) error) error {
+	tx := db.Session(&gorm.Session{NewDB: true})
+	switch db.Statement.ConnPool.(type) {
+	case gorm.TxCommitter, *sql.Conn:
+		return fc(tx)
+	}
+	return tx.Connection(fc)
+}
+
+// mysqlEscaper 转义 LOAD DATA 中具有特殊含义的字符
+var mysqlEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, "\x00", `\0`)
+
+// writeMySQLValue 按照 LOAD DATA 的文本格式写入一个值
+func writeMySQLValue(buf *bytes.Buffer, v interface{}, loc *time.Location) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString(`\N`)
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	case bool:
+		if v {
+			buf.WriteByte('1')
+		} else {
+			buf.WriteByte('0')
+		}
+	case string:
+		mysqlEscaper.WriteString(buf, v)
+	case []byte:
+		mysqlEscaper.WriteString(buf, string(v))
+	case time.Time:
+		if v.IsZero() {
+			buf.WriteString("0000-00-00 00:00:00")
+		} else {
+			buf.WriteString(v.In(loc).Format("2006-01-02 15:04:05.999999"))
+		}
+	default:
+		return fmt.Errorf("不支持的类型 %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package bulk
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// copyFrom 使用 COPY ... FROM STDIN 导入
+//
+// 驱动为 pgx 时调用 (*pgx.Conn).CopyFrom, 否则使用 lib/pq 约定的方式:
+// 预编译 COPY 语句, 每一行调用一次 Exec, 最后调用不带参数的 Exec 结束导入
+func copyFrom(db *gorm.DB, table string, values clause.Values) (int64, error) {
+	ctx := db.Statement.Context
+	columns := columnNames(values)
+
+	// 处于事务中时 db.DB() 返回的是事务所属的 *sql.DB, 不能在新的连接上导入
+	_, inTx := db.Statement.ConnPool.(gorm.TxCommitter)
+	if sqlDB, err := db.DB(); err == nil && !inTx {
+		conn, err := sqlDB.Conn(ctx)
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+
+		var rows int64
+		handled := false
+		err = conn.Raw(func(driverConn interface{}) error {
+			rows, handled, err = pgxCopyFrom(ctx, driverConn, table, columns, values.Values)
+			return err
+		})
+		if handled || err != nil {
+			return rows, err
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, err
+		}
+		rows, err = pqCopyIn(ctx, tx, db, table, columns, values.Values)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		return rows, tx.Commit()
+	}
+
+	// 已经处于事务中时, 直接在当前事务上执行
+	preparer, ok := db.Statement.ConnPool.(interface {
+		PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	})
+	if !ok {
+		return 0, errors.New("bulk: 当前连接不支持 COPY")
+	}
+	return pqCopyIn(ctx, preparer, db, table, columns, values.Values)
+}
+
+// pgxCopyFrom 通过反射调用 pgx 的 CopyFrom, 驱动不是 pgx 时 handled 为 false
+func pgxCopyFrom(ctx context.Context, driverConn interface{}, table string, columns []string, rows [][]interface{}) (n int64, handled bool, err error) {
+	connMethod := reflect.ValueOf(driverConn).MethodByName("Conn")
+	if !connMethod.IsValid() || connMethod.Type().NumIn() != 0 || connMethod.Type().NumOut() != 1 {
+		return 0, false, nil
+	}
+	copyMethod := connMethod.Call(nil)[0].MethodByName("CopyFrom")
+	if !copyMethod.IsValid() || copyMethod.Type().NumIn() != 4 {
+		return 0, false, nil
+	}
+
+	// CopyFrom(ctx, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error)
+	in := copyMethod.Type()
+	identifier := reflect.ValueOf([]string{table}).Convert(in.In(1))
+	source := reflect.ValueOf(&copySource{rows: rows})
+	if !source.Type().Implements(in.In(3)) {
+		return 0, false, nil
+	}
+	out := copyMethod.Call([]reflect.Value{reflect.ValueOf(ctx), identifier, reflect.ValueOf(columns), source})
+	n = out[0].Int()
+	if e, _ := out[1].Interface().(error); e != nil {
+		return n, true, e
+	}
+	return n, true, nil
+}
+
+// copySource 实现 pgx.CopyFromSource 接口
+type copySource struct {
+	rows [][]interface{}
+	next int
+}
+
+func (s *copySource) Next() bool {
+	s.next++
+	return s.next <= len(s.rows)
+}
+
+func (s *copySource) Values() ([]interface{}, error) {
+	return s.rows[s.next-1], nil
+}
+
+func (s *copySource) Err() error {
+	return nil
+}
+
+// pqCopyIn 使用 lib/pq 约定的方式执行 COPY
+func pqCopyIn(ctx context.Context, preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}, db *gorm.DB, table string, columns []string, rows [][]interface{}) (int64, error) {
+	var query strings.Builder
+	query.WriteString("COPY ")
+	db.Statement.QuoteTo(&query, table)
+	query.WriteString(" (")
+	for i, column := range columns {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		db.Statement.QuoteTo(&query, column)
+	}
+	query.WriteString(") FROM STDIN")
+
+	stmt, err := preparer.PrepareContext(ctx, query.String())
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for i, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return 0, fmt.Errorf("第 %d 行: %w", i, err)
+		}
+	}
+	result, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return n, nil
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gorm-learn/db/encrypt"
+	"gorm-learn/db/validate"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// DefaultBulkUpdateBatchSize BulkUpdate 每条 UPDATE 语句默认包含的记录数
+const DefaultBulkUpdateBatchSize = 500
+
+// BulkUpdateResult 批量更新的结果
+type BulkUpdateResult struct {
+	// RowsAffected 全部批次影响的行数之和
+	RowsAffected int64
+	// Batches 每一批影响的行数
+	Batches []int64
+}
+
+// BulkUpdate 按主键把每条记录中指定字段的值分别更新到数据库, 参考 BulkUpdateInBatches
+func BulkUpdate[T any](ctx context.Context, rows []T, fields ...string) (BulkUpdateResult, error) {
+	return BulkUpdateInBatches(ctx, rows, DefaultBulkUpdateBatchSize, fields...)
+}
+
+// BulkUpdateInBatches 按主键把每条记录中指定字段的值分别更新到数据库, 每 batchSize 条记录生成一条语句:
+//
+//	UPDATE `users` SET `age`=CASE `id` WHEN 1 THEN 18 WHEN 2 THEN 20 ELSE `age` END,`updated_at`=...
+//	WHERE `users`.`id` IN (1,2) AND `users`.`deleted_at` IS NULL
+//
+// 更新时间会被自动维护, 被软删除的记录不会被更新; 主键重复时以最后一条记录为准.
+// 钩子只会在每条语句上执行一次, 不会针对每条记录执行, 因此加密字段不能批量更新;
+// 注册了校验插件时, 执行之前逐条校验每条记录中需要更新的字段.
+// 某一批失败时立即返回, 已经执行的批次不会回滚, 需要原子性时请在事务中调用
+func BulkUpdateInBatches[T any](ctx context.Context, rows []T, batchSize int, fields ...string) (BulkUpdateResult, error) {
+	var result BulkUpdateResult
+	if len(rows) == 0 {
+		return result, nil
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBulkUpdateBatchSize
+	}
+
+	tx := Conn(ctx)
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(new(T)); err != nil {
+		return result, err
+	}
+	sch := stmt.Schema
+	if len(sch.PrimaryFields) == 0 {
+		return result, fmt.Errorf("%s 没有主键, 无法批量更新", sch.Name)
+	}
+	updateFields, err := bulkUpdateFields(sch, fields)
+	if err != nil {
+		return result, err
+	}
+	// CASE 表达式不会经过校验插件, 写入之前逐条校验需要更新的字段
+	if _, ok := tx.Config.Plugins[validate.Plugin{}.Name()]; ok {
+		names := make([]string, 0, len(updateFields))
+		for _, field := range updateFields {
+			names = append(names, field.Name)
+		}
+		if err := validate.Fields(ctx, rows, names...); err != nil {
+			return result, err
+		}
+	}
+
+	// 主键重复时保留最后一条记录
+	keyed := make([][]interface{}, 0, len(rows))
+	values := make([]reflect.Value, 0, len(rows))
+	index := make(map[string]int, len(rows))
+	for i := range rows {
+		row := reflect.Indirect(reflect.ValueOf(&rows[i]).Elem())
+		key := make([]interface{}, 0, len(sch.PrimaryFields))
+		for _, pk := range sch.PrimaryFields {
+			v, zero := pk.ValueOf(ctx, row)
+			if zero {
+				return result, fmt.Errorf("第 %d 条记录的主键 %s 为空", i, pk.DBName)
+			}
+			key = append(key, v)
+		}
+		id := fmt.Sprint(key...)
+		if j, ok := index[id]; ok {
+			values[j] = row
+			continue
+		}
+		index[id] = len(values)
+		keyed = append(keyed, key)
+		values = append(values, row)
+	}
+
+	for start := 0; start < len(values); start += batchSize {
+		end := min(start+batchSize, len(values))
+		updates := make(map[string]interface{}, len(updateFields))
+		for _, field := range updateFields {
+			updates[field.DBName] = caseExpr(ctx, sch, field, keyed[start:end], values[start:end])
+		}
+
+		column, ids := schema.ToQueryValues(sch.Table, sch.PrimaryFieldDBNames, keyed[start:end])
+		batch := tx.Model(new(T)).Where(clause.IN{Column: column, Values: ids}).Updates(updates)
+		if batch.Error != nil {
+			return result, fmt.Errorf("第 %d 批更新失败: %w", len(result.Batches), batch.Error)
+		}
+		result.Batches = append(result.Batches, batch.RowsAffected)
+		result.RowsAffected += batch.RowsAffected
+	}
+	return result, nil
+}
+
+// bulkUpdateFields 校验并返回需要更新的字段
+func bulkUpdateFields(sch *schema.Schema, names []string) ([]*schema.Field, error) {
+	if len(names) == 0 {
+		return nil, errors.New("批量更新需要指定字段")
+	}
+	fields := make([]*schema.Field, 0, len(names))
+	for _, name := range names {
+		field := sch.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("%w: %s.%s", ErrUnknownColumn, sch.Table, name)
+		}
+		if field.PrimaryKey {
+			return nil, fmt.Errorf("主键 %s 不能被批量更新", field.DBName)
+		}
+		if !field.Updatable {
+			return nil, fmt.Errorf("字段 %s 不允许更新", field.DBName)
+		}
+		// 加密字段的盲索引等派生列由模型的钩子逐条维护, 钩子在批量更新中只执行一次
+		if _, ok := field.Serializer.(encrypt.Serializer); ok {
+			return nil, fmt.Errorf("加密字段 %s 不能批量更新, 请逐条更新", field.DBName)
+		}
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// caseExpr 生成按主键取值的 CASE 表达式, 主键之外的记录保持原值
+func caseExpr(ctx context.Context, sch *schema.Schema, field *schema.Field, keys [][]interface{}, rows []reflect.Value) clause.Expr {
+	var sql strings.Builder
+	vars := make([]interface{}, 0, len(rows)*(len(keys[0])+1)+2)
+
+	single := len(sch.PrimaryFields) == 1
+	if single {
+		sql.WriteString("CASE ?")
+		vars = append(vars, clause.Column{Name: sch.PrimaryFields[0].DBName})
+	} else {
+		sql.WriteString("CASE")
+	}
+	for i, row := range rows {
+		if single {
+			sql.WriteString(" WHEN ?")
+			vars = append(vars, keys[i][0])
+		} else {
+			sql.WriteString(" WHEN ")
+			for j, pk := range sch.PrimaryFields {
+				if j > 0 {
+					sql.WriteString(" AND ")
+				}
+				sql.WriteString("? = ?")
+				vars = append(vars, clause.Column{Name: pk.DBName}, keys[i][j])
+			}
+		}
+		// 序列化器与 gorm.Valuer 会在生成 SQL 时生效, 与 Updates 的行为一致
+		value, _ := field.ValueOf(ctx, row)
+		sql.WriteString(" THEN ?")
+		vars = append(vars, value)
+	}
+	sql.WriteString(" ELSE ? END")
+	vars = append(vars, clause.Column{Name: field.DBName})
+	return clause.Expr{SQL: sql.String(), Vars: vars}
+}
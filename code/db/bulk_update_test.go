@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm-learn/db/validate"
+)
+
+func TestBulkUpdate(t *testing.T) {
+	d := testDB(t)
+	ids := createUsers(t, d, 3)
+
+	rows := []User{{Name: "bulk"}, {Name: "bulk"}, {Name: "bulk"}}
+	for i, id := range ids {
+		rows[i].ID, rows[i].Age = id, 20+i
+	}
+	// 主键重复时以最后一条记录为准
+	rows = append(rows, User{Name: "bulk", Age: 30})
+	rows[3].ID = ids[2]
+	result, err := BulkUpdateInBatches(context.Background(), rows, 2, "Age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RowsAffected != 3 || len(result.Batches) != 2 {
+		t.Errorf("BulkUpdateResult = %+v", result)
+	}
+	if got := ages(t, d, ids...); got[0] != 20 || got[1] != 21 || got[2] != 30 {
+		t.Errorf("年龄为 %v", got)
+	}
+}
+
+func TestBulkUpdateValidate(t *testing.T) {
+	d := testDB(t)
+	ids := createUsers(t, d, 2)
+
+	rows := []User{{Name: "bulk", Age: 20}, {Name: "bulk", Age: -5}}
+	rows[0].ID, rows[1].ID = ids[0], ids[1]
+	_, err := BulkUpdate(context.Background(), rows, "Age")
+	var errs validate.FieldErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Column != "age" || errs[0].Index != 1 {
+		t.Fatalf("年龄为负数时应该返回校验错误, 实际为 %v", err)
+	}
+	if got := ages(t, d, ids...); got[0] != 0 || got[1] != 0 {
+		t.Errorf("校验失败时不应该更新任何记录, 年龄为 %v", got)
+	}
+
+	// 只校验需要更新的字段, 没有更新的 Name 为空也不影响
+	rows = []User{{Age: 18}}
+	rows[0].ID = ids[0]
+	if _, err := BulkUpdate(context.Background(), rows, "Age"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBulkUpdateEncrypted(t *testing.T) {
+	testDB(t)
+	cards := []CreditCard{{Number: "4111111111111111"}}
+	cards[0].ID = 1
+	if _, err := BulkUpdate(context.Background(), cards, "Number"); err == nil {
+		t.Error("加密字段不应该允许批量更新")
+	}
+}
@@ -0,0 +1,412 @@
+package cascade
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm-learn/db/internal/callbacks"
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// beforeDelete 在删除父记录之前, 软删除或者物理删除声明了级联的关联记录
+//
+// 软删除时先把语句的 NowFunc 固定为按父记录软删除字段的精度截断的当前时间,
+// 父记录与级联删除的子记录写入同一个删除时间, 恢复时可以按删除时间精确匹配
+func beforeDelete(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || db.DryRun || stmt.Schema == nil || stmt.SQL.Len() > 0 {
+		return
+	}
+	field := softdelete.Field(stmt.Schema)
+	if field == nil || stmt.Unscoped {
+		run(db, HardDelete)
+		return
+	}
+	if precision := softdelete.Precision(field); precision > 0 {
+		now := db.NowFunc().Truncate(precision)
+		config := *db.Config
+		config.NowFunc = func() time.Time { return now }
+		db.Config = &config
+	}
+	run(db, SoftDelete)
+}
+
+// beforeUpdate 在恢复父记录之前, 恢复与父记录一起被删除的关联记录
+//
+// 把软删除字段更新为 NULL 或者 0 视为恢复, 例如 softdelete.Restore
+func beforeUpdate(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || db.DryRun || stmt.Schema == nil || stmt.SQL.Len() > 0 {
+		return
+	}
+	if field := softdelete.Field(stmt.Schema); field != nil && restoring(stmt, field) {
+		run(db, Restore)
+	}
+}
+
+// run 查询语句将要处理的父记录, 并对每个声明了 action 的关联执行级联操作
+func run(db *gorm.DB, action Action) {
+	stmt := db.Statement
+	all, err := rulesOf(stmt.Schema)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	rules := make([]rule, 0, len(all))
+	for _, r := range all {
+		if r.actions&action != 0 {
+			rules = append(rules, r)
+		}
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	parents, err := findParents(db, rules, action)
+	if err != nil {
+		db.AddError(fmt.Errorf("cascade: 查询 %s 失败: %w", stmt.Schema.Name, err))
+		return
+	}
+	// 跳过本次级联中已经处理过的记录, 关联形成环时在这里停止
+	ctx, seen := withVisited(stmt.Context)
+	pk := stmt.Schema.PrimaryFields[0]
+	rows := parents[:0]
+	for _, row := range parents {
+		if v, _ := pk.ValueOf(ctx, row); seen.mark(stmt.Schema.Table, v) {
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	// WithContext 会复制当前语句, 需要与 NewDB 在同一个 Session 中指定
+	tx := db.Session(&gorm.Session{NewDB: true, Context: ctx})
+	for _, r := range rules {
+		var err error
+		switch r.rel.Type {
+		case schema.HasOne, schema.HasMany:
+			err = applyHas(tx, r.rel, action, rows)
+		case schema.Many2Many:
+			err = applyMany2Many(tx, r.rel, action, rows)
+		}
+		if err != nil {
+			db.AddError(fmt.Errorf("cascade: %s.%s %s 失败: %w", stmt.Schema.Name, r.rel.Name, action, err))
+			return
+		}
+	}
+}
+
+// findParents 按语句的条件查询将要处理的父记录, 只查询主键、软删除字段以及关联引用的字段
+//
+// 语句没有任何条件并且不允许全局更新时返回空, 由 GORM 返回 ErrMissingWhereClause
+func findParents(db *gorm.DB, rules []rule, action Action) ([]reflect.Value, error) {
+	stmt := db.Statement
+	sch := stmt.Schema
+
+	conds := callbacks.Conditions(stmt)
+	if len(conds) == 0 && !db.AllowGlobalUpdate {
+		return nil, nil
+	}
+
+	columns := []string{sch.PrimaryFields[0].DBName}
+	field := softdelete.Field(sch)
+	if field != nil {
+		columns = append(columns, field.DBName)
+	}
+	for _, r := range rules {
+		for _, ref := range r.rel.References {
+			if ref.OwnPrimaryKey && !callbacks.Contains(columns, ref.PrimaryKey.DBName) {
+				columns = append(columns, ref.PrimaryKey.DBName)
+			}
+		}
+	}
+
+	query := db.Session(&gorm.Session{NewDB: true}).Model(reflect.New(sch.ModelType).Interface()).Select(columns)
+	if action != SoftDelete {
+		query = query.Unscoped()
+	}
+	if action == Restore {
+		conds = append(conds, softdelete.Trashed(field, clause.Column{Table: clause.CurrentTable, Name: field.DBName}))
+	}
+	if len(conds) > 0 {
+		query = query.Where(clause.And(conds...))
+	}
+	rows := reflect.New(reflect.SliceOf(sch.ModelType))
+	if err := query.Find(rows.Interface()).Error; err != nil {
+		return nil, err
+	}
+	result := make([]reflect.Value, rows.Elem().Len())
+	for i := range result {
+		result[i] = rows.Elem().Index(i)
+	}
+	return result, nil
+}
+
+// applyHas 对 has one、has many 关联的子记录执行级联操作
+func applyHas(tx *gorm.DB, rel *schema.Relationship, action Action, parents []reflect.Value) error {
+	var own *schema.Reference
+	extra := make([]clause.Expression, 0, 1)
+	for _, ref := range rel.References {
+		switch {
+		case ref.OwnPrimaryKey && own == nil:
+			own = ref
+		case ref.OwnPrimaryKey:
+			return fmt.Errorf("不支持多列外键")
+		case ref.PrimaryValue != "":
+			// 多态关联的类型条件
+			extra = append(extra, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: ref.ForeignKey.DBName}, Value: ref.PrimaryValue})
+		}
+	}
+	if own == nil {
+		return nil
+	}
+	child := rel.FieldSchema
+	cond := func(rows []reflect.Value) (clause.Expression, bool) {
+		keys := keyValues(tx, own.PrimaryKey, rows)
+		if len(keys) == 0 {
+			return nil, false
+		}
+		column := clause.Column{Table: clause.CurrentTable, Name: own.ForeignKey.DBName}
+		return clause.And(append([]clause.Expression{clause.IN{Column: column, Values: keys}}, extra...)...), true
+	}
+
+	switch action {
+	case SoftDelete, HardDelete:
+		c, ok := cond(parents)
+		if !ok {
+			return nil
+		}
+		return remove(tx, child, action, c)
+	case Restore:
+		field := softdelete.Field(child)
+		if field == nil {
+			return nil
+		}
+		for _, group := range byDeletedTime(tx, rel.Schema, parents) {
+			c, ok := cond(group.rows)
+			if !ok {
+				continue
+			}
+			if err := restore(tx, child, field, group.at, c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyMany2Many 对 many to many 关联的记录执行级联操作
+func applyMany2Many(tx *gorm.DB, rel *schema.Relationship, action Action, parents []reflect.Value) error {
+	var own, assoc *schema.Reference
+	for _, ref := range rel.References {
+		switch {
+		case ref.OwnPrimaryKey && own == nil:
+			own = ref
+		case !ref.OwnPrimaryKey && ref.PrimaryKey != nil && assoc == nil:
+			assoc = ref
+		default:
+			return fmt.Errorf("不支持多列外键")
+		}
+	}
+	if own == nil || assoc == nil {
+		return nil
+	}
+	join := rel.JoinTable.Table
+	ownColumn := clause.Column{Table: join, Name: own.ForeignKey.DBName}
+	assocColumn := clause.Column{Table: join, Name: assoc.ForeignKey.DBName}
+	target := rel.FieldSchema
+
+	// linked 返回连接表中与 keys 关联的记录的键
+	linked := func(query *gorm.DB) ([]interface{}, error) {
+		dest := reflect.New(reflect.SliceOf(assoc.ForeignKey.FieldType))
+		if err := query.Distinct().Pluck(assoc.ForeignKey.DBName, dest.Interface()).Error; err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, dest.Elem().Len())
+		for i := range values {
+			values[i] = dest.Elem().Index(i).Interface()
+		}
+		return values, nil
+	}
+	assocCond := func(values []interface{}) clause.Expression {
+		return clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: assoc.PrimaryKey.DBName}, Values: values}
+	}
+
+	if action == Restore {
+		field := softdelete.Field(target)
+		if field == nil {
+			return nil
+		}
+		for _, group := range byDeletedTime(tx, rel.Schema, parents) {
+			keys := keyValues(tx, own.PrimaryKey, group.rows)
+			if len(keys) == 0 {
+				continue
+			}
+			values, err := linked(tx.Table(join).Where(clause.IN{Column: ownColumn, Values: keys}))
+			if err != nil {
+				return err
+			}
+			if len(values) == 0 {
+				continue
+			}
+			if err := restore(tx, target, field, group.at, assocCond(values)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	keys := keyValues(tx, own.PrimaryKey, parents)
+	if len(keys) == 0 {
+		return nil
+	}
+	values, err := linked(tx.Table(join).Where(clause.IN{Column: ownColumn, Values: keys}))
+	if err != nil {
+		return err
+	}
+
+	// 仍然被其他父记录引用的关联记录不删除; 物理删除时已经软删除的父记录同样算作引用, 否则它们恢复之后关联会丢失
+	if len(values) > 0 {
+		others := tx.Model(reflect.New(rel.Schema.ModelType).Interface()).Select(own.PrimaryKey.DBName)
+		if action == HardDelete {
+			others = others.Unscoped()
+		}
+		shared, err := linked(tx.Table(join).
+			Where(clause.IN{Column: assocColumn, Values: values}).
+			Where(clause.Not(clause.IN{Column: ownColumn, Values: keys})).
+			Where(clause.Expr{SQL: "? IN (?)", Vars: []interface{}{ownColumn, others}}))
+		if err != nil {
+			return err
+		}
+		values = subtract(values, shared)
+	}
+
+	if action == HardDelete {
+		if err := tx.Exec("DELETE FROM ? WHERE ?", clause.Table{Name: join}, clause.IN{Column: ownColumn, Values: keys}).Error; err != nil {
+			return err
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return remove(tx, target, action, assocCond(values))
+}
+
+// remove 软删除或者物理删除 sch 中满足 cond 的记录, 这些记录同样会按自身的规则继续级联
+func remove(tx *gorm.DB, sch *schema.Schema, action Action, cond clause.Expression) error {
+	model := reflect.New(sch.ModelType).Interface()
+	if action == HardDelete {
+		return tx.Unscoped().Where(cond).Delete(model).Error
+	}
+	if softdelete.Field(sch) == nil {
+		return fmt.Errorf("%s 不支持软删除", sch.Name)
+	}
+	return tx.Where(cond).Delete(model).Error
+}
+
+// restore 恢复 sch 中满足 cond 并且在 at 时刻被删除的记录, at 为零值时不限制删除时间
+func restore(tx *gorm.DB, sch *schema.Schema, field *schema.Field, at time.Time, cond clause.Expression) error {
+	if !at.IsZero() {
+		column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+		if c, ok := softdelete.DeletedAt(field, column, at); ok {
+			cond = clause.And(cond, c)
+		}
+	}
+	return softdelete.Restore(tx, reflect.New(sch.ModelType).Interface(), cond).Error
+}
+
+// deletedGroup 删除时间相同的一组父记录
+type deletedGroup struct {
+	// at 父记录的删除时间, 父记录没有记录删除时间时为零值
+	at   time.Time
+	rows []reflect.Value
+}
+
+// byDeletedTime 按删除时间对父记录分组, 同一次删除的父记录删除时间相同
+func byDeletedTime(tx *gorm.DB, sch *schema.Schema, rows []reflect.Value) []deletedGroup {
+	field := softdelete.Field(sch)
+	var groups []deletedGroup
+	index := map[int64]int{}
+	for _, row := range rows {
+		var at time.Time
+		if v, _ := field.ValueOf(tx.Statement.Context, row); v != nil {
+			at, _ = softdelete.TimeOf(v)
+		}
+		key := at.UnixNano()
+		if at.IsZero() {
+			key = 0
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, deletedGroup{at: at})
+		}
+		groups[i].rows = append(groups[i].rows, row)
+	}
+	return groups
+}
+
+// restoring 判断更新语句是否把软删除字段更新为 NULL 或者 0
+func restoring(stmt *gorm.Statement, field *schema.Field) bool {
+	if c, ok := stmt.Clauses["SET"]; ok {
+		set, _ := c.Expression.(clause.Set)
+		for _, assignment := range set {
+			if assignment.Column.Name == field.DBName {
+				return isZero(assignment.Value)
+			}
+		}
+		return false
+	}
+	if dest, ok := stmt.Dest.(map[string]interface{}); ok {
+		for k, v := range dest {
+			if k == field.DBName || k == field.Name {
+				return isZero(v)
+			}
+		}
+	}
+	return false
+}
+
+func isZero(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	return (rv.Kind() == reflect.Ptr && rv.IsNil()) || rv.IsZero()
+}
+
+// keyValues 返回 rows 中 field 的非零值
+func keyValues(tx *gorm.DB, field *schema.Field, rows []reflect.Value) []interface{} {
+	values := make([]interface{}, 0, len(rows))
+	for _, row := range rows {
+		if v, zero := field.ValueOf(tx.Statement.Context, row); !zero {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// subtract 返回 values 中不在 remove 里的值
+func subtract(values, remove []interface{}) []interface{} {
+	if len(remove) == 0 {
+		return values
+	}
+	skip := make(map[interface{}]bool, len(remove))
+	for _, v := range remove {
+		skip[v] = true
+	}
+	result := values[:0]
+	for _, v := range values {
+		if !skip[v] {
+			result = append(result, v)
+		}
+	}
+	return result
+}
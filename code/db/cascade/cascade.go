@@ -0,0 +1,190 @@
+// 按关联声明的级联软删除、恢复与物理删除
+//
+// GORM 只会通过数据库的外键约束级联物理删除, 软删除父记录时子记录仍然有效. 在 has one、has many
+// 与 many to many 关联上声明 cascade 标签后, 插件会在同一个事务中对关联的记录执行相同的操作:
+//
+//	type User struct {
+//		gorm.Model
+//		CreditCard *CreditCard `cascade:"all"`
+//	}
+//
+//	d.Delete(&user)                 // 同时软删除 user 的信用卡
+//	softdelete.Restore(d, &user)    // 同时恢复与 user 一起被删除的信用卡
+//	d.Unscoped().Delete(&user)      // 先物理删除信用卡, 再物理删除 user
+//
+// 标签的值为逗号分隔的操作: soft_delete、hard_delete、restore, delete 表示软删除与物理删除, all 表示全部.
+// 关联的记录同样会按自身的 cascade 标签继续级联, 同一次级联中已经处理过的记录不会再次处理, 关联形成环时也会停止.
+//
+// 子记录在父记录之前处理, 物理删除时不会违反外键约束. 软删除时父记录与子记录写入同一个删除时间,
+// 按父记录软删除字段的精度截断, 例如父记录使用 softdelete.Unix 时 softdelete.Milli 的子记录同样截断到整秒;
+// 恢复时只恢复删除时间与父记录相同的子记录, 在此之前单独删除的子记录保持删除状态.
+//
+// many to many 关联软删除时保留连接表中的记录, 以便之后恢复; 物理删除时删除父记录在连接表中的记录.
+// 仍然被其他未删除的父记录引用的关联记录不会被删除
+package cascade
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// TagName 声明级联操作的标签
+const TagName = "cascade"
+
+// Action 级联的操作
+type Action uint8
+
+const (
+	// SoftDelete 软删除
+	SoftDelete Action = 1 << iota
+	// HardDelete 物理删除
+	HardDelete
+	// Restore 恢复软删除的记录
+	Restore
+
+	// Delete 软删除与物理删除
+	Delete = SoftDelete | HardDelete
+	// All 全部操作
+	All = SoftDelete | HardDelete | Restore
+)
+
+func (a Action) String() string {
+	switch a {
+	case SoftDelete:
+		return "soft_delete"
+	case HardDelete:
+		return "hard_delete"
+	case Restore:
+		return "restore"
+	}
+	names := make([]string, 0, 3)
+	for _, action := range []Action{SoftDelete, HardDelete, Restore} {
+		if a&action != 0 {
+			names = append(names, action.String())
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// parseTag 解析 cascade 标签
+func parseTag(tag string) (Action, error) {
+	var actions Action
+	for _, name := range strings.Split(tag, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "soft_delete":
+			actions |= SoftDelete
+		case "hard_delete":
+			actions |= HardDelete
+		case "restore":
+			actions |= Restore
+		case "delete":
+			actions |= Delete
+		case "all":
+			actions |= All
+		case "":
+		default:
+			return 0, fmt.Errorf("未知的级联操作 %q", name)
+		}
+	}
+	return actions, nil
+}
+
+// rule 一个声明了级联操作的关联
+type rule struct {
+	rel     *schema.Relationship
+	actions Action
+}
+
+// ruleSet 模型的全部级联规则
+type ruleSet struct {
+	rules []rule
+	err   error
+}
+
+// rulesCache 按模型缓存解析后的级联规则
+var rulesCache sync.Map
+
+// rulesOf 返回模型的级联规则, 标签错误或者关联不支持级联时返回错误
+func rulesOf(sch *schema.Schema) ([]rule, error) {
+	if v, ok := rulesCache.Load(sch); ok {
+		set := v.(*ruleSet)
+		return set.rules, set.err
+	}
+	set := &ruleSet{}
+	for _, rel := range sch.Relationships.Relations {
+		// GORM 会把父模型的 has one、has many 关联也登记在子模型中, 用于迁移时创建外键约束
+		if rel.Schema.ModelType != sch.ModelType {
+			continue
+		}
+		tag, ok := rel.Field.Tag.Lookup(TagName)
+		if !ok {
+			continue
+		}
+		actions, err := parseTag(tag)
+		if err != nil {
+			set.err = fmt.Errorf("cascade: %s.%s: %w", sch.Name, rel.Name, err)
+			break
+		}
+		if rel.Type == schema.BelongsTo {
+			set.err = fmt.Errorf("cascade: %s.%s: belongs to 关联不支持级联", sch.Name, rel.Name)
+			break
+		}
+		set.rules = append(set.rules, rule{rel: rel, actions: actions})
+	}
+	if set.err == nil && len(set.rules) > 0 && len(sch.PrimaryFields) != 1 {
+		set.err = fmt.Errorf("cascade: %s 必须只有一个主键才能级联", sch.Name)
+	}
+	v, _ := rulesCache.LoadOrStore(sch, set)
+	set = v.(*ruleSet)
+	return set.rules, set.err
+}
+
+// visitedKey 保存本次级联中已经处理过的记录的 ctx key
+type visitedKey struct{}
+
+// visited 已经处理过的记录, 按表名与主键记录
+type visited map[string]map[interface{}]bool
+
+// withVisited 返回携带 visited 的 ctx, ctx 中已经存在时沿用同一个
+func withVisited(ctx context.Context) (context.Context, visited) {
+	if v, ok := ctx.Value(visitedKey{}).(visited); ok {
+		return ctx, v
+	}
+	v := visited{}
+	return context.WithValue(ctx, visitedKey{}, v), v
+}
+
+// mark 标记记录已经处理, 之前已经处理过时返回 false
+func (v visited) mark(table string, pk interface{}) bool {
+	seen, ok := v[table]
+	if !ok {
+		seen = map[interface{}]bool{}
+		v[table] = seen
+	}
+	if seen[pk] {
+		return false
+	}
+	seen[pk] = true
+	return true
+}
+
+// Plugin 级联操作插件, 需要在 GORM 默认的事务中执行, 不要开启 SkipDefaultTransaction
+type Plugin struct{}
+
+// Name 实现 gorm.Plugin 接口
+func (Plugin) Name() string {
+	return "gorm-learn:cascade"
+}
+
+// Initialize 实现 gorm.Plugin 接口
+func (Plugin) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Delete().After("gorm:before_delete").Before("gorm:delete").Register("cascade:before_delete", beforeDelete); err != nil {
+		return err
+	}
+	return db.Callback().Update().After("gorm:before_update").Before("gorm:update").Register("cascade:before_update", beforeUpdate)
+}
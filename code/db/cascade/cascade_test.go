@@ -0,0 +1,237 @@
+package cascade
+
+import (
+	"testing"
+	"time"
+
+	"gorm-learn/db/internal/dbtest"
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/gorm"
+)
+
+// 测试使用的模型: 作者有一份资料 (has one) 和多篇文章 (has many), 文章有多个标签 (many to many),
+// 三者的软删除字段精度各不相同
+type testAuthor struct {
+	ID        uint
+	Name      string
+	DeletedAt softdelete.Milli
+	Profile   *testProfile `gorm:"foreignKey:AuthorID" cascade:"all"`
+	Posts     []testPost   `gorm:"foreignKey:AuthorID" cascade:"all"`
+}
+
+type testProfile struct {
+	ID        uint
+	AuthorID  uint
+	DeletedAt softdelete.Unix
+}
+
+type testPost struct {
+	ID        uint
+	AuthorID  uint
+	DeletedAt gorm.DeletedAt
+	Tags      []testTag `gorm:"many2many:cascade_test_post_tags" cascade:"all"`
+}
+
+type testTag struct {
+	ID        uint
+	Name      string
+	DeletedAt softdelete.Milli
+}
+
+// testNode 自引用的关联, 用于构造环
+type testNode struct {
+	ID        uint
+	ParentID  *uint
+	DeletedAt softdelete.Milli
+	Children  []testNode `gorm:"foreignKey:ParentID" cascade:"all"`
+}
+
+func (testAuthor) TableName() string  { return "cascade_test_authors" }
+func (testProfile) TableName() string { return "cascade_test_profiles" }
+func (testPost) TableName() string    { return "cascade_test_posts" }
+func (testTag) TableName() string     { return "cascade_test_tags" }
+func (testNode) TableName() string    { return "cascade_test_nodes" }
+
+// setup 清空测试表, 创建一个作者: 一份资料、两篇文章, 第一篇文章的标签 shared 同时属于另一个作者的文章
+func setup(t *testing.T) (*gorm.DB, *testAuthor, *testTag) {
+	t.Helper()
+	d := dbtest.Open(t, Plugin{})
+	dbtest.Migrate(t, d, &testAuthor{}, &testProfile{}, &testPost{}, &testTag{}, &testNode{})
+	// 上一次运行留下的环需要先断开, 才能删除
+	if err := d.Exec("UPDATE cascade_test_nodes SET parent_id = NULL").Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"cascade_test_post_tags", "cascade_test_posts", "cascade_test_profiles", "cascade_test_authors", "cascade_test_tags", "cascade_test_nodes"} {
+		if err := d.Exec("DELETE FROM " + table).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	shared := &testTag{Name: "shared"}
+	author := &testAuthor{
+		Name:    "author",
+		Profile: &testProfile{},
+		Posts: []testPost{
+			{Tags: []testTag{{Name: "own"}, *shared}},
+			{Tags: []testTag{{Name: "second"}}},
+		},
+	}
+	if err := d.Create(author).Error; err != nil {
+		t.Fatal(err)
+	}
+	*shared = author.Posts[0].Tags[1]
+	other := &testAuthor{Name: "other", Posts: []testPost{{Tags: []testTag{*shared}}}}
+	if err := d.Create(other).Error; err != nil {
+		t.Fatal(err)
+	}
+	return d, author, shared
+}
+
+// alive 判断记录是否存在并且没有被删除
+func alive(t *testing.T, d *gorm.DB, model interface{}, id uint) bool {
+	t.Helper()
+	var n int64
+	if err := d.Model(model).Where("id = ?", id).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n == 1
+}
+
+// exists 判断记录是否存在, 包括已删除的记录
+func exists(t *testing.T, d *gorm.DB, model interface{}, id uint) bool {
+	t.Helper()
+	var n int64
+	if err := d.Unscoped().Model(model).Where("id = ?", id).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n == 1
+}
+
+func TestSoftDelete(t *testing.T) {
+	d, author, shared := setup(t)
+	if err := d.Delete(author).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if alive(t, d, &testAuthor{}, author.ID) || alive(t, d, &testProfile{}, author.Profile.ID) {
+		t.Error("作者与资料应该被软删除")
+	}
+	for _, post := range author.Posts {
+		if alive(t, d, &testPost{}, post.ID) || !exists(t, d, &testPost{}, post.ID) {
+			t.Errorf("文章 %d 应该被软删除", post.ID)
+		}
+	}
+	if alive(t, d, &testTag{}, author.Posts[0].Tags[0].ID) || alive(t, d, &testTag{}, author.Posts[1].Tags[0].ID) {
+		t.Error("只属于该作者的标签应该被软删除")
+	}
+	if !alive(t, d, &testTag{}, shared.ID) {
+		t.Error("仍然被其他文章引用的标签不应该被删除")
+	}
+
+	// 父记录与子记录写入同一个删除时间
+	var a testAuthor
+	var p testProfile
+	var post testPost
+	if err := d.Unscoped().First(&a, author.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Unscoped().First(&p, author.Profile.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Unscoped().First(&post, author.Posts[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	at := a.DeletedAt.Time()
+	if int64(p.DeletedAt) != at.Unix() || !post.DeletedAt.Time.Equal(at) {
+		t.Errorf("删除时间不一致: 作者 %v, 资料 %d, 文章 %v", at, p.DeletedAt, post.DeletedAt.Time)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	d, author, _ := setup(t)
+
+	// 在作者之前单独删除的文章, 恢复作者时保持删除状态
+	earlier := author.Posts[1]
+	if err := d.Delete(&earlier).Error; err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := d.Delete(author).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := softdelete.Restore(d, &testAuthor{ID: author.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if !alive(t, d, &testAuthor{}, author.ID) || !alive(t, d, &testProfile{}, author.Profile.ID) {
+		t.Error("作者与资料应该被恢复")
+	}
+	if !alive(t, d, &testPost{}, author.Posts[0].ID) || !alive(t, d, &testTag{}, author.Posts[0].Tags[0].ID) {
+		t.Error("与作者一起删除的文章及其标签应该被恢复")
+	}
+	if alive(t, d, &testPost{}, earlier.ID) || alive(t, d, &testTag{}, earlier.Tags[0].ID) {
+		t.Error("之前单独删除的文章及其标签不应该被恢复")
+	}
+}
+
+func TestHardDelete(t *testing.T) {
+	d, author, shared := setup(t)
+	if err := d.Unscoped().Delete(author).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if exists(t, d, &testAuthor{}, author.ID) || exists(t, d, &testProfile{}, author.Profile.ID) {
+		t.Error("作者与资料应该被物理删除")
+	}
+	for _, post := range author.Posts {
+		if exists(t, d, &testPost{}, post.ID) {
+			t.Errorf("文章 %d 应该被物理删除", post.ID)
+		}
+	}
+	if exists(t, d, &testTag{}, author.Posts[0].Tags[0].ID) {
+		t.Error("只属于该作者的标签应该被物理删除")
+	}
+	if !alive(t, d, &testTag{}, shared.ID) {
+		t.Error("仍然被其他文章引用的标签不应该被删除")
+	}
+	var links int64
+	postIDs := []uint{author.Posts[0].ID, author.Posts[1].ID}
+	if err := d.Table("cascade_test_post_tags").Where("test_post_id IN ?", postIDs).Count(&links).Error; err != nil {
+		t.Fatal(err)
+	}
+	if links != 0 {
+		t.Errorf("连接表中还有 %d 条记录", links)
+	}
+}
+
+func TestCycle(t *testing.T) {
+	d, _, _ := setup(t)
+	a, b := testNode{}, testNode{}
+	if err := d.Create(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Create(&b).Error; err != nil {
+		t.Fatal(err)
+	}
+	// a 与 b 互为父节点
+	if err := d.Model(&a).Update("parent_id", b.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Model(&b).Update("parent_id", a.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Delete(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	if alive(t, d, &testNode{}, a.ID) || alive(t, d, &testNode{}, b.ID) {
+		t.Error("环中的节点应该全部被软删除")
+	}
+	if err := softdelete.Restore(d, &testNode{ID: a.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !alive(t, d, &testNode{}, a.ID) || !alive(t, d, &testNode{}, b.ID) {
+		t.Error("环中的节点应该全部被恢复")
+	}
+}
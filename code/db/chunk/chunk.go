@@ -0,0 +1,187 @@
+// 分批删除
+//
+// 一次性删除大量记录会长时间持有锁并产生大量 undo 日志, 这里按主键范围分批删除:
+//
+//	SELECT `id` FROM `users` WHERE name like ? AND `users`.`id` > 1000 ORDER BY `users`.`id` LIMIT 1000
+//	DELETE FROM `users` WHERE name like ? AND `users`.`id` > 1000 AND `users`.`id` <= 2036
+//
+// 每批之间可以暂停一段时间, 每批完成后通过 OnProgress 回调报告进度,
+// 中断后把 Progress.Cursor 作为 Config.ResumeAfter 即可从断点继续
+package chunk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// DefaultBatchSize 默认每批删除的记录数
+const DefaultBatchSize = 1000
+
+// Config 分批删除的配置
+type Config struct {
+	// BatchSize 每批删除的记录数, 默认为 DefaultBatchSize
+	BatchSize int
+	// Pause 每批之间暂停的时间, 用于降低对线上业务的影响
+	Pause time.Duration
+	// ResumeAfter 只处理主键大于该值的记录, 用于从断点继续
+	ResumeAfter interface{}
+	// Hard 为 true 时执行物理删除, 否则对支持软删除的模型执行软删除
+	Hard bool
+	// OnProgress 每批完成后调用, 返回错误时停止删除
+	OnProgress func(Progress) error
+}
+
+// Progress 删除进度
+type Progress struct {
+	// Batch 已完成的批数
+	Batch int
+	// Deleted 最近一批删除的记录数
+	Deleted int64
+	// Total 累计删除的记录数
+	Total int64
+	// Cursor 已经处理到的主键, 下次可以从这里继续
+	Cursor interface{}
+}
+
+// Deleter 按主键范围分批删除某个模型的记录
+type Deleter struct {
+	db     *gorm.DB
+	model  interface{}
+	config Config
+}
+
+// New 创建分批删除器, model 为不带主键值的结构体指针, 例如 &db.User{}, 模型必须只有一个主键
+func New(db *gorm.DB, model interface{}, config Config) *Deleter {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	return &Deleter{db: db, model: model, config: config}
+}
+
+// Delete 分批删除满足条件的记录, 条件的写法与 gorm.DB.Where 相同
+//
+// 出错时返回的 Progress 中记录了已经完成的进度
+func (d *Deleter) Delete(ctx context.Context, query interface{}, args ...interface{}) (Progress, error) {
+	return d.run(ctx, d.config.Hard, func(tx *gorm.DB) *gorm.DB {
+		if query == nil {
+			return tx
+		}
+		return tx.Where(query, args...)
+	})
+}
+
+// PurgeSoftDeleted 分批物理删除在 cutoff 之前被软删除的记录
+func (d *Deleter) PurgeSoftDeleted(ctx context.Context, cutoff time.Time) (Progress, error) {
+	sch, err := d.schema()
+	if err != nil {
+		return Progress{}, err
+	}
+	field := softdelete.Field(sch)
+	if field == nil {
+		return Progress{}, fmt.Errorf("%s 不支持软删除", sch.Name)
+	}
+
+	column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+	cond, ok := softdelete.DeletedBefore(field, column, cutoff)
+	if !ok {
+		return Progress{}, fmt.Errorf("%s 的软删除字段没有记录删除时间", sch.Name)
+	}
+	return d.run(ctx, true, func(tx *gorm.DB) *gorm.DB {
+		return tx.Unscoped().Where(cond)
+	})
+}
+
+// run 循环执行: 查询下一批的主键上界, 按主键范围删除, 报告进度, 暂停
+func (d *Deleter) run(ctx context.Context, hard bool, scope func(*gorm.DB) *gorm.DB) (Progress, error) {
+	sch, err := d.schema()
+	if err != nil {
+		return Progress{}, err
+	}
+	if len(sch.PrimaryFields) != 1 {
+		return Progress{}, fmt.Errorf("%s 必须只有一个主键才能分批删除", sch.Name)
+	}
+	pk := clause.Column{Table: clause.CurrentTable, Name: sch.PrimaryFields[0].DBName}
+
+	progress := Progress{Cursor: d.config.ResumeAfter}
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		tx := d.db.WithContext(ctx)
+		if hard {
+			tx = tx.Unscoped()
+		}
+		tx = scope(tx.Model(d.model))
+		if progress.Cursor != nil {
+			tx = tx.Where(clause.Gt{Column: pk, Value: progress.Cursor})
+		}
+
+		// 查询这一批的主键上界
+		ids := reflect.New(reflect.SliceOf(sch.PrimaryFields[0].FieldType))
+		if err := tx.Session(&gorm.Session{}).Order(clause.OrderByColumn{Column: pk}).Limit(d.config.BatchSize).Pluck(pk.Name, ids.Interface()).Error; err != nil {
+			return progress, err
+		}
+		if ids.Elem().Len() == 0 {
+			return progress, nil
+		}
+		upper := ids.Elem().Index(ids.Elem().Len() - 1).Interface()
+
+		result := tx.Session(&gorm.Session{}).Where(clause.Lte{Column: pk, Value: upper}).Delete(d.model)
+		if result.Error != nil {
+			return progress, result.Error
+		}
+		progress.Batch++
+		progress.Deleted = result.RowsAffected
+		progress.Total += result.RowsAffected
+		progress.Cursor = upper
+
+		if d.config.OnProgress != nil {
+			if err := d.config.OnProgress(progress); err != nil {
+				return progress, err
+			}
+		}
+		if ids.Elem().Len() < d.config.BatchSize {
+			return progress, nil
+		}
+		if err := sleep(ctx, d.config.Pause); err != nil {
+			return progress, err
+		}
+	}
+}
+
+// schema 解析模型
+func (d *Deleter) schema() (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: d.db}
+	if err := stmt.Parse(d.model); err != nil {
+		return nil, err
+	}
+	if reflect.Indirect(reflect.ValueOf(d.model)).Kind() != reflect.Struct {
+		return nil, errors.New("chunk: model 必须是结构体指针")
+	}
+	return stmt.Schema, nil
+}
+
+// sleep 暂停指定的时间, ctx 结束时提前返回
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
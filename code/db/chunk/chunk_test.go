@@ -0,0 +1,159 @@
+package chunk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm-learn/db/internal/dbtest"
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/gorm"
+)
+
+// testItem 测试使用的模型
+type testItem struct {
+	ID        uint
+	Name      string
+	DeletedAt softdelete.Milli
+}
+
+func (testItem) TableName() string {
+	return "chunk_test_items"
+}
+
+// setup 清空测试表, 创建 n 条名称为 old 的记录和一条名称为 keep 的记录
+func setup(t *testing.T, n int) (*gorm.DB, []testItem) {
+	t.Helper()
+	d := dbtest.Open(t)
+	dbtest.Migrate(t, d, &testItem{})
+	if err := d.Exec("DELETE FROM chunk_test_items").Error; err != nil {
+		t.Fatal(err)
+	}
+	items := make([]testItem, n, n+1)
+	for i := range items {
+		items[i].Name = "old"
+	}
+	items = append(items, testItem{Name: "keep"})
+	if err := d.Create(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	return d, items
+}
+
+// count 返回满足条件的记录数, unscoped 为 true 时包括已软删除的记录
+func count(t *testing.T, d *gorm.DB, unscoped bool, query string, args ...interface{}) int64 {
+	t.Helper()
+	var n int64
+	tx := d.Model(&testItem{})
+	if unscoped {
+		tx = tx.Unscoped()
+	}
+	if err := tx.Where(query, args...).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestDelete(t *testing.T) {
+	d, items := setup(t, 7)
+
+	var batches []Progress
+	deleter := New(d, &testItem{}, Config{BatchSize: 3, OnProgress: func(p Progress) error {
+		batches = append(batches, p)
+		return nil
+	}})
+	progress, err := deleter.Delete(context.Background(), "name = ?", "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Total != 7 || progress.Batch != 3 || len(batches) != 3 {
+		t.Fatalf("Progress = %+v, 回调了 %d 次", progress, len(batches))
+	}
+	if batches[0].Deleted != 3 || batches[0].Cursor != items[2].ID || batches[2].Deleted != 1 {
+		t.Errorf("每一批的进度为 %+v", batches)
+	}
+	// 默认执行软删除, 不满足条件的记录不受影响
+	if n := count(t, d, false, "name = ?", "old"); n != 0 {
+		t.Errorf("还有 %d 条记录没有删除", n)
+	}
+	if n := count(t, d, true, "name = ?", "old"); n != 7 {
+		t.Errorf("软删除之后表中有 %d 条记录", n)
+	}
+	if n := count(t, d, false, "name = ?", "keep"); n != 1 {
+		t.Error("不满足条件的记录被删除")
+	}
+}
+
+func TestResume(t *testing.T) {
+	d, items := setup(t, 5)
+	errStop := errors.New("stop")
+
+	// 第一批完成之后中断
+	deleter := New(d, &testItem{}, Config{BatchSize: 2, Hard: true, OnProgress: func(p Progress) error {
+		return errStop
+	}})
+	progress, err := deleter.Delete(context.Background(), "name = ?", "old")
+	if !errors.Is(err, errStop) || progress.Total != 2 || progress.Cursor != items[1].ID {
+		t.Fatalf("中断时 Progress = %+v, err = %v", progress, err)
+	}
+
+	// 从断点继续, 只处理主键大于 Cursor 的记录
+	var cursors []interface{}
+	resumed := New(d, &testItem{}, Config{BatchSize: 2, Hard: true, ResumeAfter: progress.Cursor, OnProgress: func(p Progress) error {
+		cursors = append(cursors, p.Cursor)
+		return nil
+	}})
+	progress, err = resumed.Delete(context.Background(), "name = ?", "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Total != 3 || len(cursors) != 2 || cursors[0] != items[3].ID || cursors[1] != items[4].ID {
+		t.Errorf("继续删除之后 Progress = %+v, 每一批的 Cursor 为 %v", progress, cursors)
+	}
+	if n := count(t, d, true, "name = ?", "old"); n != 0 {
+		t.Errorf("还有 %d 条记录没有被物理删除", n)
+	}
+}
+
+func TestPurgeSoftDeleted(t *testing.T) {
+	d, items := setup(t, 4)
+	if err := d.Delete(&testItem{}, []uint{items[0].ID, items[1].ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	if err := d.Delete(&items[2]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 只删除在 cutoff 之前被软删除的记录
+	progress, err := New(d, &testItem{}, Config{BatchSize: 1}).PurgeSoftDeleted(context.Background(), cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Total != 2 {
+		t.Errorf("Progress = %+v", progress)
+	}
+	if n := count(t, d, true, "id IN ?", []uint{items[0].ID, items[1].ID}); n != 0 {
+		t.Errorf("cutoff 之前删除的记录还有 %d 条", n)
+	}
+	if n := count(t, d, true, "1 = 1"); n != 3 {
+		t.Errorf("表中还有 %d 条记录, 应该为 3 条", n)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	d, _ := setup(t, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	deleter := New(d, &testItem{}, Config{BatchSize: 1, Pause: time.Hour, OnProgress: func(Progress) error {
+		cancel()
+		return nil
+	}})
+	progress, err := deleter.Delete(ctx, "name = ?", "old")
+	if !errors.Is(err, context.Canceled) || progress.Total != 1 {
+		t.Errorf("取消之后 Progress = %+v, err = %v", progress, err)
+	}
+}
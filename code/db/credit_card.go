@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"gorm-learn/db/encrypt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// normalizeCardNumber 去掉卡号中的空格与横线, 保证盲索引不受输入格式影响
+func normalizeCardNumber(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(number)
+}
+
+// cardNumberIndex 计算卡号的盲索引, 空卡号的索引为空
+func cardNumberIndex(ctx context.Context, number string) (string, error) {
+	number = normalizeCardNumber(number)
+	if number == "" {
+		return "", nil
+	}
+	return encrypt.BlindIndex(ctx, number)
+}
+
+// FindCreditCardByNumber 通过盲索引按卡号查询信用卡
+func FindCreditCardByNumber(tx *gorm.DB, number string) (*CreditCard, error) {
+	index, err := cardNumberIndex(tx.Statement.Context, number)
+	if err != nil {
+		return nil, err
+	}
+	card := new(CreditCard)
+	if err := tx.Where("number_index = ?", index).First(card).Error; err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// ReencryptCreditCards 使用当前密钥重新加密所有不是由当前密钥加密的卡号 (包括软删除的记录),
+// 加密功能上线前写入的明文卡号也会在这里被加密, 同时重新计算盲索引, 返回处理的记录数
+func ReencryptCreditCards(d *gorm.DB, batchSize int) (int64, error) {
+	ctx := d.Statement.Context
+	current, err := encrypt.CurrentKeyID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	type rawCard struct {
+		ID     uint
+		Number string
+	}
+	var (
+		rows    []rawCard
+		rotated int64
+		aad     = encrypt.FieldAAD("credit_cards", "number")
+	)
+	result := d.Table("credit_cards").Select("id", "number").Where("number IS NOT NULL").
+		FindInBatches(&rows, batchSize, func(tx *gorm.DB, batch int) error {
+			for _, row := range rows {
+				if encrypt.KeyID(row.Number) == current {
+					continue
+				}
+				plaintext, err := encrypt.Decrypt(ctx, row.Number, aad)
+				if err != nil {
+					return fmt.Errorf("解密信用卡 %d 失败: %w", row.ID, err)
+				}
+				ciphertext, err := encrypt.Encrypt(ctx, plaintext, aad)
+				if err != nil {
+					return err
+				}
+				index, err := cardNumberIndex(ctx, plaintext)
+				if err != nil {
+					return err
+				}
+				err = tx.Table("credit_cards").Where("id = ?", row.ID).UpdateColumns(map[string]interface{}{
+					"number":       ciphertext,
+					"number_index": index,
+				}).Error
+				if err != nil {
+					return fmt.Errorf("更新信用卡 %d 失败: %w", row.ID, err)
+				}
+				rotated++
+			}
+			return nil
+		})
+	return rotated, result.Error
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm-learn/db/encrypt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func TestCreditCardMapUpdate(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	user := User{Name: "card-owner"}
+	if err := d.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	card := CreditCard{Number: "4111 1111 1111 1111", UserID: user.ID}
+	if err := d.Create(&card).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 每次运行使用不同的卡号, 避免查询到之前创建的记录
+	number := fmt.Sprintf("5500 %04d %04d %04d", time.Now().Unix()%10000, time.Now().Nanosecond()/1e5%10000, card.ID%10000)
+	values := map[string]interface{}{"number": number}
+	if err := d.Model(&card).Updates(values).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := values["number"]; got != number {
+		t.Errorf("调用方的 map 被修改为 %v", got)
+	}
+	if card.Number != number {
+		t.Errorf("模型中的卡号 = %q, 应该为明文", card.Number)
+	}
+
+	var stored string
+	if err := d.Table("credit_cards").Where("id = ?", card.ID).Pluck("number", &stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !encrypt.IsEncrypted(stored) {
+		t.Fatalf("数据库中的卡号没有加密: %q", stored)
+	}
+	found, err := FindCreditCardByNumber(d.WithContext(ctx), strings.ReplaceAll(number, " ", "-"))
+	if err != nil {
+		t.Fatalf("按新卡号查询失败: %v", err)
+	}
+	if found.ID != card.ID || found.Number != number {
+		t.Errorf("FindCreditCardByNumber = %d %q", found.ID, found.Number)
+	}
+}
+
+func TestCreditCardMapUpdateValue(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	user := User{Name: "card-owner"}
+	if err := d.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	card := CreditCard{Number: "4111 1111 1111 1111", UserID: user.ID}
+	if err := d.Create(&card).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 无法加密的值返回错误, 而不是以明文写入
+	number := fmt.Sprintf("4000 %04d %04d %04d", time.Now().Unix()%10000, time.Now().Nanosecond()/1e5%10000, card.ID%10000)
+	for _, value := range []interface{}{&number, gorm.Expr("CONCAT(?, '')", number), nil} {
+		if err := d.Model(&card).Updates(map[string]interface{}{"number": value}).Error; err == nil {
+			t.Errorf("以 %T 更新卡号应该返回错误", value)
+		}
+	}
+
+	// 已经加密过的密文 (BeforeSave 替换后的值) 保持不变, 盲索引按明文计算
+	cipher, err := encrypt.Encrypt(ctx, number, encrypt.FieldAAD("credit_cards", "number"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Model(&card).Updates(map[string]interface{}{"Number": clause.Expr{SQL: "?", Vars: []interface{}{cipher}}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var stored CreditCard
+	if err := d.Table("credit_cards").Select("number", "number_index").Where("id = ?", card.ID).Scan(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Number != number {
+		t.Errorf("数据库中的卡号解密后为 %q", stored.Number)
+	}
+	found, err := FindCreditCardByNumber(d.WithContext(ctx), number)
+	if err != nil || found.ID != card.ID {
+		t.Errorf("按卡号查询返回 %d, %v", found.ID, err)
+	}
+}
@@ -2,6 +2,21 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm-learn/db/actor"
+	"gorm-learn/db/audit"
+	"gorm-learn/db/cascade"
+	"gorm-learn/db/encrypt"
+	"gorm-learn/db/event"
+	"gorm-learn/db/firewall"
+	"gorm-learn/db/optimistic"
+	"gorm-learn/db/outbox"
+	"gorm-learn/db/returning"
+	"gorm-learn/db/temporal"
+	"gorm-learn/db/txhook"
+	"gorm-learn/db/validate"
 	"log"
 	"sync"
 
@@ -12,13 +27,81 @@ import (
 var db *gorm.DB
 var initOnce sync.Once
 
+// DB 返回全局的数据库连接
+//
+// 信用卡号等加密字段使用的密钥从环境变量中读取, 参考 encrypt.FromEnv;
+// MySQL 不支持 RETURNING, 由 returning 插件在事务中模拟;
+// 所有语句都会经过 firewall 插件检查, 插件使用的 outbox、audit_logs 以及历史表在连接时自动迁移;
+// 创建与更新之前由 validate 插件按模型的 validate 标签校验;
+// 模型的变更通过 event 插件写入 outbox 表, 并在事务提交之后发布为领域事件, 参考 Subscribe;
+// 带有 optimistic.Version 字段的模型在更新时由 optimistic 插件检查版本冲突;
+// 声明了 cascade 标签的关联由 cascade 插件级联软删除、恢复与物理删除;
+// 每一次变更前后的值由 audit 插件写入 audit_logs 表, 操作者与请求 ID 通过 actor 包写入 ctx;
+// 嵌入了 AuditModel 的模型由 actor 插件根据 ctx 中的操作者填写 CreatedBy、UpdatedBy 与 DeletedBy;
+// 版本化的模型由 temporal 插件在更新与删除之前把当前版本复制到历史表
 func DB() *gorm.DB {
 	initOnce.Do(func() {
-		d, err := gorm.Open(mysql.Open("root:123456@tcp(127.0.0.1:3306)/gorm-learn?charset=utf8mb4&parseTime=True&loc=Local"))
+		if ring, err := encrypt.FromEnv(); err == nil {
+			encrypt.SetKeyProvider(ring)
+		} else if !errors.Is(err, encrypt.ErrNoKeys) {
+			log.Fatal("加载加密密钥失败: ", err)
+		}
+
+		d, err := open("root:123456@tcp(127.0.0.1:3306)/gorm-learn?charset=utf8mb4&parseTime=True&loc=Local")
 		if err != nil {
-			log.Fatal("failed to connect database")
+			log.Fatal(err)
 		}
 		db = d
 	})
 	return db
 }
+
+// open 连接 dsn 指定的数据库, 注册全部插件并迁移插件使用的表
+func open(dsn string) (*gorm.DB, error) {
+	d, err := gorm.Open(mysql.Open(dsn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect database: %w", err)
+	}
+	if err := d.Use(firewall.Plugin{}); err != nil {
+		return nil, fmt.Errorf("注册 firewall 插件失败: %w", err)
+	}
+	if err := d.Use(txhook.Plugin{}); err != nil {
+		return nil, fmt.Errorf("注册 txhook 插件失败: %w", err)
+	}
+	if err := d.Use(event.Plugin{Bus: events, Models: eventModels, Recorders: []event.Recorder{outbox.Record}}); err != nil {
+		return nil, fmt.Errorf("注册 event 插件失败: %w", err)
+	}
+	if err := d.Use(validate.Plugin{}); err != nil {
+		return nil, fmt.Errorf("注册 validate 插件失败: %w", err)
+	}
+	if err := d.Use(actor.Plugin{}); err != nil {
+		return nil, fmt.Errorf("注册 actor 插件失败: %w", err)
+	}
+	if err := d.Use(cascade.Plugin{}); err != nil {
+		return nil, fmt.Errorf("注册 cascade 插件失败: %w", err)
+	}
+	if err := d.Use(audit.Plugin{Models: auditModels}); err != nil {
+		return nil, fmt.Errorf("注册 audit 插件失败: %w", err)
+	}
+	if err := d.Use(temporal.Plugin{Models: versionedModels}); err != nil {
+		return nil, fmt.Errorf("注册 temporal 插件失败: %w", err)
+	}
+	if err := d.Use(optimistic.Plugin{}); err != nil {
+		return nil, fmt.Errorf("注册 optimistic 插件失败: %w", err)
+	}
+	if err := d.Use(returning.Plugin{}); err != nil {
+		return nil, fmt.Errorf("注册 returning 插件失败: %w", err)
+	}
+	if err := migratePlugins(d); err != nil {
+		return nil, fmt.Errorf("迁移插件使用的表失败: %w", err)
+	}
+	return d, nil
+}
+
+// Conn 返回绑定了 ctx 的数据库连接, ctx 携带了 WithTx 开启的事务时返回该事务
+func Conn(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return DB().WithContext(ctx)
+}
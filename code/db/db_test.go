@@ -0,0 +1,44 @@
+package db
+
+import (
+	"sync"
+	"testing"
+
+	"gorm-learn/db/internal/dbtest"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var migrateOnce sync.Once
+
+// testDB 使用测试数据库初始化全局连接, 并迁移练习使用的模型; 数据库不可用时跳过测试
+func testDB(tb testing.TB) *gorm.DB {
+	tb.Helper()
+	if err := dbtest.Available(); err != nil {
+		tb.Skipf("测试数据库不可用 (%s=%q): %v", dbtest.EnvDSN, dbtest.DSN(), err)
+	}
+	dbtest.Keys()
+	initOnce.Do(func() {
+		d, err := open(dbtest.DSN())
+		if err != nil {
+			tb.Fatal(err)
+		}
+		d.Logger = logger.Discard
+		db = d
+	})
+	var err error
+	migrateOnce.Do(func() {
+		// 已有的 products 表可能还在使用旧的删除时间列
+		if db.Migrator().HasTable(&Product{}) {
+			err = MigrateProductSoftDelete(db)
+		}
+		if err == nil {
+			err = Migrate(&User{}, &CreditCard{}, &Product{})
+		}
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,142 @@
+// 字段级加密
+//
+// 使用 AES-GCM 加密字段值, 密文中携带密钥 ID 以支持密钥轮换:
+//
+//	enc:v1:<密钥 ID>:<base64(nonce + 密文)>
+//
+// 同时提供基于 HMAC-SHA256 的盲索引, 用于对加密字段进行等值查询
+package encrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix 密文的固定前缀
+const prefix = "enc:v1:"
+
+// ErrMalformed 密文格式不正确
+var ErrMalformed = errors.New("密文格式不正确")
+
+// IsEncrypted 判断字符串是否为本包生成的密文
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// KeyID 返回密文所使用的密钥 ID, 不是密文时返回空字符串
+func KeyID(s string) string {
+	if !IsEncrypted(s) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(s, prefix), ":")
+	return id
+}
+
+// FieldAAD 返回字段的附加认证数据, 将密文与所在的表和列绑定, 防止密文被挪用到其它列
+func FieldAAD(table, column string) []byte {
+	return []byte(table + "." + column)
+}
+
+func newGCM(key Key) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key.Secret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// CurrentKeyID 返回当前用于加密的密钥 ID
+func CurrentKeyID(ctx context.Context) (string, error) {
+	p, err := currentProvider()
+	if err != nil {
+		return "", err
+	}
+	key, err := p.CurrentKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("获取当前密钥失败: %w", err)
+	}
+	return key.ID, nil
+}
+
+// Encrypt 使用当前密钥加密明文
+func Encrypt(ctx context.Context, plaintext string, aad []byte) (string, error) {
+	p, err := currentProvider()
+	if err != nil {
+		return "", err
+	}
+	key, err := p.CurrentKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("获取当前密钥失败: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), aad)
+	return prefix + key.ID + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密密文, 不是密文的字符串 (加密上线前写入的旧数据) 原样返回
+func Decrypt(ctx context.Context, s string, aad []byte) (string, error) {
+	if !IsEncrypted(s) {
+		return s, nil
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(s, prefix), ":")
+	if !ok {
+		return "", ErrMalformed
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	p, err := currentProvider()
+	if err != nil {
+		return "", err
+	}
+	key, err := p.Key(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", ErrMalformed
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+	if err != nil {
+		return "", fmt.Errorf("解密失败 (密钥 %s): %w", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex 计算值的盲索引 (HMAC-SHA256 的十六进制), 相同的值总是得到相同的索引
+func BlindIndex(ctx context.Context, value string) (string, error) {
+	p, err := currentProvider()
+	if err != nil {
+		return "", err
+	}
+	key, err := p.IndexKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("获取盲索引密钥失败: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
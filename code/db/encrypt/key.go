@@ -0,0 +1,149 @@
+package encrypt
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 读取密钥时使用的环境变量
+const (
+	// EnvKeys 全部数据密钥, 格式为 "k1:<base64>,k2:<base64>"
+	EnvKeys = "GORM_LEARN_ENCRYPTION_KEYS"
+	// EnvCurrentKey 当前用于加密的密钥 ID, 为空时使用 EnvKeys 中的最后一个
+	EnvCurrentKey = "GORM_LEARN_ENCRYPTION_CURRENT"
+	// EnvIndexKey 计算盲索引使用的密钥, base64 编码
+	EnvIndexKey = "GORM_LEARN_BLIND_INDEX_KEY"
+)
+
+var (
+	// ErrNoKeys 没有配置任何密钥
+	ErrNoKeys = errors.New("没有配置加密密钥")
+	// ErrKeyNotFound 找不到密文对应的密钥
+	ErrKeyNotFound = errors.New("找不到对应的密钥")
+)
+
+// Key 一把 AES 数据密钥, Secret 的长度必须为 16 / 24 / 32 字节
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// KeyProvider 密钥提供者, 可以对接 KMS 等外部系统
+type KeyProvider interface {
+	// CurrentKey 返回当前用于加密的密钥
+	CurrentKey(ctx context.Context) (Key, error)
+	// Key 根据 ID 返回密钥, 用于解密旧数据
+	Key(ctx context.Context, id string) (Key, error)
+	// IndexKey 返回计算盲索引使用的 HMAC 密钥
+	IndexKey(ctx context.Context) ([]byte, error)
+}
+
+// KeyRing 基于内存的密钥提供者
+type KeyRing struct {
+	current  string
+	keys     map[string]Key
+	indexKey []byte
+}
+
+// NewKeyRing 使用一组密钥构造 KeyRing, current 为当前用于加密的密钥 ID
+func NewKeyRing(current string, keys map[string][]byte, indexKey []byte) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	ring := &KeyRing{current: current, keys: make(map[string]Key, len(keys)), indexKey: indexKey}
+	for id, secret := range keys {
+		if id == "" || strings.ContainsAny(id, ":,") {
+			return nil, fmt.Errorf("不合法的密钥 ID: %q", id)
+		}
+		switch len(secret) {
+		case 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("密钥 %s 的长度必须为 16/24/32 字节, 实际为 %d", id, len(secret))
+		}
+		ring.keys[id] = Key{ID: id, Secret: secret}
+	}
+	if _, ok := ring.keys[current]; !ok {
+		return nil, fmt.Errorf("%w: 当前密钥 %q", ErrKeyNotFound, current)
+	}
+	if len(indexKey) < 16 {
+		return nil, errors.New("盲索引密钥至少需要 16 字节")
+	}
+	return ring, nil
+}
+
+// CurrentKey 实现 KeyProvider 接口
+func (r *KeyRing) CurrentKey(ctx context.Context) (Key, error) {
+	return r.keys[r.current], nil
+}
+
+// Key 实现 KeyProvider 接口
+func (r *KeyRing) Key(ctx context.Context, id string) (Key, error) {
+	key, ok := r.keys[id]
+	if !ok {
+		return Key{}, fmt.Errorf("%w: %q", ErrKeyNotFound, id)
+	}
+	return key, nil
+}
+
+// IndexKey 实现 KeyProvider 接口
+func (r *KeyRing) IndexKey(ctx context.Context) ([]byte, error) {
+	return r.indexKey, nil
+}
+
+// FromEnv 从环境变量中读取密钥, 没有配置时返回 ErrNoKeys
+func FromEnv() (*KeyRing, error) {
+	raw := strings.TrimSpace(os.Getenv(EnvKeys))
+	if raw == "" {
+		return nil, ErrNoKeys
+	}
+
+	keys := make(map[string][]byte)
+	current := ""
+	for _, item := range strings.Split(raw, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			return nil, fmt.Errorf("%s 的格式应为 id:base64, 实际为 %q", EnvKeys, item)
+		}
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("密钥 %s 不是合法的 base64: %w", id, err)
+		}
+		keys[id] = secret
+		current = id
+	}
+	if v := os.Getenv(EnvCurrentKey); v != "" {
+		current = v
+	}
+
+	indexKey, err := base64.StdEncoding.DecodeString(os.Getenv(EnvIndexKey))
+	if err != nil {
+		return nil, fmt.Errorf("%s 不是合法的 base64: %w", EnvIndexKey, err)
+	}
+	return NewKeyRing(current, keys, indexKey)
+}
+
+var (
+	providerMu sync.RWMutex
+	provider   KeyProvider
+)
+
+// SetKeyProvider 设置全局的密钥提供者
+func SetKeyProvider(p KeyProvider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	provider = p
+}
+
+func currentProvider() (KeyProvider, error) {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	if provider == nil {
+		return nil, fmt.Errorf("%w, 请先调用 encrypt.SetKeyProvider 或配置环境变量 %s", ErrNoKeys, EnvKeys)
+	}
+	return provider, nil
+}
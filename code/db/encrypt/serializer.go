@@ -0,0 +1,51 @@
+package encrypt
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// Serializer 加密序列化器, 通过 `gorm:"serializer:encrypted"` 标签使用, 只支持 string 类型的字段
+//
+// 注意: 每次加密都会使用随机的 nonce, 因此不能直接用加密字段作为查询条件, 需要配合盲索引列
+type Serializer struct{}
+
+// Scan 实现 schema.SerializerInterface 接口, 将数据库中的密文解密后写入字段
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var s string
+	switch v := dbValue.(type) {
+	case nil:
+		return field.Set(ctx, dst, "")
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("加密字段 %s 不支持的数据类型: %T", field.Name, dbValue)
+	}
+
+	plaintext, err := Decrypt(ctx, s, FieldAAD(field.Schema.Table, field.DBName))
+	if err != nil {
+		return fmt.Errorf("解密字段 %s 失败: %w", field.Name, err)
+	}
+	return field.Set(ctx, dst, plaintext)
+}
+
+// Value 实现 schema.SerializerValuerInterface 接口, 使用当前密钥加密字段值, 空字符串存储为 NULL
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	s, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("加密字段 %s 只支持 string 类型, 实际为 %T", field.Name, fieldValue)
+	}
+	if s == "" {
+		return nil, nil
+	}
+	return Encrypt(ctx, s, FieldAAD(field.Schema.Table, field.DBName))
+}
@@ -0,0 +1,120 @@
+// 由模型生命周期驱动的领域事件
+//
+// 插件在创建、更新与删除之后为注册的模型生成事件, 并通过 txhook 在事务提交之后发布到 Bus,
+// 事务回滚时事件会被丢弃, 订阅者不会看到没有生效的变更:
+//
+//	bus := event.NewBus()
+//	d.Use(txhook.Plugin{})
+//	d.Use(event.Plugin{Bus: bus, Models: []interface{}{&User{}}})
+//
+//	bus.Subscribe(func(ctx context.Context, e event.Event) {
+//		log.Println(e.Kind, e.Model, e.Changed)
+//	})
+//
+// 订阅者在提交事务的 goroutine 中同步执行, 耗时的处理应当自行异步执行;
+// 需要在同一个事务中持久化事件时 (例如 outbox), 使用 Plugin.Recorders
+package event
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Kind 事件类型
+type Kind string
+
+const (
+	// Created 创建了记录
+	Created Kind = "created"
+	// Updated 更新了记录, Event.Changed 为更新的字段
+	Updated Kind = "updated"
+	// SoftDeleted 软删除了记录
+	SoftDeleted Kind = "soft_deleted"
+	// Restored 恢复了软删除的记录, 即把删除时间更新为 NULL
+	Restored Kind = "restored"
+	// Deleted 永久删除了记录
+	Deleted Kind = "deleted"
+)
+
+// Event 领域事件
+type Event struct {
+	Kind Kind
+	// Model 模型名称, 例如 User
+	Model string
+	// Table 表名
+	Table string
+	// Type 模型的类型
+	Type reflect.Type
+	// Value 语句执行之后记录的副本, 类型为模型的指针;
+	// 以 map 创建或者按条件批量更新、删除时, 无法确定具体的记录, Value 为 nil
+	Value interface{}
+	// Changed 更新的字段名, 不包含自动更新的时间字段
+	Changed []string
+	// RowsAffected 语句影响的行数, 批量创建时每个事件都是整条语句的行数
+	RowsAffected int64
+	Time         time.Time
+}
+
+// Handler 事件的订阅者
+type Handler func(ctx context.Context, e Event)
+
+// Bus 进程内的事件总线
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[int]Handler
+	next     int
+}
+
+// NewBus 创建事件总线
+func NewBus() *Bus {
+	return &Bus{handlers: map[int]Handler{}}
+}
+
+// Subscribe 订阅全部事件, 返回取消订阅的函数
+func (b *Bus) Subscribe(h Handler) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.handlers[id] = h
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+// Publish 按订阅的顺序把事件依次发送给每个订阅者, 订阅者 panic 时只记录日志, 不影响其他订阅者
+func (b *Bus) Publish(ctx context.Context, events ...Event) {
+	b.mu.RLock()
+	ids := make([]int, 0, len(b.handlers))
+	for id := range b.handlers {
+		ids = append(ids, id)
+	}
+	handlers := make([]Handler, 0, len(ids))
+	slices.Sort(ids)
+	for _, id := range ids {
+		handlers = append(handlers, b.handlers[id])
+	}
+	b.mu.RUnlock()
+
+	for _, e := range events {
+		for _, h := range handlers {
+			deliver(ctx, h, e)
+		}
+	}
+}
+
+// deliver 把事件发送给一个订阅者
+func deliver(ctx context.Context, h Handler, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("event: 处理 %s %s 事件时 panic: %v", e.Model, e.Kind, r)
+		}
+	}()
+	h(ctx, e)
+}
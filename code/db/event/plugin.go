@@ -0,0 +1,314 @@
+package event
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"gorm-learn/db/internal/callbacks"
+	"gorm-learn/db/softdelete"
+	"gorm-learn/db/txhook"
+
+	"gorm.io/gorm"
+	gormcallbacks "gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+)
+
+// Plugin 在创建、更新与删除之后生成领域事件的 GORM 插件, 需要先注册 txhook.Plugin
+type Plugin struct {
+	// Bus 事件发布到这里
+	Bus *Bus
+	// Models 产生事件的模型, 其他模型 (例如任务进度表) 的变更不会产生事件
+	Models []interface{}
+	// Recorders 在语句所在的事务中记录事件, 例如写入 outbox 表; 返回错误时事务回滚
+	Recorders []Recorder
+}
+
+// Recorder 在语句所在的事务中记录事件, tx 为执行语句的连接
+type Recorder func(tx *gorm.DB, events []Event) error
+
+// Name 实现 gorm.Plugin 接口
+func (Plugin) Name() string {
+	return "gorm-learn:event"
+}
+
+// Initialize 实现 gorm.Plugin 接口
+func (p Plugin) Initialize(db *gorm.DB) error {
+	if p.Bus == nil {
+		return errors.New("event: 没有指定 Bus")
+	}
+	if _, ok := db.Plugins[txhook.Plugin{}.Name()]; !ok {
+		return errors.New("event: 需要先注册 txhook 插件")
+	}
+	e := &emitter{bus: p.Bus, models: map[reflect.Type]bool{}, recorders: p.Recorders}
+	for _, model := range p.Models {
+		t := reflect.TypeOf(model)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		e.models[t] = true
+	}
+
+	// 在模型的 After 钩子之后、提交事务之前生成事件
+	create := db.Callback().Create()
+	if err := create.After("gorm:after_create").Before("gorm:commit_or_rollback_transaction").Register("event:after_create", e.afterCreate); err != nil {
+		return err
+	}
+	update := db.Callback().Update()
+	if err := update.After("gorm:save_before_associations").Before("gorm:update").Register("event:before_update", e.beforeUpdate); err != nil {
+		return err
+	}
+	if err := update.After("gorm:after_update").Before("gorm:commit_or_rollback_transaction").Register("event:after_update", e.afterUpdate); err != nil {
+		return err
+	}
+	del := db.Callback().Delete()
+	return del.After("gorm:after_delete").Before("gorm:commit_or_rollback_transaction").Register("event:after_delete", e.afterDelete)
+}
+
+// setKey 标记 SET 子句是由 beforeUpdate 生成的
+const setKey = "event:set"
+
+// restoredKey 标记更新语句恢复了已删除的记录
+const restoredKey = "event:restored"
+
+// upsertKey 保存 WithUpsert 标记的结果
+const upsertKey = "event:upsert"
+
+// Upsert 一条 upsert 语句中各条记录的结果, 由执行 upsert 的代码通过 WithUpsert 提供
+type Upsert struct {
+	// Updated 与语句中的记录按顺序一一对应, 为 true 表示记录与已有的记录冲突
+	Updated []bool
+	// Changed 冲突时更新的字段名, 为空表示冲突的记录被忽略, 不生成事件
+	Changed []string
+}
+
+// WithUpsert 标记 tx 上的创建语句为 upsert, 与已有记录冲突的记录生成 Updated 事件;
+// 没有标记的 ON CONFLICT 语句无法区分插入与更新, 全部生成 Created 事件
+func WithUpsert(tx *gorm.DB, upsert Upsert) *gorm.DB {
+	return tx.Set(upsertKey, upsert)
+}
+
+// emitter 生成并发布事件
+type emitter struct {
+	bus       *Bus
+	models    map[reflect.Type]bool
+	recorders []Recorder
+}
+
+// enabled 判断语句是否需要生成事件, DryRun 以及没有影响任何行的语句不会生成事件
+func (e *emitter) enabled(db *gorm.DB) bool {
+	stmt := db.Statement
+	return db.Error == nil && !db.DryRun && stmt.Schema != nil && e.models[stmt.Schema.ModelType] && db.RowsAffected > 0
+}
+
+func (e *emitter) afterCreate(db *gorm.DB) {
+	if !e.enabled(db) {
+		return
+	}
+	var values []interface{}
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}, *map[string]interface{}:
+		values = []interface{}{nil}
+	case []map[string]interface{}:
+		values = make([]interface{}, len(dest))
+	case *[]map[string]interface{}:
+		values = make([]interface{}, len(*dest))
+	default:
+		values = records(db, false)
+	}
+	upsert, _ := db.Get(upsertKey)
+	u, _ := upsert.(Upsert)
+	if len(u.Updated) != len(values) {
+		u = Upsert{}
+	}
+	events := make([]Event, 0, len(values))
+	for i, value := range values {
+		if u.Updated == nil || !u.Updated[i] {
+			events = append(events, e.newEvent(db, Created, value, nil))
+		} else if len(u.Changed) > 0 {
+			events = append(events, e.newEvent(db, Updated, value, u.Changed))
+		}
+	}
+	if len(events) > 0 {
+		e.publish(db, events)
+	}
+}
+
+// beforeUpdate 提前生成 SET 子句, 并判断语句是否恢复了已删除的记录
+//
+// gorm:update 在执行之后会删除自己生成的 SET 子句, 之后就无法知道更新了哪些字段,
+// 因此在它之前使用相同的逻辑生成, 执行之后再由 afterUpdate 删除
+func (e *emitter) beforeUpdate(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || db.DryRun || stmt.Schema == nil || !e.models[stmt.Schema.ModelType] || stmt.SQL.Len() > 0 {
+		return
+	}
+	if _, ok := stmt.Clauses["SET"]; !ok {
+		if set := gormcallbacks.ConvertToAssignments(stmt); len(set) > 0 {
+			stmt.AddClause(set)
+			db.InstanceSet(setKey, true)
+		}
+	}
+	if restoring(stmt) && trashed(db) {
+		db.InstanceSet(restoredKey, true)
+	}
+}
+
+func (e *emitter) afterUpdate(db *gorm.DB) {
+	kind, changed := Updated, changedFields(db.Statement)
+	if _, ok := db.InstanceGet(restoredKey); ok {
+		kind = Restored
+	}
+	if _, ok := db.InstanceGet(setKey); ok {
+		delete(db.Statement.Clauses, "SET")
+	}
+	if !e.enabled(db) {
+		return
+	}
+	e.publish(db, e.events(db, kind, changed))
+}
+
+func (e *emitter) afterDelete(db *gorm.DB) {
+	if !e.enabled(db) {
+		return
+	}
+	// 软删除由 DELETE 回调生成 UPDATE 语句
+	kind := Deleted
+	if strings.HasPrefix(strings.TrimSpace(db.Statement.SQL.String()), "UPDATE") {
+		kind = SoftDeleted
+	}
+	e.publish(db, e.events(db, kind, nil))
+}
+
+// events 为语句影响的每条记录生成事件, 无法确定具体的记录时生成一个 Value 为 nil 的事件
+func (e *emitter) events(db *gorm.DB, kind Kind, changed []string) []Event {
+	values := records(db, true)
+	if len(values) == 0 {
+		values = []interface{}{nil}
+	}
+	events := make([]Event, 0, len(values))
+	for _, value := range values {
+		events = append(events, e.newEvent(db, kind, value, changed))
+	}
+	return events
+}
+
+func (e *emitter) newEvent(db *gorm.DB, kind Kind, value interface{}, changed []string) Event {
+	sch := db.Statement.Schema
+	return Event{
+		Kind:         kind,
+		Model:        sch.Name,
+		Table:        db.Statement.Table,
+		Type:         sch.ModelType,
+		Value:        value,
+		Changed:      changed,
+		RowsAffected: db.RowsAffected,
+		Time:         db.NowFunc(),
+	}
+}
+
+// publish 在事务中记录事件, 并在事务提交之后发布
+func (e *emitter) publish(db *gorm.DB, events []Event) {
+	for _, record := range e.recorders {
+		if db.AddError(record(db, events)) != nil {
+			return
+		}
+	}
+	ctx := db.Statement.Context
+	db.AddError(txhook.AfterCommit(db, func() {
+		e.bus.Publish(ctx, events...)
+	}))
+}
+
+// records 复制语句中的每条记录, requirePK 为 true 时跳过主键为零值的记录
+func records(db *gorm.DB, requirePK bool) []interface{} {
+	stmt := db.Statement
+	pk := stmt.Schema.PrioritizedPrimaryField
+	var values []interface{}
+	add := func(rv reflect.Value) {
+		rv = reflect.Indirect(rv)
+		if rv.Kind() != reflect.Struct || rv.Type() != stmt.Schema.ModelType {
+			return
+		}
+		if requirePK && pk != nil {
+			if _, zero := pk.ValueOf(stmt.Context, rv); zero {
+				return
+			}
+		}
+		cp := reflect.New(rv.Type())
+		cp.Elem().Set(rv)
+		values = append(values, cp.Interface())
+	}
+
+	rv := reflect.Indirect(stmt.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			add(rv.Index(i))
+		}
+	case reflect.Struct:
+		add(rv)
+	}
+	return values
+}
+
+// changedFields 返回 SET 子句中更新的字段名, 不包含自动更新的时间字段
+func changedFields(stmt *gorm.Statement) []string {
+	set, ok := stmt.Clauses["SET"].Expression.(clause.Set)
+	if !ok {
+		return nil
+	}
+	changed := make([]string, 0, len(set))
+	for _, assignment := range set {
+		field := stmt.Schema.LookUpField(assignment.Column.Name)
+		if field == nil {
+			changed = append(changed, assignment.Column.Name)
+			continue
+		}
+		if field.AutoUpdateTime > 0 {
+			continue
+		}
+		changed = append(changed, field.Name)
+	}
+	return changed
+}
+
+// restoring 判断更新语句是否可能恢复已删除的记录: 语句为 Unscoped, 并且把软删除字段更新为 NULL 或者 0
+//
+// 没有 Unscoped 的更新只会影响未删除的记录, Save 未删除的记录时同样会把软删除字段写为 0
+func restoring(stmt *gorm.Statement) bool {
+	if !stmt.Unscoped {
+		return false
+	}
+	set, _ := stmt.Clauses["SET"].Expression.(clause.Set)
+	for _, assignment := range set {
+		field := stmt.Schema.LookUpField(assignment.Column.Name)
+		if field == nil || !softdelete.IsField(field) {
+			continue
+		}
+		if assignment.Value == nil {
+			return true
+		}
+		if v := reflect.ValueOf(assignment.Value); (v.Kind() == reflect.Ptr && v.IsNil()) || v.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// trashed 在更新之前查询语句将要更新的记录中是否有已删除的记录
+func trashed(db *gorm.DB) bool {
+	stmt := db.Statement
+	conds := callbacks.Conditions(stmt)
+	if len(conds) == 0 && !stmt.AllowGlobalUpdate {
+		return false
+	}
+	field := softdelete.Field(stmt.Schema)
+	var count int64
+	err := db.Session(&gorm.Session{NewDB: true}).Unscoped().
+		Model(reflect.New(stmt.Schema.ModelType).Interface()).
+		Where(clause.And(conds...)).
+		Where(softdelete.Trashed(field, clause.Column{Table: clause.CurrentTable, Name: field.DBName})).
+		Count(&count).Error
+	return db.AddError(err) == nil && count > 0
+}
@@ -0,0 +1,61 @@
+package event
+
+import (
+	"testing"
+
+	"gorm-learn/db/internal/dbtest"
+	"gorm-learn/db/softdelete"
+	"gorm-learn/db/txhook"
+
+	"gorm.io/gorm"
+)
+
+// eventItem 测试使用的软删除模型
+type eventItem struct {
+	ID        uint
+	Name      string
+	DeletedAt softdelete.Unix
+}
+
+func (eventItem) TableName() string {
+	return "event_test_items"
+}
+
+func TestUpdateKinds(t *testing.T) {
+	var kinds []Kind
+	record := func(_ *gorm.DB, events []Event) error {
+		for _, e := range events {
+			kinds = append(kinds, e.Kind)
+		}
+		return nil
+	}
+	d := dbtest.Open(t, txhook.Plugin{}, Plugin{Bus: NewBus(), Models: []interface{}{&eventItem{}}, Recorders: []Recorder{record}})
+	dbtest.Migrate(t, d, &eventItem{})
+
+	item := eventItem{Name: "item"}
+	steps := []struct {
+		name string
+		run  func() *gorm.DB
+		want Kind
+	}{
+		{"Create", func() *gorm.DB { return d.Create(&item) }, Created},
+		{"Save", func() *gorm.DB { item.Name = "saved"; return d.Save(&item) }, Updated},
+		{"Unscoped Save", func() *gorm.DB { item.Name = "unscoped"; return d.Unscoped().Save(&item) }, Updated},
+		{"Updates", func() *gorm.DB { return d.Model(&item).Updates(map[string]interface{}{"name": "updated"}) }, Updated},
+		{"Unscoped Updates", func() *gorm.DB {
+			return d.Unscoped().Model(&item).Updates(map[string]interface{}{"name": "live", "deleted_at": 0})
+		}, Updated},
+		{"Delete", func() *gorm.DB { return d.Delete(&item) }, SoftDeleted},
+		{"Restore", func() *gorm.DB { return softdelete.Restore(d, &eventItem{ID: item.ID}) }, Restored},
+		{"Updates after Restore", func() *gorm.DB { return d.Model(&item).Update("name", "restored") }, Updated},
+	}
+	for _, step := range steps {
+		kinds = nil
+		if err := step.run().Error; err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if len(kinds) != 1 || kinds[0] != step.want {
+			t.Errorf("%s: 事件为 %v, 应该为 %s", step.name, kinds, step.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"context"
+	"gorm-learn/db/event"
+	"reflect"
+)
+
+// events 全局数据库连接产生的领域事件, 只有 eventModels 中的模型会产生事件;
+// 事件同时在同一个事务中写入 outbox 表, 由 outbox.Dispatcher 投递到其他服务
+var events = event.NewBus()
+
+// eventModels 产生领域事件的模型
+var eventModels = []interface{}{&User{}, &CreditCard{}, &Product{}}
+
+// Subscribe 订阅全部领域事件, 事件在事务提交之后发布, 返回取消订阅的函数
+func Subscribe(h event.Handler) (unsubscribe func()) {
+	return events.Subscribe(h)
+}
+
+// On 订阅模型 T 的 kind 类型的事件, 返回取消订阅的函数
+//
+// value 为语句执行之后记录的副本, 无法确定具体的记录时 (例如按条件批量更新) 为 nil
+func On[T any](kind event.Kind, fn func(ctx context.Context, e event.Event, value *T)) (unsubscribe func()) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	return events.Subscribe(func(ctx context.Context, e event.Event) {
+		if e.Kind != kind || e.Type != t {
+			return
+		}
+		value, _ := e.Value.(*T)
+		fn(ctx, e, value)
+	})
+}
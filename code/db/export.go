@@ -0,0 +1,10 @@
+package db
+
+import "gorm-learn/db/export"
+
+// 注册可以通过 export 包以及 cmd/export 导出的模型
+func init() {
+	export.Register("users", &User{}, "CreditCard")
+	export.Register("products", &Product{})
+	export.Register("credit_cards", &CreditCard{})
+}
@@ -0,0 +1,292 @@
+// 流式导出
+//
+// 通过 Rows 逐行读取并使用 ScanRows 扫描到同一个模型实例中, 写出后立即复用,
+// 因此无论表有多大, 内存占用都是固定的:
+//
+//	export.Register("users", &db.User{}, "CreditCard")
+//	n, err := export.Export(ctx, d, os.Stdout, "users", export.Options{Format: export.CSV})
+//
+// 几何类型的字段使用 ST_AsText 读取, 注册时指定的一对一关联通过 LEFT JOIN 一并导出,
+// 列名为 "关联名.列名", 例如 credit_card.number.
+// 带有 mask 标签的字段默认输出脱敏后的结果, 只有经过 mask.WithUnmasked 授权的 ctx 才会输出明文
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"gorm-learn/db/mask"
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Format 导出格式
+type Format string
+
+const (
+	// CSV 第一行为列名
+	CSV Format = "csv"
+	// JSONL 每行一个 JSON 对象, 键的顺序与列的顺序一致
+	JSONL Format = "jsonl"
+	// SQL 每行一条 INSERT 语句, 只能导出模型本身的列
+	SQL Format = "sql"
+)
+
+// ErrNotRegistered 模型没有注册
+var ErrNotRegistered = errors.New("export: 模型没有注册")
+
+// Options 导出选项
+type Options struct {
+	// Format 导出格式, 默认为 CSV
+	Format Format
+	// Columns 导出的列, 默认为模型以及关联的全部列
+	Columns []string
+	// Where 过滤条件, 写法与 gorm.DB.Where 相同
+	Where interface{}
+	Args  []interface{}
+	// Limit 最多导出的记录数, 0 表示不限制
+	Limit int
+}
+
+// model 注册的模型
+type model struct {
+	value interface{}
+	joins []string
+}
+
+var (
+	registry   = map[string]model{}
+	registryMu sync.RWMutex
+)
+
+// Register 注册可以导出的模型, joins 为需要一并导出的一对一关联 (has one / belongs to)
+func Register(name string, value interface{}, joins ...string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = model{value: value, joins: joins}
+}
+
+// Models 返回全部已注册的模型名称
+func Models() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// column 导出的一列
+type column struct {
+	name  string
+	field *schema.Field
+	// rel 列所属的关联, 为 nil 时属于模型本身
+	rel *schema.Relationship
+}
+
+// Export 把已注册的模型 name 按 opts 导出到 w, 返回导出的记录数
+func Export(ctx context.Context, db *gorm.DB, w io.Writer, name string, opts Options) (int64, error) {
+	registryMu.RLock()
+	m, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrNotRegistered, name)
+	}
+	if opts.Format == "" {
+		opts.Format = CSV
+	}
+
+	tx := db.WithContext(ctx)
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(m.value); err != nil {
+		return 0, err
+	}
+	sch := stmt.Schema
+
+	rels := make([]*schema.Relationship, 0, len(m.joins))
+	for _, join := range m.joins {
+		rel, ok := sch.Relationships.Relations[join]
+		if !ok || (rel.Type != schema.HasOne && rel.Type != schema.BelongsTo) {
+			return 0, fmt.Errorf("export: %s 不是 %s 的一对一关联", join, sch.Name)
+		}
+		rels = append(rels, rel)
+	}
+	columns, err := selectColumns(tx, sch, rels, opts)
+	if err != nil {
+		return 0, err
+	}
+	out, err := newWriter(opts.Format, w, tx, sch, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	// 只关联导出的列用到的表; 关联的主键总是一并查询, clearMissing 据此判断是否匹配到了关联记录
+	joined := rels[:0]
+	selected := slices.Clip(columns)
+	for _, rel := range rels {
+		if !slices.ContainsFunc(columns, func(c column) bool { return c.rel == rel }) {
+			continue
+		}
+		joined = append(joined, rel)
+		pk := rel.FieldSchema.PrioritizedPrimaryField
+		if pk != nil && !slices.ContainsFunc(columns, func(c column) bool { return c.rel == rel && c.field == pk }) {
+			selected = append(selected, column{field: pk, rel: rel})
+		}
+	}
+	query := tx.Model(m.value).Select(selectSQL(stmt, selected)).Order(clause.OrderBy{Columns: primaryOrder(sch)})
+	for _, rel := range joined {
+		query = query.Joins(joinSQL(stmt, rel))
+	}
+	if opts.Where != nil {
+		query = query.Where(opts.Where, opts.Args...)
+	}
+	if opts.Limit > 0 {
+		query = query.Limit(opts.Limit)
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	masked := !mask.Unmasked(ctx)
+	row := reflect.New(sch.ModelType)
+	var n int64
+	for rows.Next() {
+		row.Elem().SetZero()
+		if err := query.ScanRows(rows, row.Interface()); err != nil {
+			return n, err
+		}
+		original := row.Elem()
+		clearMissing(ctx, original, joined)
+		value := original
+		if masked {
+			value = reflect.ValueOf(mask.Struct(original.Interface()))
+		}
+		if err := out.write(ctx, original, value); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	return n, out.flush()
+}
+
+// selectColumns 根据 opts.Columns 选出导出的列
+func selectColumns(db *gorm.DB, sch *schema.Schema, rels []*schema.Relationship, opts Options) ([]column, error) {
+	var all []column
+	for _, field := range sch.Fields {
+		if field.DBName != "" && field.Readable {
+			all = append(all, column{name: field.DBName, field: field})
+		}
+	}
+	if opts.Format != SQL || len(opts.Columns) > 0 {
+		for _, rel := range rels {
+			prefix := db.NamingStrategy.ColumnName("", rel.Name) + "."
+			for _, field := range rel.FieldSchema.Fields {
+				if field.DBName != "" && field.Readable {
+					all = append(all, column{name: prefix + field.DBName, field: field, rel: rel})
+				}
+			}
+		}
+	}
+	if len(opts.Columns) == 0 {
+		return all, nil
+	}
+
+	columns := make([]column, 0, len(opts.Columns))
+	for _, name := range opts.Columns {
+		var found *column
+		for i := range all {
+			if all[i].name == name || (all[i].rel == nil && all[i].field.Name == name) {
+				found = &all[i]
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("export: %s 没有列 %s", sch.Name, name)
+		}
+		if opts.Format == SQL && found.rel != nil {
+			return nil, fmt.Errorf("export: SQL 格式不能导出关联的列 %s", name)
+		}
+		columns = append(columns, *found)
+	}
+	return columns, nil
+}
+
+// selectSQL 生成 SELECT 的列, 关联的列使用 ScanRows 能识别的 "关联名__列名" 作为别名
+func selectSQL(stmt *gorm.Statement, columns []column) string {
+	parts := make([]string, 0, len(columns))
+	for _, c := range columns {
+		table, alias := stmt.Table, c.field.DBName
+		if c.rel != nil {
+			table, alias = c.rel.Name, c.rel.Name+"__"+c.field.DBName
+		}
+		ref := stmt.Quote(table) + "." + stmt.Quote(c.field.DBName)
+		if c.field.DataType == "geometry" {
+			ref = "ST_AsText(" + ref + ")"
+		}
+		parts = append(parts, ref+" AS "+stmt.Quote(alias))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// joinSQL 生成关联的 LEFT JOIN, 关联表以关联名作为别名, 被软删除的关联记录不会被导出
+func joinSQL(stmt *gorm.Statement, rel *schema.Relationship) string {
+	alias := stmt.Quote(rel.Name)
+	conditions := make([]string, 0, len(rel.References)+1)
+	for _, ref := range rel.References {
+		if ref.PrimaryKey == nil {
+			continue
+		}
+		if ref.OwnPrimaryKey {
+			conditions = append(conditions, alias+"."+stmt.Quote(ref.ForeignKey.DBName)+" = "+stmt.Quote(stmt.Table)+"."+stmt.Quote(ref.PrimaryKey.DBName))
+		} else {
+			conditions = append(conditions, alias+"."+stmt.Quote(ref.PrimaryKey.DBName)+" = "+stmt.Quote(stmt.Table)+"."+stmt.Quote(ref.ForeignKey.DBName))
+		}
+	}
+	if field := softdelete.Field(rel.FieldSchema); field != nil {
+		cond := &gorm.Statement{DB: stmt.DB}
+		softdelete.Alive(field, clause.Column{Table: rel.Name, Name: field.DBName}).Build(cond)
+		conditions = append(conditions, cond.SQL.String())
+	}
+	return "LEFT JOIN " + stmt.Quote(rel.FieldSchema.Table) + " " + alias + " ON " + strings.Join(conditions, " AND ")
+}
+
+// clearMissing LEFT JOIN 没有匹配到关联记录时, ScanRows 仍然会创建关联对象, 这里把它们重置为零值
+func clearMissing(ctx context.Context, row reflect.Value, rels []*schema.Relationship) {
+	for _, rel := range rels {
+		pk := rel.FieldSchema.PrioritizedPrimaryField
+		value := rel.Field.ReflectValueOf(ctx, row)
+		target := reflect.Indirect(value)
+		if pk == nil || !target.IsValid() {
+			continue
+		}
+		if _, zero := pk.ValueOf(ctx, target); zero {
+			value.SetZero()
+		}
+	}
+}
+
+// primaryOrder 按主键排序, 保证导出的顺序稳定
+func primaryOrder(sch *schema.Schema) []clause.OrderByColumn {
+	columns := make([]clause.OrderByColumn, 0, len(sch.PrimaryFields))
+	for _, field := range sch.PrimaryFields {
+		columns = append(columns, clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}})
+	}
+	return columns
+}
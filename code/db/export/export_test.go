@@ -0,0 +1,149 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm-learn/db/internal/dbtest"
+	"gorm-learn/db/mask"
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/gorm"
+)
+
+// testOwner 测试使用的模型, 一对一关联 testProfile
+type testOwner struct {
+	ID        uint
+	Name      string
+	Email     string `mask:"email"`
+	DeletedAt softdelete.Unix
+	Profile   *testProfile `gorm:"foreignKey:OwnerID"`
+}
+
+type testProfile struct {
+	ID        uint
+	OwnerID   uint
+	City      string
+	DeletedAt softdelete.Unix
+}
+
+func (testOwner) TableName() string   { return "export_test_owners" }
+func (testProfile) TableName() string { return "export_test_profiles" }
+
+func init() {
+	Register("export_test_owners", &testOwner{}, "Profile")
+}
+
+// setup 清空测试表, 创建三个用户: alice 有资料, bob 的资料被软删除, carol 被软删除
+func setup(t *testing.T) *gorm.DB {
+	t.Helper()
+	d := dbtest.Open(t)
+	dbtest.Migrate(t, d, &testOwner{}, &testProfile{})
+	for _, table := range []string{"export_test_profiles", "export_test_owners"} {
+		if err := d.Exec("DELETE FROM " + table).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	owners := []testOwner{
+		{ID: 1, Name: "alice", Email: "alice@example.com", Profile: &testProfile{City: "Hangzhou"}},
+		{ID: 2, Name: "bob", Email: "bob@example.com", Profile: &testProfile{City: "Beijing"}},
+		{ID: 3, Name: "carol", Email: "carol@example.com"},
+	}
+	if err := d.Create(&owners).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete(owners[1].Profile).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete(&owners[2]).Error; err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// export 导出到字符串
+func export(t *testing.T, ctx context.Context, d *gorm.DB, opts Options) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := Export(ctx, d, &buf, "export_test_owners", opts); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestExport(t *testing.T) {
+	d := setup(t)
+	ctx := context.Background()
+	columns := []string{"id", "Name", "email", "profile.city"}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		opts Options
+		want string
+	}{
+		{
+			// 没有匹配到关联记录 (包括关联记录被软删除) 时关联的列为空, 被软删除的记录不会被导出
+			name: "csv",
+			ctx:  ctx,
+			opts: Options{Columns: columns},
+			want: "id,name,email,profile.city\n1,alice,a***@example.com,Hangzhou\n2,bob,b***@example.com,\n",
+		},
+		{
+			name: "unmasked",
+			ctx:  mask.WithUnmasked(ctx),
+			opts: Options{Columns: columns, Limit: 1},
+			want: "id,name,email,profile.city\n1,alice,alice@example.com,Hangzhou\n",
+		},
+		{
+			name: "jsonl",
+			ctx:  ctx,
+			opts: Options{Format: JSONL, Columns: columns, Where: "name = ?", Args: []interface{}{"bob"}},
+			want: `{"id":2,"name":"bob","email":"b***@example.com","profile.city":null}` + "\n",
+		},
+		{
+			// SQL 格式默认只导出模型本身的列
+			name: "sql",
+			ctx:  ctx,
+			opts: Options{Format: SQL, Limit: 1},
+			want: "INSERT INTO `export_test_owners` (`id`,`name`,`email`,`deleted_at`) VALUES (1,'alice','a***@example.com','0');\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := export(t, tt.ctx, d, tt.opts); got != tt.want {
+			t.Errorf("%s: 导出的内容为\n%s\n应该为\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	// 默认导出模型与关联的全部列
+	header, _, _ := strings.Cut(export(t, ctx, d, Options{}), "\n")
+	if header != "id,name,email,deleted_at,profile.id,profile.owner_id,profile.city,profile.deleted_at" {
+		t.Errorf("默认导出的列为 %s", header)
+	}
+}
+
+func TestExportError(t *testing.T) {
+	d := setup(t)
+	ctx := context.Background()
+	var buf bytes.Buffer
+	if _, err := Export(ctx, d, &buf, "missing", Options{}); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("没有注册的模型返回 %v", err)
+	}
+
+	tests := []Options{
+		{Columns: []string{"age"}},
+		{Format: SQL, Columns: []string{"profile.city"}},
+		{Format: "xml"},
+	}
+	for _, opts := range tests {
+		if _, err := Export(ctx, d, &buf, "export_test_owners", opts); err == nil {
+			t.Errorf("%+v 应该返回错误", opts)
+		}
+	}
+	if got := Models(); !strings.Contains(strings.Join(got, ","), "export_test_owners") {
+		t.Errorf("Models() = %v", got)
+	}
+}
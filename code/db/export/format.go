@@ -0,0 +1,182 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"database/sql/driver"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// writer 按格式写出每一行
+type writer interface {
+	// write 写出一行, original 为数据库中的值, value 为脱敏后的值
+	write(ctx context.Context, original, value reflect.Value) error
+	flush() error
+}
+
+func newWriter(format Format, w io.Writer, db *gorm.DB, sch *schema.Schema, columns []column) (writer, error) {
+	switch format {
+	case CSV:
+		cw := csv.NewWriter(w)
+		header := make([]string, 0, len(columns))
+		for _, c := range columns {
+			header = append(header, c.name)
+		}
+		if err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: cw, columns: columns}, nil
+	case JSONL:
+		return &jsonlWriter{w: bufio.NewWriter(w), columns: columns}, nil
+	case SQL:
+		return &sqlWriter{w: bufio.NewWriter(w), db: db, table: sch.Table, columns: columns}, nil
+	}
+	return nil, fmt.Errorf("export: 不支持的格式 %q", format)
+}
+
+// valueOf 返回一行中某一列的值, 关联不存在时返回 nil
+func valueOf(ctx context.Context, row reflect.Value, c column) interface{} {
+	if c.rel != nil {
+		row = reflect.Indirect(c.rel.Field.ReflectValueOf(ctx, row))
+		if !row.IsValid() {
+			return nil
+		}
+	}
+	v := c.field.ReflectValueOf(ctx, row)
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// csvWriter CSV 格式
+type csvWriter struct {
+	w       *csv.Writer
+	columns []column
+	record  []string
+}
+
+func (c *csvWriter) write(ctx context.Context, _, value reflect.Value) error {
+	c.record = c.record[:0]
+	for _, col := range c.columns {
+		text, err := formatText(valueOf(ctx, value, col))
+		if err != nil {
+			return fmt.Errorf("列 %s: %w", col.name, err)
+		}
+		c.record = append(c.record, text)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatText 把值转换为 CSV 中的文本, NULL 输出为空字符串
+func formatText(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case time.Time:
+		if v.IsZero() {
+			return "", nil
+		}
+		return v.Format(time.RFC3339Nano), nil
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		return string(text), err
+	case driver.Valuer:
+		value, err := v.Value()
+		if err != nil {
+			return "", err
+		}
+		return formatText(value)
+	case fmt.Stringer:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// jsonlWriter JSON Lines 格式
+type jsonlWriter struct {
+	w       *bufio.Writer
+	columns []column
+}
+
+func (j *jsonlWriter) write(ctx context.Context, _, value reflect.Value) error {
+	j.w.WriteByte('{')
+	for i, col := range j.columns {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(col.name)
+		j.w.Write(key)
+		j.w.WriteByte(':')
+		data, err := json.Marshal(valueOf(ctx, value, col))
+		if err != nil {
+			return fmt.Errorf("列 %s: %w", col.name, err)
+		}
+		j.w.Write(data)
+	}
+	j.w.WriteString("}\n")
+	return nil
+}
+
+func (j *jsonlWriter) flush() error {
+	return j.w.Flush()
+}
+
+// sqlWriter INSERT 语句格式, 使用序列化器的字段输出数据库中存储的值 (例如密文), 不受脱敏影响
+type sqlWriter struct {
+	w       *bufio.Writer
+	db      *gorm.DB
+	table   string
+	columns []column
+}
+
+func (s *sqlWriter) write(ctx context.Context, original, value reflect.Value) error {
+	columns := make([]clause.Column, 0, len(s.columns))
+	values := make([]interface{}, 0, len(s.columns))
+	for _, col := range s.columns {
+		columns = append(columns, clause.Column{Name: col.field.DBName})
+		if col.field.Serializer != nil {
+			v, _ := col.field.ValueOf(ctx, original)
+			values = append(values, v)
+		} else {
+			values = append(values, valueOf(ctx, value, col))
+		}
+	}
+
+	stmt := &gorm.Statement{DB: s.db, Context: ctx, Clauses: map[string]clause.Clause{}}
+	stmt.AddClause(clause.Insert{Table: clause.Table{Name: s.table}})
+	stmt.AddClause(clause.Values{Columns: columns, Values: [][]interface{}{values}})
+	stmt.Build("INSERT", "VALUES")
+	if s.db.Error != nil {
+		return s.db.Error
+	}
+	s.w.WriteString(s.db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...))
+	s.w.WriteString(";\n")
+	return nil
+}
+
+func (s *sqlWriter) flush() error {
+	return s.w.Flush()
+}
@@ -0,0 +1,529 @@
+package firewall
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// tokenKind 词法单元的类型
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenParam
+	tokenSymbol
+)
+
+// token 词法单元, 占位符在分析前会被替换为对应的参数值
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// is 判断是否为指定的关键字或符号, 关键字不区分大小写
+func (t token) is(text string) bool {
+	return (t.kind == tokenWord || t.kind == tokenSymbol) && strings.EqualFold(t.text, text)
+}
+
+// ddlKeywords 属于 DDL 的语句
+var ddlKeywords = []string{"CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME"}
+
+// analyzer 分析语句需要的配置
+type analyzer struct {
+	mysql      bool
+	softDelete []string
+	migrating  bool
+}
+
+// analyze 分析语句, 返回违反的规则
+func analyze(query string, args []interface{}, a analyzer) []Violation {
+	var violations []Violation
+	statements := split(bind(a.tokenize(query), args))
+	if len(statements) > 1 {
+		violations = append(violations, Violation{Rule: MultiStatement, Reason: fmt.Sprintf("包含 %d 条语句", len(statements))})
+	}
+
+	for _, tokens := range statements {
+		verb := verbOf(tokens)
+		switch {
+		case isOneOf(verb, ddlKeywords...):
+			if !a.migrating {
+				violations = append(violations, Violation{Rule: DDL, Reason: strings.ToUpper(verb.text) + " 只能在迁移中执行"})
+			}
+		case verb.is("UPDATE") || verb.is("DELETE"):
+			where, ok := whereOf(tokens)
+			if !ok {
+				violations = append(violations, Violation{Rule: NoWhere, Reason: strings.ToUpper(verb.text) + " 没有 WHERE 条件"})
+				continue
+			}
+			if len(a.meaningful(where)) == 0 {
+				violations = append(violations, Violation{Rule: NoWhere, Reason: strings.ToUpper(verb.text) + " 只有软删除条件"})
+				continue
+			}
+			if a.tautology(where) {
+				violations = append(violations, Violation{Rule: Tautology, Reason: "WHERE 条件恒为真: " + join(where)})
+			}
+		}
+	}
+	return violations
+}
+
+// tokenize 把 SQL 拆分为词法单元, 忽略注释; MySQL 的可执行注释 /*! ... */ 中的内容会被当作 SQL
+func (a analyzer) tokenize(query string) []token {
+	var tokens []token
+	src := []rune(query)
+	inExecutable := false
+	for i := 0; i < len(src); {
+		c := src[i]
+		next := rune(0)
+		if i+1 < len(src) {
+			next = src[i+1]
+		}
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '-' && next == '-', c == '#' && a.mysql:
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && next == '*':
+			if a.mysql && i+2 < len(src) && src[i+2] == '!' {
+				inExecutable = true
+				for i += 3; i < len(src) && unicode.IsDigit(src[i]); i++ {
+				}
+				continue
+			}
+			for i += 2; i < len(src) && !(src[i] == '*' && i+1 < len(src) && src[i+1] == '/'); i++ {
+			}
+			i += 2
+		case c == '*' && next == '/' && inExecutable:
+			inExecutable = false
+			i += 2
+		case c == '\'' || c == '"' && a.mysql:
+			text, n := quoted(src[i:], a.mysql)
+			tokens = append(tokens, token{kind: tokenString, text: text})
+			i += n
+		case c == '"' || c == '`' || c == '[':
+			text, n := quoted(src[i:], false)
+			tokens = append(tokens, token{kind: tokenIdent, text: text})
+			i += n
+		case unicode.IsDigit(c) || c == '.' && unicode.IsDigit(next):
+			start := i
+			for i < len(src) && (unicode.IsDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(src[start:i])})
+		case c == '?':
+			tokens = append(tokens, token{kind: tokenParam, text: "?"})
+			i++
+		case (c == '$' && unicode.IsDigit(next)) || (c == '@' && isWordRune(next)):
+			start := i
+			for i++; i < len(src) && isWordRune(src[i]); i++ {
+			}
+			tokens = append(tokens, token{kind: tokenParam, text: string(src[start:i])})
+		case isWordRune(c):
+			start := i
+			for i < len(src) && isWordRune(src[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: string(src[start:i])})
+		default:
+			text := string(c)
+			if strings.Contains("<>!=", string(c)) && strings.Contains("<>=", string(next)) && next != 0 {
+				text += string(next)
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, text: text})
+			i += len([]rune(text))
+		}
+	}
+	return tokens
+}
+
+// quoted 读取引号包围的内容, 返回去掉引号的文本以及消耗的字符数; 连续两个引号表示引号本身
+func quoted(src []rune, backslash bool) (string, int) {
+	closing := src[0]
+	if closing == '[' {
+		closing = ']'
+	}
+	var text strings.Builder
+	for i := 1; i < len(src); i++ {
+		switch {
+		case backslash && src[i] == '\\' && i+1 < len(src):
+			i++
+			text.WriteRune(src[i])
+		case src[i] == closing && i+1 < len(src) && src[i+1] == closing:
+			i++
+			text.WriteRune(closing)
+		case src[i] == closing:
+			return text.String(), i + 1
+		default:
+			text.WriteRune(src[i])
+		}
+	}
+	return text.String(), len(src)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// bind 把占位符替换为参数值, 数字和字符串参数替换为字面量, 其他参数保持为占位符
+func bind(tokens []token, args []interface{}) []token {
+	seq := 0
+	for i, t := range tokens {
+		if t.kind != tokenParam {
+			continue
+		}
+		index := -1
+		switch {
+		case t.text == "?":
+			index = seq
+			seq++
+		case strings.HasPrefix(t.text, "$"):
+			n, _ := strconv.Atoi(t.text[1:])
+			index = n - 1
+		case strings.HasPrefix(strings.ToLower(t.text), "@p"):
+			n, _ := strconv.Atoi(t.text[2:])
+			index = n - 1
+		}
+		if index < 0 || index >= len(args) {
+			continue
+		}
+		if literal, ok := literalOf(args[index]); ok {
+			tokens[i] = literal
+		}
+	}
+	return tokens
+}
+
+// literalOf 把参数值转换为字面量
+func literalOf(v interface{}) (token, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return token{kind: tokenNumber, text: strconv.FormatInt(rv.Int(), 10)}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return token{kind: tokenNumber, text: strconv.FormatUint(rv.Uint(), 10)}, true
+	case reflect.Float32, reflect.Float64:
+		return token{kind: tokenNumber, text: strconv.FormatFloat(rv.Float(), 'g', -1, 64)}, true
+	case reflect.Bool:
+		if rv.Bool() {
+			return token{kind: tokenNumber, text: "1"}, true
+		}
+		return token{kind: tokenNumber, text: "0"}, true
+	case reflect.String:
+		return token{kind: tokenString, text: rv.String()}, true
+	}
+	return token{}, false
+}
+
+// split 按分号拆分为多条语句, 忽略空语句
+func split(tokens []token) [][]token {
+	var statements [][]token
+	start := 0
+	for i := 0; i <= len(tokens); i++ {
+		if i == len(tokens) || tokens[i].is(";") {
+			if i > start {
+				statements = append(statements, tokens[start:i])
+			}
+			start = i + 1
+		}
+	}
+	return statements
+}
+
+// verbOf 返回语句的类型, WITH 开头的语句返回 CTE 之后的主语句类型
+func verbOf(tokens []token) token {
+	if len(tokens) == 0 {
+		return token{}
+	}
+	if !tokens[0].is("WITH") {
+		return tokens[0]
+	}
+	depth := 0
+	for _, t := range tokens[1:] {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case depth == 0 && isOneOf(t, "SELECT", "INSERT", "UPDATE", "DELETE"):
+			return t
+		}
+	}
+	return tokens[0]
+}
+
+// whereOf 返回最外层的 WHERE 条件
+func whereOf(tokens []token) ([]token, bool) {
+	depth, start := 0, -1
+	for i, t := range tokens {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case depth > 0:
+		case start < 0 && t.is("WHERE"):
+			start = i + 1
+		case start >= 0 && isOneOf(t, "ORDER", "LIMIT", "RETURNING", "OUTPUT"):
+			return tokens[start:i], i > start
+		}
+	}
+	if start < 0 {
+		return nil, false
+	}
+	return tokens[start:], len(tokens) > start
+}
+
+// meaningful 去掉最外层 AND 中的软删除条件, 返回剩余的条件
+func (a analyzer) meaningful(where []token) [][]token {
+	var terms [][]token
+	for _, term := range splitTop(where, "AND") {
+		if !a.softDeleteTerm(term) {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// softDeleteTerm 判断是否为 "deleted_at IS NULL" 或者 "deleted_at = 0" 这样的软删除条件
+func (a analyzer) softDeleteTerm(term []token) bool {
+	term = unwrap(term)
+	n := len(term)
+	if n < 3 {
+		return false
+	}
+	isNull := term[n-2].is("IS") && term[n-1].is("NULL")
+	isZero := term[n-2].is("=") && ((term[n-1].kind == tokenNumber && term[n-1].text == "0") || term[n-1].is("FALSE"))
+	if !isNull && !isZero {
+		return false
+	}
+	column := term[:n-2]
+	if len(column) == 3 && column[1].is(".") {
+		column = column[2:]
+	}
+	if len(column) != 1 || (column[0].kind != tokenWord && column[0].kind != tokenIdent) {
+		return false
+	}
+	for _, name := range a.softDelete {
+		if strings.EqualFold(column[0].text, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// tautology 判断条件是否恒为真: OR 的任意一个分支恒为真, 或者 AND 的全部条件都恒为真 (软删除条件除外)
+func (a analyzer) tautology(expr []token) bool {
+	expr = unwrap(expr)
+	if branches := splitTop(expr, "OR"); len(branches) > 1 {
+		for _, branch := range branches {
+			if a.tautology(branch) {
+				return true
+			}
+		}
+		return false
+	}
+	if terms := splitTop(expr, "AND"); len(terms) > 1 {
+		found := false
+		for _, term := range terms {
+			switch {
+			case a.softDeleteTerm(term):
+			case a.tautology(term):
+				found = true
+			default:
+				return false
+			}
+		}
+		return found
+	}
+	return alwaysTrue(expr)
+}
+
+// alwaysTrue 判断单个条件是否恒为真, 只识别常见的写法:
+// 非零常量、TRUE、两个常量的比较、同一列与自身相等 (包括 users.id = users.id) 以及 LIKE '%'
+func alwaysTrue(term []token) bool {
+	if len(term) == 1 {
+		if term[0].is("TRUE") {
+			return true
+		}
+		if term[0].kind == tokenNumber {
+			f, err := strconv.ParseFloat(term[0].text, 64)
+			return err == nil && f != 0
+		}
+		return false
+	}
+	for i := 1; i < len(term)-1; i++ {
+		op := term[i]
+		if !op.is("LIKE") && !isOneOf(op, "=", "<>", "!=", "<", "<=", ">", ">=") {
+			continue
+		}
+		left, right := term[:i], term[i+1:]
+		if op.is("LIKE") {
+			return len(right) == 1 && right[0].kind == tokenString && right[0].text != "" && strings.Trim(right[0].text, "%") == ""
+		}
+		l, lok := columnOf(left)
+		r, rok := columnOf(right)
+		if lok && rok {
+			return sameColumn(l, r) && isOneOf(op, "=", "<=", ">=")
+		}
+		return len(left) == 1 && len(right) == 1 && compare(left[0], op.text, right[0])
+	}
+	return false
+}
+
+// columnOf 解析 col、tbl.col 或 db.tbl.col 形式的列, 返回各部分的名称
+func columnOf(tokens []token) ([]string, bool) {
+	if len(tokens)%2 == 0 {
+		return nil, false
+	}
+	parts := make([]string, 0, len(tokens)/2+1)
+	for i, t := range tokens {
+		if i%2 == 1 {
+			if !t.is(".") {
+				return nil, false
+			}
+			continue
+		}
+		if t.kind != tokenWord && t.kind != tokenIdent {
+			return nil, false
+		}
+		parts = append(parts, t.text)
+	}
+	return parts, true
+}
+
+// sameColumn 判断两个列是否相同; 一侧没有指定表名时只比较列名, 例如 users.id 与 id
+func sameColumn(left, right []string) bool {
+	if len(left) != len(right) && len(left) > 1 && len(right) > 1 {
+		left, right = left[len(left)-2:], right[len(right)-2:]
+	}
+	if len(left) == 1 || len(right) == 1 {
+		left, right = left[len(left)-1:], right[len(right)-1:]
+	}
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if !strings.EqualFold(left[i], right[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// compare 比较两个字面量, 无法比较时返回 false
+func compare(left token, op string, right token) bool {
+	var cmp int
+	switch {
+	case left.kind == tokenNumber && right.kind == tokenNumber:
+		l, err1 := strconv.ParseFloat(left.text, 64)
+		r, err2 := strconv.ParseFloat(right.text, 64)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case left.kind == tokenString && right.kind == tokenString:
+		cmp = strings.Compare(left.text, right.text)
+	default:
+		return false
+	}
+
+	switch op {
+	case "=":
+		return cmp == 0
+	case "<>", "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// splitTop 按最外层的关键字拆分条件, BETWEEN ... AND ... 中的 AND 不会被拆分
+func splitTop(expr []token, keyword string) [][]token {
+	var parts [][]token
+	depth, start, between := 0, 0, false
+	for i, t := range expr {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case depth > 0:
+		case t.is("BETWEEN"):
+			between = true
+		case t.is(keyword):
+			if keyword == "AND" && between {
+				between = false
+				continue
+			}
+			parts = append(parts, expr[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+// unwrap 去掉包围整个条件的括号
+func unwrap(expr []token) []token {
+	for len(expr) >= 2 && expr[0].is("(") && expr[len(expr)-1].is(")") {
+		depth := 0
+		for i, t := range expr {
+			if t.is("(") {
+				depth++
+			} else if t.is(")") {
+				depth--
+			}
+			if depth == 0 && i < len(expr)-1 {
+				return expr
+			}
+		}
+		expr = expr[1 : len(expr)-1]
+	}
+	return expr
+}
+
+func isOneOf(t token, keywords ...string) bool {
+	for _, keyword := range keywords {
+		if t.is(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// join 把条件还原为便于阅读的文本
+func join(tokens []token) string {
+	var text strings.Builder
+	for i, t := range tokens {
+		if i > 0 && !t.is(".") && !tokens[i-1].is(".") && !t.is(")") && !tokens[i-1].is("(") {
+			text.WriteByte(' ')
+		}
+		if t.kind == tokenString {
+			text.WriteString("'" + t.text + "'")
+		} else {
+			text.WriteString(t.text)
+		}
+	}
+	return text.String()
+}
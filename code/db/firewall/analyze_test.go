@@ -0,0 +1,116 @@
+package firewall
+
+import (
+	"reflect"
+	"testing"
+)
+
+// rulesOf 返回违反的规则, 按出现的顺序排列
+func rulesOf(violations []Violation) []Rule {
+	var rules []Rule
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestAnalyze(t *testing.T) {
+	mysql := analyzer{mysql: true, softDelete: DefaultSoftDeleteColumns}
+	tests := []struct {
+		name  string
+		query string
+		args  []interface{}
+		want  []Rule
+	}{
+		// NoWhere
+		{"DELETE 没有 WHERE", "DELETE FROM users", nil, []Rule{NoWhere}},
+		{"UPDATE 没有 WHERE", "UPDATE users SET age = 1", nil, []Rule{NoWhere}},
+		{"只有 ORDER BY 与 LIMIT", "DELETE FROM users ORDER BY id LIMIT 10", nil, []Rule{NoWhere}},
+		{"只有 deleted_at IS NULL", "UPDATE `users` SET `age`=? WHERE `users`.`deleted_at` IS NULL", []interface{}{1}, []Rule{NoWhere}},
+		{"只有 deleted_at = 0", "DELETE FROM products WHERE (deleted_at = 0)", nil, []Rule{NoWhere}},
+		{"只有 Flag 的 deleted = 0", "UPDATE items SET name = 'a' WHERE deleted = 0", nil, []Rule{NoWhere}},
+		{"只有 Flag 的 is_deleted = false", "UPDATE items SET name = 'a' WHERE `items`.`is_deleted` = ?", []interface{}{false}, []Rule{NoWhere}},
+		{"主键条件", "DELETE FROM users WHERE id = ?", []interface{}{1}, nil},
+		{"主键与软删除条件", "UPDATE `users` SET `age`=? WHERE `id` = ? AND `users`.`deleted_at` IS NULL", []interface{}{1, 2}, nil},
+		{"子查询中的 WHERE 不算", "DELETE FROM users WHERE id IN (SELECT user_id FROM orders WHERE 1 = 1)", nil, nil},
+		{"SELECT 不检查", "SELECT * FROM users", nil, nil},
+
+		// Tautology
+		{"1 = 1", "DELETE FROM users WHERE 1 = 1", nil, []Rule{Tautology}},
+		{"非零常量", "DELETE FROM users WHERE 1", nil, []Rule{Tautology}},
+		{"TRUE", "UPDATE users SET age = 1 WHERE true", nil, []Rule{Tautology}},
+		{"字符串相等", "DELETE FROM users WHERE 'a' = 'a'", nil, []Rule{Tautology}},
+		{"参数相等", "DELETE FROM users WHERE ? = ?", []interface{}{"x", "x"}, []Rule{Tautology}},
+		{"同一列", "DELETE FROM users WHERE id = id", nil, []Rule{Tautology}},
+		{"带表名的同一列", "DELETE FROM users WHERE users.id = users.id", nil, []Rule{Tautology}},
+		{"带引号与表名的同一列", "DELETE FROM users WHERE `users`.`id` >= `users`.`id`", nil, []Rule{Tautology}},
+		{"一侧带表名的同一列", "DELETE FROM users WHERE users.id = ID", nil, []Rule{Tautology}},
+		{"LIKE '%'", "DELETE FROM users WHERE name LIKE '%%'", nil, []Rule{Tautology}},
+		{"OR 的一个分支恒为真", "DELETE FROM users WHERE id = 1 OR (1 = 1)", nil, []Rule{Tautology}},
+		{"恒为真的条件与软删除条件", "UPDATE users SET age = 1 WHERE 1 = 1 AND deleted_at IS NULL", nil, []Rule{Tautology}},
+		{"不同表的列", "DELETE FROM users WHERE users.id = orders.user_id", nil, nil},
+		{"AND 中还有有效条件", "DELETE FROM users WHERE 1 = 1 AND id = 1", nil, nil},
+		{"常量不相等", "DELETE FROM users WHERE 1 = 2", nil, nil},
+		{"BETWEEN", "DELETE FROM users WHERE id BETWEEN 1 AND 10", nil, nil},
+		{"LIKE 前缀", "DELETE FROM users WHERE name LIKE 'a%'", nil, nil},
+
+		// DDL
+		{"DROP", "DROP TABLE users", nil, []Rule{DDL}},
+		{"小写的 create", "create table t (id int)", nil, []Rule{DDL}},
+		{"ALTER", "ALTER TABLE users ADD COLUMN x int", nil, []Rule{DDL}},
+		{"TRUNCATE", "TRUNCATE users", nil, []Rule{DDL}},
+
+		// MultiStatement
+		{"两条语句", "DELETE FROM users WHERE id = 1; DROP TABLE orders", nil, []Rule{MultiStatement, DDL}},
+		{"末尾的分号", "SELECT 1;", nil, nil},
+
+		// 注释
+		{"-- 注释中的 WHERE", "DELETE FROM users -- WHERE id = 1", nil, []Rule{NoWhere}},
+		{"# 注释中的 WHERE", "DELETE FROM users # WHERE id = 1", nil, []Rule{NoWhere}},
+		{"块注释中的 WHERE", "DELETE FROM users /* WHERE id = 1 */", nil, []Rule{NoWhere}},
+		{"块注释中的分号", "SELECT 1 /* ; DROP TABLE users */", nil, nil},
+		{"可执行注释", "DELETE FROM users /*!50000 WHERE 1 = 1 */", nil, []Rule{Tautology}},
+		{"可执行注释中的分号", "SELECT 1 /*! ; DROP TABLE users */", nil, []Rule{MultiStatement, DDL}},
+
+		// 字符串
+		{"字符串中的分号", "UPDATE users SET name = 'a; DROP TABLE users' WHERE id = 1", nil, nil},
+		{"字符串中的 WHERE", "UPDATE users SET name = 'WHERE id = 1'", nil, []Rule{NoWhere}},
+		{"连续两个引号", "UPDATE users SET name = 'it''s; x' WHERE id = 1", nil, nil},
+		{"反斜杠转义的引号", `UPDATE users SET name = 'a\'; DROP TABLE b' WHERE id = 1`, nil, nil},
+		{"双引号字符串", `UPDATE users SET name = "a; b" WHERE id = 1`, nil, nil},
+		{"字符串中的注释", "UPDATE users SET name = '-- x' WHERE id = 1", nil, nil},
+		{"参数中的分号", "UPDATE users SET name = ? WHERE id = ?", []interface{}{"; DROP TABLE users", 1}, nil},
+	}
+	for _, tt := range tests {
+		if got := rulesOf(analyze(tt.query, tt.args, mysql)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %s 违反了 %v, 应该为 %v", tt.name, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeMigrating(t *testing.T) {
+	a := analyzer{mysql: true, softDelete: DefaultSoftDeleteColumns, migrating: true}
+	if got := rulesOf(analyze("ALTER TABLE users ADD COLUMN x int; DROP TABLE b", nil, a)); !reflect.DeepEqual(got, []Rule{MultiStatement}) {
+		t.Errorf("迁移中违反了 %v", got)
+	}
+}
+
+func TestAnalyzePostgres(t *testing.T) {
+	a := analyzer{softDelete: DefaultSoftDeleteColumns}
+	tests := []struct {
+		query string
+		args  []interface{}
+		want  []Rule
+	}{
+		// 双引号是标识符, # 不是注释
+		{`DELETE FROM users WHERE "users"."id" = "users"."id"`, nil, []Rule{Tautology}},
+		{`DELETE FROM users WHERE $1 = $2`, []interface{}{1, 1}, []Rule{Tautology}},
+		{`DELETE FROM users WHERE id = $1`, []interface{}{1}, nil},
+		{`UPDATE users SET name = 'a\' WHERE id = 1`, nil, nil},
+	}
+	for _, tt := range tests {
+		if got := rulesOf(analyze(tt.query, tt.args, a)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s 违反了 %v, 应该为 %v", tt.query, got, tt.want)
+		}
+	}
+}
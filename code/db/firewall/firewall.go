@@ -0,0 +1,258 @@
+// SQL 防火墙
+//
+// GORM 自带的全局更新/删除保护只检查回调生成的语句, 通过 Where("1 = 1")、Exec 或 Raw
+// 都可以轻易绕过. 防火墙插件替换了 *gorm.DB 的连接池, 在语句发送到数据库之前分析最终的 SQL,
+// 因此同样覆盖 Exec、Raw、Row 以及其他插件直接通过连接池执行的语句:
+//
+//	d.Use(firewall.Plugin{})
+//
+//	d.Exec("delete from users")                         // ErrApprovalRequired
+//	d.Where("1 = 1").Delete(&db.User{})                 // ErrApprovalRequired
+//	d.WithContext(firewall.Approve(ctx, firewall.NoWhere)).Exec("delete from users") // 放行并记录审计日志
+//
+// 每条规则可以配置为拦截、需要审批或者只记录审计日志, 参考 DefaultRules.
+//
+// 通过 Row 或 QueryRowContext 执行的语句被拦截时, Row.Scan 只能返回 context.Canceled,
+// 需要通过 errors.Is 判断 ErrBlocked、ErrApprovalRequired 时使用 Rows、Scan 或 Find
+package firewall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/gorm"
+)
+
+// Rule 防火墙规则
+type Rule string
+
+const (
+	// NoWhere UPDATE / DELETE 没有 WHERE 条件, 或者只有软删除条件
+	NoWhere Rule = "no_where"
+	// Tautology WHERE 条件恒为真, 例如 1 = 1、'a' = 'a'、id = id
+	Tautology Rule = "tautology"
+	// DDL 在迁移之外执行 CREATE / ALTER / DROP / TRUNCATE / RENAME
+	DDL Rule = "ddl"
+	// MultiStatement 一次执行多条以分号分隔的语句
+	MultiStatement Rule = "multi_statement"
+)
+
+// Action 违反规则时的处理方式
+type Action int
+
+const (
+	// Block 直接拦截, 无法审批
+	Block Action = iota
+	// RequireApproval 拦截, 除非 ctx 通过 Approve 批准了该规则
+	RequireApproval
+	// Audit 放行, 只记录审计日志
+	Audit
+)
+
+func (a Action) String() string {
+	switch a {
+	case Block:
+		return "block"
+	case RequireApproval:
+		return "require_approval"
+	case Audit:
+		return "audit"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// DefaultRules 默认的规则配置
+//
+// DDL 默认只记录审计日志, AutoMigrate 可以直接执行; 需要拦截时配置为 Block,
+// 并通过 Migrating 标记迁移使用的 ctx
+var DefaultRules = map[Rule]Action{
+	NoWhere:        RequireApproval,
+	Tautology:      RequireApproval,
+	DDL:            Audit,
+	MultiStatement: Block,
+}
+
+// DefaultSoftDeleteColumns 默认的软删除字段, 包括记录删除时间的 deleted_at 以及 softdelete.Flag 常用的列名
+var DefaultSoftDeleteColumns = []string{"deleted_at", "deleted", "is_deleted"}
+
+var (
+	// ErrBlocked 语句违反了配置为 Block 的规则
+	ErrBlocked = errors.New("firewall: 语句被拦截")
+	// ErrApprovalRequired 语句违反了配置为 RequireApproval 的规则, 并且没有被批准
+	ErrApprovalRequired = errors.New("firewall: 语句需要审批")
+)
+
+// Violation 语句违反的一条规则
+type Violation struct {
+	Rule   Rule
+	Action Action
+	// Reason 违反规则的原因
+	Reason string
+	// Approved 是否已经通过 Approve 批准
+	Approved bool
+}
+
+// Event 审计事件, 语句违反了至少一条规则时产生
+type Event struct {
+	Time time.Time
+	SQL  string
+	Vars []interface{}
+	// Violations 违反的全部规则
+	Violations []Violation
+	// Blocked 语句是否被拦截
+	Blocked bool
+}
+
+// Error 语句被拦截时返回的错误, 可以使用 errors.Is 判断是 ErrBlocked 还是 ErrApprovalRequired
+type Error struct {
+	// Violation 导致语句被拦截的规则
+	Violation
+	SQL string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v (%s: %s): %s", e.Unwrap(), e.Rule, e.Reason, e.SQL)
+}
+
+func (e *Error) Unwrap() error {
+	if e.Action == RequireApproval {
+		return ErrApprovalRequired
+	}
+	return ErrBlocked
+}
+
+// Config 防火墙配置
+type Config struct {
+	// Rules 启用的规则以及处理方式, 为 nil 时使用 DefaultRules, 不在其中的规则不会检查
+	Rules map[Rule]Action
+	// SoftDeleteColumns 软删除字段, "deleted_at IS NULL" 或者 "deleted = 0" 这样的条件不算有效的 WHERE 条件,
+	// 默认为 DefaultSoftDeleteColumns
+	SoftDeleteColumns []string
+	// Models 模型中的软删除字段 (gorm.DeletedAt 以及 softdelete 包中的类型) 同样加入 SoftDeleteColumns,
+	// 用于列名不在默认列表中的模型
+	Models []interface{}
+	// AuditLog 记录审计事件, 默认使用 log 包输出
+	AuditLog func(context.Context, Event)
+}
+
+// Plugin SQL 防火墙插件, 开启的事务以及其他插件执行的语句同样会被检查
+type Plugin struct {
+	Config Config
+}
+
+// Name 实现 gorm.Plugin 接口
+func (Plugin) Name() string {
+	return "gorm-learn:firewall"
+}
+
+// Initialize 实现 gorm.Plugin 接口, 使用防火墙包装连接池
+func (p Plugin) Initialize(db *gorm.DB) error {
+	config := p.Config
+	if config.Rules == nil {
+		config.Rules = DefaultRules
+	}
+	if len(config.SoftDeleteColumns) == 0 {
+		config.SoftDeleteColumns = DefaultSoftDeleteColumns
+	}
+	// 复制之后再追加, 不修改调用方或默认的列表
+	config.SoftDeleteColumns = append([]string(nil), config.SoftDeleteColumns...)
+	for _, model := range config.Models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		if field := softdelete.Field(stmt.Schema); field != nil {
+			config.SoftDeleteColumns = append(config.SoftDeleteColumns, field.DBName)
+		}
+	}
+	if config.AuditLog == nil {
+		dialector := db.Dialector
+		config.AuditLog = func(_ context.Context, e Event) {
+			rules := make([]string, 0, len(e.Violations))
+			for _, v := range e.Violations {
+				rules = append(rules, string(v.Rule))
+			}
+			outcome := "放行"
+			if e.Blocked {
+				outcome = "拦截"
+			}
+			log.Printf("firewall: %s [%s] %s", outcome, strings.Join(rules, ","), dialector.Explain(e.SQL, e.Vars...))
+		}
+	}
+
+	fw := &firewall{config: config, mysql: db.Dialector.Name() == "mysql"}
+	wrapped := &pool{conn{ConnPool: db.Config.ConnPool, fw: fw}}
+	db.Config.ConnPool = wrapped
+	db.Statement.ConnPool = wrapped
+	return nil
+}
+
+type approvedKey struct{}
+type migratingKey struct{}
+
+// Approve 返回批准了指定规则的 ctx, 只对配置为 RequireApproval 的规则生效
+func Approve(ctx context.Context, rules ...Rule) context.Context {
+	approved := make(map[Rule]bool, len(rules))
+	if parent, ok := ctx.Value(approvedKey{}).(map[Rule]bool); ok {
+		for rule := range parent {
+			approved[rule] = true
+		}
+	}
+	for _, rule := range rules {
+		approved[rule] = true
+	}
+	return context.WithValue(ctx, approvedKey{}, approved)
+}
+
+// Migrating 返回标记为正在迁移的 ctx, 迁移中允许执行 DDL
+func Migrating(ctx context.Context) context.Context {
+	return context.WithValue(ctx, migratingKey{}, true)
+}
+
+// firewall 对每条语句执行规则检查
+type firewall struct {
+	config Config
+	mysql  bool
+}
+
+// check 检查语句, 被拦截时返回 *Error
+func (f *firewall) check(ctx context.Context, query string, args []interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	migrating, _ := ctx.Value(migratingKey{}).(bool)
+	approved, _ := ctx.Value(approvedKey{}).(map[Rule]bool)
+
+	var blocked *Error
+	violations := analyze(query, args, analyzer{mysql: f.mysql, softDelete: f.config.SoftDeleteColumns, migrating: migrating})
+	event := Event{SQL: query, Vars: args}
+	for _, v := range violations {
+		action, ok := f.config.Rules[v.Rule]
+		if !ok {
+			continue
+		}
+		v.Action = action
+		v.Approved = action == RequireApproval && approved[v.Rule]
+		if blocked == nil && (action == Block || (action == RequireApproval && !v.Approved)) {
+			blocked = &Error{Violation: v, SQL: query}
+		}
+		event.Violations = append(event.Violations, v)
+	}
+	if len(event.Violations) == 0 {
+		return nil
+	}
+
+	event.Time = time.Now()
+	event.Blocked = blocked != nil
+	f.config.AuditLog(ctx, event)
+	if blocked != nil {
+		return blocked
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// archivedItem 软删除字段的列名不在默认列表中
+type archivedItem struct {
+	ID       uint
+	Archived softdelete.Flag
+}
+
+// open 注册防火墙插件, 不连接数据库
+func open(t *testing.T, config Config) (*gorm.DB, *firewall) {
+	t.Helper()
+	d, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:1)/none", SkipInitializeWithVersion: true}), &gorm.Config{Logger: logger.Discard, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Use(Plugin{Config: config}); err != nil {
+		t.Fatal(err)
+	}
+	return d, d.Config.ConnPool.(*pool).fw
+}
+
+func TestSoftDeleteColumns(t *testing.T) {
+	var events []Event
+	_, fw := open(t, Config{Models: []interface{}{&archivedItem{}}, AuditLog: func(_ context.Context, e Event) { events = append(events, e) }})
+
+	for _, query := range []string{
+		"UPDATE archived_items SET id = 1 WHERE archived = 0",
+		"DELETE FROM products WHERE deleted = 0",
+		"DELETE FROM users WHERE deleted_at IS NULL",
+	} {
+		if err := fw.check(context.Background(), query, nil); !errors.Is(err, ErrApprovalRequired) {
+			t.Errorf("%s: 只有软删除条件时返回 %v", query, err)
+		}
+	}
+	if len(events) != 3 {
+		t.Errorf("记录了 %d 条审计事件", len(events))
+	}
+	if len(DefaultSoftDeleteColumns) != 3 {
+		t.Errorf("DefaultSoftDeleteColumns 被修改为 %v", DefaultSoftDeleteColumns)
+	}
+
+	// 配置了 SoftDeleteColumns 时不再使用默认列表
+	_, fw = open(t, Config{SoftDeleteColumns: []string{"removed_at"}, AuditLog: func(context.Context, Event) {}})
+	if err := fw.check(context.Background(), "DELETE FROM users WHERE deleted_at IS NULL", nil); err != nil {
+		t.Errorf("deleted_at 不是软删除字段时返回 %v", err)
+	}
+}
+
+func TestApprove(t *testing.T) {
+	_, fw := open(t, Config{AuditLog: func(context.Context, Event) {}})
+	ctx := context.Background()
+	if err := fw.check(Approve(ctx, NoWhere), "DELETE FROM users", nil); err != nil {
+		t.Errorf("批准之后返回 %v", err)
+	}
+	if err := fw.check(Approve(ctx, Tautology), "DELETE FROM users", nil); !errors.Is(err, ErrApprovalRequired) {
+		t.Errorf("批准了其他规则时返回 %v", err)
+	}
+	// Block 的规则无法审批
+	var fwErr *Error
+	if err := fw.check(Approve(ctx, MultiStatement), "SELECT 1; SELECT 2", nil); !errors.Is(err, ErrBlocked) || !errors.As(err, &fwErr) || fwErr.Rule != MultiStatement {
+		t.Errorf("多条语句返回 %v", err)
+	}
+	// DDL 默认只记录审计日志
+	if err := fw.check(ctx, "DROP TABLE users", nil); err != nil {
+		t.Errorf("DDL 返回 %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package firewall
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// conn 在执行语句之前进行检查的连接
+type conn struct {
+	gorm.ConnPool
+	fw *firewall
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if err := c.fw.check(ctx, query, nil); err != nil {
+		return nil, err
+	}
+	return c.ConnPool.PrepareContext(ctx, query)
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if err := c.fw.check(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return c.ConnPool.ExecContext(ctx, query, args...)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if err := c.fw.check(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return c.ConnPool.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext 无法直接返回错误, 被拦截时使用已经取消的 ctx 执行,
+// Row.Scan 只能返回 context.Canceled, 具体原因只记录在审计日志中;
+// *sql.Row 无法携带其他错误, 需要判断拦截原因时使用 Rows、Scan 或 Find, 它们返回 *Error
+func (c *conn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if err := c.fw.check(ctx, query, args); err != nil {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		return c.ConnPool.QueryRowContext(canceled, query, args...)
+	}
+	return c.ConnPool.QueryRowContext(ctx, query, args...)
+}
+
+// pool 包装 *gorm.DB 的连接池, 开启的事务同样会被包装
+type pool struct {
+	conn
+}
+
+// BeginTx 实现 gorm.ConnPoolBeginner 接口
+func (p *pool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	var inner gorm.ConnPool
+	switch beginner := p.ConnPool.(type) {
+	case gorm.TxBeginner:
+		t, err := beginner.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		inner = t
+	case gorm.ConnPoolBeginner:
+		t, err := beginner.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		inner = t
+	default:
+		return nil, gorm.ErrInvalidTransaction
+	}
+
+	committer, ok := inner.(gorm.TxCommitter)
+	if !ok {
+		return nil, errors.New("firewall: 事务不支持提交")
+	}
+	return &tx{conn: conn{ConnPool: inner, fw: p.fw}, committer: committer}, nil
+}
+
+// GetDBConn 实现 gorm.GetDBConnector 接口, 使 *gorm.DB.DB() 可以返回底层的 *sql.DB
+func (p *pool) GetDBConn() (*sql.DB, error) {
+	switch inner := p.ConnPool.(type) {
+	case *sql.DB:
+		return inner, nil
+	case gorm.GetDBConnector:
+		return inner.GetDBConn()
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+// tx 包装事务, 实现 gorm.Tx 接口
+type tx struct {
+	conn
+	committer gorm.TxCommitter
+}
+
+func (t *tx) Commit() error {
+	return t.committer.Commit()
+}
+
+func (t *tx) Rollback() error {
+	return t.committer.Rollback()
+}
+
+func (t *tx) StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
+	if s, ok := t.ConnPool.(interface {
+		StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt
+	}); ok {
+		return s.StmtContext(ctx, stmt)
+	}
+	return stmt
+}
@@ -0,0 +1,136 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+// readCSV 逐行读取 CSV, 第一行为列名
+func readCSV(r io.Reader, columns func([]string) error, add func(record) error) error {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("importer: 读取列名失败: %w", err)
+	}
+	header = append([]string(nil), header...)
+	if err := columns(header); err != nil {
+		return err
+	}
+
+	for {
+		fields, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("importer: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		values := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(fields) {
+				values[name] = fields[i]
+			}
+		}
+		if err := add(record{line: line, values: values}); err != nil {
+			return err
+		}
+	}
+}
+
+// readJSONL 逐行读取 JSON Lines, 空行会被跳过, 列名取自第一行的键
+func readJSONL(r io.Reader, columns func([]string) error, add func(record) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line, known := 0, map[string]bool{}
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(data, &raw); err != nil {
+			if err := add(record{line: line, values: map[string]string{"": string(data)}, err: fmt.Errorf("JSON 格式错误: %w", err)}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// 出现新的键时重新匹配字段
+		var names []string
+		for name := range raw {
+			if !known[name] {
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			for name := range raw {
+				known[name] = true
+			}
+			all := make([]string, 0, len(known))
+			for name := range known {
+				all = append(all, name)
+			}
+			if err := columns(all); err != nil {
+				return fmt.Errorf("第 %d 行: %w", line, err)
+			}
+		}
+		if err := add(record{line: line, raw: raw}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// textUnmarshalerType encoding.TextUnmarshaler 的类型
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// setText 把文本转换为字段的值, 空字符串表示使用零值
+//
+// 实现了 encoding.TextUnmarshaler 的类型 (例如 types.Date、Location) 使用 UnmarshalText,
+// 其他类型交给 GORM 的 Field.Set 转换
+func setText(ctx context.Context, field *schema.Field, row reflect.Value, text string) error {
+	if text == "" {
+		return nil
+	}
+	if reflect.PointerTo(field.IndirectFieldType).Implements(textUnmarshalerType) {
+		value := reflect.New(field.IndirectFieldType)
+		if err := value.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+			return err
+		}
+		return field.Set(ctx, row, value.Interface())
+	}
+	if err := field.Set(ctx, row, text); err != nil {
+		return fmt.Errorf("无法转换为 %s: %q", field.FieldType, text)
+	}
+	return nil
+}
+
+// setJSON 把 JSON 值转换为字段的值, null 表示使用零值; 无法直接解析的 JSON 字符串按文本转换
+func setJSON(ctx context.Context, field *schema.Field, row reflect.Value, raw json.RawMessage) error {
+	if string(raw) == "null" {
+		return nil
+	}
+	value := reflect.New(field.IndirectFieldType)
+	err := json.Unmarshal(raw, value.Interface())
+	if err == nil {
+		return field.Set(ctx, row, value.Interface())
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return setText(ctx, field, row, text)
+	}
+	return fmt.Errorf("无法转换为 %s: %s", field.FieldType, raw)
+}
@@ -0,0 +1,326 @@
+// 从 CSV / JSON Lines 导入数据, 是 export 的逆过程
+//
+//	report, err := importer.Import[db.User](ctx, file, importer.Options[db.User]{
+//		Format:  importer.CSV,
+//		Mapping: map[string]string{"姓名": "Name"},
+//		Rejects: rejectsFile,
+//	})
+//
+// 每一行都会先转换为模型, 再按模型的 validate 标签以及 Options.Validate 校验,
+// 转换或校验失败的行写入 Rejects, 不会中断导入;
+// 合法的行按批写入数据库, 某一批写入失败时逐行重试, 找出具体失败的行
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"gorm-learn/db"
+	"gorm-learn/db/validate"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Format 文件格式
+type Format string
+
+const (
+	// CSV 第一行为列名
+	CSV Format = "csv"
+	// JSONL 每行一个 JSON 对象
+	JSONL Format = "jsonl"
+)
+
+// DefaultBatchSize 默认每批写入的记录数
+const DefaultBatchSize = 500
+
+// Options 导入选项
+type Options[T any] struct {
+	// Format 文件格式, 默认为 CSV
+	Format Format
+	// Mapping 列名到字段的映射, 字段可以是字段名或者列名, 映射为 "-" 的列会被忽略;
+	// 没有映射的列按同名的字段或列名匹配
+	Mapping map[string]string
+	// IgnoreUnknown 为 true 时忽略无法匹配到字段的列, 否则返回错误
+	IgnoreUnknown bool
+	// Validate 在 validate 标签声明的规则之外额外校验转换后的记录, 返回错误时该行被拒绝
+	Validate func(*T) error
+	// BatchSize 每批写入的记录数, 默认为 DefaultBatchSize
+	BatchSize int
+	// Conflict 不为 nil 时使用 db.Upsert 写入, 否则使用 CreateInBatches
+	Conflict *db.Conflict
+	// DryRun 为 true 时只转换和校验, 不写入数据库, 将要写入的记录以 JSON Lines 写入 DryRunOutput
+	DryRun       bool
+	DryRunOutput io.Writer
+	// Rejects 被拒绝的行以 JSON Lines 写入这里, 每行包含行号、原始数据以及失败原因
+	Rejects io.Writer
+}
+
+// Report 导入结果
+type Report struct {
+	// Read 读取的行数
+	Read int
+	// Inserted 新插入的记录数, DryRun 时为将要写入的记录数
+	Inserted int64
+	// Updated upsert 时更新的记录数
+	Updated int64
+	// Rejected 被拒绝的行数
+	Rejected int
+	// Batches 写入的批次数
+	Batches int
+}
+
+// Reject 被拒绝的一行
+type Reject struct {
+	Line   int               `json:"line"`
+	Record map[string]string `json:"record"`
+	Errors []string          `json:"errors"`
+}
+
+// record 读取到的一行
+type record struct {
+	line   int
+	values map[string]string
+	// raw JSON Lines 中的原始值, CSV 时为 nil
+	raw map[string]json.RawMessage
+	// err 这一行本身的格式错误
+	err error
+}
+
+// pending 等待写入的一行
+type pending[T any] struct {
+	record record
+	value  T
+}
+
+// Import 从 r 中读取数据并写入 T 对应的表
+//
+// 文件格式错误、列无法匹配或者写入被拒绝文件失败时返回错误, 单行的问题只会记录到 Rejects 中
+func Import[T any](ctx context.Context, r io.Reader, opts Options[T]) (*Report, error) {
+	if opts.Format == "" {
+		opts.Format = CSV
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	tx := db.Conn(ctx)
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	im := &importer[T]{ctx: ctx, tx: tx, sch: stmt.Schema, opts: opts, report: &Report{}}
+	if opts.Rejects != nil {
+		im.rejects = json.NewEncoder(opts.Rejects)
+	}
+	if opts.DryRun && opts.DryRunOutput != nil {
+		im.dryRun = json.NewEncoder(opts.DryRunOutput)
+	}
+
+	var err error
+	switch opts.Format {
+	case CSV:
+		err = readCSV(r, im.columns, im.add)
+	case JSONL:
+		err = readJSONL(r, im.columns, im.add)
+	default:
+		err = fmt.Errorf("importer: 不支持的格式 %q", opts.Format)
+	}
+	if err == nil {
+		err = im.flush()
+	}
+	return im.report, err
+}
+
+// importer 一次导入的状态
+type importer[T any] struct {
+	ctx     context.Context
+	tx      *gorm.DB
+	sch     *schema.Schema
+	opts    Options[T]
+	report  *Report
+	fields  []mapped
+	batch   []pending[T]
+	rejects *json.Encoder
+	dryRun  *json.Encoder
+}
+
+// mapped 与字段对应的一列
+type mapped struct {
+	name  string
+	field *schema.Field
+}
+
+// columns 根据列名确定每一列对应的字段
+func (im *importer[T]) columns(names []string) error {
+	im.fields = make([]mapped, 0, len(names))
+	var unknown []string
+	for _, name := range names {
+		target, isMapped := im.opts.Mapping[name]
+		if target == "-" {
+			continue
+		}
+		if !isMapped {
+			target = name
+		}
+		field := im.sch.LookUpField(target)
+		if field == nil || field.DBName == "" || !field.Creatable {
+			if isMapped || !im.opts.IgnoreUnknown {
+				unknown = append(unknown, name)
+			}
+			continue
+		}
+		im.fields = append(im.fields, mapped{name: name, field: field})
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("importer: %s 中没有与这些列对应的字段: %v", im.sch.Name, unknown)
+	}
+	return nil
+}
+
+// add 转换并校验一行, 合法的行加入当前批次
+func (im *importer[T]) add(rec record) error {
+	im.report.Read++
+	if rec.err != nil {
+		return im.reject(rec, rec.err.Error())
+	}
+	var value T
+	rv := reflect.ValueOf(&value).Elem()
+
+	var errs []string
+	for _, m := range im.fields {
+		var err error
+		if rec.raw != nil {
+			raw, ok := rec.raw[m.name]
+			if !ok {
+				continue
+			}
+			err = setJSON(im.ctx, m.field, rv, raw)
+		} else {
+			err = setText(im.ctx, m.field, rv, rec.values[m.name])
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", m.name, err))
+		}
+	}
+	if len(errs) == 0 {
+		if err := validate.Struct(im.ctx, &value); err != nil {
+			errs = append(errs, validationMessages(err)...)
+		}
+	}
+	if len(errs) == 0 && im.opts.Validate != nil {
+		if err := im.opts.Validate(&value); err != nil {
+			errs = append(errs, validationMessages(err)...)
+		}
+	}
+	if len(errs) > 0 {
+		return im.reject(rec, errs...)
+	}
+
+	im.batch = append(im.batch, pending[T]{record: rec, value: value})
+	if len(im.batch) >= im.opts.BatchSize {
+		return im.flush()
+	}
+	return nil
+}
+
+// validationMessages 把校验错误拆分为多条信息, 支持 errors.Join 合并的错误
+func validationMessages(err error) []string {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var messages []string
+		for _, e := range joined.Unwrap() {
+			messages = append(messages, validationMessages(e)...)
+		}
+		return messages
+	}
+	return []string{err.Error()}
+}
+
+// flush 写入当前批次, 整批失败时逐行重试
+func (im *importer[T]) flush() error {
+	if len(im.batch) == 0 {
+		return nil
+	}
+	batch := im.batch
+	im.batch = im.batch[:0:0]
+	im.report.Batches++
+
+	values := make([]T, 0, len(batch))
+	for _, p := range batch {
+		values = append(values, p.value)
+	}
+	if im.opts.DryRun {
+		im.report.Inserted += int64(len(values))
+		if im.dryRun != nil {
+			for _, v := range values {
+				if err := im.dryRun.Encode(v); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	err := im.write(values)
+	if err == nil {
+		return nil
+	}
+	if len(batch) == 1 {
+		return im.reject(batch[0].record, err.Error())
+	}
+	for _, p := range batch {
+		if err := im.write([]T{p.value}); err != nil {
+			if err := im.reject(p.record, err.Error()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// write 写入一批记录
+func (im *importer[T]) write(values []T) error {
+	if im.opts.Conflict != nil {
+		result, err := db.Upsert(im.ctx, &values, im.opts.Conflict)
+		if err != nil {
+			return err
+		}
+		im.report.Inserted += result.Inserted
+		im.report.Updated += result.Updated
+		return nil
+	}
+	result := im.tx.CreateInBatches(&values, len(values))
+	if result.Error != nil {
+		return result.Error
+	}
+	im.report.Inserted += result.RowsAffected
+	return nil
+}
+
+// reject 记录被拒绝的行
+func (im *importer[T]) reject(rec record, errs ...string) error {
+	im.report.Rejected++
+	if im.rejects == nil {
+		return nil
+	}
+	values := rec.values
+	if rec.raw != nil {
+		values = make(map[string]string, len(rec.raw))
+		for k, v := range rec.raw {
+			var text string
+			if json.Unmarshal(v, &text) != nil {
+				text = string(v)
+			}
+			values[k] = text
+		}
+	}
+	if err := im.rejects.Encode(Reject{Line: rec.line, Record: values, Errors: errs}); err != nil {
+		return errors.Join(errors.New("importer: 写入被拒绝的行失败"), err)
+	}
+	return nil
+}
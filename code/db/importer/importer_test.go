@@ -0,0 +1,189 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm-learn/db"
+	"gorm-learn/db/internal/dbtest"
+
+	"gorm.io/gorm"
+)
+
+// testItem 测试使用的模型
+type testItem struct {
+	ID   uint
+	Code string `gorm:"type:varchar(32);uniqueIndex" validate:"required"`
+	Name string `validate:"required,max=16"`
+	Age  int    `validate:"min=0"`
+}
+
+func (testItem) TableName() string {
+	return "importer_test_items"
+}
+
+// setup 清空测试表, 返回用于准备和检查数据的连接
+//
+// Import 通过 db.Conn 使用全局连接, 它总是连接本地数据库, 因此指定了其他测试数据库时跳过
+func setup(t *testing.T) *gorm.DB {
+	t.Helper()
+	if os.Getenv(dbtest.EnvDSN) != "" {
+		t.Skipf("Import 使用 db.DB 连接的本地数据库, 指定了 %s 时跳过", dbtest.EnvDSN)
+	}
+	d := dbtest.Open(t)
+	dbtest.Keys()
+	dbtest.Migrate(t, d, &testItem{})
+	if err := d.Exec("DELETE FROM importer_test_items").Error; err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// items 返回表中全部记录的 "code:name:age", 按主键排序
+func items(t *testing.T, d *gorm.DB) []string {
+	t.Helper()
+	var rows []testItem
+	if err := d.Order("id").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	result := make([]string, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, fmt.Sprintf("%s:%s:%d", row.Code, row.Name, row.Age))
+	}
+	return result
+}
+
+// rejects 解析被拒绝的行
+func rejects(t *testing.T, buf *bytes.Buffer) []Reject {
+	t.Helper()
+	var result []Reject
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var r Reject
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+func TestImportCSV(t *testing.T) {
+	d := setup(t)
+	input := strings.Join([]string{
+		"code,姓名,年龄,备注",
+		"A1,alice,18,",
+		"A2,bob,abc,年龄不是数字",
+		"A3,,-1,姓名为空且年龄为负数",
+		"A1,carol,20,与第一行重复",
+		"A4,dave,,",
+	}, "\n")
+
+	var rejected bytes.Buffer
+	report, err := Import(context.Background(), strings.NewReader(input), Options[testItem]{
+		Mapping:   map[string]string{"姓名": "Name", "年龄": "age", "备注": "-"},
+		BatchSize: 10,
+		Rejects:   &rejected,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *report != (Report{Read: 5, Inserted: 2, Rejected: 3, Batches: 1}) {
+		t.Errorf("Report = %+v", *report)
+	}
+	if got := items(t, d); !reflect.DeepEqual(got, []string{"A1:alice:18", "A4:dave:0"}) {
+		t.Errorf("表中的记录为 %v", got)
+	}
+
+	// 被拒绝的行带有行号、原始数据以及原因; 整批写入失败时逐行重试, 只拒绝违反唯一索引的一行
+	got := rejects(t, &rejected)
+	if len(got) != 3 {
+		t.Fatalf("被拒绝的行为 %+v", got)
+	}
+	if got[0].Line != 3 || got[0].Record["姓名"] != "bob" || len(got[0].Errors) != 1 || !strings.HasPrefix(got[0].Errors[0], "年龄: ") {
+		t.Errorf("转换失败的行为 %+v", got[0])
+	}
+	if got[1].Line != 4 || !reflect.DeepEqual(got[1].Errors, []string{"name 不能为空", "age 不能小于 0"}) {
+		t.Errorf("校验失败的行为 %+v", got[1])
+	}
+	if got[2].Line != 5 || !strings.Contains(got[2].Errors[0], "1062") {
+		t.Errorf("写入失败的行为 %+v", got[2])
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	d := setup(t)
+	input := `{"code":"D1","name":"alice","age":18}
+{"code":"D2","name":"bob","age":-1}
+not json
+{"code":"D3","name":"carol"}
+`
+	var output, rejected bytes.Buffer
+	report, err := Import(context.Background(), strings.NewReader(input), Options[testItem]{
+		Format:       JSONL,
+		BatchSize:    1,
+		DryRun:       true,
+		DryRunOutput: &output,
+		Rejects:      &rejected,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只转换与校验, 不写入数据库
+	if *report != (Report{Read: 4, Inserted: 2, Rejected: 2, Batches: 2}) {
+		t.Errorf("Report = %+v", *report)
+	}
+	if got := items(t, d); len(got) != 0 {
+		t.Errorf("DryRun 写入了 %v", got)
+	}
+	want := `{"ID":0,"Code":"D1","Name":"alice","Age":18}` + "\n" + `{"ID":0,"Code":"D3","Name":"carol","Age":0}` + "\n"
+	if output.String() != want {
+		t.Errorf("DryRunOutput 为\n%s", output.String())
+	}
+	got := rejects(t, &rejected)
+	if len(got) != 2 || got[0].Line != 2 || got[1].Line != 3 || got[1].Record[""] != "not json" {
+		t.Errorf("被拒绝的行为 %+v", got)
+	}
+}
+
+func TestImportUpsert(t *testing.T) {
+	d := setup(t)
+	if err := d.Create(&testItem{Code: "U1", Name: "old", Age: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	input := "code,name,age\nU1,alice,18\nU2,bob,20\n"
+	report, err := Import(context.Background(), strings.NewReader(input), Options[testItem]{
+		Conflict: db.OnConflict("code").Update("name", "age"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Inserted != 1 || report.Updated != 1 {
+		t.Errorf("Report = %+v", *report)
+	}
+	if got := items(t, d); !reflect.DeepEqual(got, []string{"U1:alice:18", "U2:bob:20"}) {
+		t.Errorf("表中的记录为 %v", got)
+	}
+}
+
+func TestImportColumns(t *testing.T) {
+	setup(t)
+	input := "code,name,email\nC1,alice,alice@example.com\n"
+	if _, err := Import(context.Background(), strings.NewReader(input), Options[testItem]{DryRun: true}); err == nil || !strings.Contains(err.Error(), "email") {
+		t.Errorf("无法匹配的列应该返回错误, 实际为 %v", err)
+	}
+	report, err := Import(context.Background(), strings.NewReader(input), Options[testItem]{DryRun: true, IgnoreUnknown: true})
+	if err != nil || report.Inserted != 1 {
+		t.Errorf("IgnoreUnknown: Report = %+v, err = %v", report, err)
+	}
+	// 映射到不存在的字段时总是返回错误
+	if _, err := Import(context.Background(), strings.NewReader(input), Options[testItem]{DryRun: true, IgnoreUnknown: true, Mapping: map[string]string{"email": "Email"}}); err == nil {
+		t.Error("映射到不存在的字段时应该返回错误")
+	}
+}
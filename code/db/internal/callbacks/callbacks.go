@@ -0,0 +1,70 @@
+// 插件之间共用的回调注册与语句处理
+package callbacks
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// RegisterBeforeUpdate 在 gorm:before_update 之后注册修改更新字段的回调
+//
+// 写入的字段需要在其他插件读取更新的字段之前完成, 因此注册了 event 插件时在它生成 SET 子句之前执行;
+// 同一个回调只能指定一个 Before, 后指定的会覆盖前面的, 所以按是否注册了 event 插件选择
+func RegisterBeforeUpdate(db *gorm.DB, name string, fn func(*gorm.DB)) error {
+	update := db.Callback().Update()
+	before := "gorm:update"
+	if update.Get("event:before_update") != nil {
+		before = "event:before_update"
+	}
+	return update.After("gorm:before_update").Before(before).Register(name, fn)
+}
+
+// WithValue 复制 m 并设置 key, 不修改调用方的 map
+func WithValue(m map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	cp := make(map[string]interface{}, len(m)+1)
+	for k, v := range m {
+		cp[k] = v
+	}
+	cp[key] = value
+	return cp
+}
+
+// Contains 判断 list 中是否包含 s
+func Contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Conditions 返回语句的 WHERE 条件以及记录的主键条件, 与 GORM 更新、删除时使用的条件相同
+//
+// 语句没有任何条件时返回空, 调用方需要按 AllowGlobalUpdate 判断是否处理全部记录
+func Conditions(stmt *gorm.Statement) []clause.Expression {
+	var conds []clause.Expression
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			conds = append(conds, clause.And(where.Exprs...))
+		}
+	}
+	values := []reflect.Value{stmt.ReflectValue}
+	if stmt.Model != nil && stmt.Model != stmt.Dest && !(stmt.ReflectValue.CanAddr() && stmt.ReflectValue.Addr().Interface() == stmt.Model) {
+		values = append(values, reflect.ValueOf(stmt.Model))
+	}
+	for _, rv := range values {
+		if !rv.IsValid() || reflect.Indirect(rv).Kind() == reflect.Map {
+			continue
+		}
+		_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, rv, stmt.Schema.PrimaryFields)
+		column, vs := schema.ToQueryValues(clause.CurrentTable, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		if len(vs) > 0 {
+			conds = append(conds, clause.IN{Column: column, Values: vs})
+		}
+	}
+	return conds
+}
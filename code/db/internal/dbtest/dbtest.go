@@ -0,0 +1,94 @@
+// 测试使用的数据库连接
+//
+// 测试连接 GORM_LEARN_TEST_DSN 指定的 MySQL, 没有指定时使用与 db.DB 相同的本地数据库;
+// 连接失败时跳过需要数据库的测试, 不影响其他测试
+package dbtest
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"gorm-learn/db/encrypt"
+	"gorm-learn/db/firewall"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// EnvDSN 测试数据库的 DSN
+const EnvDSN = "GORM_LEARN_TEST_DSN"
+
+// DSN 返回测试数据库的 DSN
+func DSN() string {
+	if dsn := os.Getenv(EnvDSN); dsn != "" {
+		return dsn
+	}
+	return "root:123456@tcp(127.0.0.1:3306)/gorm-learn?charset=utf8mb4&parseTime=True&loc=Local"
+}
+
+var (
+	keysOnce sync.Once
+	pingOnce sync.Once
+	pingErr  error
+)
+
+// Keys 设置测试使用的加密密钥, 已经通过环境变量配置时使用环境变量中的密钥
+func Keys() {
+	keysOnce.Do(func() {
+		if ring, err := encrypt.FromEnv(); err == nil {
+			encrypt.SetKeyProvider(ring)
+			return
+		}
+		ring, err := encrypt.NewKeyRing("test", map[string][]byte{"test": []byte("0123456789abcdef0123456789abcdef")}, []byte("blind-index-test-key"))
+		if err != nil {
+			panic(err)
+		}
+		encrypt.SetKeyProvider(ring)
+	})
+}
+
+// Available 判断测试数据库是否可以连接
+func Available() error {
+	pingOnce.Do(func() {
+		var d *gorm.DB
+		if d, pingErr = gorm.Open(mysql.Open(DSN()), &gorm.Config{Logger: logger.Discard}); pingErr == nil {
+			sqlDB, _ := d.DB()
+			pingErr = sqlDB.Ping()
+			sqlDB.Close()
+		}
+	})
+	return pingErr
+}
+
+// Open 打开测试数据库并注册 plugins, 数据库无法连接时跳过测试
+func Open(tb testing.TB, plugins ...gorm.Plugin) *gorm.DB {
+	tb.Helper()
+	if err := Available(); err != nil {
+		tb.Skipf("测试数据库不可用 (%s=%q): %v", EnvDSN, DSN(), err)
+	}
+	Keys()
+	d, err := gorm.Open(mysql.Open(DSN()), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, p := range plugins {
+		if err := d.Use(p); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if sqlDB, err := d.DB(); err == nil {
+		tb.Cleanup(func() { sqlDB.Close() })
+	}
+	return d
+}
+
+// Migrate 在测试数据库中迁移 models, 使用 firewall.Migrating 标记, 配置为拦截 DDL 时同样可以执行
+func Migrate(tb testing.TB, d *gorm.DB, models ...interface{}) {
+	tb.Helper()
+	if err := d.WithContext(firewall.Migrating(context.Background())).AutoMigrate(models...); err != nil {
+		tb.Fatal(err)
+	}
+}
@@ -0,0 +1,436 @@
+// 可恢复的批处理任务
+//
+// 基于 FindInBatches 按主键顺序分批读取模型, 每一批交给处理函数, 处理完成后把已经处理到的主键
+// 作为检查点保存在 batch_jobs 表中. 任务中断后使用同样的名称再次运行, 会从检查点继续:
+//
+//	db.Migrate(&job.BatchJob{})
+//	result, err := job.Run(ctx, d, job.Config{Name: "backfill-age"}, nil,
+//		func(ctx context.Context, tx *gorm.DB, users []db.User) error {
+//			return tx.Model(&db.User{}).Where("id IN ?", ids(users)).Update("age", 18).Error
+//		})
+//
+// 首次运行时会记录当前最大的主键作为上界, 运行期间新插入的记录不会被处理.
+// 并发处理时检查点只会推进到连续完成的批次, 因此中断后部分批次可能被重复处理, 处理函数需要是幂等的
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// 任务状态
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// 默认配置
+const (
+	DefaultBatchSize = 500
+	DefaultLease     = 5 * time.Minute
+)
+
+var (
+	// ErrLocked 同名任务正在其他进程中运行
+	ErrLocked = errors.New("job: 任务正在运行")
+	// ErrLeaseLost 运行期间任务的租约被其他进程抢占
+	ErrLeaseLost = errors.New("job: 任务租约已失效")
+)
+
+// errDryRun 试运行时用于回滚事务
+var errDryRun = errors.New("job: dry run")
+
+// BatchJob 保存在 batch_jobs 表中的任务检查点
+type BatchJob struct {
+	Name   string `gorm:"primaryKey;type:varchar(128)"`
+	Status string `gorm:"type:varchar(16)"`
+	// LastID 已经处理完成的最大主键
+	LastID uint64
+	// HighWater 首次运行时的最大主键, 只处理不超过该值的记录
+	HighWater uint64
+	Batches   int
+	Processed int64
+	Error     string `gorm:"type:text"`
+	// LockedBy 与 LockedUntil 组成租约, 防止同名任务同时运行
+	LockedBy    string `gorm:"type:varchar(32)"`
+	LockedUntil *time.Time
+	StartedAt   *time.Time
+	FinishedAt  *time.Time
+	UpdatedAt   time.Time
+}
+
+// Config 任务配置
+type Config struct {
+	// Name 任务名称, 同名任务共享检查点
+	Name string
+	// BatchSize 每批的记录数, 默认为 DefaultBatchSize
+	BatchSize int
+	// Concurrency 同时处理的批次数, 默认为 1
+	Concurrency int
+	// Transaction 为 true 时在事务中调用处理函数, 处理函数返回错误时回滚
+	Transaction bool
+	// DryRun 为 true 时在事务中调用处理函数并总是回滚, 不会保存检查点
+	DryRun bool
+	// Restart 为 true 时忽略已有的检查点, 从头开始
+	Restart bool
+	// Lease 租约时长, 每保存一次检查点续约一次, 默认为 DefaultLease
+	Lease time.Duration
+	// OnProgress 每次推进检查点后调用
+	OnProgress func(Progress)
+}
+
+// Progress 任务进度
+type Progress struct {
+	Batches   int
+	Processed int64
+	LastID    uint64
+	HighWater uint64
+}
+
+// Result 任务运行结果, 包含之前运行时已经完成的进度
+type Result struct {
+	Progress
+	// Resumed 是否从之前的检查点继续
+	Resumed bool
+	// AlreadyCompleted 任务之前已经完成, 本次没有处理任何记录
+	AlreadyCompleted bool
+}
+
+// Handler 处理一批记录, tx 在开启事务时为事务连接, 否则为普通连接
+type Handler[T any] func(ctx context.Context, tx *gorm.DB, batch []T) error
+
+// Run 运行任务, scope 用于过滤需要处理的记录, 可以为 nil
+func Run[T any](ctx context.Context, d *gorm.DB, config Config, scope func(*gorm.DB) *gorm.DB, handler Handler[T]) (Result, error) {
+	if config.Name == "" {
+		return Result{}, errors.New("job: 任务名称不能为空")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.Lease <= 0 {
+		config.Lease = DefaultLease
+	}
+
+	d = d.WithContext(ctx)
+	stmt := &gorm.Statement{DB: d}
+	if err := stmt.Parse(new(T)); err != nil {
+		return Result{}, err
+	}
+	if len(stmt.Schema.PrimaryFields) != 1 || !isInteger(stmt.Schema.PrimaryFields[0]) {
+		return Result{}, fmt.Errorf("job: %s 必须只有一个整数主键", stmt.Schema.Name)
+	}
+	pk := stmt.Schema.PrimaryFields[0]
+	query := d.Model(new(T))
+	if scope != nil {
+		query = scope(query)
+	}
+
+	r := &runner[T]{config: config, d: d, pk: pk, handler: handler}
+	job, err := r.start(query)
+	if err != nil || job.Status == StatusCompleted && !config.Restart {
+		return Result{Progress: progressOf(job), AlreadyCompleted: err == nil}, err
+	}
+	result := Result{Resumed: job.LastID > 0}
+	r.progress = progressOf(job)
+
+	err = r.run(ctx, query)
+	result.Progress = r.progress
+	if !config.DryRun {
+		if finishErr := r.finish(err); finishErr != nil {
+			err = errors.Join(err, finishErr)
+		}
+	}
+	return result, err
+}
+
+// runner 一次任务运行的状态
+type runner[T any] struct {
+	config   Config
+	d        *gorm.DB
+	pk       *schema.Field
+	handler  Handler[T]
+	owner    string
+	progress Progress
+}
+
+// start 读取检查点并获取租约, 试运行时只读取检查点
+func (r *runner[T]) start(query *gorm.DB) (BatchJob, error) {
+	var job BatchJob
+	jobs := r.d.Session(&gorm.Session{NewDB: true})
+	if r.config.DryRun {
+		err := jobs.Where("name = ?", r.config.Name).Limit(1).Find(&job).Error
+		if err == nil && (job.Name == "" || r.config.Restart) {
+			job = BatchJob{Name: r.config.Name, Status: StatusPending}
+		}
+		if err == nil && job.HighWater == 0 {
+			job.HighWater, err = r.highWater(query)
+		}
+		return job, err
+	}
+
+	if err := jobs.Clauses(clause.OnConflict{DoNothing: true}).Create(&BatchJob{Name: r.config.Name, Status: StatusPending}).Error; err != nil {
+		return job, err
+	}
+	if err := jobs.Where("name = ?", r.config.Name).First(&job).Error; err != nil {
+		return job, err
+	}
+	if job.Status == StatusCompleted && !r.config.Restart {
+		return job, nil
+	}
+
+	owner := make([]byte, 8)
+	rand.Read(owner)
+	r.owner = hex.EncodeToString(owner)
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":       StatusRunning,
+		"error":        "",
+		"locked_by":    r.owner,
+		"locked_until": now.Add(r.config.Lease),
+		"started_at":   now,
+		"finished_at":  nil,
+	}
+	if r.config.Restart {
+		updates["last_id"], updates["high_water"], updates["batches"], updates["processed"] = 0, 0, 0, 0
+	}
+	result := jobs.Model(&BatchJob{}).
+		Where("name = ? AND (locked_by = '' OR locked_by IS NULL OR locked_until < ?)", r.config.Name, now).
+		Updates(updates)
+	if result.Error != nil {
+		return job, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return job, fmt.Errorf("%w: %s", ErrLocked, r.config.Name)
+	}
+	job = BatchJob{}
+	if err := jobs.Where("name = ?", r.config.Name).First(&job).Error; err != nil {
+		return job, err
+	}
+
+	if job.HighWater == 0 {
+		highWater, err := r.highWater(query)
+		if err != nil {
+			return job, err
+		}
+		job.HighWater = highWater
+		if err := r.save(map[string]interface{}{"high_water": highWater}); err != nil {
+			return job, err
+		}
+	}
+	return job, nil
+}
+
+// highWater 查询当前最大的主键
+func (r *runner[T]) highWater(query *gorm.DB) (uint64, error) {
+	var max sql.NullInt64
+	err := query.Session(&gorm.Session{}).
+		Select("MAX(?)", clause.Column{Table: clause.CurrentTable, Name: r.pk.DBName}).
+		Row().Scan(&max)
+	return uint64(max.Int64), err
+}
+
+// task 交给 worker 处理的一批记录
+type task[T any] struct {
+	seq    int
+	batch  []T
+	lastID uint64
+}
+
+// done 一批记录的处理结果
+type done struct {
+	seq    int
+	lastID uint64
+	rows   int
+	err    error
+}
+
+// run 读取并分发批次, 按完成情况推进检查点
+func (r *runner[T]) run(ctx context.Context, query *gorm.DB) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tasks := make(chan task[T])
+	results := make(chan done)
+	workers := make(chan struct{}, r.config.Concurrency)
+	var fetchErr error
+	go func() {
+		defer close(tasks)
+		column := clause.Column{Table: clause.CurrentTable, Name: r.pk.DBName}
+		var rows []T
+		seq := 0
+		fetchErr = query.Session(&gorm.Session{}).
+			Where(clause.Gt{Column: column, Value: r.progress.LastID}).
+			Where(clause.Lte{Column: column, Value: r.progress.HighWater}).
+			FindInBatches(&rows, r.config.BatchSize, func(_ *gorm.DB, _ int) error {
+				last, _ := r.pk.ValueOf(ctx, reflect.ValueOf(rows[len(rows)-1]))
+				t := task[T]{seq: seq, batch: slices.Clone(rows), lastID: toUint64(last)}
+				seq++
+				select {
+				case tasks <- t:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}).Error
+	}()
+	go func() {
+		for t := range tasks {
+			workers <- struct{}{}
+			go func(t task[T]) {
+				defer func() { <-workers }()
+				results <- done{seq: t.seq, lastID: t.lastID, rows: len(t.batch), err: r.process(ctx, t.batch)}
+			}(t)
+		}
+		for i := 0; i < cap(workers); i++ {
+			workers <- struct{}{}
+		}
+		close(results)
+	}()
+
+	// 检查点只推进到连续完成的批次, 某一批失败后仍然会记录已经连续完成的进度
+	var firstErr, saveErr error
+	finished := map[int]done{}
+	next := 0
+	for res := range results {
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("第 %d 批 (主键 <= %d) 处理失败: %w", res.seq, res.lastID, res.err)
+				cancel()
+			}
+			continue
+		}
+		finished[res.seq] = res
+		advanced := false
+		for {
+			res, ok := finished[next]
+			if !ok {
+				break
+			}
+			delete(finished, next)
+			next++
+			r.progress.Batches++
+			r.progress.Processed += int64(res.rows)
+			r.progress.LastID = res.lastID
+			advanced = true
+		}
+		if advanced && saveErr == nil {
+			if saveErr = r.checkpoint(); saveErr != nil && firstErr == nil {
+				firstErr = saveErr
+				cancel()
+			}
+		}
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if fetchErr != nil {
+		return fetchErr
+	}
+	return ctx.Err()
+}
+
+// process 处理一批记录
+func (r *runner[T]) process(ctx context.Context, batch []T) error {
+	if !r.config.Transaction && !r.config.DryRun {
+		return r.handler(ctx, r.d.Session(&gorm.Session{NewDB: true, Context: ctx}), batch)
+	}
+	err := r.d.Session(&gorm.Session{NewDB: true, Context: ctx}).Transaction(func(tx *gorm.DB) error {
+		if err := r.handler(ctx, tx, batch); err != nil {
+			return err
+		}
+		if r.config.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
+
+// checkpoint 保存检查点并续约
+func (r *runner[T]) checkpoint() error {
+	if r.config.OnProgress != nil {
+		r.config.OnProgress(r.progress)
+	}
+	if r.config.DryRun {
+		return nil
+	}
+	return r.save(map[string]interface{}{
+		"last_id":      r.progress.LastID,
+		"batches":      r.progress.Batches,
+		"processed":    r.progress.Processed,
+		"locked_until": time.Now().Add(r.config.Lease),
+	})
+}
+
+// finish 记录任务的最终状态与进度并释放租约
+func (r *runner[T]) finish(err error) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"last_id":      r.progress.LastID,
+		"batches":      r.progress.Batches,
+		"processed":    r.progress.Processed,
+		"status":       StatusCompleted,
+		"locked_by":    "",
+		"locked_until": nil,
+		"finished_at":  now,
+	}
+	if err != nil {
+		updates["status"], updates["error"] = StatusFailed, err.Error()
+	}
+	return r.save(updates)
+}
+
+// save 在持有租约的前提下更新任务记录
+func (r *runner[T]) save(updates map[string]interface{}) error {
+	// 使用不受取消影响的 ctx, 保证失败时也能记录状态
+	result := r.d.Session(&gorm.Session{NewDB: true, Context: context.WithoutCancel(r.d.Statement.Context)}).
+		Model(&BatchJob{}).
+		Where("name = ? AND locked_by = ?", r.config.Name, r.owner).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrLeaseLost, r.config.Name)
+	}
+	return nil
+}
+
+func progressOf(job BatchJob) Progress {
+	return Progress{Batches: job.Batches, Processed: job.Processed, LastID: job.LastID, HighWater: job.HighWater}
+}
+
+func isInteger(field *schema.Field) bool {
+	return field.DataType == schema.Int || field.DataType == schema.Uint
+}
+
+func toUint64(v interface{}) uint64 {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint()
+	}
+	return 0
+}
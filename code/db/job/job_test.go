@@ -0,0 +1,232 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"gorm-learn/db/internal/dbtest"
+
+	"gorm.io/gorm"
+)
+
+// testItem 测试使用的模型
+type testItem struct {
+	ID   uint
+	Name string
+	Done bool
+}
+
+func (testItem) TableName() string {
+	return "job_test_items"
+}
+
+// setup 清空测试表与任务 name 的检查点, 创建 n 条记录
+func setup(t *testing.T, name string, n int) (*gorm.DB, []testItem) {
+	t.Helper()
+	d := dbtest.Open(t)
+	dbtest.Migrate(t, d, &testItem{}, &BatchJob{})
+	if err := d.Exec("DELETE FROM job_test_items").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Where("name = ?", name).Delete(&BatchJob{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	items := make([]testItem, n)
+	for i := range items {
+		items[i].Name = "item"
+	}
+	if err := d.Create(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	return d, items
+}
+
+// recorder 记录处理过的主键, 遇到 failAt 时返回错误
+type recorder struct {
+	mu     sync.Mutex
+	ids    []uint
+	failAt uint
+}
+
+var errFail = errors.New("fail")
+
+func (r *recorder) handle(ctx context.Context, tx *gorm.DB, batch []testItem) error {
+	ids := make([]uint, 0, len(batch))
+	for _, item := range batch {
+		if item.ID == r.failAt {
+			return errFail
+		}
+		ids = append(ids, item.ID)
+	}
+	if err := tx.Model(&testItem{}).Where("id IN ?", ids).Update("done", true).Error; err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.ids = append(r.ids, ids...)
+	r.mu.Unlock()
+	return nil
+}
+
+// load 读取任务的检查点
+func load(t *testing.T, d *gorm.DB, name string) BatchJob {
+	t.Helper()
+	var job BatchJob
+	if err := d.Where("name = ?", name).First(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func ids(items []testItem) []uint {
+	result := make([]uint, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.ID)
+	}
+	return result
+}
+
+func TestResume(t *testing.T) {
+	d, items := setup(t, "job-test-resume", 7)
+	ctx := context.Background()
+	config := Config{Name: "job-test-resume", BatchSize: 2}
+
+	// 第三批失败, 检查点停在第二批的最后一条记录
+	first := &recorder{failAt: items[4].ID}
+	result, err := Run(ctx, d, config, nil, first.handle)
+	if !errors.Is(err, errFail) {
+		t.Fatalf("第一次运行返回 %v", err)
+	}
+	if result.Resumed || result.Batches != 2 || result.Processed != 4 || result.LastID != uint64(items[3].ID) {
+		t.Errorf("第一次运行的结果为 %+v", result)
+	}
+	job := load(t, d, config.Name)
+	if job.Status != StatusFailed || job.LastID != uint64(items[3].ID) || job.Error == "" || job.LockedBy != "" {
+		t.Errorf("失败之后的检查点为 %+v", job)
+	}
+
+	// 运行期间新插入的记录超过了首次运行时的上界, 不会被处理
+	extra := testItem{Name: "extra"}
+	if err := d.Create(&extra).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 使用同样的名称再次运行, 从检查点继续
+	second := &recorder{}
+	result, err = Run(ctx, d, config, nil, second.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(second.ids, ids(items[4:])) {
+		t.Errorf("继续运行时处理了 %v, 应该为 %v", second.ids, ids(items[4:]))
+	}
+	if !result.Resumed || result.Batches != 4 || result.Processed != 7 || result.HighWater != uint64(items[6].ID) {
+		t.Errorf("继续运行的结果为 %+v", result)
+	}
+	job = load(t, d, config.Name)
+	if job.Status != StatusCompleted || job.Error != "" || job.FinishedAt == nil {
+		t.Errorf("完成之后的检查点为 %+v", job)
+	}
+	var n int64
+	if err := d.Model(&testItem{}).Where("done = ?", false).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("还有 %d 条记录没有处理, 应该只有新插入的一条", n)
+	}
+
+	// 已经完成的任务不会再处理
+	third := &recorder{}
+	result, err = Run(ctx, d, config, nil, third.handle)
+	if err != nil || !result.AlreadyCompleted || len(third.ids) != 0 {
+		t.Errorf("再次运行已完成的任务: %+v, 处理了 %v, err = %v", result, third.ids, err)
+	}
+
+	// Restart 从头开始, 并重新计算上界
+	restart := &recorder{}
+	config.Restart = true
+	result, err = Run(ctx, d, config, nil, restart.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restart.ids) != 8 || result.Resumed || result.Processed != 8 {
+		t.Errorf("重新运行的结果为 %+v, 处理了 %v", result, restart.ids)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	d, items := setup(t, "job-test-concurrency", 10)
+	r := &recorder{}
+	var progress []Progress
+	result, err := Run(context.Background(), d, Config{
+		Name:        "job-test-concurrency",
+		BatchSize:   3,
+		Concurrency: 3,
+		Transaction: true,
+		OnProgress:  func(p Progress) { progress = append(progress, p) },
+	}, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("id <> ?", items[0].ID)
+	}, r.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// scope 过滤掉的记录不会被处理, 每条记录只处理一次
+	if len(r.ids) != 9 || result.Batches != 3 || result.Processed != 9 {
+		t.Errorf("结果为 %+v, 处理了 %v", result, r.ids)
+	}
+	// 检查点只会增加
+	for i := 1; i < len(progress); i++ {
+		if progress[i].LastID <= progress[i-1].LastID {
+			t.Errorf("检查点没有递增: %+v", progress)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	d, _ := setup(t, "job-test-dry-run", 3)
+	r := &recorder{}
+	result, err := Run(context.Background(), d, Config{Name: "job-test-dry-run", DryRun: true}, nil, r.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.ids) != 3 || result.Processed != 3 {
+		t.Errorf("试运行的结果为 %+v", result)
+	}
+	// 处理函数的修改被回滚, 也不会保存检查点
+	var n int64
+	if err := d.Model(&testItem{}).Where("done = ?", true).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("试运行修改了 %d 条记录", n)
+	}
+	if err := d.Model(&BatchJob{}).Where("name = ?", "job-test-dry-run").Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Error("试运行保存了检查点")
+	}
+}
+
+func TestLocked(t *testing.T) {
+	d, _ := setup(t, "job-test-locked", 1)
+	config := Config{Name: "job-test-locked"}
+
+	// 运行期间同名任务无法获取租约
+	var lockErr error
+	_, err := Run(context.Background(), d, config, nil, func(ctx context.Context, tx *gorm.DB, batch []testItem) error {
+		_, lockErr = Run(ctx, d, config, nil, (&recorder{}).handle)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(lockErr, ErrLocked) {
+		t.Errorf("同名任务返回 %v", lockErr)
+	}
+	if _, err := Run(context.Background(), d, Config{}, nil, (&recorder{}).handle); err == nil {
+		t.Error("任务名称为空时应该返回错误")
+	}
+}
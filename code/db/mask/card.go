@@ -0,0 +1,99 @@
+package mask
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Brand 银行卡品牌
+type Brand string
+
+// 可识别的银行卡品牌
+const (
+	BrandUnknown    Brand = "Unknown"
+	BrandVisa       Brand = "Visa"
+	BrandMastercard Brand = "Mastercard"
+	BrandAmex       Brand = "American Express"
+	BrandUnionPay   Brand = "UnionPay"
+	BrandDiscover   Brand = "Discover"
+	BrandJCB        Brand = "JCB"
+	BrandDiners     Brand = "Diners Club"
+)
+
+// brandRule 根据卡号前缀与长度识别品牌的规则
+type brandRule struct {
+	brand Brand
+	// ranges 卡号前缀的闭区间, 两端的位数必须相同
+	ranges  [][2]int
+	lengths []int
+}
+
+// brandRules 按顺序匹配, 先匹配到的规则优先
+var brandRules = []brandRule{
+	{BrandAmex, [][2]int{{34, 34}, {37, 37}}, []int{15}},
+	{BrandDiners, [][2]int{{300, 305}, {36, 36}, {38, 39}}, []int{14, 16}},
+	{BrandJCB, [][2]int{{3528, 3589}}, []int{16, 17, 18, 19}},
+	{BrandVisa, [][2]int{{4, 4}}, []int{13, 16, 19}},
+	{BrandMastercard, [][2]int{{51, 55}, {2221, 2720}}, []int{16}},
+	{BrandDiscover, [][2]int{{6011, 6011}, {644, 649}, {65, 65}}, []int{16, 17, 18, 19}},
+	{BrandUnionPay, [][2]int{{62, 62}}, []int{16, 17, 18, 19}},
+}
+
+// cardDigits 去掉卡号中的空格与横线, 包含其他字符时返回 false
+func cardDigits(number string) (string, bool) {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(number)
+	if digits == "" {
+		return "", false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return "", false
+		}
+	}
+	return digits, true
+}
+
+// DetectBrand 根据卡号识别银行卡品牌, 无法识别时返回 BrandUnknown
+func DetectBrand(number string) Brand {
+	digits, ok := cardDigits(number)
+	if !ok {
+		return BrandUnknown
+	}
+	for _, rule := range brandRules {
+		if !slices.Contains(rule.lengths, len(digits)) {
+			continue
+		}
+		for _, r := range rule.ranges {
+			width := len(strconv.Itoa(r[0]))
+			if len(digits) < width {
+				continue
+			}
+			prefix, _ := strconv.Atoi(digits[:width])
+			if prefix >= r[0] && prefix <= r[1] {
+				return rule.brand
+			}
+		}
+	}
+	return BrandUnknown
+}
+
+// CardLast4 返回卡号的后四位, 卡号不合法时返回空字符串
+func CardLast4(number string) string {
+	digits, ok := cardDigits(number)
+	if !ok {
+		return ""
+	}
+	return Last4(digits)
+}
+
+// Card 对银行卡号脱敏, 只保留后四位, 例如 ************1111
+//
+// 不是合法卡号的内容 (例如尚未解密的密文) 会被完全隐藏
+func Card(number string) string {
+	digits, ok := cardDigits(number)
+	if !ok || len(digits) <= 4 {
+		return Full(number)
+	}
+	return Last4Masked(digits)
+}
@@ -0,0 +1,153 @@
+// 敏感字段脱敏
+//
+// 通过结构体标签声明字段的脱敏策略, 例如:
+//
+//	Number string `mask:"card"`
+//
+// String()、JSON 输出以及调试打印都应当使用脱敏后的副本,
+// 需要原始值的代码必须显式调用 WithUnmasked 获得授权
+package mask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// TagName 声明脱敏策略的结构体标签名
+const TagName = "mask"
+
+// 内置的脱敏策略
+const (
+	// StrategyCard 银行卡号, 只保留后四位
+	StrategyCard = "card"
+	// StrategyLast4 任意字符串, 只保留后四位
+	StrategyLast4 = "last4"
+	// StrategyEmail 邮箱, 只保留首字母和域名
+	StrategyEmail = "email"
+	// StrategyFull 完全隐藏
+	StrategyFull = "full"
+)
+
+// maskChar 用于替换敏感内容的字符
+const maskChar = "*"
+
+// redacted 完全隐藏时输出的固定内容, 不暴露原始长度
+const redacted = "******"
+
+// ErrNotAllowed 当前上下文没有查看明文的授权
+var ErrNotAllowed = errors.New("没有查看敏感字段明文的授权")
+
+// Func 脱敏函数
+type Func func(s string) string
+
+var (
+	mu         sync.RWMutex
+	strategies = map[string]Func{
+		StrategyCard:  Card,
+		StrategyLast4: Last4Masked,
+		StrategyEmail: Email,
+		StrategyFull:  Full,
+	}
+)
+
+// Register 注册自定义的脱敏策略, 同名策略会被覆盖
+func Register(name string, fn Func) {
+	mu.Lock()
+	defer mu.Unlock()
+	strategies[name] = fn
+}
+
+// Value 使用指定策略对字符串脱敏, 未知策略按完全隐藏处理, 已经脱敏的值原样返回
+func Value(strategy, s string) string {
+	if s == "" || IsMasked(s) {
+		return s
+	}
+	mu.RLock()
+	fn, ok := strategies[strategy]
+	mu.RUnlock()
+	if !ok {
+		return Full(s)
+	}
+	return fn(s)
+}
+
+// Full 完全隐藏
+func Full(s string) string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// Last4 返回字符串的后四位, 不足四位时返回空字符串
+func Last4(s string) string {
+	r := []rune(s)
+	if len(r) < 4 {
+		return ""
+	}
+	return string(r[len(r)-4:])
+}
+
+// Last4Masked 只保留后四位, 其余字符替换为 *
+func Last4Masked(s string) string {
+	r := []rune(s)
+	if len(r) <= 4 {
+		return Full(s)
+	}
+	return strings.Repeat(maskChar, len(r)-4) + string(r[len(r)-4:])
+}
+
+// Email 只保留用户名首字母和域名, 例如 a***@example.com
+func Email(s string) string {
+	name, domain, ok := strings.Cut(s, "@")
+	if !ok || name == "" {
+		return Full(s)
+	}
+	return string([]rune(name)[:1]) + strings.Repeat(maskChar, 3) + "@" + domain
+}
+
+// IsMasked 判断字符串是否为脱敏后的结果, 用于避免把脱敏值当作原始值写回数据库
+func IsMasked(s string) bool {
+	if rest := strings.TrimLeft(s, maskChar); rest != s && len([]rune(rest)) <= 4 {
+		return true
+	}
+	name, _, ok := strings.Cut(s, "@")
+	return ok && len([]rune(name)) == 4 && strings.HasSuffix(name, strings.Repeat(maskChar, 3))
+}
+
+type unmaskedKey struct{}
+
+// WithUnmasked 返回一个允许查看敏感字段明文的上下文, 只应在经过授权的代码路径中使用
+func WithUnmasked(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unmaskedKey{}, true)
+}
+
+// Unmasked 判断上下文是否允许查看明文
+func Unmasked(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	allowed, _ := ctx.Value(unmaskedKey{}).(bool)
+	return allowed
+}
+
+// Reveal 在上下文有授权时返回明文, 否则返回 ErrNotAllowed
+func Reveal(ctx context.Context, s string) (string, error) {
+	if !Unmasked(ctx) {
+		return "", ErrNotAllowed
+	}
+	return s, nil
+}
+
+// Dump 返回脱敏后的调试输出, 效果等同于对脱敏副本使用 %+v
+//
+// 实现了 fmt.Stringer 的值约定自行脱敏, 直接使用其 String 方法
+func Dump(v interface{}) string {
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%+v", Struct(v))
+}
@@ -0,0 +1,109 @@
+package mask
+
+import "reflect"
+
+// maxDepth 递归处理嵌套结构体的最大深度, 防止循环引用导致死循环
+const maxDepth = 8
+
+// Struct 返回 v 的脱敏副本, 原始值不会被修改
+//
+// 带有 mask 标签的字符串字段会按照标签指定的策略脱敏,
+// 嵌套的结构体、指针、切片与 map 中的结构体会被递归处理
+func Struct[T any](v T) T {
+	rv := reflect.ValueOf(&v).Elem()
+	masked := copyValue(rv, 0)
+	return masked.Interface().(T)
+}
+
+// copyValue 复制 v 并对其中带有 mask 标签的字段脱敏
+func copyValue(v reflect.Value, depth int) reflect.Value {
+	if depth > maxDepth || !needsCopy(v.Type(), 0) {
+		return v
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(copyValue(v.Elem(), depth+1))
+		return out
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(copyValue(v.Elem(), depth+1))
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(copyValue(v.Index(i), depth+1))
+		}
+		return out
+	case reflect.Array:
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(copyValue(v.Index(i), depth+1))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), copyValue(iter.Value(), depth+1))
+		}
+		return out
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if strategy, ok := field.Tag.Lookup(TagName); ok {
+				if field.Type.Kind() == reflect.String {
+					out.Field(i).SetString(Value(strategy, v.Field(i).String()))
+				}
+				continue
+			}
+			out.Field(i).Set(copyValue(v.Field(i), depth+1))
+		}
+		return out
+	}
+	return v
+}
+
+// needsCopy 判断类型中是否可能包含需要脱敏的字段, 避免对无关的值做深拷贝
+func needsCopy(t reflect.Type, depth int) bool {
+	if depth > maxDepth {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return needsCopy(t.Elem(), depth+1)
+	case reflect.Map:
+		return needsCopy(t.Elem(), depth+1)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if _, ok := field.Tag.Lookup(TagName); ok || needsCopy(field.Type, depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"gorm-learn/db/audit"
+	"gorm-learn/db/firewall"
+	"gorm-learn/db/outbox"
+	"gorm-learn/db/temporal"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Migrate 自动迁移 models 对应的表结构, 版本化的模型同时迁移历史表, 使模型新增的列也出现在历史表中
+//
+// outbox、audit_logs 等插件使用的表在连接数据库时已经迁移, 不需要在 models 中列出
+func Migrate(models ...interface{}) error {
+	if err := DB().WithContext(firewall.Migrating(context.Background())).AutoMigrate(models...); err != nil {
+		return err
+	}
+	return MigrateHistory(models...)
+}
+
+// migratePlugins 迁移插件使用的表: 保存领域事件的 outbox 表、audit_logs 表以及版本化模型的历史表
+func migratePlugins(d *gorm.DB) error {
+	d = d.WithContext(firewall.Migrating(context.Background()))
+	if err := d.AutoMigrate(&outbox.Message{}, &audit.Log{}); err != nil {
+		return err
+	}
+	return temporal.Migrate(d, versionedModels...)
+}
+
+// modelOf 判断 model 与 registry 中的某个模型是否为同一类型
+func modelOf(registry []interface{}, model interface{}) bool {
+	t := reflect.Indirect(reflect.ValueOf(model)).Type()
+	for _, m := range registry {
+		if reflect.Indirect(reflect.ValueOf(m)).Type() == t {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateProductPrice 将旧版 products 表中 uint 类型的 price 列迁移为 price_amount + price_currency
+//
+// 旧数据中的 price 按整数金额处理, 币种统一设置为 currency, 迁移完成后删除 price 列;
+// 只添加价格的两列, 不修改表中的其他列, 旧的 deleted_at 列由 MigrateProductSoftDelete 迁移;
+// 重复执行是安全的, 旧列不存在时直接返回
+func MigrateProductPrice(d *gorm.DB, currency string) error {
+	d = d.WithContext(firewall.Migrating(d.Statement.Context))
+	m := d.Migrator()
+	if !m.HasColumn(&Product{}, "price") {
+		return nil
+	}
+	for _, column := range []string{"price_amount", "price_currency"} {
+		if m.HasColumn(&Product{}, column) {
+			continue
+		}
+		if err := m.AddColumn(&Product{}, column); err != nil {
+			return fmt.Errorf("创建价格列 %s 失败: %w", column, err)
+		}
+	}
+
+	// 使用原生 SQL, 迁移数据不递增版本号, 也不写入历史表、审计日志与领域事件
+	err := d.Exec("UPDATE `products` SET `price_amount` = `price`, `price_currency` = ? WHERE `price_currency` IS NULL OR `price_currency` = ''", currency).Error
+	if err != nil {
+		return fmt.Errorf("迁移旧价格数据失败: %w", err)
+	}
+
+	if err := m.DropColumn(&Product{}, "price"); err != nil {
+		return fmt.Errorf("删除旧价格列失败: %w", err)
+	}
+	return nil
+}
+
+// MigrateProductSoftDelete 将旧版 products 表中可以为 NULL 的 deleted_at 时间迁移为秒级时间戳
+//
+// 旧列先重命名为 deleted_at_old, 由 AutoMigrate 创建新的 deleted_at 列以及 (code, deleted_at) 唯一索引,
+// 再把已删除记录的删除时间写入新列, 最后删除旧列与只包含 code 的唯一索引;
+// 重复执行是安全的, deleted_at 已经是整数类型时直接返回, 中途失败时再次执行会从旧列继续迁移
+func MigrateProductSoftDelete(d *gorm.DB) error {
+	d = d.WithContext(firewall.Migrating(d.Statement.Context))
+	m := d.Migrator()
+	if !m.HasColumn(&Product{}, "deleted_at_old") {
+		columns, err := m.ColumnTypes(&Product{})
+		if err != nil {
+			return fmt.Errorf("读取 products 表结构失败: %w", err)
+		}
+		legacy := false
+		for _, column := range columns {
+			if column.Name() == "deleted_at" {
+				name := strings.ToUpper(column.DatabaseTypeName())
+				legacy = name == "DATETIME" || name == "TIMESTAMP"
+			}
+		}
+		if !legacy {
+			return nil
+		}
+		if err := m.RenameColumn(&Product{}, "deleted_at", "deleted_at_old"); err != nil {
+			return fmt.Errorf("重命名旧的删除时间列失败: %w", err)
+		}
+	}
+	if err := m.AutoMigrate(&Product{}); err != nil {
+		return fmt.Errorf("创建删除时间列失败: %w", err)
+	}
+
+	// 使用原生 SQL, 迁移数据不递增版本号, 也不产生领域事件
+	err := d.Exec("UPDATE `products` SET `deleted_at` = UNIX_TIMESTAMP(`deleted_at_old`) WHERE `deleted_at_old` IS NOT NULL AND `deleted_at` = 0").Error
+	if err != nil {
+		return fmt.Errorf("迁移旧的删除时间失败: %w", err)
+	}
+
+	if err := m.DropColumn(&Product{}, "deleted_at_old"); err != nil {
+		return fmt.Errorf("删除旧的删除时间列失败: %w", err)
+	}
+	if m.HasIndex(&Product{}, "idx_products_code") {
+		if err := m.DropIndex(&Product{}, "idx_products_code"); err != nil {
+			return fmt.Errorf("删除旧的唯一索引失败: %w", err)
+		}
+	}
+	return nil
+}
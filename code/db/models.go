@@ -3,10 +3,18 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"gorm-learn/db/encrypt"
+	"gorm-learn/db/internal/callbacks"
+	"gorm-learn/db/mask"
+	"gorm-learn/db/optimistic"
+	"gorm-learn/db/softdelete"
+	"gorm-learn/db/types"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -14,15 +22,54 @@ import (
 )
 
 type Product struct {
-	gorm.Model
-	Code  string
-	Price uint
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// DeletedAt 删除时间的秒级时间戳, 未删除时为 0, 与 Code 组成唯一索引, 删除之后可以再创建相同 Code 的商品
+	DeletedAt softdelete.Unix `gorm:"not null;default:0;uniqueIndex:idx_products_code_deleted_at,priority:2"`
+	Code      string          `gorm:"type:varchar(64);uniqueIndex:idx_products_code_deleted_at,priority:1" validate:"required,max=64,regexp=^[A-Z][A-Z0-9-]*$"`
+	Price     types.Money     `gorm:"embedded;embeddedPrefix:price_"`
+	// Stock 库存数量, 通过 Reserve 在行锁中扣减, 数据库约束保证不会小于 0
+	Stock int `gorm:"not null;default:0;check:chk_products_stock,stock >= 0" validate:"min=0"`
+	// Version 乐观锁版本号, 由 optimistic 插件在更新时检查并递增
+	Version optimistic.Version `gorm:"not null;default:1"`
+}
+
+// AdjustPrice 在数据库中原子地调整价格: price = price * factor + delta, 结果按币种最小单位四舍五入
+//
+// delta 为 0 时不限制币种, 否则要求商品的币种与 delta 一致, 不一致时返回 types.ErrCurrencyMismatch
+func (p *Product) AdjustPrice(tx *gorm.DB, factor types.Decimal, delta types.Money) error {
+	// 价格在数据库中原子地计算, 不需要检查读取之后是否被修改过
+	query := optimistic.Unchecked(tx).Model(p)
+	places := types.MinorUnits(p.Price.Currency)
+	if !delta.IsZero() {
+		query = query.Where("price_currency = ?", delta.Currency)
+		places = types.MinorUnits(delta.Currency)
+	}
+
+	result := query.Update("price_amount", types.AmountExpr("price_amount", factor, delta.Amount, places))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var current Product
+		if err := tx.Select("price_currency").First(&current, p.ID).Error; err != nil {
+			return err
+		}
+		if !delta.IsZero() && current.Price.Currency != delta.Currency {
+			return fmt.Errorf("%w: 商品为 %s, 调整金额为 %s", types.ErrCurrencyMismatch, current.Price.Currency, delta.Currency)
+		}
+	}
+	return tx.First(p, p.ID).Error
 }
 
 type Location struct {
 	X, Y int
 }
 
+// pointPattern 匹配 ST_AsText 输出的 POINT(x y), 坐标可以为负数
+var pointPattern = regexp.MustCompile(`POINT\((-?\d+) (-?\d+)\)`)
+
 // Scan 实现 sql.Scanner 接口, 用于将数据库数据转换为自定义结构
 func (l *Location) Scan(v interface{}) error {
 	var bytes []byte
@@ -30,9 +77,7 @@ func (l *Location) Scan(v interface{}) error {
 	if bytes, ok = v.([]byte); !ok {
 		return errors.New("数据库返回错误的格式")
 	}
-	reg := `POINT\((\d+) (\d+)\)`
-	exp := regexp.MustCompile(reg)
-	results := exp.FindStringSubmatch(string(bytes))
+	results := pointPattern.FindStringSubmatch(string(bytes))
 	if len(results) != 3 {
 		return errors.New("解析数据库返回结果失败")
 	}
@@ -58,23 +103,229 @@ func (l *Location) String() string {
 	return fmt.Sprintf(`Location{X: %v, Y: %v}`, l.X, l.Y)
 }
 
+// MarshalText 实现 encoding.TextMarshaler 接口, 输出为 "x,y", 用于 CSV 等文本格式
+func (l Location) MarshalText() ([]byte, error) {
+	return []byte(strconv.Itoa(l.X) + "," + strconv.Itoa(l.Y)), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler 接口, 解析 "x,y" 格式的坐标
+func (l *Location) UnmarshalText(text []byte) error {
+	xs, ys, ok := strings.Cut(string(text), ",")
+	if !ok {
+		return fmt.Errorf("坐标格式应为 \"x,y\": %q", text)
+	}
+	x, err := strconv.Atoi(strings.TrimSpace(xs))
+	if err != nil {
+		return fmt.Errorf("坐标 x 必须是整数: %s", xs)
+	}
+	y, err := strconv.Atoi(strings.TrimSpace(ys))
+	if err != nil {
+		return fmt.Errorf("坐标 y 必须是整数: %s", ys)
+	}
+	l.X, l.Y = x, y
+	return nil
+}
+
+// geoJSONPoint GeoJSON 中 Point 类型的结构
+type geoJSONPoint struct {
+	Type string `json:"type"`
+	// Coordinates 保留原始的 JSON, 只接受整数字面量, 不接受 "1" 这样的字符串
+	Coordinates []json.RawMessage `json:"coordinates"`
+}
+
+// MarshalJSON 实现 json.Marshaler 接口, 将坐标输出为 GeoJSON 格式的 Point
+func (l Location) MarshalJSON() ([]byte, error) {
+	return json.Marshal(geoJSONPoint{
+		Type:        "Point",
+		Coordinates: []json.RawMessage{json.RawMessage(strconv.Itoa(l.X)), json.RawMessage(strconv.Itoa(l.Y))},
+	})
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler 接口, 从 GeoJSON 格式的 Point 中解析坐标
+func (l *Location) UnmarshalJSON(data []byte) error {
+	var point geoJSONPoint
+	if err := json.Unmarshal(data, &point); err != nil {
+		return fmt.Errorf("解析 GeoJSON 失败: %w", err)
+	}
+	if point.Type != "Point" {
+		return fmt.Errorf("不支持的 GeoJSON 类型: %q, 只支持 Point", point.Type)
+	}
+	if len(point.Coordinates) != 2 {
+		return fmt.Errorf("GeoJSON Point 需要 2 个坐标, 实际为 %d 个", len(point.Coordinates))
+	}
+	x, err := strconv.Atoi(string(point.Coordinates[0]))
+	if err != nil {
+		return fmt.Errorf("坐标 x 必须是整数: %s", point.Coordinates[0])
+	}
+	y, err := strconv.Atoi(string(point.Coordinates[1]))
+	if err != nil {
+		return fmt.Errorf("坐标 y 必须是整数: %s", point.Coordinates[1])
+	}
+	l.X, l.Y = x, y
+	return nil
+}
+
 type CreditCard struct {
 	gorm.Model
-	Number string
-	UserID uint
+	// Number 使用 AES-GCM 加密存储, 按卡号查询时需要使用 NumberIndex;
+	// 打印与 JSON 输出时只保留后四位, 需要明文时使用 RevealNumber
+	Number string `gorm:"serializer:encrypted;type:varchar(255)" mask:"card"`
+	// NumberIndex 卡号的盲索引, 由 BeforeSave 钩子自动维护
+	NumberIndex string `gorm:"type:char(64);index"`
+	UserID      uint
+}
+
+// BeforeSave 在新增或修改卡号时同步更新盲索引
+//
+// 以 map 更新时 GORM 不会经过序列化器, 因此这里把卡号替换为密文; 替换在 map 的副本中进行,
+// 调用方的 map 保持明文, 密文包装为 clause.Expr, GORM 把 map 中的值写回模型时会忽略它,
+// 模型中的 Number 同样为明文
+func (cc *CreditCard) BeforeSave(tx *gorm.DB) error {
+	ctx := tx.Statement.Context
+	number := cc.Number
+	if dest, isMap := tx.Statement.Dest.(map[string]interface{}); isMap {
+		var (
+			key   string
+			found bool
+			err   error
+		)
+		if number, key, found, err = lookupString(dest, "Number", "number"); err != nil || !found {
+			return err
+		}
+		aad := encrypt.FieldAAD("credit_cards", "number")
+		cipher := number
+		if encrypt.IsEncrypted(number) {
+			plain, err := encrypt.Decrypt(ctx, number, aad)
+			if err != nil {
+				return err
+			}
+			number = plain
+		} else if number != "" {
+			var err error
+			if cipher, err = encrypt.Encrypt(ctx, number, aad); err != nil {
+				return err
+			}
+		}
+		tx.Statement.Dest = callbacks.WithValue(dest, key, clause.Expr{SQL: "?", Vars: []interface{}{cipher}})
+		cc.Number = number
+	}
+
+	index, err := cardNumberIndex(ctx, number)
+	if err != nil {
+		return err
+	}
+	tx.Statement.SetColumn("NumberIndex", index)
+	return nil
+}
+
+// Brand 返回卡号所属的银行卡品牌
+func (cc *CreditCard) Brand() mask.Brand {
+	return mask.DetectBrand(cc.Number)
+}
+
+// Last4 返回卡号的后四位
+func (cc *CreditCard) Last4() string {
+	return mask.CardLast4(cc.Number)
+}
+
+// RevealNumber 返回卡号明文, 只有经过 mask.WithUnmasked 授权的上下文才能调用成功
+func (cc *CreditCard) RevealNumber(ctx context.Context) (string, error) {
+	return mask.Reveal(ctx, cc.Number)
 }
 
+// String 输出脱敏后的信用卡信息
 func (cc *CreditCard) String() string {
-	return fmt.Sprintf(`CreditCard{ID: %v, Number: %v, UserId: %v}`, cc.ID, cc.Number, cc.UserID)
+	m := mask.Struct(*cc)
+	return fmt.Sprintf(`CreditCard{ID: %v, Number: %v, Brand: %v, UserId: %v}`, m.ID, m.Number, cc.Brand(), m.UserID)
+}
+
+// creditCardJSON 信用卡在 JSON 中的结构
+type creditCardJSON struct {
+	ID        uint           `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at"`
+	Number    string         `json:"number" mask:"card"`
+	Brand     mask.Brand     `json:"brand,omitempty"`
+	Last4     string         `json:"last4,omitempty"`
+	UserID    uint           `json:"user_id"`
+}
+
+// MarshalJSON 实现 json.Marshaler 接口, 卡号只输出脱敏后的结果
+func (cc CreditCard) MarshalJSON() ([]byte, error) {
+	v := creditCardJSON{
+		ID:        cc.ID,
+		CreatedAt: cc.CreatedAt,
+		UpdatedAt: cc.UpdatedAt,
+		DeletedAt: cc.DeletedAt,
+		Number:    cc.Number,
+		Last4:     cc.Last4(),
+		UserID:    cc.UserID,
+	}
+	if cc.Number != "" {
+		v.Brand = cc.Brand()
+	}
+	return json.Marshal(mask.Struct(v))
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler 接口, 脱敏后的卡号会被忽略, 避免写回数据库
+func (cc *CreditCard) UnmarshalJSON(data []byte) error {
+	var v creditCardJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	cc.ID, cc.CreatedAt, cc.UpdatedAt, cc.DeletedAt = v.ID, v.CreatedAt, v.UpdatedAt, v.DeletedAt
+	if !mask.IsMasked(v.Number) {
+		cc.Number = v.Number
+	}
+	cc.UserID = v.UserID
+	return nil
+}
+
+// lookupString 从 map 中按顺序查找第一个存在的键并返回其中的字符串
+//
+// 值为 BeforeSave 已经替换过的密文 (只包含一个密文参数的 clause.Expr) 时返回密文本身,
+// 其他类型的值无法加密, 返回错误
+func lookupString(m map[string]interface{}, keys ...string) (value, key string, found bool, err error) {
+	for _, key := range keys {
+		v, ok := m[key]
+		if !ok {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			return v, key, true, nil
+		case clause.Expr:
+			if len(v.Vars) == 1 && v.SQL == "?" {
+				if s, isString := v.Vars[0].(string); isString && encrypt.IsEncrypted(s) {
+					return s, key, true, nil
+				}
+			}
+		}
+		return "", key, true, fmt.Errorf("%s 必须是字符串, 实际为 %T", key, v)
+	}
+	return "", "", false, nil
+}
+
+// AuditModel 记录创建、最后修改与删除记录的操作者, 与 gorm.Model 一起嵌入模型,
+// 由 actor 插件根据 ctx 中的操作者填写, 参考 actor.With
+type AuditModel struct {
+	CreatedBy string `gorm:"type:varchar(64)"`
+	UpdatedBy string `gorm:"type:varchar(64)"`
+	DeletedBy string `gorm:"type:varchar(64)"`
 }
 
 type User struct {
 	gorm.Model
-	Name       string
-	Age        int
-	Birthday   time.Time
-	Location   *Location
-	CreditCard *CreditCard
+	AuditModel
+	Name     string `validate:"required,max=64"`
+	Age      int    `validate:"min=0,max=150"`
+	Birthday types.Date
+	Location *Location
+	// CreditCard 随用户一起软删除、恢复与物理删除
+	CreditCard *CreditCard `cascade:"all"`
+	// Version 乐观锁版本号, 由 optimistic 插件在更新时检查并递增
+	Version optimistic.Version `gorm:"not null;default:1"`
 }
 
 func (u *User) String() string {
@@ -84,11 +335,65 @@ func (u *User) String() string {
 			CreatedAt: %v,
 			UpdatedAt: %v,
 			DeletedAt: %v,
+			CreatedBy: %v,
+			UpdatedBy: %v,
+			DeletedBy: %v,
 			Name: %v,
 			Age: %v,
 			Birthday: %v,
 			Location: %v,
-			CreditCard: %v
+			CreditCard: %v,
+			Version: %v
 		}
-	`, u.ID, u.CreatedAt, u.UpdatedAt, u.DeletedAt, u.Name, u.Age, u.Birthday, u.Location, u.CreditCard)
+	`, u.ID, u.CreatedAt, u.UpdatedAt, u.DeletedAt, u.CreatedBy, u.UpdatedBy, u.DeletedBy, u.Name, u.Age, u.Birthday, u.Location, u.CreditCard, u.Version)
+}
+
+// userJSON 用户在 JSON 中的结构
+type userJSON struct {
+	ID         uint               `json:"id"`
+	CreatedAt  time.Time          `json:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt     `json:"deleted_at"`
+	CreatedBy  string             `json:"created_by,omitempty"`
+	UpdatedBy  string             `json:"updated_by,omitempty"`
+	DeletedBy  string             `json:"deleted_by,omitempty"`
+	Name       string             `json:"name"`
+	Age        int                `json:"age"`
+	Birthday   types.Date         `json:"birthday"`
+	Location   *Location          `json:"location"`
+	CreditCard *CreditCard        `json:"credit_card"`
+	Version    optimistic.Version `json:"version"`
+}
+
+// MarshalJSON 实现 json.Marshaler 接口, 字段名统一使用下划线风格, 坐标输出为 GeoJSON
+func (u User) MarshalJSON() ([]byte, error) {
+	return json.Marshal(userJSON{
+		ID:         u.ID,
+		CreatedAt:  u.CreatedAt,
+		UpdatedAt:  u.UpdatedAt,
+		DeletedAt:  u.DeletedAt,
+		CreatedBy:  u.CreatedBy,
+		UpdatedBy:  u.UpdatedBy,
+		DeletedBy:  u.DeletedBy,
+		Name:       u.Name,
+		Age:        u.Age,
+		Birthday:   u.Birthday,
+		Location:   u.Location,
+		CreditCard: u.CreditCard,
+		Version:    u.Version,
+	})
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler 接口, 坐标不合法时返回错误
+func (u *User) UnmarshalJSON(data []byte) error {
+	var v userJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("解析用户 JSON 失败: %w", err)
+	}
+	u.ID, u.CreatedAt, u.UpdatedAt, u.DeletedAt = v.ID, v.CreatedAt, v.UpdatedAt, v.DeletedAt
+	u.CreatedBy, u.UpdatedBy, u.DeletedBy = v.CreatedBy, v.UpdatedBy, v.DeletedBy
+	u.Name, u.Age, u.Birthday = v.Name, v.Age, v.Birthday
+	u.Location, u.CreditCard = v.Location, v.CreditCard
+	u.Version = v.Version
+	return nil
 }
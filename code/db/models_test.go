@@ -0,0 +1,185 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm-learn/db/types"
+
+	"gorm.io/gorm"
+)
+
+func TestLocationJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want Location
+		err  string
+	}{
+		{name: "point", json: `{"type":"Point","coordinates":[1,2]}`, want: Location{X: 1, Y: 2}},
+		{name: "spaces", json: `{"type": "Point", "coordinates": [ 3 , 4 ]}`, want: Location{X: 3, Y: 4}},
+		{name: "negative", json: `{"type":"Point","coordinates":[-30,0]}`, want: Location{X: -30, Y: 0}},
+		{name: "wrong type", json: `{"type":"LineString","coordinates":[1,2]}`, err: "不支持的 GeoJSON 类型"},
+		{name: "missing type", json: `{"coordinates":[1,2]}`, err: "不支持的 GeoJSON 类型"},
+		{name: "one coordinate", json: `{"type":"Point","coordinates":[1]}`, err: "需要 2 个坐标"},
+		{name: "three coordinates", json: `{"type":"Point","coordinates":[1,2,3]}`, err: "需要 2 个坐标"},
+		{name: "float x", json: `{"type":"Point","coordinates":[1.5,2]}`, err: "坐标 x 必须是整数"},
+		{name: "float y", json: `{"type":"Point","coordinates":[1,2e3]}`, err: "坐标 y 必须是整数"},
+		{name: "string coordinate", json: `{"type":"Point","coordinates":["1",2]}`, err: "坐标 x 必须是整数"},
+		{name: "null coordinate", json: `{"type":"Point","coordinates":[1,null]}`, err: "坐标 y 必须是整数"},
+		{name: "not an object", json: `[1,2]`, err: "解析 GeoJSON 失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Location
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Unmarshal(%s) error = %v, want %q", tt.json, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%s) error = %v", tt.json, err)
+			}
+			if got != tt.want {
+				t.Fatalf("Unmarshal(%s) = %+v, want %+v", tt.json, got, tt.want)
+			}
+
+			// 输出之后再解析应该得到相同的坐标
+			data, err := json.Marshal(got)
+			if err != nil {
+				t.Fatalf("Marshal(%+v) error = %v", got, err)
+			}
+			var again Location
+			if err := json.Unmarshal(data, &again); err != nil || again != got {
+				t.Fatalf("round trip %s = %+v, %v, want %+v", data, again, err, got)
+			}
+		})
+	}
+}
+
+func TestLocationScan(t *testing.T) {
+	tests := []struct {
+		text string
+		want Location
+		ok   bool
+	}{
+		{text: "POINT(33 44)", want: Location{X: 33, Y: 44}, ok: true},
+		{text: "POINT(-30 0)", want: Location{X: -30, Y: 0}, ok: true},
+		{text: "POINT(12 -7)", want: Location{X: 12, Y: -7}, ok: true},
+		{text: "POINT(-1 -2)", want: Location{X: -1, Y: -2}, ok: true},
+		{text: "POINT(1.5 2)"},
+		{text: "LINESTRING(1 2,3 4)"},
+	}
+	for _, tt := range tests {
+		var got Location
+		err := got.Scan([]byte(tt.text))
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("Scan(%q) = %+v, %v", tt.text, got, err)
+		}
+	}
+	if err := new(Location).Scan("POINT(1 2)"); err == nil {
+		t.Error("扫描非 []byte 的数据应该返回错误")
+	}
+}
+
+func TestLocationRoundTrip(t *testing.T) {
+	d := testDB(t)
+	for _, want := range []Location{{X: 33, Y: 44}, {X: -30, Y: 0}, {X: 12, Y: -7}, {X: -1, Y: -2}} {
+		user := User{Name: "location-owner", Location: &want}
+		if err := d.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		var got Location
+		if err := d.Raw("SELECT ST_AsText(location) FROM users WHERE id = ?", user.ID).Row().Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("写入 %+v, 读取到 %+v", want, got)
+		}
+	}
+}
+
+func TestUserJSON(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		user User
+	}{
+		{name: "empty", user: User{}},
+		{
+			name: "full",
+			user: User{
+				Model:      gorm.Model{ID: 7, CreatedAt: now, UpdatedAt: now.Add(time.Hour)},
+				AuditModel: AuditModel{CreatedBy: "alice", UpdatedBy: "bob"},
+				Name:       "ZhangSan",
+				Age:        18,
+				Birthday:   types.DateOf(time.Date(2006, time.January, 2, 0, 0, 0, 0, time.UTC)),
+				Location:   &Location{X: 100, Y: 200},
+				Version:    3,
+			},
+		},
+		{
+			name: "deleted",
+			user: User{
+				Model:      gorm.Model{ID: 8, CreatedAt: now, UpdatedAt: now, DeletedAt: gorm.DeletedAt{Time: now, Valid: true}},
+				AuditModel: AuditModel{DeletedBy: "carol"},
+				Name:       "LiSi",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.user)
+			if err != nil {
+				t.Fatalf("Marshal error = %v", err)
+			}
+			var got User
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal(%s) error = %v", data, err)
+			}
+			if !reflect.DeepEqual(got, tt.user) {
+				t.Fatalf("round trip %s\n got %+v\nwant %+v", data, got, tt.user)
+			}
+		})
+	}
+}
+
+func TestUserJSONKeys(t *testing.T) {
+	data, err := json.Marshal(User{Name: "ZhangSan", Location: &Location{X: 1, Y: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"id", "created_at", "name", "birthday", "location", "credit_card", "version"} {
+		if _, ok := m[key]; !ok {
+			t.Errorf("%s 中缺少 %q", data, key)
+		}
+	}
+	if _, ok := m["created_by"]; ok {
+		t.Errorf("%s 中空的 created_by 应该省略", data)
+	}
+	if got := string(m["location"]); got != `{"type":"Point","coordinates":[1,2]}` {
+		t.Errorf("location = %s, want GeoJSON Point", got)
+	}
+}
+
+func TestUserJSONInvalidLocation(t *testing.T) {
+	for _, data := range []string{
+		`{"name":"a","location":{"type":"Polygon","coordinates":[1,2]}}`,
+		`{"name":"a","location":{"type":"Point","coordinates":[1,2,3]}}`,
+		`{"name":"a","location":{"type":"Point","coordinates":[1.1,2]}}`,
+	} {
+		var u User
+		if err := json.Unmarshal([]byte(data), &u); err == nil {
+			t.Errorf("Unmarshal(%s) 应该返回错误", data)
+		}
+	}
+}
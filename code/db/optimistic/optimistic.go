@@ -0,0 +1,271 @@
+// 基于版本号的乐观锁
+//
+// 模型中声明 Version 类型的字段后, 插件会在更新时自动检查并递增版本号:
+//
+//	type User struct {
+//		gorm.Model
+//		Version optimistic.Version `gorm:"not null;default:1"`
+//	}
+//
+//	d.First(&user, 27)
+//	user.Age = 99
+//	d.Save(&user) // UPDATE ... SET ..., `version`=2 WHERE `id` = 27 AND `version` = 1
+//
+// 记录在读取之后被其他请求修改过时, 更新不会影响任何行, 返回 *StaleObjectError, 可以通过
+// errors.Is(err, ErrStaleObject) 判断; 需要自动解决冲突时使用 Retry 重新读取并再次应用修改
+package optimistic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm-learn/db/internal/callbacks"
+
+	"gorm.io/gorm"
+	gormcallbacks "gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Version 版本号, 创建时为 1, 每次更新加 1
+type Version int64
+
+// ErrStaleObject 记录已经被其他请求修改, 当前持有的版本已过期
+var ErrStaleObject = errors.New("optimistic: 记录已经被其他请求修改")
+
+// StaleObjectError 版本冲突的详细信息
+type StaleObjectError struct {
+	// Model 模型名称
+	Model string
+	// PrimaryKey 记录的主键
+	PrimaryKey interface{}
+	// Version 更新时持有的版本号
+	Version Version
+}
+
+func (e *StaleObjectError) Error() string {
+	return fmt.Sprintf("optimistic: %s(%v) 已经被其他请求修改, 版本 %d 已过期", e.Model, e.PrimaryKey, e.Version)
+}
+
+// Is 使 errors.Is(err, ErrStaleObject) 成立
+func (e *StaleObjectError) Is(target error) bool {
+	return target == ErrStaleObject
+}
+
+// 保存在 Statement 中的状态
+const (
+	stateKey     = "optimistic:state"
+	uncheckedKey = "optimistic:unchecked"
+	// setKey 标记 SET 子句是由 beforeUpdate 生成的
+	setKey = "optimistic:set"
+)
+
+// Unchecked 返回不检查版本冲突的 db, 版本号仍然会在数据库中加 1
+//
+// 用于不依赖读取时状态的原子更新, 例如 UPDATE ... SET stock = stock - 1
+func Unchecked(db *gorm.DB) *gorm.DB {
+	return db.Set(uncheckedKey, true)
+}
+
+// state 更新之前记录的版本信息
+type state struct {
+	field   *schema.Field
+	version Version
+}
+
+// versionType Version 的反射类型
+var versionType = reflect.TypeOf(Version(0))
+
+// Plugin 乐观锁插件
+type Plugin struct{}
+
+// Name 实现 gorm.Plugin 接口
+func (Plugin) Name() string {
+	return "gorm-learn:optimistic"
+}
+
+// Initialize 实现 gorm.Plugin 接口
+//
+// 没有持有版本号的结构体更新由插件提前生成 SET 子句, 修改更新字段的插件 (例如 actor) 需要在它之前注册;
+// 生成的 SET 子句在其他插件读取之后删除, 注册了 event 插件时在它的 after_update 之后
+func (Plugin) Initialize(db *gorm.DB) error {
+	if err := callbacks.RegisterBeforeUpdate(db, "optimistic:before_update", beforeUpdate); err != nil {
+		return err
+	}
+	update := db.Callback().Update()
+	if err := update.After("gorm:update").Before("gorm:after_update").Register("optimistic:after_update", afterUpdate); err != nil {
+		return err
+	}
+	after := "gorm:after_update"
+	if update.Get("event:after_update") != nil {
+		after = "event:after_update"
+	}
+	return update.After(after).Before("gorm:commit_or_rollback_transaction").Register("optimistic:clean_set", cleanSet)
+}
+
+// Field 返回模型的版本号字段, 模型没有 Version 字段时返回 nil
+func Field(sch *schema.Schema) *schema.Field {
+	if sch == nil {
+		return nil
+	}
+	for _, field := range sch.Fields {
+		if field.FieldType == versionType && field.DBName != "" {
+			return field
+		}
+	}
+	return nil
+}
+
+// beforeUpdate 写入新的版本号, 并且在持有版本号时增加版本条件
+//
+// 模型中的版本号为零值 (例如按条件批量更新) 或者使用了 Unchecked 时不检查冲突, 版本号在数据库中加 1:
+// 使用 map 更新时写入 map, 使用结构体更新时按 GORM 的规则提前生成 SET 子句, 再追加版本号的赋值
+func beforeUpdate(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil || stmt.SQL.Len() > 0 {
+		return
+	}
+	if _, ok := stmt.Clauses["SET"]; ok {
+		return
+	}
+	field := Field(stmt.Schema)
+	if field == nil {
+		return
+	}
+
+	var current Version
+	if unchecked, _ := db.Get(uncheckedKey); unchecked == true {
+		current = 0
+	} else if stmt.ReflectValue.Kind() == reflect.Struct {
+		if v, zero := field.ValueOf(stmt.Context, stmt.ReflectValue); !zero {
+			current = v.(Version)
+		}
+	}
+	if current == 0 {
+		increment := gorm.Expr(stmt.Quote(field.DBName) + " + 1")
+		if dest, ok := stmt.Dest.(map[string]interface{}); ok {
+			stmt.Dest = callbacks.WithValue(dest, field.DBName, increment)
+			selectVersion(stmt, field)
+			return
+		}
+		set := gormcallbacks.ConvertToAssignments(stmt)
+		if len(set) == 0 {
+			return
+		}
+		// 结构体中的版本号 (Unchecked 时可能不为零) 替换为在数据库中加 1
+		assignments := make(clause.Set, 0, len(set)+1)
+		for _, assignment := range set {
+			if assignment.Column.Name != field.DBName {
+				assignments = append(assignments, assignment)
+			}
+		}
+		stmt.AddClause(append(assignments, clause.Assignment{Column: clause.Column{Name: field.DBName}, Value: increment}))
+		db.InstanceSet(setKey, true)
+		return
+	}
+
+	next := current + 1
+	switch dest := stmt.Dest.(type) {
+	case map[string]interface{}:
+		stmt.Dest = callbacks.WithValue(dest, field.DBName, next)
+	default:
+		rv := reflect.ValueOf(stmt.Dest)
+		if stmt.Dest != stmt.Model {
+			// Updates 的参数与 Model 不是同一个对象时, 复制一份再写入版本号, 不修改调用方的参数
+			if reflect.Indirect(rv).Type() != stmt.Schema.ModelType {
+				return
+			}
+			cp := reflect.New(stmt.Schema.ModelType)
+			cp.Elem().Set(reflect.Indirect(rv))
+			db.AddError(field.Set(stmt.Context, cp.Elem(), next))
+			stmt.Dest = cp.Interface()
+		}
+		db.AddError(field.Set(stmt.Context, stmt.ReflectValue, next))
+	}
+	selectVersion(stmt, field)
+
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: current},
+	}})
+	db.InstanceSet(stateKey, &state{field: field, version: current})
+}
+
+// selectVersion Select 了部分字段时, 版本号同样需要更新
+func selectVersion(stmt *gorm.Statement, field *schema.Field) {
+	if len(stmt.Selects) > 0 && !callbacks.Contains(stmt.Selects, "*") && !callbacks.Contains(stmt.Selects, field.DBName) && !callbacks.Contains(stmt.Selects, field.Name) {
+		stmt.Selects = append(stmt.Selects, field.DBName)
+	}
+}
+
+// cleanSet 删除 beforeUpdate 生成的 SET 子句, 与 gorm:update 删除自己生成的 SET 子句相同,
+// 避免继续使用同一个 *gorm.DB 的语句沿用这次更新的字段
+func cleanSet(db *gorm.DB) {
+	if _, ok := db.InstanceGet(setKey); ok {
+		delete(db.Statement.Clauses, "SET")
+	}
+}
+
+// afterUpdate 没有影响任何行时返回 StaleObjectError, 并恢复模型中的版本号
+func afterUpdate(db *gorm.DB) {
+	v, ok := db.InstanceGet(stateKey)
+	if !ok || db.Error != nil || db.DryRun || db.RowsAffected > 0 {
+		return
+	}
+	s := v.(*state)
+	stmt := db.Statement
+	db.AddError(s.field.Set(stmt.Context, stmt.ReflectValue, s.version))
+
+	var pk interface{}
+	if field := stmt.Schema.PrioritizedPrimaryField; field != nil {
+		pk, _ = field.ValueOf(stmt.Context, stmt.ReflectValue)
+	}
+	db.AddError(&StaleObjectError{Model: stmt.Schema.Name, PrimaryKey: pk, Version: s.version})
+}
+
+// DefaultRetryAttempts Retry 默认的最大尝试次数
+const DefaultRetryAttempts = 3
+
+// Retry 把 apply 的修改保存到 value 中, 发生版本冲突时重新读取最新的记录并再次调用 apply
+//
+// apply 应当只修改需要变更的字段, 每次调用时 value 都是数据库中最新的记录;
+// 最多尝试 attempts 次, attempts <= 0 时为 DefaultRetryAttempts, 仍然冲突时返回 StaleObjectError
+func Retry[T any](ctx context.Context, db *gorm.DB, value *T, apply func(value *T) error, attempts int) error {
+	if attempts <= 0 {
+		attempts = DefaultRetryAttempts
+	}
+	tx := db.WithContext(ctx)
+	for i := 1; ; i++ {
+		if err := apply(value); err != nil {
+			return err
+		}
+		err := tx.Save(value).Error
+		if !errors.Is(err, ErrStaleObject) || i >= attempts {
+			return err
+		}
+		if err := reload(tx, value); err != nil {
+			return err
+		}
+	}
+}
+
+// reload 按主键重新读取记录
+func reload[T any](tx *gorm.DB, value *T) error {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(value); err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(value).Elem()
+	conds := make([]clause.Expression, 0, len(stmt.Schema.PrimaryFields))
+	for _, field := range stmt.Schema.PrimaryFields {
+		pk, _ := field.ValueOf(tx.Statement.Context, rv)
+		conds = append(conds, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: pk})
+	}
+	var latest T
+	if err := tx.Where(clause.And(conds...)).Take(&latest).Error; err != nil {
+		return err
+	}
+	*value = latest
+	return nil
+}
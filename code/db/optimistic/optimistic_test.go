@@ -0,0 +1,178 @@
+package optimistic
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm-learn/db/internal/dbtest"
+
+	"gorm.io/gorm"
+)
+
+// testItem 测试使用的模型
+type testItem struct {
+	ID      uint
+	Name    string
+	Stock   int
+	Version Version `gorm:"not null;default:1"`
+}
+
+func (testItem) TableName() string { return "optimistic_test_items" }
+
+// setup 清空测试表并创建一条记录, 返回重新读取之后的记录
+func setup(t *testing.T) (*gorm.DB, testItem) {
+	t.Helper()
+	d := dbtest.Open(t, Plugin{})
+	dbtest.Migrate(t, d, &testItem{})
+	if err := d.Exec("DELETE FROM optimistic_test_items").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Create(&testItem{Name: "item", Stock: 10}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var item testItem
+	if err := d.First(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if item.Version != 1 {
+		t.Fatalf("创建之后版本号为 %d", item.Version)
+	}
+	return d, item
+}
+
+// load 重新读取记录
+func load(t *testing.T, d *gorm.DB, id uint) testItem {
+	t.Helper()
+	var item testItem
+	if err := d.First(&item, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func TestSaveStale(t *testing.T) {
+	d, a := setup(t)
+	b := a
+
+	a.Name = "a"
+	if err := d.Save(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	if a.Version != 2 || load(t, d, a.ID).Version != 2 {
+		t.Errorf("保存之后版本号为 %d, 数据库中为 %d", a.Version, load(t, d, a.ID).Version)
+	}
+
+	// b 持有的版本已经过期
+	b.Name = "b"
+	err := d.Save(&b).Error
+	if !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("版本过期时 Save 返回 %v", err)
+	}
+	var stale *StaleObjectError
+	if !errors.As(err, &stale) || stale.Version != 1 || stale.PrimaryKey != b.ID || stale.Model != "testItem" {
+		t.Errorf("StaleObjectError = %+v", stale)
+	}
+	if b.Version != 1 {
+		t.Errorf("冲突之后模型中的版本号应该恢复为 1, 实际为 %d", b.Version)
+	}
+	if got := load(t, d, a.ID); got.Name != "a" || got.Version != 2 {
+		t.Errorf("冲突的更新不应该写入: %+v", got)
+	}
+}
+
+func TestUpdates(t *testing.T) {
+	d, item := setup(t)
+
+	// 持有版本号时检查并递增
+	if err := d.Model(&item).Updates(testItem{Name: "struct"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if item.Version != 2 {
+		t.Errorf("结构体更新之后版本号为 %d", item.Version)
+	}
+	if err := d.Model(&item).Update("stock", 9).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := load(t, d, item.ID); item.Version != 3 || got.Version != 3 || got.Stock != 9 {
+		t.Errorf("Update 之后模型中的版本号为 %d, 数据库中为 %+v", item.Version, got)
+	}
+
+	// 版本号为零值时不检查冲突, 在数据库中加 1
+	tests := []struct {
+		name   string
+		update func(tx *gorm.DB) *gorm.DB
+	}{
+		{"按条件使用结构体", func(tx *gorm.DB) *gorm.DB {
+			return tx.Model(&testItem{}).Where("id = ?", item.ID).Updates(testItem{Name: "bulk-struct"})
+		}},
+		{"按条件使用 map", func(tx *gorm.DB) *gorm.DB {
+			return tx.Model(&testItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{"name": "bulk-map"})
+		}},
+		{"Select 部分字段", func(tx *gorm.DB) *gorm.DB {
+			return tx.Model(&testItem{}).Where("id = ?", item.ID).Select("name").Updates(map[string]interface{}{"name": "selected"})
+		}},
+		{"Unchecked 持有过期的版本号", func(tx *gorm.DB) *gorm.DB {
+			stale := testItem{ID: item.ID, Version: 1}
+			return Unchecked(tx).Model(&stale).Updates(testItem{Stock: 5, Version: 1})
+		}},
+	}
+	for _, tt := range tests {
+		before := load(t, d, item.ID).Version
+		result := tt.update(d)
+		if result.Error != nil || result.RowsAffected != 1 {
+			t.Errorf("%s: RowsAffected = %d, %v", tt.name, result.RowsAffected, result.Error)
+			continue
+		}
+		if _, ok := result.Statement.Clauses["SET"]; ok {
+			t.Errorf("%s: 生成的 SET 子句没有删除", tt.name)
+		}
+		if got := load(t, d, item.ID).Version; got != before+1 {
+			t.Errorf("%s: 版本号从 %d 变为 %d", tt.name, before, got)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	d, item := setup(t)
+	ctx := context.Background()
+
+	// 第一次保存之前, 其他请求修改了记录
+	calls := 0
+	err := Retry(ctx, d, &item, func(v *testItem) error {
+		calls++
+		if calls == 1 {
+			if err := d.Model(&testItem{}).Where("id = ?", v.ID).Update("stock", 20).Error; err != nil {
+				return err
+			}
+		}
+		v.Stock++
+		return nil
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := load(t, d, item.ID); calls != 2 || got.Stock != 21 || item.Stock != 21 {
+		t.Errorf("apply 调用了 %d 次, 库存为 %d, 模型中为 %d", calls, got.Stock, item.Stock)
+	}
+
+	// 每次保存之前都被修改, 超过最大尝试次数之后返回冲突
+	calls = 0
+	err = Retry(ctx, d, &item, func(v *testItem) error {
+		calls++
+		if err := d.Model(&testItem{}).Where("id = ?", v.ID).Update("stock", gorm.Expr("stock + 1")).Error; err != nil {
+			return err
+		}
+		v.Name = "retry"
+		return nil
+	}, 2)
+	if !errors.Is(err, ErrStaleObject) || calls != 2 {
+		t.Errorf("Retry 返回 %v, apply 调用了 %d 次", err, calls)
+	}
+
+	// apply 返回的错误直接返回
+	errApply := errors.New("apply")
+	if err := Retry(ctx, d, &item, func(*testItem) error { return errApply }, 0); !errors.Is(err, errApply) {
+		t.Errorf("Retry 返回 %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 默认的投递配置
+const (
+	DefaultBatchSize    = 100
+	DefaultPollInterval = time.Second
+	DefaultMaxAttempts  = 10
+	DefaultLease        = time.Minute
+)
+
+// Dispatcher 轮询 outbox 表并投递消息
+type Dispatcher struct {
+	DB   *gorm.DB
+	Sink Sink
+	// BatchSize 每次领取的消息数量, 默认为 DefaultBatchSize
+	BatchSize int
+	// PollInterval 没有消息时轮询的间隔, 默认为 DefaultPollInterval
+	PollInterval time.Duration
+	// MaxAttempts 最大尝试次数, 超过后消息标记为 Failed, 默认为 DefaultMaxAttempts
+	MaxAttempts int
+	// Backoff 第 attempts 次失败之后等待多久重试, 默认为 Backoff
+	Backoff func(attempts int) time.Duration
+	// Lease 领取的消息在多久之内不会被再次领取, 默认为 DefaultLease;
+	// 应当大于投递一批消息需要的时间, Dispatcher 在投递中途退出时, 消息在租约到期之后重新投递
+	Lease time.Duration
+}
+
+// Backoff 默认的重试间隔: 1s、2s、4s ... 最多 5 分钟, 并增加最多 20% 的随机抖动,
+// 避免大量失败的消息在同一时刻重试
+func Backoff(attempts int) time.Duration {
+	d := 5 * time.Minute
+	if attempts < 10 {
+		d = min(time.Second<<max(attempts-1, 0), d)
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
+
+// Run 持续投递消息, 直到 ctx 被取消; 数据库错误只记录日志, 等待下一次轮询
+func (d *Dispatcher) Run(ctx context.Context) error {
+	interval := d.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		n, err := d.DispatchOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("outbox: 投递消息失败: %v", err)
+		}
+		// 领取满一批时可能还有消息, 立即继续
+		wait := interval
+		if err == nil && n >= d.batchSize() {
+			wait = 0
+		}
+		timer.Reset(wait)
+	}
+}
+
+func (d *Dispatcher) batchSize() int {
+	if d.BatchSize > 0 {
+		return d.BatchSize
+	}
+	return DefaultBatchSize
+}
+
+// DispatchOnce 领取一批到期的消息并逐条投递, 返回领取的消息数量
+//
+// 领取在一个短事务中完成: 锁定消息并把 next_attempt_at 推迟 Lease 作为租约, 随即提交;
+// 投递在事务之外进行, 慢速的 Sink 不会长时间持有行锁和连接. 投递成功的消息标记为 Done,
+// 投递失败的消息增加尝试次数并按 Backoff 推迟, 不影响同一批中的其他消息
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	if d.Sink == nil {
+		return 0, errors.New("outbox: 没有指定 Sink")
+	}
+	maxAttempts := d.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	backoff := d.Backoff
+	if backoff == nil {
+		backoff = Backoff
+	}
+
+	db := d.DB.WithContext(ctx)
+	messages, err := d.claim(db)
+	if err != nil {
+		return 0, err
+	}
+	for i := range messages {
+		msg := &messages[i]
+		sendErr := d.Sink.Send(ctx, *msg)
+		now := db.NowFunc()
+		updates := map[string]interface{}{"attempts": msg.Attempts + 1}
+		switch {
+		case sendErr == nil:
+			updates["status"], updates["processed_at"], updates["last_error"] = Done, now, ""
+		case msg.Attempts+1 >= maxAttempts:
+			updates["status"], updates["processed_at"], updates["last_error"] = Failed, now, sendErr.Error()
+		default:
+			updates["next_attempt_at"], updates["last_error"] = now.Add(backoff(msg.Attempts+1)), sendErr.Error()
+		}
+		if err := db.Model(msg).Where("status = ?", Pending).Updates(updates).Error; err != nil {
+			return len(messages), err
+		}
+	}
+	return len(messages), nil
+}
+
+// claim 在事务中锁定一批到期的消息, 并把它们的 next_attempt_at 推迟到租约结束
+func (d *Dispatcher) claim(db *gorm.DB) ([]Message, error) {
+	lease := d.Lease
+	if lease <= 0 {
+		lease = DefaultLease
+	}
+	var messages []Message
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := tx.NowFunc()
+		err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
+			Where("status = ? AND next_attempt_at <= ?", Pending, now).
+			Order("id").Limit(d.batchSize()).Find(&messages).Error
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+		ids := make([]uint64, 0, len(messages))
+		for _, msg := range messages {
+			ids = append(ids, msg.ID)
+		}
+		return tx.Model(&Message{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	return messages, err
+}
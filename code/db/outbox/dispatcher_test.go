@@ -0,0 +1,186 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gorm-learn/db/internal/dbtest"
+
+	"gorm.io/gorm"
+)
+
+// setup 使用单独的 outbox_test 表, 不会领取其他程序写入 outbox 表的消息
+func setup(t *testing.T, n int) (*gorm.DB, []Message) {
+	t.Helper()
+	d := dbtest.Open(t).Table("outbox_test").Session(&gorm.Session{})
+	dbtest.Migrate(t, d, &Message{})
+	if err := d.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&Message{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	messages := make([]Message, n)
+	for i := range messages {
+		messages[i] = Message{Topic: "Test.created", Payload: []byte(`{"n":1}`), Status: Pending, NextAttemptAt: d.NowFunc().Add(-time.Second)}
+	}
+	if n > 0 {
+		if err := d.Create(&messages).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d, messages
+}
+
+// load 重新读取消息
+func load(t *testing.T, d *gorm.DB, id uint64) Message {
+	t.Helper()
+	var msg Message
+	if err := d.First(&msg, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestDispatchOnce(t *testing.T) {
+	d, messages := setup(t, 3)
+	ch := make(chan Message, len(messages))
+	dispatcher := &Dispatcher{DB: d, Sink: ChanSink(ch)}
+
+	n, err := dispatcher.DispatchOnce(context.Background())
+	if err != nil || n != 3 {
+		t.Fatalf("DispatchOnce = %d, %v", n, err)
+	}
+	close(ch)
+	var received []uint64
+	for msg := range ch {
+		received = append(received, msg.ID)
+	}
+	if len(received) != 3 || received[0] != messages[0].ID {
+		t.Errorf("收到的消息 %v", received)
+	}
+	for _, msg := range messages {
+		if got := load(t, d, msg.ID); got.Status != Done || got.Attempts != 1 || got.ProcessedAt == nil {
+			t.Errorf("消息 %d: Status = %s, Attempts = %d", msg.ID, got.Status, got.Attempts)
+		}
+	}
+
+	if n, err := dispatcher.DispatchOnce(context.Background()); err != nil || n != 0 {
+		t.Errorf("再次投递 DispatchOnce = %d, %v", n, err)
+	}
+}
+
+func TestDispatchOnceLease(t *testing.T) {
+	d, messages := setup(t, 1)
+	id := messages[0].ID
+	other := &Dispatcher{DB: d, Sink: SinkFunc(func(context.Context, Message) error { return nil })}
+
+	var sendErr error
+	dispatcher := &Dispatcher{DB: d, Lease: time.Minute, Sink: SinkFunc(func(ctx context.Context, msg Message) error {
+		// 投递时领取消息的事务已经提交, 其他连接可以立即修改这条消息
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		if err := d.WithContext(ctx).Model(&Message{}).Where("id = ?", id).Update("last_error", "sending").Error; err != nil {
+			sendErr = err
+			return err
+		}
+		// 租约没有到期, 其他 Dispatcher 不会领取这条消息
+		if n, err := other.DispatchOnce(ctx); err != nil || n != 0 {
+			sendErr = errors.New("租约期间消息被再次领取")
+			return sendErr
+		}
+		return nil
+	})}
+
+	if n, err := dispatcher.DispatchOnce(context.Background()); err != nil || n != 1 {
+		t.Fatalf("DispatchOnce = %d, %v", n, err)
+	}
+	if sendErr != nil {
+		t.Fatal(sendErr)
+	}
+	if got := load(t, d, id); got.Status != Done || got.LastError != "" {
+		t.Errorf("Status = %s, LastError = %q", got.Status, got.LastError)
+	}
+}
+
+func TestDispatchOnceRetry(t *testing.T) {
+	d, messages := setup(t, 1)
+	id := messages[0].ID
+	failing := SinkFunc(func(context.Context, Message) error { return errors.New("unavailable") })
+	dispatcher := &Dispatcher{DB: d, Sink: failing, MaxAttempts: 2, Backoff: func(int) time.Duration { return time.Hour }}
+
+	if _, err := dispatcher.DispatchOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := load(t, d, id)
+	if got.Status != Pending || got.Attempts != 1 || got.LastError != "unavailable" || !got.NextAttemptAt.After(time.Now().Add(30*time.Minute)) {
+		t.Fatalf("第一次失败之后: Status = %s, Attempts = %d, LastError = %q, NextAttemptAt = %v", got.Status, got.Attempts, got.LastError, got.NextAttemptAt)
+	}
+
+	if err := d.Model(&Message{}).Where("id = ?", id).Update("next_attempt_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dispatcher.DispatchOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := load(t, d, id); got.Status != Failed || got.Attempts != 2 {
+		t.Errorf("超过最大尝试次数之后: Status = %s, Attempts = %d", got.Status, got.Attempts)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	d, messages := setup(t, 2)
+	received := make(chan string, len(messages))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// JSON 列返回的内容可能经过数据库格式化, 按解析后的值比较
+		var payload struct{ N int }
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.N != 1 || r.Header.Get("X-Outbox-Topic") != "Test.created" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		received <- r.Header.Get("X-Outbox-Id")
+	}))
+	defer server.Close()
+
+	dispatcher := &Dispatcher{DB: d, Sink: &HTTPSink{URL: server.URL}}
+	if n, err := dispatcher.DispatchOnce(context.Background()); err != nil || n != 2 {
+		t.Fatalf("DispatchOnce = %d, %v", n, err)
+	}
+	if len(received) != 2 {
+		t.Errorf("HTTP 服务收到 %d 条消息", len(received))
+	}
+	for _, msg := range messages {
+		if got := load(t, d, msg.ID); got.Status != Done {
+			t.Errorf("消息 %d: Status = %s, LastError = %q", msg.ID, got.Status, got.LastError)
+		}
+	}
+}
+
+func TestHTTPSinkError(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "暂时不可用", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	if err := (&HTTPSink{URL: unavailable.URL}).Send(context.Background(), Message{ID: 1}); err == nil {
+		t.Error("响应状态码不是 2xx 时应该返回错误")
+	}
+
+	done := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer slow.Close()
+	defer close(done)
+	sink := &HTTPSink{URL: slow.URL, Client: &http.Client{Timeout: 50 * time.Millisecond}}
+	if err := sink.Send(context.Background(), Message{ID: 1}); err == nil {
+		t.Error("接收方没有响应时应该超时")
+	}
+	if defaultClient.Timeout != DefaultHTTPTimeout {
+		t.Errorf("默认客户端的超时时间为 %v", defaultClient.Timeout)
+	}
+}
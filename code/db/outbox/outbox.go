@@ -0,0 +1,107 @@
+// 事务性发件箱 (transactional outbox)
+//
+// 领域事件与业务数据在同一个事务中写入 outbox 表, 事务提交则消息一定存在, 回滚则一定不存在;
+// 再由 Dispatcher 轮询 outbox 表, 把消息投递到 Sink:
+//
+//	d.Use(event.Plugin{Bus: bus, Models: models, Recorders: []event.Recorder{outbox.Record}})
+//
+//	dispatcher := &outbox.Dispatcher{DB: d, Sink: &outbox.HTTPSink{URL: "http://127.0.0.1:8080/events"}}
+//	go dispatcher.Run(ctx)
+//
+// 多个 Dispatcher 可以同时运行, 它们使用 SELECT ... FOR UPDATE SKIP LOCKED 领取不同的消息,
+// 领取之后通过推迟 next_attempt_at 持有租约, 投递时不占用事务.
+// 投递至少会成功一次 (at-least-once), 同一条消息可能被重复投递, 接收方应当按 Message.ID 去重
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm-learn/db/event"
+
+	"gorm.io/gorm"
+)
+
+// Status 消息状态
+type Status string
+
+const (
+	// Pending 等待投递, 包括投递失败等待重试的消息
+	Pending Status = "pending"
+	// Done 投递成功
+	Done Status = "done"
+	// Failed 超过最大尝试次数, 不再重试
+	Failed Status = "failed"
+)
+
+// Message outbox 表中的一条消息
+type Message struct {
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// Topic 消息主题, 领域事件为 "模型名.事件类型", 例如 User.created
+	Topic string `gorm:"type:varchar(128);index" json:"topic"`
+	// Key 消息所属记录的主键, 无法确定具体的记录时为空
+	Key string `gorm:"type:varchar(64)" json:"key,omitempty"`
+	// Payload 消息内容
+	Payload       json.RawMessage `gorm:"type:json" json:"payload"`
+	Status        Status          `gorm:"type:varchar(16);not null;default:pending;index:idx_outbox_pending,priority:1" json:"status"`
+	Attempts      int             `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time       `gorm:"index:idx_outbox_pending,priority:2" json:"next_attempt_at"`
+	LastError     string          `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	ProcessedAt   *time.Time      `json:"processed_at,omitempty"`
+}
+
+// TableName 实现 schema.Tabler 接口
+func (Message) TableName() string {
+	return "outbox"
+}
+
+// payload 领域事件在消息中的结构
+type payload struct {
+	Kind    event.Kind  `json:"kind"`
+	Model   string      `json:"model"`
+	Table   string      `json:"table"`
+	Changed []string    `json:"changed,omitempty"`
+	Value   interface{} `json:"value,omitempty"`
+	Time    time.Time   `json:"time"`
+}
+
+// Record 实现 event.Recorder, 把领域事件写入 tx 所在事务的 outbox 表
+//
+// 记录按模型自身的 JSON 格式序列化, 敏感字段同样是脱敏之后的结果
+func Record(tx *gorm.DB, events []event.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	now := tx.NowFunc()
+	messages := make([]Message, 0, len(events))
+	for _, e := range events {
+		data, err := json.Marshal(payload{Kind: e.Kind, Model: e.Model, Table: e.Table, Changed: e.Changed, Value: e.Value, Time: e.Time})
+		if err != nil {
+			return fmt.Errorf("outbox: 序列化 %s %s 事件失败: %w", e.Model, e.Kind, err)
+		}
+		messages = append(messages, Message{
+			Topic:         e.Model + "." + string(e.Kind),
+			Key:           key(tx, e),
+			Payload:       data,
+			Status:        Pending,
+			NextAttemptAt: now,
+		})
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).Create(&messages).Error
+}
+
+// key 返回事件记录的主键
+func key(tx *gorm.DB, e event.Event) string {
+	sch := tx.Statement.Schema
+	if e.Value == nil || sch == nil || sch.PrioritizedPrimaryField == nil {
+		return ""
+	}
+	rv := reflect.Indirect(reflect.ValueOf(e.Value))
+	if v, zero := sch.PrioritizedPrimaryField.ValueOf(tx.Statement.Context, rv); !zero {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Sink 消息的投递目标, 返回错误时消息会被重试
+type Sink interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SinkFunc 使用函数实现 Sink
+type SinkFunc func(ctx context.Context, msg Message) error
+
+// Send 实现 Sink 接口
+func (f SinkFunc) Send(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// FileSink 以 JSON Lines 追加写入文件
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink 打开 path 用于追加写入, 文件不存在时创建
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: f}, nil
+}
+
+// Send 实现 Sink 接口, 每条消息写入一行
+func (s *FileSink) Send(_ context.Context, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close 关闭文件
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// ChanSink 把消息发送到 channel, 用于进程内消费或者测试
+type ChanSink chan<- Message
+
+// Send 实现 Sink 接口, channel 已满时等待, 直到 ctx 被取消
+func (s ChanSink) Send(ctx context.Context, msg Message) error {
+	select {
+	case s <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DefaultHTTPTimeout HTTPSink 没有指定 Client 时每个请求的超时时间
+const DefaultHTTPTimeout = 10 * time.Second
+
+// defaultClient HTTPSink 没有指定 Client 时使用的客户端
+var defaultClient = &http.Client{Timeout: DefaultHTTPTimeout}
+
+// HTTPSink 以 POST 请求投递消息, 请求体为 Payload, 响应状态码不是 2xx 时视为失败
+//
+// 消息的 ID、主题与主键分别放在 X-Outbox-Id、X-Outbox-Topic 与 X-Outbox-Key 请求头中
+type HTTPSink struct {
+	URL string
+	// Client 默认使用超时时间为 DefaultHTTPTimeout 的客户端, 避免无响应的接收方一直占用 Dispatcher
+	Client *http.Client
+}
+
+// Send 实现 Sink 接口
+func (s *HTTPSink) Send(ctx context.Context, msg Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(msg.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Outbox-Id", strconv.FormatUint(msg.ID, 10))
+	req.Header.Set("X-Outbox-Topic", msg.Topic)
+	if msg.Key != "" {
+		req.Header.Set("X-Outbox-Key", msg.Key)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("outbox: %s 返回 %s: %s", s.URL, resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+// 为不支持 RETURNING 的数据库 (例如 MySQL) 模拟 RETURNING 子句
+//
+// 在删除或更新之前, 先在事务中使用相同的条件执行 SELECT ... FOR UPDATE 锁定目标记录,
+// 语句执行成功后再把 clause.Returning 中要求的字段回填到目标对象中:
+//
+//	d.Clauses(clause.Returning{Columns: []clause.Column{{Name: "name"}}}).Delete(&users, "age > ?", 18)
+//
+// 删除时回填的是删除前锁定的记录, 更新时回填的是更新后重新查询的记录
+package returning
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"gorm.io/gorm/utils"
+)
+
+// 保存在 Statement 中的状态
+const (
+	stateKey     = "returning:state"
+	startedTxKey = "returning:started_transaction"
+)
+
+// state 执行语句前记录的状态
+type state struct {
+	// fields RETURNING 要求回填的字段
+	fields []*schema.Field
+	// rows 执行语句前锁定的记录
+	rows reflect.Value
+}
+
+// Plugin 模拟 RETURNING 的 GORM 插件, 数据库原生支持 RETURNING 时不会注册任何回调
+type Plugin struct{}
+
+// Name 实现 gorm.Plugin 接口
+func (Plugin) Name() string {
+	return "gorm-learn:returning"
+}
+
+// Initialize 实现 gorm.Plugin 接口
+func (Plugin) Initialize(db *gorm.DB) error {
+	if !utils.Contains(db.Callback().Delete().Clauses, "RETURNING") {
+		del := db.Callback().Delete()
+		if err := del.Before("gorm:delete").After("gorm:before_delete").Register("returning:before_delete", beforeDelete); err != nil {
+			return err
+		}
+		if err := del.After("gorm:delete").Register("returning:after_delete", afterDelete); err != nil {
+			return err
+		}
+		if err := del.After("gorm:commit_or_rollback_transaction").Register("returning:finish_delete", finish); err != nil {
+			return err
+		}
+	}
+
+	if !utils.Contains(db.Callback().Update().Clauses, "RETURNING") {
+		upd := db.Callback().Update()
+		if err := upd.Before("gorm:update").After("gorm:before_update").Register("returning:before_update", beforeUpdate); err != nil {
+			return err
+		}
+		if err := upd.After("gorm:update").Register("returning:after_update", afterUpdate); err != nil {
+			return err
+		}
+		if err := upd.After("gorm:commit_or_rollback_transaction").Register("returning:finish_update", finish); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returningFields 返回 RETURNING 子句要求回填的字段, 语句中没有 RETURNING 时返回 false
+func returningFields(db *gorm.DB) ([]*schema.Field, bool) {
+	stmt := db.Statement
+	if db.Error != nil || db.DryRun || stmt.Schema == nil || stmt.SQL.Len() > 0 {
+		return nil, false
+	}
+	c, ok := stmt.Clauses["RETURNING"]
+	if !ok {
+		return nil, false
+	}
+
+	returning, _ := c.Expression.(clause.Returning)
+	if len(returning.Columns) == 0 || (len(returning.Columns) == 1 && returning.Columns[0].Name == "*") {
+		fields := make([]*schema.Field, 0, len(stmt.Schema.DBNames))
+		for _, name := range stmt.Schema.DBNames {
+			fields = append(fields, stmt.Schema.FieldsByDBName[name])
+		}
+		return fields, true
+	}
+
+	fields := make([]*schema.Field, 0, len(returning.Columns))
+	for _, column := range returning.Columns {
+		field := stmt.Schema.LookUpField(column.Name)
+		if field == nil || field.DBName == "" {
+			db.AddError(fmt.Errorf("RETURNING 中的字段 %s 不存在于 %s", column.Name, stmt.Schema.Name))
+			return nil, false
+		}
+		fields = append(fields, field)
+	}
+	return fields, true
+}
+
+// beforeDelete 删除前锁定并读取即将被删除的记录
+func beforeDelete(db *gorm.DB) {
+	fields, ok := returningFields(db)
+	if !ok {
+		return
+	}
+	conds, ok := conditions(db, false)
+	if !ok || !begin(db) {
+		return
+	}
+	if rows, err := lockRows(db, conds, fields); db.AddError(err) == nil {
+		db.InstanceSet(stateKey, &state{fields: fields, rows: rows})
+	}
+}
+
+// afterDelete 删除成功后把锁定的记录回填到目标对象
+func afterDelete(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	if v, ok := db.InstanceGet(stateKey); ok {
+		st := v.(*state)
+		fill(db, st.rows, st.fields)
+	}
+}
+
+// beforeUpdate 更新前锁定目标记录并记下它们的主键
+func beforeUpdate(db *gorm.DB) {
+	fields, ok := returningFields(db)
+	if !ok {
+		return
+	}
+	conds, ok := conditions(db, true)
+	if !ok || !begin(db) {
+		return
+	}
+	if rows, err := lockRows(db, conds, db.Statement.Schema.PrimaryFields); db.AddError(err) == nil {
+		db.InstanceSet(stateKey, &state{fields: fields, rows: rows})
+	}
+}
+
+// afterUpdate 更新成功后按主键重新查询记录并回填到目标对象
+func afterUpdate(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	v, ok := db.InstanceGet(stateKey)
+	if !ok {
+		return
+	}
+	st := v.(*state)
+
+	stmt := db.Statement
+	_, pkValues := schema.GetIdentityFieldValuesMap(stmt.Context, st.rows, stmt.Schema.PrimaryFields)
+	if len(pkValues) == 0 {
+		return
+	}
+	column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, pkValues)
+	rows, err := selectRows(db.Session(&gorm.Session{NewDB: true}).Unscoped(), db, []clause.Expression{clause.IN{Column: column, Values: values}}, st.fields)
+	if db.AddError(err) == nil {
+		fill(db, rows, st.fields)
+	}
+}
+
+// conditions 按照 GORM 删除 / 更新回调的方式收集语句最终会使用的条件
+//
+// 没有任何条件且不允许全局更新时返回 false, 交由 GORM 报告 ErrMissingWhereClause
+func conditions(db *gorm.DB, update bool) ([]clause.Expression, bool) {
+	stmt := db.Statement
+	var conds []clause.Expression
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			conds = append(conds, where.Exprs...)
+		}
+	}
+
+	addPrimaryKeys := func(value reflect.Value) {
+		_, pkValues := schema.GetIdentityFieldValuesMap(stmt.Context, value, stmt.Schema.PrimaryFields)
+		if column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, pkValues); len(values) > 0 {
+			conds = append(conds, clause.IN{Column: column, Values: values})
+		}
+	}
+	addPrimaryKeys(stmt.ReflectValue)
+	if stmt.ReflectValue.CanAddr() && stmt.Dest != stmt.Model && stmt.Model != nil {
+		if update {
+			// 使用结构体更新时, GORM 会把其中非零的主键作为条件
+			if dest := reflect.Indirect(reflect.ValueOf(stmt.Dest)); dest.Kind() == reflect.Struct && dest.Type() == stmt.Schema.ModelType {
+				addPrimaryKeys(dest)
+			}
+		} else {
+			addPrimaryKeys(reflect.ValueOf(stmt.Model))
+		}
+	}
+
+	if len(conds) == 0 && !db.AllowGlobalUpdate {
+		return nil, false
+	}
+	return conds, true
+}
+
+// lockRows 使用 SELECT ... FOR UPDATE 锁定满足条件的记录
+func lockRows(db *gorm.DB, conds []clause.Expression, fields []*schema.Field) (reflect.Value, error) {
+	tx := db.Session(&gorm.Session{NewDB: true}).Clauses(clause.Locking{Strength: "UPDATE"})
+	if db.Statement.Unscoped {
+		tx = tx.Unscoped()
+	}
+	return selectRows(tx, db, conds, fields)
+}
+
+// selectRows 查询指定字段以及主键, 返回模型类型的切片
+func selectRows(tx, db *gorm.DB, conds []clause.Expression, fields []*schema.Field) (reflect.Value, error) {
+	sch := db.Statement.Schema
+	columns := make([]string, 0, len(fields)+len(sch.PrimaryFields))
+	for _, group := range [][]*schema.Field{fields, sch.PrimaryFields} {
+		for _, field := range group {
+			if !utils.Contains(columns, field.DBName) {
+				columns = append(columns, field.DBName)
+			}
+		}
+	}
+
+	rows := reflect.New(reflect.SliceOf(sch.ModelType))
+	err := tx.Model(reflect.New(sch.ModelType).Interface()).
+		Table(db.Statement.Table).
+		Select(columns).
+		Clauses(clause.Where{Exprs: conds}).
+		Find(rows.Interface()).Error
+	return rows.Elem(), err
+}
+
+// fill 把查询到的记录中指定的字段回填到语句的目标对象
+//
+// 目标为空切片时追加新元素, 否则按主键匹配已有的元素
+func fill(db *gorm.DB, rows reflect.Value, fields []*schema.Field) {
+	stmt := db.Statement
+	target := stmt.ReflectValue
+	if !target.CanAddr() {
+		return
+	}
+
+	byKey := make(map[string]reflect.Value, rows.Len())
+	for i := 0; i < rows.Len(); i++ {
+		byKey[primaryKey(db, rows.Index(i))] = rows.Index(i)
+	}
+
+	switch target.Kind() {
+	case reflect.Slice:
+		if target.Len() == 0 {
+			elemType := target.Type().Elem()
+			out := reflect.MakeSlice(target.Type(), 0, rows.Len())
+			for i := 0; i < rows.Len(); i++ {
+				elem := reflect.New(stmt.Schema.ModelType)
+				copyFields(db, elem.Elem(), rows.Index(i), fields)
+				if elemType.Kind() != reflect.Ptr {
+					elem = elem.Elem()
+				}
+				out = reflect.Append(out, elem)
+			}
+			target.Set(out)
+			return
+		}
+		for i := 0; i < target.Len(); i++ {
+			elem := reflect.Indirect(target.Index(i))
+			if row, ok := byKey[primaryKey(db, elem)]; ok {
+				copyFields(db, elem, row, fields)
+			}
+		}
+	case reflect.Struct:
+		row, ok := byKey[primaryKey(db, target)]
+		if !ok && rows.Len() > 0 {
+			row, ok = rows.Index(0), true
+		}
+		if ok {
+			copyFields(db, target, row, fields)
+		}
+	}
+}
+
+func copyFields(db *gorm.DB, dst, src reflect.Value, fields []*schema.Field) {
+	for _, field := range fields {
+		field.ReflectValueOf(db.Statement.Context, dst).Set(field.ReflectValueOf(db.Statement.Context, src))
+	}
+}
+
+// primaryKey 把记录的主键拼接为字符串, 用于匹配记录
+func primaryKey(db *gorm.DB, value reflect.Value) string {
+	values := make([]string, 0, len(db.Statement.Schema.PrimaryFields))
+	for _, field := range db.Statement.Schema.PrimaryFields {
+		v, _ := field.ValueOf(db.Statement.Context, value)
+		values = append(values, fmt.Sprint(v))
+	}
+	return strings.Join(values, "\x00")
+}
+
+// begin 保证后续的语句在事务中执行, 需要时开启新的事务
+func begin(db *gorm.DB) bool {
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return true
+	}
+	tx := db.Begin()
+	if db.AddError(tx.Error) != nil {
+		return false
+	}
+	db.Statement.ConnPool = tx.Statement.ConnPool
+	db.InstanceSet(startedTxKey, true)
+	return true
+}
+
+// finish 提交或回滚 begin 开启的事务
+func finish(db *gorm.DB) {
+	if _, ok := db.InstanceGet(startedTxKey); !ok {
+		return
+	}
+	if db.Error != nil {
+		db.Rollback()
+	} else {
+		db.Commit()
+	}
+	db.Statement.ConnPool = db.ConnPool
+}
@@ -0,0 +1,121 @@
+package returning
+
+import (
+	"testing"
+
+	"gorm-learn/db/internal/dbtest"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// testItem 测试使用的模型
+type testItem struct {
+	ID   uint
+	Name string
+	Age  int
+}
+
+func (testItem) TableName() string {
+	return "returning_test_items"
+}
+
+// setup 清空测试表并创建年龄为 10、20、30 的三条记录
+func setup(t *testing.T) (*gorm.DB, []testItem) {
+	t.Helper()
+	d := dbtest.Open(t, Plugin{})
+	dbtest.Migrate(t, d, &testItem{})
+	if err := d.Exec("DELETE FROM returning_test_items").Error; err != nil {
+		t.Fatal(err)
+	}
+	items := []testItem{{Name: "a", Age: 10}, {Name: "b", Age: 20}, {Name: "c", Age: 30}}
+	if err := d.Create(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	return d, items
+}
+
+// columns 返回 RETURNING 子句
+func columns(names ...string) clause.Returning {
+	returning := clause.Returning{}
+	for _, name := range names {
+		returning.Columns = append(returning.Columns, clause.Column{Name: name})
+	}
+	return returning
+}
+
+// count 返回表中的记录数
+func count(t *testing.T, d *gorm.DB) int64 {
+	t.Helper()
+	var n int64
+	if err := d.Model(&testItem{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestDelete(t *testing.T) {
+	d, items := setup(t)
+
+	// 目标为空切片时追加删除的记录, 与原生的 RETURNING 一样只包含要求的字段
+	var deleted []testItem
+	if err := d.Clauses(columns("name")).Delete(&deleted, "age > ?", 15).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 2 || deleted[0].Name != "b" || deleted[1].Name != "c" || deleted[0].ID != 0 || deleted[0].Age != 0 {
+		t.Errorf("删除的记录为 %+v", deleted)
+	}
+	if n := count(t, d); n != 1 {
+		t.Errorf("表中还有 %d 条记录", n)
+	}
+
+	// 按主键删除时回填全部字段
+	item := testItem{ID: items[0].ID}
+	if err := d.Clauses(columns()).Delete(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if item != items[0] {
+		t.Errorf("删除的记录为 %+v, 应该为 %+v", item, items[0])
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	d, items := setup(t)
+
+	// 回填的是更新之后重新查询的值, 包括由数据库计算的值
+	item := testItem{ID: items[0].ID}
+	if err := d.Model(&item).Clauses(columns("name", "age")).Update("age", gorm.Expr("age * ?", 3)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if item.Name != "a" || item.Age != 30 {
+		t.Errorf("更新之后的记录为 %+v", item)
+	}
+
+	// 目标切片中已有的元素按主键匹配
+	targets := []testItem{{ID: items[2].ID}, {ID: items[1].ID}}
+	err := d.Model(&targets).Clauses(columns("age")).Where("age >= ?", 20).Update("age", gorm.Expr("age + ?", 1)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targets[0].Age != 31 || targets[1].Age != 21 {
+		t.Errorf("更新之后的记录为 %+v", targets)
+	}
+}
+
+func TestError(t *testing.T) {
+	d, _ := setup(t)
+
+	// RETURNING 中的字段不存在时不执行删除
+	var deleted []testItem
+	if err := d.Clauses(columns("email")).Delete(&deleted, "age > ?", 0).Error; err == nil {
+		t.Error("字段不存在时应该返回错误")
+	}
+	if n := count(t, d); n != 3 {
+		t.Errorf("表中还有 %d 条记录", n)
+	}
+
+	// 没有条件时与 GORM 一样返回 ErrMissingWhereClause
+	if err := d.Clauses(columns("name")).Delete(&testItem{}).Error; err != gorm.ErrMissingWhereClause {
+		t.Errorf("没有条件时返回 %v", err)
+	}
+}
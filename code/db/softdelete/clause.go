@@ -0,0 +1,109 @@
+package softdelete
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// enabledKey 与 gorm.DeletedAt 共用的标记, 避免同一个语句重复添加软删除条件
+const enabledKey = "soft_delete_enabled"
+
+func queryClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{queryClause{field: f}}
+}
+
+func updateClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{updateClause{field: f}}
+}
+
+func deleteClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{deleteClause{field: f}}
+}
+
+// queryClause 为查询增加未删除的条件, 与 gorm.SoftDeleteQueryClause 相同
+type queryClause struct {
+	field *schema.Field
+}
+
+func (queryClause) Name() string               { return "" }
+func (queryClause) Build(clause.Builder)       {}
+func (queryClause) MergeClause(*clause.Clause) {}
+
+func (c queryClause) ModifyStatement(stmt *gorm.Statement) {
+	if _, ok := stmt.Clauses[enabledKey]; ok || stmt.Statement.Unscoped {
+		return
+	}
+	// 只有一个 Or 条件时, 先把已有的条件用括号括起来, 避免与软删除条件组成 a OR b AND c
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) >= 1 {
+			for _, expr := range where.Exprs {
+				if orCond, ok := expr.(clause.OrConditions); ok && len(orCond.Exprs) == 1 {
+					where.Exprs = []clause.Expression{clause.And(where.Exprs...)}
+					c.Expression = where
+					stmt.Clauses["WHERE"] = c
+					break
+				}
+			}
+		}
+	}
+
+	column := clause.Column{Table: clause.CurrentTable, Name: c.field.DBName}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{Alive(c.field, column)}})
+	stmt.Clauses[enabledKey] = clause.Clause{}
+}
+
+// updateClause 更新时只更新未删除的记录
+type updateClause struct {
+	field *schema.Field
+}
+
+func (updateClause) Name() string               { return "" }
+func (updateClause) Build(clause.Builder)       {}
+func (updateClause) MergeClause(*clause.Clause) {}
+
+func (c updateClause) ModifyStatement(stmt *gorm.Statement) {
+	if stmt.SQL.Len() == 0 && !stmt.Statement.Unscoped {
+		queryClause(c).ModifyStatement(stmt)
+	}
+}
+
+// deleteClause 把 DELETE 改写为写入删除标记的 UPDATE, 与 gorm.SoftDeleteDeleteClause 相同
+type deleteClause struct {
+	field *schema.Field
+}
+
+func (deleteClause) Name() string               { return "" }
+func (deleteClause) Build(clause.Builder)       {}
+func (deleteClause) MergeClause(*clause.Clause) {}
+
+func (c deleteClause) ModifyStatement(stmt *gorm.Statement) {
+	if stmt.SQL.Len() > 0 || stmt.Statement.Unscoped {
+		return
+	}
+	value := deletedValue(c.field, stmt.DB.NowFunc())
+	stmt.AddClause(clause.Set{{Column: clause.Column{Name: c.field.DBName}, Value: value}})
+	stmt.SetColumn(c.field.DBName, value, true)
+
+	if stmt.Schema != nil {
+		_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, stmt.ReflectValue, stmt.Schema.PrimaryFields)
+		column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		if len(values) > 0 {
+			stmt.AddClause(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: values}}})
+		}
+
+		if stmt.ReflectValue.CanAddr() && stmt.Dest != stmt.Model && stmt.Model != nil {
+			_, queryValues = schema.GetIdentityFieldValuesMap(stmt.Context, reflect.ValueOf(stmt.Model), stmt.Schema.PrimaryFields)
+			column, values = schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+			if len(values) > 0 {
+				stmt.AddClause(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: values}}})
+			}
+		}
+	}
+
+	queryClause(c).ModifyStatement(stmt)
+	stmt.AddClauseIfNotExists(clause.Update{})
+	stmt.Build(stmt.DB.Callback().Update().Clauses...)
+}
@@ -0,0 +1,73 @@
+package softdelete
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WithTrashed 查询时包含已删除的记录, 等同于 Unscoped, 因此在其上调用 Delete 会物理删除记录
+//
+//	d.Scopes(softdelete.WithTrashed).Find(&products)
+func WithTrashed(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// OnlyTrashed 只查询已删除的记录
+//
+//	d.Scopes(softdelete.OnlyTrashed).Find(&products)
+func OnlyTrashed(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Where(trashed{})
+}
+
+// Restore 恢复 value 对应的已删除记录, conds 与 Delete 的内联条件相同
+//
+// value 带有主键时只恢复这条记录, 否则恢复所有满足 conds 的已删除记录;
+// 恢复的记录与未删除的记录违反唯一索引时返回数据库的错误
+//
+//	softdelete.Restore(d, &product)
+//	softdelete.Restore(d, &Product{}, "code = ?", "D42")
+func Restore(db *gorm.DB, value interface{}, conds ...interface{}) *gorm.DB {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(value); err != nil {
+		db = db.Session(&gorm.Session{})
+		db.AddError(err)
+		return db
+	}
+	field := Field(stmt.Schema)
+	if field == nil {
+		db = db.Session(&gorm.Session{})
+		db.AddError(fmt.Errorf("softdelete: %s 不支持软删除", stmt.Schema.Name))
+		return db
+	}
+
+	tx := OnlyTrashed(db).Model(value)
+	if len(conds) > 0 {
+		tx = tx.Where(conds[0], conds[1:]...)
+	}
+	return tx.Update(field.DBName, aliveValue(field))
+}
+
+// Purge 物理删除 value 对应的已删除记录, 未删除的记录不受影响, conds 与 Delete 的内联条件相同
+//
+//	softdelete.Purge(d, &Product{}, "deleted_at < ?", cutoff.Unix())
+func Purge(db *gorm.DB, value interface{}, conds ...interface{}) *gorm.DB {
+	return OnlyTrashed(db).Delete(value, conds...)
+}
+
+// trashed 构建语句时根据模型的软删除字段生成已删除的条件
+type trashed struct{}
+
+func (trashed) Build(builder clause.Builder) {
+	stmt, ok := builder.(*gorm.Statement)
+	if !ok {
+		return
+	}
+	field := Field(stmt.Schema)
+	if field == nil {
+		stmt.AddError(fmt.Errorf("softdelete: %s 不支持软删除", stmt.Table))
+		return
+	}
+	Trashed(field, clause.Column{Table: clause.CurrentTable, Name: field.DBName}).Build(stmt)
+}
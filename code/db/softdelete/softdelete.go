@@ -0,0 +1,235 @@
+// 可替换的软删除策略
+//
+// gorm.DeletedAt 使用可以为 NULL 的时间记录删除时间, 唯一索引中的 NULL 互不相等,
+// 无法与业务字段组成唯一索引. 本包提供另外三种不使用 NULL 的软删除字段, 未删除的记录都为 0:
+//
+//	Unix  删除时间的秒级时间戳
+//	Milli 删除时间的毫秒级时间戳
+//	Flag  是否已删除
+//
+// 使用 Unix 或 Milli 时可以把业务字段与删除时间组成唯一索引, 删除之后可以再创建同名的记录:
+//
+//	type Product struct {
+//		Code      string           `gorm:"uniqueIndex:idx_code_deleted_at,priority:1"`
+//		DeletedAt softdelete.Unix  `gorm:"not null;default:0;uniqueIndex:idx_code_deleted_at,priority:2"`
+//	}
+//
+// 同一秒内删除两条相同 Code 的记录时 Unix 仍然会冲突, 此时应当使用 Milli; Flag 只有一个删除状态,
+// 不能用于唯一索引.
+//
+// 查询、更新与删除的行为与 gorm.DeletedAt 相同, Restore、OnlyTrashed、WithTrashed 与 Purge
+// 同时支持 gorm.DeletedAt 与本包中的字段
+package softdelete
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// strategy 软删除字段的类型需要实现的接口
+type strategy interface {
+	// deleted 返回删除时写入的值
+	deleted(now time.Time) interface{}
+}
+
+// Unix 软删除字段, 未删除时为 0, 删除后为删除时间的秒级时间戳
+type Unix int64
+
+// Milli 软删除字段, 未删除时为 0, 删除后为删除时间的毫秒级时间戳
+type Milli int64
+
+// Flag 软删除字段, 未删除时为 false (0), 删除后为 true (1)
+type Flag bool
+
+func (Unix) deleted(now time.Time) interface{}  { return Unix(now.Unix()) }
+func (Milli) deleted(now time.Time) interface{} { return Milli(now.UnixMilli()) }
+func (Flag) deleted(time.Time) interface{}      { return Flag(true) }
+
+// Time 返回删除时间, 未删除时返回零值
+func (u Unix) Time() time.Time {
+	if u == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(u), 0)
+}
+
+// Time 返回删除时间, 未删除时返回零值
+func (m Milli) Time() time.Time {
+	if m == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(m))
+}
+
+// Deleted 判断记录是否已被删除
+func (u Unix) Deleted() bool { return u != 0 }
+
+// Deleted 判断记录是否已被删除
+func (m Milli) Deleted() bool { return m != 0 }
+
+// Deleted 判断记录是否已被删除
+func (f Flag) Deleted() bool { return bool(f) }
+
+// Scan 实现 sql.Scanner 接口, MySQL 的 bool 列为 tinyint, 需要从整数读取
+func (f *Flag) Scan(value interface{}) error {
+	v, err := driver.Bool.ConvertValue(value)
+	if err != nil {
+		return fmt.Errorf("softdelete: 无法把 %v 读取为 Flag: %w", value, err)
+	}
+	*f = Flag(v.(bool))
+	return nil
+}
+
+// Value 实现 driver.Valuer 接口
+func (f Flag) Value() (driver.Value, error) {
+	return bool(f), nil
+}
+
+// QueryClauses 实现 schema.QueryClausesInterface, 查询时只返回未删除的记录
+func (Unix) QueryClauses(f *schema.Field) []clause.Interface { return queryClauses(f) }
+
+// UpdateClauses 实现 schema.UpdateClausesInterface, 只更新未删除的记录
+func (Unix) UpdateClauses(f *schema.Field) []clause.Interface { return updateClauses(f) }
+
+// DeleteClauses 实现 schema.DeleteClausesInterface, 删除时改为更新删除时间
+func (Unix) DeleteClauses(f *schema.Field) []clause.Interface { return deleteClauses(f) }
+
+// QueryClauses 实现 schema.QueryClausesInterface, 查询时只返回未删除的记录
+func (Milli) QueryClauses(f *schema.Field) []clause.Interface { return queryClauses(f) }
+
+// UpdateClauses 实现 schema.UpdateClausesInterface, 只更新未删除的记录
+func (Milli) UpdateClauses(f *schema.Field) []clause.Interface { return updateClauses(f) }
+
+// DeleteClauses 实现 schema.DeleteClausesInterface, 删除时改为更新删除时间
+func (Milli) DeleteClauses(f *schema.Field) []clause.Interface { return deleteClauses(f) }
+
+// QueryClauses 实现 schema.QueryClausesInterface, 查询时只返回未删除的记录
+func (Flag) QueryClauses(f *schema.Field) []clause.Interface { return queryClauses(f) }
+
+// UpdateClauses 实现 schema.UpdateClausesInterface, 只更新未删除的记录
+func (Flag) UpdateClauses(f *schema.Field) []clause.Interface { return updateClauses(f) }
+
+// DeleteClauses 实现 schema.DeleteClausesInterface, 删除时改为设置删除标记
+func (Flag) DeleteClauses(f *schema.Field) []clause.Interface { return deleteClauses(f) }
+
+// deletedAtType gorm.DeletedAt 的反射类型
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// IsField 判断字段是否为软删除字段, 包括 gorm.DeletedAt 与本包中的类型
+func IsField(field *schema.Field) bool {
+	if field == nil || field.DBName == "" {
+		return false
+	}
+	if field.FieldType == deletedAtType {
+		return true
+	}
+	_, ok := reflect.Zero(field.FieldType).Interface().(strategy)
+	return ok
+}
+
+// Field 返回模型的软删除字段, 模型不支持软删除时返回 nil
+func Field(sch *schema.Schema) *schema.Field {
+	if sch == nil {
+		return nil
+	}
+	for _, field := range sch.Fields {
+		if IsField(field) {
+			return field
+		}
+	}
+	return nil
+}
+
+// TracksTime 判断软删除字段是否记录了删除时间, Flag 只记录是否已删除
+func TracksTime(field *schema.Field) bool {
+	return field.FieldType != reflect.TypeOf(Flag(false))
+}
+
+// Alive 返回记录未被删除的条件: gorm.DeletedAt 为 IS NULL, 其他字段为 = 0
+func Alive(field *schema.Field, column clause.Column) clause.Expression {
+	if field.FieldType == deletedAtType {
+		return clause.Eq{Column: column, Value: nil}
+	}
+	// 直接写入 0 而不是占位符, 防火墙可以把它识别为软删除条件
+	return clause.Expr{SQL: "? = 0", Vars: []interface{}{column}}
+}
+
+// Trashed 返回记录已被删除的条件: gorm.DeletedAt 为 IS NOT NULL, 其他字段为 <> 0
+func Trashed(field *schema.Field, column clause.Column) clause.Expression {
+	if field.FieldType == deletedAtType {
+		return clause.Neq{Column: column, Value: nil}
+	}
+	return clause.Expr{SQL: "? <> 0", Vars: []interface{}{column}}
+}
+
+// DeletedBefore 返回在 t 之前被删除的条件, Flag 没有记录删除时间, 返回 false
+func DeletedBefore(field *schema.Field, column clause.Column, t time.Time) (clause.Expression, bool) {
+	var value interface{}
+	switch field.FieldType {
+	case deletedAtType:
+		value = t
+	case reflect.TypeOf(Unix(0)):
+		value = t.Unix()
+	case reflect.TypeOf(Milli(0)):
+		value = t.UnixMilli()
+	default:
+		return nil, false
+	}
+	return clause.And(Trashed(field, column), clause.Lt{Column: column, Value: value}), true
+}
+
+// DeletedAt 返回在 t 时刻被删除的条件, 即软删除字段等于删除时写入的值; Flag 没有记录删除时间, 返回 false
+func DeletedAt(field *schema.Field, column clause.Column, t time.Time) (clause.Expression, bool) {
+	if !TracksTime(field) {
+		return nil, false
+	}
+	return clause.Eq{Column: column, Value: deletedValue(field, t)}, true
+}
+
+// Precision 返回软删除字段记录删除时间的精度: Unix 为秒, Milli 与 gorm.DeletedAt 为毫秒, Flag 为 0
+//
+// gorm.DeletedAt 按 MySQL 默认的 datetime(3) 列计算
+func Precision(field *schema.Field) time.Duration {
+	switch field.FieldType {
+	case reflect.TypeOf(Unix(0)):
+		return time.Second
+	case reflect.TypeOf(Flag(false)):
+		return 0
+	}
+	return time.Millisecond
+}
+
+// TimeOf 返回软删除字段的值中记录的删除时间, 未删除或者没有记录删除时间时返回 false
+func TimeOf(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case gorm.DeletedAt:
+		return v.Time, v.Valid
+	case Unix:
+		return v.Time(), v.Deleted()
+	case Milli:
+		return v.Time(), v.Deleted()
+	}
+	return time.Time{}, false
+}
+
+// deletedValue 在 now 删除记录时写入的值
+func deletedValue(field *schema.Field, now time.Time) interface{} {
+	if field.FieldType == deletedAtType {
+		return now
+	}
+	return reflect.Zero(field.FieldType).Interface().(strategy).deleted(now)
+}
+
+// aliveValue 恢复记录时写入的值
+func aliveValue(field *schema.Field) interface{} {
+	if field.FieldType == deletedAtType {
+		return nil
+	}
+	return reflect.Zero(field.FieldType).Interface()
+}
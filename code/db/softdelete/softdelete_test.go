@@ -0,0 +1,124 @@
+// 外部测试包: dbtest 依赖的 firewall 包引用了 softdelete
+package softdelete_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm-learn/db/internal/dbtest"
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/gorm"
+)
+
+// testItem 测试使用的模型, 每种软删除字段使用各自的表
+type testItem[T any] struct {
+	ID        uint
+	Name      string
+	DeletedAt T
+}
+
+func (testItem[T]) TableName() string {
+	var zero T
+	return "softdelete_test_" + strings.ToLower(reflect.TypeOf(zero).Name())
+}
+
+// plainItem 不支持软删除的模型
+type plainItem struct {
+	ID   uint
+	Name string
+}
+
+func (plainItem) TableName() string {
+	return "softdelete_test_plain"
+}
+
+func TestScopes(t *testing.T) {
+	d := dbtest.Open(t)
+	tests := []struct {
+		name string
+		run  func(t *testing.T, d *gorm.DB)
+	}{
+		{"gorm.DeletedAt", testScopes[gorm.DeletedAt]},
+		{"Unix", testScopes[softdelete.Unix]},
+		{"Milli", testScopes[softdelete.Milli]},
+		{"Flag", testScopes[softdelete.Flag]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, d)
+		})
+	}
+}
+
+// testScopes 创建 a、b、c 三条记录并软删除 a 与 b, 依次检查 WithTrashed、OnlyTrashed、Restore 与 Purge
+func testScopes[T any](t *testing.T, d *gorm.DB) {
+	dbtest.Migrate(t, d, &testItem[T]{})
+	if err := d.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&testItem[T]{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	items := []testItem[T]{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	if err := d.Create(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete(&testItem[T]{}, []uint{items[0].ID, items[1].ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// names 返回 scopes 查询到的记录名称
+	names := func(scopes ...func(*gorm.DB) *gorm.DB) string {
+		t.Helper()
+		var got []string
+		if err := d.Model(&testItem[T]{}).Scopes(scopes...).Order("name").Pluck("name", &got).Error; err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(got, ",")
+	}
+	if got := names(); got != "c" {
+		t.Errorf("默认查询到 %q", got)
+	}
+	if got := names(softdelete.WithTrashed); got != "a,b,c" {
+		t.Errorf("WithTrashed 查询到 %q", got)
+	}
+	if got := names(softdelete.OnlyTrashed); got != "a,b" {
+		t.Errorf("OnlyTrashed 查询到 %q", got)
+	}
+
+	// 带有主键时只恢复这条记录
+	if tx := softdelete.Restore(d, &testItem[T]{ID: items[0].ID}); tx.Error != nil || tx.RowsAffected != 1 {
+		t.Fatalf("Restore: %v, RowsAffected = %d", tx.Error, tx.RowsAffected)
+	}
+	var restored testItem[T]
+	if err := d.First(&restored, items[0].ID).Error; err != nil {
+		t.Fatalf("恢复之后查询不到记录: %v", err)
+	}
+	if !reflect.ValueOf(restored.DeletedAt).IsZero() {
+		t.Errorf("恢复之后软删除字段为 %v", restored.DeletedAt)
+	}
+	if got := names(softdelete.OnlyTrashed); got != "b" {
+		t.Errorf("恢复之后 OnlyTrashed 查询到 %q", got)
+	}
+
+	// Purge 只删除已删除的记录
+	if tx := softdelete.Purge(d, &testItem[T]{}, "name = ?", "c"); tx.Error != nil || tx.RowsAffected != 0 {
+		t.Errorf("Purge 未删除的记录: %v, RowsAffected = %d", tx.Error, tx.RowsAffected)
+	}
+	if tx := softdelete.Purge(d, &testItem[T]{}); tx.Error != nil || tx.RowsAffected != 1 {
+		t.Errorf("Purge: %v, RowsAffected = %d", tx.Error, tx.RowsAffected)
+	}
+	if got := names(softdelete.WithTrashed); got != "a,c" {
+		t.Errorf("Purge 之后 WithTrashed 查询到 %q", got)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	d := dbtest.Open(t)
+	dbtest.Migrate(t, d, &plainItem{})
+	if err := softdelete.Restore(d, &plainItem{ID: 1}).Error; err == nil {
+		t.Error("Restore 不支持软删除的模型时应该返回错误")
+	}
+	if err := softdelete.Purge(d, &plainItem{}).Error; err == nil {
+		t.Error("Purge 不支持软删除的模型时应该返回错误")
+	}
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LockMode 读取库存时加锁的方式
+type LockMode int
+
+const (
+	// LockWait SELECT ... FOR UPDATE, 行被锁定时等待, 超过 innodb_lock_wait_timeout 返回 ErrLockTimeout
+	LockWait LockMode = iota
+	// LockNoWait SELECT ... FOR UPDATE NOWAIT, 行被锁定时立即返回 ErrLockNotAvailable
+	LockNoWait
+	// LockSkipLocked SELECT ... FOR UPDATE SKIP LOCKED, 行被锁定时跳过, 返回 ErrLockNotAvailable
+	LockSkipLocked
+)
+
+func (m LockMode) String() string {
+	switch m {
+	case LockNoWait:
+		return "NOWAIT"
+	case LockSkipLocked:
+		return "SKIP LOCKED"
+	default:
+		return "WAIT"
+	}
+}
+
+// clause 返回对应的锁定子句
+func (m LockMode) clause() clause.Locking {
+	locking := clause.Locking{Strength: clause.LockingStrengthUpdate}
+	switch m {
+	case LockNoWait:
+		locking.Options = clause.LockingOptionsNoWait
+	case LockSkipLocked:
+		locking.Options = clause.LockingOptionsSkipLocked
+	}
+	return locking
+}
+
+// ErrCodeLockNoWait NOWAIT 加锁失败 (3572)
+const ErrCodeLockNoWait = 3572
+
+var (
+	// ErrInsufficientStock 库存不足
+	ErrInsufficientStock = errors.New("库存不足")
+	// ErrLockTimeout 等待行锁超时
+	ErrLockTimeout = errors.New("等待行锁超时")
+	// ErrLockNotAvailable 使用 NOWAIT 或者 SKIP LOCKED 时行已经被其他事务锁定
+	ErrLockNotAvailable = errors.New("行已经被其他事务锁定")
+)
+
+// LockError 加锁失败的详细信息, 可以通过 errors.Is 与 ErrLockTimeout、ErrLockNotAvailable 比较
+type LockError struct {
+	// Mode 加锁的方式
+	Mode LockMode
+	// Table 加锁的表
+	Table string
+	// ID 加锁的记录主键
+	ID uint
+	// Err 数据库返回的错误, SKIP LOCKED 跳过记录时为 nil
+	Err error
+}
+
+func (e *LockError) Error() string {
+	msg := fmt.Sprintf("%s(%d) 加锁失败 (%s): %v", e.Table, e.ID, e.Mode, e.kind())
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// kind 返回对应的哨兵错误
+func (e *LockError) kind() error {
+	if e.Mode == LockWait {
+		return ErrLockTimeout
+	}
+	return ErrLockNotAvailable
+}
+
+// Is 使 errors.Is(err, ErrLockTimeout) 或者 errors.Is(err, ErrLockNotAvailable) 成立
+func (e *LockError) Is(target error) bool {
+	return target == e.kind()
+}
+
+// Unwrap 返回数据库错误, 锁等待超时仍然可以被 IsRetryable 识别
+func (e *LockError) Unwrap() error {
+	return e.Err
+}
+
+// lockError 把数据库返回的加锁错误转换为 *LockError, 其他错误原样返回
+func lockError(err error, table string, id uint) error {
+	var mysqlErr *mysqldriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case ErrCodeLockWaitTimeout:
+			return &LockError{Mode: LockWait, Table: table, ID: id, Err: err}
+		case ErrCodeLockNoWait:
+			return &LockError{Mode: LockNoWait, Table: table, ID: id, Err: err}
+		}
+	}
+	return err
+}
+
+// Reserve 在 tx 所在的事务中锁定商品并扣减 qty 件库存, 成功后 p 为扣减之后的记录
+//
+// 库存在行锁中检查并扣减, 并发调用不会超卖; 库存不足时返回 ErrInsufficientStock, 不修改数据.
+// tx 必须处于事务中, 否则行锁在 SELECT 结束后就会释放
+func (p *Product) Reserve(tx *gorm.DB, qty int, mode LockMode) error {
+	if qty <= 0 {
+		return fmt.Errorf("扣减的库存数量必须大于 0: %d", qty)
+	}
+	id := p.ID
+	var locked Product
+	err := tx.Clauses(mode.clause()).Take(&locked, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && mode == LockSkipLocked {
+		// SKIP LOCKED 跳过了被锁定的行, 不加锁再查询一次区分记录不存在与被锁定
+		var n int64
+		if err := tx.Model(&Product{}).Where("id = ?", id).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return &LockError{Mode: mode, Table: "products", ID: id}
+		}
+	}
+	if err != nil {
+		return lockError(err, "products", id)
+	}
+	if locked.Stock < qty {
+		*p = locked
+		return fmt.Errorf("%w: 商品 %s 剩余 %d, 需要 %d", ErrInsufficientStock, locked.Code, locked.Stock, qty)
+	}
+
+	// 记录已经被锁定, 版本号一定是最新的, 乐观锁检查总是通过
+	if err := tx.Model(&locked).Update("stock", locked.Stock-qty).Error; err != nil {
+		return err
+	}
+	*p = locked
+	return nil
+}
+
+// ReserveStock 在事务中扣减商品 id 的 qty 件库存, 返回扣减之后的商品
+//
+// ctx 携带 WithTx 开启的事务时加入该事务, 否则开启新的事务; 锁等待超时会按 WithTx 的规则重试,
+// 仍然失败时返回的错误满足 errors.Is(err, ErrLockTimeout)
+func ReserveStock(ctx context.Context, id uint, qty int, mode LockMode) (*Product, error) {
+	product := &Product{}
+	err := WithTx(ctx, func(tx *gorm.DB) error {
+		product.ID = id
+		return product.Reserve(tx, qty, mode)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm-learn/db/types"
+
+	"gorm.io/gorm/clause"
+)
+
+// createProduct 创建库存为 stock 的商品, 每次使用不同的编码
+func createProduct(t *testing.T, stock int) *Product {
+	t.Helper()
+	product := &Product{Code: fmt.Sprintf("S%d", time.Now().UnixNano()), Price: types.MustMoney("10", "CNY"), Stock: stock}
+	if err := testDB(t).Create(product).Error; err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func TestReserveStockConcurrent(t *testing.T) {
+	const buyers, stock = 20, 5
+	d := testDB(t)
+	product := createProduct(t, stock)
+
+	errs := make(chan error, buyers)
+	var wg sync.WaitGroup
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ReserveStock(context.Background(), product.ID, 1, LockWait)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var reserved, insufficient int
+	for err := range errs {
+		switch {
+		case err == nil:
+			reserved++
+		case errors.Is(err, ErrInsufficientStock):
+			insufficient++
+		default:
+			t.Errorf("ReserveStock: %v", err)
+		}
+	}
+	if reserved != stock || insufficient != buyers-stock {
+		t.Errorf("成功 %d 次, 库存不足 %d 次, 应该分别为 %d 与 %d", reserved, insufficient, stock, buyers-stock)
+	}
+
+	var left Product
+	if err := d.First(&left, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if left.Stock != 0 {
+		t.Errorf("剩余库存为 %d, 应该为 0", left.Stock)
+	}
+}
+
+func TestReserveStockLockNotAvailable(t *testing.T) {
+	d := testDB(t)
+	product := createProduct(t, 1)
+
+	// 另一个事务持有行锁
+	holder := d.Begin()
+	if err := holder.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).Take(&Product{}, product.ID).Error; err != nil {
+		holder.Rollback()
+		t.Fatal(err)
+	}
+	defer holder.Rollback()
+
+	for _, mode := range []LockMode{LockNoWait, LockSkipLocked} {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := ReserveStock(ctx, product.ID, 1, mode)
+		cancel()
+		if !errors.Is(err, ErrLockNotAvailable) {
+			t.Errorf("%s: 应该返回 ErrLockNotAvailable, 实际为 %v", mode, err)
+		}
+		var lockErr *LockError
+		if errors.As(err, &lockErr) && lockErr.Mode != mode {
+			t.Errorf("%s: LockError.Mode = %s", mode, lockErr.Mode)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package db
+
+import "gorm-learn/db/temporal"
+
+// versionedModels 版本化的模型, 每次更新与删除之前的版本保存在 <表名>_history 表中,
+// 通过 temporal.AsOf 查询任意时刻的状态
+var versionedModels = []interface{}{&Product{}}
+
+// versioned 返回 models 中版本化的模型
+func versioned(models []interface{}) []interface{} {
+	var result []interface{}
+	for _, model := range models {
+		if modelOf(versionedModels, model) {
+			result = append(result, model)
+		}
+	}
+	return result
+}
+
+// MigrateHistory 为 models 中版本化的模型创建历史表, Migrate 会自动调用
+func MigrateHistory(models ...interface{}) error {
+	return temporal.Migrate(DB(), versioned(models)...)
+}
@@ -0,0 +1,91 @@
+package temporal
+
+import (
+	"reflect"
+	"strings"
+
+	"gorm-learn/db/internal/callbacks"
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Plugin 在更新与删除之前把记录的当前版本复制到历史表的 GORM 插件,
+// 需要在 GORM 默认的事务中执行, 语句失败回滚时复制的版本同样会被回滚
+type Plugin struct {
+	// Models 版本化的模型, 需要先通过 Migrate 创建历史表
+	Models []interface{}
+}
+
+// Name 实现 gorm.Plugin 接口
+func (Plugin) Name() string {
+	return "gorm-learn:temporal"
+}
+
+// Initialize 实现 gorm.Plugin 接口
+func (p Plugin) Initialize(db *gorm.DB) error {
+	v := &versioner{models: map[reflect.Type]bool{}}
+	for _, model := range p.Models {
+		sch, err := parse(db, model)
+		if err != nil {
+			return err
+		}
+		v.models[sch.ModelType] = true
+	}
+	if err := db.Callback().Update().After("gorm:before_update").Before("gorm:update").Register("temporal:before_update", v.archive); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:before_delete").Before("gorm:delete").Register("temporal:before_delete", v.archive)
+}
+
+// versioner 复制记录的历史版本
+type versioner struct {
+	models map[reflect.Type]bool
+}
+
+// archive 使用与语句相同的条件, 把受影响记录的当前版本复制到历史表
+//
+//	INSERT INTO `products_history` (`id`,...,`valid_from`,`valid_to`)
+//	SELECT `products`.`id`,...,COALESCE((SELECT MAX(`valid_to`) FROM `products_history` WHERE 主键相同), `products`.`created_at`), now
+//	FROM `products` WHERE 语句的条件 AND `products`.`deleted_at` = 0
+func (v *versioner) archive(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || db.DryRun || stmt.Schema == nil || !v.models[stmt.Schema.ModelType] || stmt.SQL.Len() > 0 {
+		return
+	}
+	conds := callbacks.Conditions(stmt)
+	if len(conds) == 0 && !db.AllowGlobalUpdate {
+		return
+	}
+	if field := softdelete.Field(stmt.Schema); field != nil && !stmt.Unscoped {
+		conds = append(conds, softdelete.Alive(field, clause.Column{Table: clause.CurrentTable, Name: field.DBName}))
+	}
+
+	table, history := stmt.Table, HistoryTable(stmt.Table)
+	fields := columns(stmt.Schema)
+	targets := make([]string, 0, len(fields)+2)
+	selects := make([]string, 0, len(fields)+2)
+	for _, field := range fields {
+		targets = append(targets, stmt.Quote(field.DBName))
+		selects = append(selects, stmt.Quote(clause.Column{Table: table, Name: field.DBName}))
+	}
+	targets = append(targets, stmt.Quote(ValidFromColumn), stmt.Quote(ValidToColumn))
+	// 同一个表在 INSERT 与子查询中同时出现时需要别名
+	selects = append(selects,
+		"COALESCE((SELECT MAX(h."+stmt.Quote(ValidToColumn)+") FROM "+stmt.Quote(history)+" h WHERE "+samePrimaryKey(stmt, "h", table)+"), "+
+			stmt.Quote(clause.Column{Table: table, Name: createdAt(stmt.Schema).DBName})+")",
+		"?",
+	)
+
+	sql := "INSERT INTO " + stmt.Quote(history) + " (" + strings.Join(targets, ",") + ") SELECT " + strings.Join(selects, ",") + " FROM " + stmt.Quote(table)
+	vars := []interface{}{db.NowFunc()}
+	if len(conds) > 0 {
+		sql += " WHERE ?"
+		vars = append(vars, clause.And(conds...))
+	}
+	// 条件中的 clause.CurrentTable 需要解析为语句的表名, softdelete.OnlyTrashed 等条件在生成 SQL 时需要模型的结构
+	tx := db.Session(&gorm.Session{NewDB: true}).Table(table)
+	tx.Statement.Schema = stmt.Schema
+	db.AddError(tx.Exec(sql, vars...).Error)
+}
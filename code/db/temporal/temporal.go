@@ -0,0 +1,225 @@
+// 系统版本化的历史表 (system-versioned temporal table)
+//
+// 注册的模型在每次更新与删除之前, 插件使用 INSERT ... SELECT 把受影响记录的当前版本复制到
+// <表名>_history 表中, 并记录这个版本的有效期 [valid_from, valid_to):
+//
+//	d.Use(temporal.Plugin{Models: []interface{}{&Product{}}})
+//	temporal.Migrate(d, &Product{}) // 创建 products_history 表
+//
+//	d.Model(&product).Update("price_amount", 20)
+//	d.Scopes(temporal.AsOf(lastMonth)).First(&old, product.ID) // 查询上个月时的价格
+//
+// 版本的 valid_from 为上一个版本的 valid_to, 没有历史版本时为记录的创建时间, 因此模型需要 CreatedAt 字段.
+// 软删除同样会产生历史版本, AsOf 与普通查询一样默认排除查询时刻已经删除的记录.
+// 插件不是模型的钩子, UpdateColumn 等跳过钩子的更新同样产生历史版本;
+// 只有 Exec 执行的原生 SQL 不经过插件, 不会产生历史版本
+package temporal
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm-learn/db/firewall"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// 历史表中额外的列
+const (
+	HistoryIDColumn = "history_id"
+	ValidFromColumn = "valid_from"
+	ValidToColumn   = "valid_to"
+)
+
+// HistoryTable 返回 table 的历史表名
+func HistoryTable(table string) string {
+	return table + "_history"
+}
+
+// historyTypes 按模型缓存历史表的结构体类型
+var historyTypes sync.Map
+
+// historyType 使用 reflect.StructOf 生成历史表的结构体类型, 只用于迁移
+//
+// 包含模型的全部列以及 history_id、valid_from、valid_to, 不复制唯一索引等约束,
+// 同一条记录的多个版本可以共存; 主键与 valid_to 组成索引, 用于查找记录在某一时刻的版本
+func historyType(sch *schema.Schema) reflect.Type {
+	if t, ok := historyTypes.Load(sch); ok {
+		return t.(reflect.Type)
+	}
+	index := "idx_" + HistoryTable(sch.Table) + "_valid_to"
+	fields := []reflect.StructField{{
+		Name: "HistoryID",
+		Type: reflect.TypeOf(uint64(0)),
+		Tag:  reflect.StructTag(fmt.Sprintf(`gorm:"column:%s;primaryKey;autoIncrement"`, HistoryIDColumn)),
+	}}
+	for i, field := range columns(sch) {
+		settings := []string{"column:" + field.DBName}
+		for _, key := range []string{"TYPE", "SERIALIZER", "SIZE", "PRECISION", "SCALE"} {
+			if v, ok := field.TagSettings[key]; ok {
+				settings = append(settings, strings.ToLower(key)+":"+v)
+			}
+		}
+		if field.PrimaryKey {
+			settings = append(settings, fmt.Sprintf("index:%s,priority:%d", index, i+1))
+		}
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("Field%d", i),
+			Type: field.FieldType,
+			Tag:  reflect.StructTag(fmt.Sprintf(`gorm:"%s"`, strings.Join(settings, ";"))),
+		})
+	}
+	fields = append(fields,
+		reflect.StructField{
+			Name: "ValidFrom",
+			Type: reflect.TypeOf(time.Time{}),
+			Tag:  reflect.StructTag(fmt.Sprintf(`gorm:"column:%s;not null"`, ValidFromColumn)),
+		},
+		reflect.StructField{
+			Name: "ValidTo",
+			Type: reflect.TypeOf(time.Time{}),
+			Tag:  reflect.StructTag(fmt.Sprintf(`gorm:"column:%s;not null;index:%s,priority:%d"`, ValidToColumn, index, len(sch.PrimaryFields)+1)),
+		},
+	)
+	t, _ := historyTypes.LoadOrStore(sch, reflect.StructOf(fields))
+	return t.(reflect.Type)
+}
+
+// columns 返回模型中复制到历史表的字段, 主键排在最前面
+func columns(sch *schema.Schema) []*schema.Field {
+	fields := make([]*schema.Field, 0, len(sch.DBNames))
+	fields = append(fields, sch.PrimaryFields...)
+	for _, field := range sch.Fields {
+		if field.DBName != "" && !field.PrimaryKey {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// createdAt 返回模型的创建时间字段
+func createdAt(sch *schema.Schema) *schema.Field {
+	for _, field := range sch.Fields {
+		if field.AutoCreateTime > 0 && field.DBName != "" {
+			return field
+		}
+	}
+	return nil
+}
+
+// parse 解析模型, 检查模型是否可以版本化
+func parse(db *gorm.DB, model interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	if len(stmt.Schema.PrimaryFields) == 0 {
+		return nil, fmt.Errorf("temporal: %s 没有主键", stmt.Schema.Name)
+	}
+	if createdAt(stmt.Schema) == nil {
+		return nil, fmt.Errorf("temporal: %s 需要 CreatedAt 字段作为第一个版本的 valid_from", stmt.Schema.Name)
+	}
+	return stmt.Schema, nil
+}
+
+// Migrate 为 models 创建或更新历史表, 模型新增的列同样会添加到历史表中
+func Migrate(db *gorm.DB, models ...interface{}) error {
+	db = db.WithContext(firewall.Migrating(db.Statement.Context))
+	for _, model := range models {
+		sch, err := parse(db, model)
+		if err != nil {
+			return err
+		}
+		history := reflect.New(historyType(sch)).Interface()
+		if err := db.Table(HistoryTable(sch.Table)).AutoMigrate(history); err != nil {
+			return fmt.Errorf("temporal: 迁移 %s 失败: %w", HistoryTable(sch.Table), err)
+		}
+	}
+	return nil
+}
+
+// ErrJoins AsOf 不支持 Joins
+var ErrJoins = errors.New("temporal: AsOf 不支持 Joins")
+
+// AsOf 返回查询 t 时刻记录状态的 scope
+//
+//	d.Scopes(temporal.AsOf(t)).Where("code = ?", "D42").First(&product)
+//
+// 以历史表中在 t 时刻有效的版本, 加上 t 时刻之后没有被修改过的当前记录作为查询的表;
+// 软删除的条件同样作用于这些版本, 需要包含已删除的版本时配合 Unscoped 使用
+func AsOf(t time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		// Joins 会用自己的 FROM 子句替换 asOf
+		if len(db.Statement.Joins) > 0 {
+			db.AddError(ErrJoins)
+			return db
+		}
+		return db.Clauses(asOf{t: t})
+	}
+}
+
+// asOf 替换查询的 FROM 子句, 在生成 SQL 时才读取模型的结构
+type asOf struct {
+	t time.Time
+}
+
+// Name 实现 clause.Interface 接口
+func (asOf) Name() string {
+	return "FROM"
+}
+
+// MergeClause 实现 clause.Interface 接口
+func (a asOf) MergeClause(c *clause.Clause) {
+	c.Expression = a
+}
+
+// Build 实现 clause.Expression 接口
+//
+//	FROM (SELECT ... FROM `products_history` WHERE `valid_from` <= t AND `valid_to` > t
+//	      UNION ALL
+//	      SELECT ... FROM `products` WHERE `created_at` <= t AND NOT EXISTS (
+//	          SELECT 1 FROM `products_history` WHERE 主键相同 AND `valid_to` > t)) `products`
+func (a asOf) Build(builder clause.Builder) {
+	stmt, ok := builder.(*gorm.Statement)
+	if !ok || stmt.Schema == nil {
+		builder.AddError(errors.New("temporal: AsOf 需要指定模型"))
+		return
+	}
+	created := createdAt(stmt.Schema)
+	if created == nil {
+		builder.AddError(fmt.Errorf("temporal: %s 需要 CreatedAt 字段", stmt.Schema.Name))
+		return
+	}
+	table, history := stmt.Table, HistoryTable(stmt.Table)
+	fields := columns(stmt.Schema)
+	selects := make([]string, 0, len(fields))
+	for _, field := range fields {
+		selects = append(selects, stmt.Quote(field.DBName))
+	}
+	list := strings.Join(selects, ",")
+
+	builder.WriteString("(SELECT " + list + " FROM " + stmt.Quote(history) + " WHERE " + stmt.Quote(ValidFromColumn) + " <= ")
+	builder.AddVar(builder, a.t)
+	builder.WriteString(" AND " + stmt.Quote(ValidToColumn) + " > ")
+	builder.AddVar(builder, a.t)
+	builder.WriteString(" UNION ALL SELECT " + list + " FROM " + stmt.Quote(table) + " WHERE " + stmt.Quote(clause.Column{Table: table, Name: created.DBName}) + " <= ")
+	builder.AddVar(builder, a.t)
+	builder.WriteString(" AND NOT EXISTS (SELECT 1 FROM " + stmt.Quote(history) + " WHERE " + samePrimaryKey(stmt, history, table) + " AND " + stmt.Quote(clause.Column{Table: history, Name: ValidToColumn}) + " > ")
+	builder.AddVar(builder, a.t)
+	builder.WriteString(")) " + stmt.Quote(table))
+}
+
+// samePrimaryKey 返回历史表 history 与表 table 的主键相等的条件
+func samePrimaryKey(stmt *gorm.Statement, history, table string) string {
+	conds := make([]string, 0, len(stmt.Schema.PrimaryFields))
+	for _, field := range stmt.Schema.PrimaryFields {
+		conds = append(conds, stmt.Quote(clause.Column{Table: history, Name: field.DBName})+" = "+stmt.Quote(clause.Column{Table: table, Name: field.DBName}))
+	}
+	return strings.Join(conds, " AND ")
+}
@@ -0,0 +1,259 @@
+package temporal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm-learn/db/internal/dbtest"
+	"gorm-learn/db/softdelete"
+
+	"gorm.io/gorm"
+)
+
+// testItem 测试使用的版本化模型
+type testItem struct {
+	ID        uint
+	CreatedAt time.Time
+	Name      string
+	Price     int
+	DeletedAt softdelete.Unix
+}
+
+func (testItem) TableName() string { return "temporal_test_items" }
+
+// testClock 测试使用的时钟, 每次 tick 前进一小时, 使每个版本的有效期互不重叠
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) tick() time.Time {
+	c.now = c.now.Add(time.Hour)
+	return c.now
+}
+
+// setup 清空测试表与历史表, 返回使用 clock 作为当前时间的连接
+func setup(t *testing.T) (*gorm.DB, *testClock) {
+	t.Helper()
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)}
+	d := dbtest.Open(t, Plugin{Models: []interface{}{&testItem{}}})
+	d.Config.NowFunc = func() time.Time { return clock.now }
+	dbtest.Migrate(t, d, &testItem{})
+	if err := Migrate(d, &testItem{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"temporal_test_items", HistoryTable("temporal_test_items")} {
+		if err := d.Exec("DELETE FROM " + table).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d, clock
+}
+
+// version 历史表中的一个版本
+type version struct {
+	Price     int
+	ValidFrom time.Time
+	ValidTo   time.Time
+}
+
+// versions 返回记录在历史表中的全部版本, 按有效期排列
+func versions(t *testing.T, d *gorm.DB, id uint) []version {
+	t.Helper()
+	var result []version
+	if err := d.Table(HistoryTable("temporal_test_items")).Where("id = ?", id).Order(ValidFromColumn).Find(&result).Error; err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// priceAsOf 返回记录在 at 时刻的价格, 记录在该时刻不存在时返回 -1
+func priceAsOf(t *testing.T, d *gorm.DB, id uint, at time.Time) int {
+	t.Helper()
+	var item testItem
+	err := d.Scopes(AsOf(at)).First(&item, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return -1
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item.Price
+}
+
+func TestUpdate(t *testing.T) {
+	d, clock := setup(t)
+	created := clock.tick()
+	item := testItem{Name: "item", Price: 10}
+	if err := d.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	t1 := clock.tick()
+	if err := d.Model(&item).Update("price", 20).Error; err != nil {
+		t.Fatal(err)
+	}
+	t2 := clock.tick()
+	if err := d.Model(&item).Updates(testItem{Price: 30}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 跳过钩子的更新同样产生历史版本
+	t3 := clock.tick()
+	if err := d.Model(&item).UpdateColumn("price", 40).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 原生 SQL 不经过插件
+	clock.tick()
+	if err := d.Exec("UPDATE temporal_test_items SET name = ? WHERE id = ?", "raw", item.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	want := []version{{10, created, t1}, {20, t1, t2}, {30, t2, t3}}
+	got := versions(t, d, item.ID)
+	if len(got) != len(want) {
+		t.Fatalf("历史版本为 %v, 应该为 %v", got, want)
+	}
+	for i := range want {
+		if got[i].Price != want[i].Price || !got[i].ValidFrom.Equal(want[i].ValidFrom) || !got[i].ValidTo.Equal(want[i].ValidTo) {
+			t.Errorf("第 %d 个版本为 %v, 应该为 %v", i+1, got[i], want[i])
+		}
+	}
+
+	half := 30 * time.Minute
+	tests := []struct {
+		at   time.Time
+		want int
+	}{
+		{created.Add(-half), -1},
+		{created, 10},
+		{created.Add(half), 10},
+		{t1, 20},
+		{t2.Add(half), 30},
+		{t3.Add(half), 40},
+		{clock.now.Add(half), 40},
+	}
+	for _, tt := range tests {
+		if got := priceAsOf(t, d, item.ID, tt.at); got != tt.want {
+			t.Errorf("%s 时的价格为 %d, 应该为 %d", tt.at.Format(time.TimeOnly), got, tt.want)
+		}
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	d, clock := setup(t)
+	created := clock.tick()
+	item := testItem{Name: "item", Price: 10}
+	if err := d.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	deleted := clock.tick()
+	if err := d.Delete(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	restored := clock.tick()
+	if err := softdelete.Restore(d, &testItem{ID: item.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 删除之前的版本与删除之后的版本都保存在历史表中
+	got := versions(t, d, item.ID)
+	if len(got) != 2 || !got[0].ValidFrom.Equal(created) || !got[0].ValidTo.Equal(deleted) || !got[1].ValidFrom.Equal(deleted) || !got[1].ValidTo.Equal(restored) {
+		t.Fatalf("历史版本为 %v", got)
+	}
+
+	half := 30 * time.Minute
+	if priceAsOf(t, d, item.ID, created.Add(half)) != 10 {
+		t.Error("删除之前的记录应该可以查询到")
+	}
+	if priceAsOf(t, d, item.ID, deleted.Add(half)) != -1 {
+		t.Error("AsOf 应该排除查询时刻已经删除的记录")
+	}
+	var trashed testItem
+	if err := d.Unscoped().Scopes(AsOf(deleted.Add(half))).First(&trashed, item.ID).Error; err != nil || !trashed.DeletedAt.Deleted() {
+		t.Errorf("Unscoped 应该查询到已删除的版本: %v, DeletedAt = %d", err, trashed.DeletedAt)
+	}
+	if priceAsOf(t, d, item.ID, restored.Add(half)) != 10 {
+		t.Error("恢复之后的记录应该可以查询到")
+	}
+}
+
+func TestAsOfJoins(t *testing.T) {
+	d, _ := setup(t)
+	var items []testItem
+	err := d.Joins("JOIN temporal_test_items other ON other.id = temporal_test_items.id").Scopes(AsOf(time.Now())).Find(&items).Error
+	if !errors.Is(err, ErrJoins) {
+		t.Errorf("使用 Joins 时返回 %v", err)
+	}
+}
+
+// migrationItem 与 migrationItemV2 使用同一个表, V2 新增了 Stock 列
+type migrationItem struct {
+	ID        uint
+	CreatedAt time.Time
+	Code      string `gorm:"type:varchar(32);uniqueIndex"`
+}
+
+type migrationItemV2 struct {
+	ID        uint
+	CreatedAt time.Time
+	Code      string `gorm:"type:varchar(32);uniqueIndex"`
+	Stock     int
+}
+
+func (migrationItem) TableName() string   { return "temporal_test_migrations" }
+func (migrationItemV2) TableName() string { return "temporal_test_migrations" }
+
+// historyColumns 返回历史表中的列名
+func historyColumns(t *testing.T, d *gorm.DB, history string) map[string]bool {
+	t.Helper()
+	types, err := d.Migrator().ColumnTypes(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := map[string]bool{}
+	for _, column := range types {
+		columns[column.Name()] = true
+	}
+	return columns
+}
+
+func TestMigrate(t *testing.T) {
+	d := dbtest.Open(t)
+	history := HistoryTable("temporal_test_migrations")
+	if err := d.Migrator().DropTable(history); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(d, &migrationItem{}); err != nil {
+		t.Fatal(err)
+	}
+	columns := historyColumns(t, d, history)
+	for _, column := range []string{HistoryIDColumn, "id", "created_at", "code", ValidFromColumn, ValidToColumn} {
+		if !columns[column] {
+			t.Errorf("历史表中没有 %s 列", column)
+		}
+	}
+
+	// 模型新增的列同样添加到历史表中
+	if err := Migrate(d, &migrationItemV2{}); err != nil {
+		t.Fatal(err)
+	}
+	if !historyColumns(t, d, history)["stock"] {
+		t.Error("历史表中没有新增的 stock 列")
+	}
+
+	// 历史表不复制唯一索引, 同一条记录的多个版本可以共存
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := d.Exec("INSERT INTO "+history+" (id, created_at, code, valid_from, valid_to) VALUES (1, ?, 'A', ?, ?)", now, now, now).Error; err != nil {
+			t.Fatalf("写入第 %d 个版本: %v", i+1, err)
+		}
+	}
+
+	// 没有 CreatedAt 字段的模型不能版本化
+	type noCreatedAt struct {
+		ID uint
+	}
+	if err := Migrate(d, &noCreatedAt{}); err == nil {
+		t.Error("没有 CreatedAt 字段时应该返回错误")
+	}
+}
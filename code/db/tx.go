@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gorm-learn/db/txhook"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// 事务冲突时的重试配置
+const (
+	// TxMaxAttempts WithTx 最多执行 fn 的次数
+	TxMaxAttempts = 5
+	// txBaseDelay 第一次重试之前等待的最长时间, 之后每次翻倍
+	txBaseDelay = 20 * time.Millisecond
+	// txMaxDelay 重试之前等待的最长时间
+	txMaxDelay = time.Second
+)
+
+// MySQL 中可以通过重试整个事务解决的错误码
+const (
+	// ErrCodeLockWaitTimeout 等待行锁超时 (1205)
+	ErrCodeLockWaitTimeout = 1205
+	// ErrCodeDeadlock 检测到死锁, 事务已经被回滚 (1213)
+	ErrCodeDeadlock = 1213
+)
+
+// txKey 保存当前事务的 ctx key
+type txKey struct{}
+
+// WithTx 在事务中执行 fn, 事务通过 ctx 传递
+//
+// 传入 fn 的 tx 绑定了携带事务的 ctx, fn 中再调用 WithTx、Conn、Upsert 等接收 ctx 的函数时
+// 会加入同一个事务, 嵌套的 WithTx 使用保存点, 失败时只回滚到保存点.
+//
+// 最外层的 WithTx 遇到死锁 (1213) 或者锁等待超时 (1205) 时, 会在随机等待之后重新执行整个 fn,
+// 最多执行 TxMaxAttempts 次, 因此 fn 应当可以重复执行, 不要在其中产生事务之外的副作用,
+// 需要在提交之后执行的操作使用 AfterCommit 注册
+func WithTx(ctx context.Context, fn func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return savepoint(tx.WithContext(ctx), fn)
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			txCtx := context.WithValue(ctx, txKey{}, tx)
+			return fn(tx.WithContext(txCtx))
+		}, opts...)
+		if err == nil || !IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= TxMaxAttempts {
+			return fmt.Errorf("事务执行 %d 次后仍然失败: %w", attempt, err)
+		}
+
+		timer := time.NewTimer(txDelay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// savepointSeq 用于生成唯一的保存点名称
+//
+// gorm.DB.Transaction 使用 fn 的函数地址作为保存点名称, 同一个闭包嵌套调用时名称会重复,
+// 回滚到内层的保存点之后, 外层就无法再回滚到自己的保存点
+var savepointSeq atomic.Uint64
+
+// savepoint 在保存点中执行 fn, 成功时释放保存点, 失败或者 panic 时回滚到保存点
+//
+// 不释放的保存点会一直保留到事务结束, 循环中嵌套调用 WithTx 时会不断累积
+func savepoint(tx *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	name := fmt.Sprintf("sp%d", savepointSeq.Add(1))
+	if err := tx.SavePoint(name).Error; err != nil {
+		return err
+	}
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			tx.RollbackTo(name)
+		}
+	}()
+	err = fn(tx)
+	panicked = false
+	if err == nil {
+		err = tx.Exec("RELEASE SAVEPOINT " + name).Error
+	}
+	return err
+}
+
+// txDelay 第 attempt 次失败之后等待的时间, 在 [0, min(base * 2^(attempt-1), max)) 之间随机选择,
+// 避免发生死锁的事务再次同时重试
+func txDelay(attempt int) time.Duration {
+	d := txMaxDelay
+	if attempt < 10 {
+		d = min(txBaseDelay<<(attempt-1), txMaxDelay)
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// IsRetryable 判断错误是否可以通过重试整个事务解决, 即死锁或者锁等待超时
+func IsRetryable(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == ErrCodeDeadlock || mysqlErr.Number == ErrCodeLockWaitTimeout
+	}
+	return false
+}
+
+// InTx 判断 ctx 是否携带了 WithTx 开启的事务
+func InTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(*gorm.DB)
+	return ok
+}
+
+// AfterCommit 注册在 ctx 所在事务提交之后执行的回调
+//
+// ctx 没有携带事务时 fn 立即执行; 事务回滚或者因为死锁而重试时, 已注册的回调会被丢弃,
+// 嵌套的 WithTx 回滚到保存点时, 其中注册的回调同样会被丢弃
+func AfterCommit(ctx context.Context, fn func()) error {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return txhook.AfterCommit(tx, fn)
+	}
+	fn()
+	return nil
+}
@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// createUsers 创建 n 个用户, 返回它们的主键
+func createUsers(t *testing.T, d *gorm.DB, n int) []uint {
+	t.Helper()
+	ids := make([]uint, n)
+	for i := range ids {
+		user := User{Name: "tx-test"}
+		if err := d.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = user.ID
+	}
+	return ids
+}
+
+// ages 返回用户的年龄, 按 ids 的顺序
+func ages(t *testing.T, d *gorm.DB, ids ...uint) []int {
+	t.Helper()
+	result := make([]int, len(ids))
+	for i, id := range ids {
+		if err := d.Model(&User{}).Where("id = ?", id).Pluck("age", &result[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return result
+}
+
+func TestWithTxDeadlockRetry(t *testing.T) {
+	d := testDB(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ids := createUsers(t, d, 2)
+
+	// 两个事务分别锁定一行之后再锁定另一行, 加锁顺序相反, 第一次执行时必然死锁
+	var locked sync.WaitGroup
+	locked.Add(2)
+	var attempts, committed atomic.Int32
+	deadlocks := make(chan int, 2)
+	transfer := func(first, second uint) error {
+		attempt := 0
+		return WithTx(ctx, func(tx *gorm.DB) error {
+			attempts.Add(1)
+			attempt++
+			if err := AfterCommit(tx.Statement.Context, func() { committed.Add(1) }); err != nil {
+				return err
+			}
+			if err := tx.Exec("UPDATE users SET age = age + 1 WHERE id = ?", first).Error; err != nil {
+				return err
+			}
+			if attempt == 1 {
+				locked.Done()
+				locked.Wait()
+			}
+			err := tx.Exec("UPDATE users SET age = age + 1 WHERE id = ?", second).Error
+			var mysqlErr *mysqldriver.MySQLError
+			if errors.As(err, &mysqlErr) {
+				deadlocks <- int(mysqlErr.Number)
+			}
+			return err
+		})
+	}
+
+	errs := make(chan error, 2)
+	go func() { errs <- transfer(ids[0], ids[1]) }()
+	go func() { errs <- transfer(ids[1], ids[0]) }()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(deadlocks)
+
+	if code := <-deadlocks; code != ErrCodeDeadlock {
+		t.Errorf("应该发生死锁 (%d), 实际错误码为 %d", ErrCodeDeadlock, code)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("fn 执行了 %d 次, 应该为 3 次", n)
+	}
+	// 死锁回滚的那次执行中注册的回调被丢弃
+	if n := committed.Load(); n != 2 {
+		t.Errorf("提交之后的回调执行了 %d 次, 应该为 2 次", n)
+	}
+	if got := ages(t, d, ids...); got[0] != 2 || got[1] != 2 {
+		t.Errorf("年龄为 %v, 两个事务都应该提交", got)
+	}
+}
+
+func TestWithTxSavepoint(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+	ids := createUsers(t, d, 1)
+	errInner := errors.New("inner")
+
+	var outerCommitted, innerCommitted bool
+	err := WithTx(ctx, func(tx *gorm.DB) error {
+		ctx := tx.Statement.Context
+		if err := tx.Exec("UPDATE users SET age = 1 WHERE id = ?", ids[0]).Error; err != nil {
+			return err
+		}
+		if err := AfterCommit(ctx, func() { outerCommitted = true }); err != nil {
+			return err
+		}
+
+		err := WithTx(ctx, func(tx *gorm.DB) error {
+			if err := tx.Exec("UPDATE users SET age = 2 WHERE id = ?", ids[0]).Error; err != nil {
+				return err
+			}
+			if err := AfterCommit(tx.Statement.Context, func() { innerCommitted = true }); err != nil {
+				return err
+			}
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			t.Errorf("嵌套的 WithTx 返回 %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ages(t, d, ids...); got[0] != 1 {
+		t.Errorf("年龄为 %d, 应该回滚到保存点, 保留外层的更新", got[0])
+	}
+	if !outerCommitted {
+		t.Error("外层注册的回调没有执行")
+	}
+	if innerCommitted {
+		t.Error("回滚到保存点之后, 其中注册的回调不应该执行")
+	}
+}
+
+func TestWithTxReleaseSavepoint(t *testing.T) {
+	d := testDB(t)
+	ids := createUsers(t, d, 1)
+
+	var committed bool
+	err := WithTx(context.Background(), func(tx *gorm.DB) error {
+		ctx := tx.Statement.Context
+		err := WithTx(ctx, func(tx *gorm.DB) error {
+			if err := AfterCommit(tx.Statement.Context, func() { committed = true }); err != nil {
+				return err
+			}
+			return tx.Exec("UPDATE users SET age = 3 WHERE id = ?", ids[0]).Error
+		})
+		if err != nil {
+			return err
+		}
+		// 成功之后保存点已经被释放, 无法再回滚到它
+		name := fmt.Sprintf("sp%d", savepointSeq.Load())
+		if err := tx.RollbackTo(name).Error; err == nil {
+			t.Errorf("保存点 %s 没有被释放", name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ages(t, d, ids...); got[0] != 3 {
+		t.Errorf("年龄为 %d, 释放保存点之后的更新应该随事务提交", got[0])
+	}
+	if !committed {
+		t.Error("释放保存点之后, 其中注册的回调应该在提交之后执行")
+	}
+}
+
+func TestWithTxRollback(t *testing.T) {
+	d := testDB(t)
+	ids := createUsers(t, d, 1)
+	errRollback := errors.New("rollback")
+
+	committed := false
+	err := WithTx(context.Background(), func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE users SET age = 3 WHERE id = ?", ids[0]).Error; err != nil {
+			return err
+		}
+		if err := AfterCommit(tx.Statement.Context, func() { committed = true }); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx 返回 %v", err)
+	}
+	if committed {
+		t.Error("事务回滚之后, 注册的回调不应该执行")
+	}
+	if got := ages(t, d, ids...); got[0] != 0 {
+		t.Errorf("年龄为 %d, 更新应该被回滚", got[0])
+	}
+
+	// 没有事务时回调立即执行
+	ran := false
+	if err := AfterCommit(context.Background(), func() { ran = true }); err != nil || !ran {
+		t.Errorf("没有事务时 AfterCommit = %v, 回调执行: %v", err, ran)
+	}
+}
@@ -0,0 +1,201 @@
+// 事务提交后的回调
+//
+// 插件包装了 *gorm.DB 的连接池, 开启的事务会记录通过 AfterCommit 注册的回调,
+// 事务提交成功后按注册顺序执行, 回滚时丢弃:
+//
+//	d.Use(txhook.Plugin{})
+//
+//	d.Transaction(func(tx *gorm.DB) error {
+//		tx.Create(&user)
+//		return txhook.AfterCommit(tx, func() { sendMail(user) }) // 提交之后才会发送
+//	})
+//
+// 嵌套事务回滚到保存点时, 保存点之后注册的回调同样会被丢弃.
+// 插件需要在其他包装连接池的插件 (例如 firewall) 之后注册, 这样 *gorm.DB 中保存的才是本插件的事务
+package txhook
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnmanagedTx 语句所在的事务不是由本插件开启的, 无法确定提交的时机
+var ErrUnmanagedTx = errors.New("txhook: 事务不是通过 txhook 插件开启的")
+
+// Plugin 记录并在提交后执行回调的 GORM 插件
+type Plugin struct{}
+
+// Name 实现 gorm.Plugin 接口
+func (Plugin) Name() string {
+	return "gorm-learn:txhook"
+}
+
+// Initialize 实现 gorm.Plugin 接口, 包装连接池
+func (Plugin) Initialize(db *gorm.DB) error {
+	wrapped := &pool{ConnPool: db.Config.ConnPool}
+	db.Config.ConnPool = wrapped
+	db.Statement.ConnPool = wrapped
+	return nil
+}
+
+// AfterCommit 注册在 db 所在事务提交之后执行的回调
+//
+// db 不在事务中时语句已经自动提交, fn 会立即执行;
+// 事务不是通过本插件开启时返回 ErrUnmanagedTx, fn 不会执行
+func AfterCommit(db *gorm.DB, fn func()) error {
+	switch conn := db.Statement.ConnPool.(type) {
+	case *tx:
+		conn.add(fn)
+		return nil
+	case gorm.TxCommitter:
+		return ErrUnmanagedTx
+	}
+	run(fn)
+	return nil
+}
+
+// InTransaction 判断 db 是否处于通过本插件开启的事务中
+func InTransaction(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(*tx)
+	return ok
+}
+
+// run 执行回调, 事务已经提交, 回调 panic 时只记录日志
+func run(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("txhook: 提交后的回调 panic: %v", r)
+		}
+	}()
+	fn()
+}
+
+// pool 包装连接池, 开启的事务会被包装为 tx
+type pool struct {
+	gorm.ConnPool
+}
+
+// BeginTx 实现 gorm.ConnPoolBeginner 接口
+func (p *pool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	var inner gorm.ConnPool
+	switch beginner := p.ConnPool.(type) {
+	case gorm.TxBeginner:
+		t, err := beginner.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		inner = t
+	case gorm.ConnPoolBeginner:
+		t, err := beginner.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		inner = t
+	default:
+		return nil, gorm.ErrInvalidTransaction
+	}
+
+	committer, ok := inner.(gorm.TxCommitter)
+	if !ok {
+		return nil, errors.New("txhook: 事务不支持提交")
+	}
+	return &tx{ConnPool: inner, committer: committer, savepoints: map[string]int{}}, nil
+}
+
+// GetDBConn 实现 gorm.GetDBConnector 接口, 使 *gorm.DB.DB() 可以返回底层的 *sql.DB
+func (p *pool) GetDBConn() (*sql.DB, error) {
+	switch inner := p.ConnPool.(type) {
+	case *sql.DB:
+		return inner, nil
+	case gorm.GetDBConnector:
+		return inner.GetDBConn()
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+// tx 包装事务, 实现 gorm.Tx 接口
+type tx struct {
+	gorm.ConnPool
+	committer gorm.TxCommitter
+
+	mu    sync.Mutex
+	hooks []func()
+	// savepoints 保存点创建时已经注册的回调数量
+	savepoints map[string]int
+}
+
+func (t *tx) add(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hooks = append(t.hooks, fn)
+}
+
+// take 取出并清空全部回调
+func (t *tx) take() []func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hooks := t.hooks
+	t.hooks = nil
+	return hooks
+}
+
+func (t *tx) Commit() error {
+	if err := t.committer.Commit(); err != nil {
+		t.take()
+		return err
+	}
+	for _, fn := range t.take() {
+		run(fn)
+	}
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	t.take()
+	return t.committer.Rollback()
+}
+
+// ExecContext 记录保存点, 回滚到保存点时丢弃之后注册的回调
+func (t *tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	result, err := t.ConnPool.ExecContext(ctx, query, args...)
+	if err == nil {
+		t.savepoint(query)
+	}
+	return result, err
+}
+
+// savepoint 识别 SAVEPOINT / ROLLBACK TO [SAVEPOINT] / RELEASE SAVEPOINT 语句
+func (t *tx) savepoint(query string) {
+	words := strings.Fields(strings.ToUpper(strings.TrimRight(strings.TrimSpace(query), ";")))
+	if len(words) < 2 {
+		return
+	}
+	name := strings.Trim(words[len(words)-1], "`\"")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case len(words) == 2 && words[0] == "SAVEPOINT":
+		t.savepoints[name] = len(t.hooks)
+	case words[0] == "ROLLBACK" && len(words) >= 3 && words[1] == "TO":
+		if n, ok := t.savepoints[name]; ok && n <= len(t.hooks) {
+			t.hooks = t.hooks[:n]
+		}
+	case words[0] == "RELEASE" && len(words) == 3 && words[1] == "SAVEPOINT":
+		delete(t.savepoints, name)
+	}
+}
+
+func (t *tx) StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
+	if s, ok := t.ConnPool.(interface {
+		StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt
+	}); ok {
+		return s.StmtContext(ctx, stmt)
+	}
+	return stmt
+}
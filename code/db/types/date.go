@@ -0,0 +1,167 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// dateLayout 日期的文本格式
+const dateLayout = "2006-01-02"
+
+// Date 不带时间与时区的日历日期, 例如生日, 零值存储为 NULL
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// DateOf 取时间在其所在时区中的日期部分
+func DateOf(t time.Time) Date {
+	if t.IsZero() {
+		return Date{}
+	}
+	y, m, d := t.Date()
+	return Date{Year: y, Month: m, Day: d}
+}
+
+// Today 返回本地时区的当天日期
+func Today() Date {
+	return DateOf(time.Now())
+}
+
+// ParseDate 解析 2006-01-02 格式的日期
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return Date{}, fmt.Errorf("不合法的日期: %q", s)
+	}
+	return DateOf(t), nil
+}
+
+// IsZero 是否为零值
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+// In 返回指定时区中该日期零点的时间
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// AddDays 加上指定的天数
+func (d Date) AddDays(n int) Date {
+	return DateOf(d.In(time.UTC).AddDate(0, 0, n))
+}
+
+// Before 是否早于 other
+func (d Date) Before(other Date) bool {
+	return d.In(time.UTC).Before(other.In(time.UTC))
+}
+
+// After 是否晚于 other
+func (d Date) After(other Date) bool {
+	return d.In(time.UTC).After(other.In(time.UTC))
+}
+
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.In(time.UTC).Format(dateLayout)
+}
+
+// Scan 实现 sql.Scanner 接口, 支持 time.Time 以及文本格式
+func (d *Date) Scan(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		*d = Date{}
+		return nil
+	case time.Time:
+		*d = DateOf(v)
+		return nil
+	}
+	bs, ok := toBytes(v)
+	if !ok {
+		return fmt.Errorf("无法将 %T 扫描为 Date", v)
+	}
+	if len(bs) > len(dateLayout) {
+		bs = bs[:len(dateLayout)]
+	}
+	parsed, err := ParseDate(string(bs))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value 实现 driver.Valuer 接口
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.String(), nil
+}
+
+// GormDataType 实现 schema.GormDataTypeInterface 接口
+func (Date) GormDataType() string {
+	return "date"
+}
+
+// GormDBDataType 各个方言都使用 DATE 类型
+func (Date) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return "DATE"
+}
+
+// MarshalJSON 实现 json.Marshaler 接口, 零值输出为 null
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler 接口
+func (d *Date) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*d = Date{}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("日期必须是字符串: %s", data)
+	}
+	return d.UnmarshalText([]byte(s))
+}
+
+// MarshalText 实现 encoding.TextMarshaler 接口
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler 接口, 空字符串解析为零值
+func (d *Date) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*d = Date{}
+		return nil
+	}
+	parsed, err := ParseDate(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// DateBetween 构造 "日期列位于 [from, to] 闭区间内" 的查询条件
+//
+//	db.Where(types.DateBetween("birthday", from, to)).Find(&users)
+func DateBetween(column string, from, to Date) clause.Expression {
+	return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []interface{}{clause.Column{Name: column}, from, to}}
+}
@@ -0,0 +1,337 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// DecimalPlaces Decimal 固定保留的小数位数
+const DecimalPlaces = 4
+
+// decimalFactor 10 ^ DecimalPlaces
+const decimalFactor = 10000
+
+// ErrDecimalOverflow 运算结果超出了 Decimal 的取值范围
+var ErrDecimalOverflow = errors.New("Decimal 运算溢出")
+
+// Decimal 精确的定点小数, 固定保留 4 位小数, 对应数据库中的 DECIMAL(19,4)
+//
+// 内部以 int64 存储 "值 * 10^4", 取值范围约为 ±9.22e14;
+// Add、Sub 等运算溢出时会 panic, 处理外部输入时使用 CheckedAdd 等返回 ErrDecimalOverflow 的版本
+type Decimal struct {
+	units int64
+}
+
+// NewDecimal 构造 value * 10^exp, 例如 NewDecimal(1234, -2) 表示 12.34
+func NewDecimal(value int64, exp int) Decimal {
+	if exp < -DecimalPlaces {
+		panic(fmt.Sprintf("Decimal 最多支持 %d 位小数, exp: %d", DecimalPlaces, exp))
+	}
+	units := big.NewInt(value)
+	units.Mul(units, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp+DecimalPlaces)), nil))
+	return fromBig(units)
+}
+
+// DecimalFromInt 将整数转换为 Decimal
+func DecimalFromInt(n int64) Decimal {
+	return NewDecimal(n, 0)
+}
+
+// ParseDecimal 解析 "-12.34" 格式的字符串, 超过 4 位的非零小数会返回错误
+func ParseDecimal(s string) (Decimal, error) {
+	raw := strings.TrimSpace(s)
+	neg := false
+	// 最多一个符号, 其余字符在下面按数字检查
+	if strings.HasPrefix(raw, "-") || strings.HasPrefix(raw, "+") {
+		neg = raw[0] == '-'
+		raw = raw[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(raw, ".")
+	if intPart == "" && fracPart == "" {
+		return Decimal{}, fmt.Errorf("不合法的小数: %q", s)
+	}
+	if trimmed := strings.TrimRight(fracPart, "0"); len(trimmed) > DecimalPlaces {
+		return Decimal{}, fmt.Errorf("小数 %q 超出了 %d 位精度", s, DecimalPlaces)
+	}
+	if len(fracPart) > DecimalPlaces {
+		fracPart = fracPart[:DecimalPlaces]
+	}
+	digits := intPart + fracPart + strings.Repeat("0", DecimalPlaces-len(fracPart))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Decimal{}, fmt.Errorf("不合法的小数: %q", s)
+		}
+	}
+	units, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Decimal{}, fmt.Errorf("小数 %q 超出取值范围", s)
+	}
+	if neg {
+		units = -units
+	}
+	return Decimal{units: units}, nil
+}
+
+// MustDecimal 与 ParseDecimal 相同, 解析失败时 panic, 适用于常量
+func MustDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func fromBig(units *big.Int) Decimal {
+	d, err := checkedFromBig(units)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func checkedFromBig(units *big.Int) (Decimal, error) {
+	if !units.IsInt64() {
+		return Decimal{}, ErrDecimalOverflow
+	}
+	return Decimal{units: units.Int64()}, nil
+}
+
+// Add 加法, 溢出时 panic
+func (d Decimal) Add(o Decimal) Decimal {
+	return fromBig(d.add(o))
+}
+
+// CheckedAdd 加法, 溢出时返回 ErrDecimalOverflow
+func (d Decimal) CheckedAdd(o Decimal) (Decimal, error) {
+	return checkedFromBig(d.add(o))
+}
+
+func (d Decimal) add(o Decimal) *big.Int {
+	return new(big.Int).Add(big.NewInt(d.units), big.NewInt(o.units))
+}
+
+// Sub 减法, 溢出时 panic
+func (d Decimal) Sub(o Decimal) Decimal {
+	return fromBig(d.sub(o))
+}
+
+// CheckedSub 减法, 溢出时返回 ErrDecimalOverflow
+func (d Decimal) CheckedSub(o Decimal) (Decimal, error) {
+	return checkedFromBig(d.sub(o))
+}
+
+func (d Decimal) sub(o Decimal) *big.Int {
+	return new(big.Int).Sub(big.NewInt(d.units), big.NewInt(o.units))
+}
+
+// Neg 取相反数
+func (d Decimal) Neg() Decimal {
+	return d.Mul(DecimalFromInt(-1))
+}
+
+// Mul 乘法, 结果超过 4 位小数的部分四舍五入, 溢出时 panic
+func (d Decimal) Mul(o Decimal) Decimal {
+	return fromBig(d.mul(o))
+}
+
+// CheckedMul 乘法, 溢出时返回 ErrDecimalOverflow
+func (d Decimal) CheckedMul(o Decimal) (Decimal, error) {
+	return checkedFromBig(d.mul(o))
+}
+
+func (d Decimal) mul(o Decimal) *big.Int {
+	product := new(big.Int).Mul(big.NewInt(d.units), big.NewInt(o.units))
+	return divRound(product, big.NewInt(decimalFactor))
+}
+
+// MulInt 乘以整数, 溢出时 panic
+func (d Decimal) MulInt(n int64) Decimal {
+	return fromBig(d.mulInt(n))
+}
+
+// CheckedMulInt 乘以整数, 溢出时返回 ErrDecimalOverflow
+func (d Decimal) CheckedMulInt(n int64) (Decimal, error) {
+	return checkedFromBig(d.mulInt(n))
+}
+
+func (d Decimal) mulInt(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(d.units), big.NewInt(n))
+}
+
+// Round 四舍五入 (远离零) 保留 places 位小数, 溢出时 panic
+func (d Decimal) Round(places int) Decimal {
+	return fromBig(d.round(places))
+}
+
+// CheckedRound 四舍五入 (远离零) 保留 places 位小数, 溢出时返回 ErrDecimalOverflow
+func (d Decimal) CheckedRound(places int) (Decimal, error) {
+	return checkedFromBig(d.round(places))
+}
+
+func (d Decimal) round(places int) *big.Int {
+	if places >= DecimalPlaces {
+		return big.NewInt(d.units)
+	}
+	if places < 0 {
+		places = 0
+	}
+	unit := big.NewInt(int64(math.Pow10(DecimalPlaces - places)))
+	rounded := divRound(big.NewInt(d.units), unit)
+	return rounded.Mul(rounded, unit)
+}
+
+// divRound 整数除法, 按远离零的方式四舍五入
+func divRound(x, y *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).Cmp(new(big.Int).Abs(y)) >= 0 {
+		if x.Sign()*y.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+// Cmp 比较大小, 返回 -1 / 0 / 1
+func (d Decimal) Cmp(o Decimal) int {
+	switch {
+	case d.units < o.units:
+		return -1
+	case d.units > o.units:
+		return 1
+	}
+	return 0
+}
+
+// Sign 返回符号 -1 / 0 / 1
+func (d Decimal) Sign() int {
+	return d.Cmp(Decimal{})
+}
+
+// IsZero 是否为 0
+func (d Decimal) IsZero() bool {
+	return d.units == 0
+}
+
+// StringFixed 固定输出 places 位小数 (会先四舍五入)
+func (d Decimal) StringFixed(places int) string {
+	if places > DecimalPlaces {
+		places = DecimalPlaces
+	}
+	if places < 0 {
+		places = 0
+	}
+	// 按 big.Int 格式化, 取值范围边界上的四舍五入不会溢出
+	units := d.round(places)
+	sign := ""
+	if units.Sign() < 0 {
+		sign = "-"
+	}
+	abs := new(big.Int).Abs(units).String()
+	if len(abs) <= DecimalPlaces {
+		abs = strings.Repeat("0", DecimalPlaces-len(abs)+1) + abs
+	}
+	intPart, fracPart := abs[:len(abs)-DecimalPlaces], abs[len(abs)-DecimalPlaces:]
+	if places == 0 {
+		return sign + intPart
+	}
+	return sign + intPart + "." + fracPart[:places]
+}
+
+// String 输出去掉末尾 0 的最短形式
+func (d Decimal) String() string {
+	s := d.StringFixed(DecimalPlaces)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// Scan 实现 sql.Scanner 接口, NULL 扫描为 0
+func (d *Decimal) Scan(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		*d = Decimal{}
+		return nil
+	case int64:
+		*d = DecimalFromInt(v)
+		return nil
+	case float64:
+		parsed, err := ParseDecimal(strconv.FormatFloat(v, 'f', DecimalPlaces, 64))
+		if err != nil {
+			return err
+		}
+		*d = parsed
+		return nil
+	}
+	bs, ok := toBytes(v)
+	if !ok {
+		return fmt.Errorf("无法将 %T 扫描为 Decimal", v)
+	}
+	parsed, err := ParseDecimal(string(bs))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value 实现 driver.Valuer 接口, 以字符串形式传递, 避免浮点误差
+func (d Decimal) Value() (driver.Value, error) {
+	return d.StringFixed(DecimalPlaces), nil
+}
+
+// GormDataType 实现 schema.GormDataTypeInterface 接口
+func (Decimal) GormDataType() string {
+	return "decimal"
+}
+
+// GormDBDataType 根据数据库方言指定列类型
+func (Decimal) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case Postgres:
+		return "NUMERIC(19,4)"
+	case SQLite:
+		return "NUMERIC"
+	default:
+		return "DECIMAL(19,4)"
+	}
+}
+
+// MarshalJSON 实现 json.Marshaler 接口, 输出为字符串以免丢失精度
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler 接口, 同时支持字符串与数字
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	return d.UnmarshalText([]byte(s))
+}
+
+// MarshalText 实现 encoding.TextMarshaler 接口
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler 接口
+func (d *Decimal) UnmarshalText(text []byte) error {
+	parsed, err := ParseDecimal(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
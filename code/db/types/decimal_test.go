@@ -0,0 +1,162 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"12.34", "12.34", true},
+		{"-12.34", "-12.34", true},
+		{"+5", "5", true},
+		{" 0.5 ", "0.5", true},
+		{".25", "0.25", true},
+		{"7.", "7", true},
+		{"1.23450", "1.2345", true},
+		{"-0", "0", true},
+		{"1.23456", "", false},
+		{"-+5", "", false},
+		{"+-5", "", false},
+		{"--5", "", false},
+		{"5-", "", false},
+		{"1e3", "", false},
+		{"", "", false},
+		{".", "", false},
+		{"-", "", false},
+		{"1.2.3", "", false},
+		{"922337203685477.5807", "922337203685477.5807", true},
+		{"922337203685477.5808", "", false},
+	}
+	for _, tt := range tests {
+		d, err := ParseDecimal(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseDecimal(%q) 错误为 %v", tt.in, err)
+			continue
+		}
+		if tt.ok && d.String() != tt.want {
+			t.Errorf("ParseDecimal(%q) = %s, want %s", tt.in, d, tt.want)
+		}
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Decimal
+		want string
+	}{
+		{"Add", MustDecimal("0.1").Add(MustDecimal("0.2")), "0.3"},
+		{"Sub", MustDecimal("1").Sub(MustDecimal("1.0001")), "-0.0001"},
+		{"Neg", MustDecimal("2.5").Neg(), "-2.5"},
+		{"Mul", MustDecimal("1.5").Mul(MustDecimal("1.5")), "2.25"},
+		{"Mul 四舍五入", MustDecimal("0.0001").Mul(MustDecimal("0.5")), "0.0001"},
+		{"Mul 负数四舍五入", MustDecimal("-0.0001").Mul(MustDecimal("0.5")), "-0.0001"},
+		{"MulInt", MustDecimal("19.99").MulInt(3), "59.97"},
+		{"Round", MustDecimal("2.345").Round(2), "2.35"},
+		{"Round 负数", MustDecimal("-2.345").Round(2), "-2.35"},
+		{"Round 0 位", MustDecimal("2.5").Round(0), "3"},
+		{"NewDecimal", NewDecimal(1234, -2), "12.34"},
+		{"DecimalFromInt", DecimalFromInt(-7), "-7"},
+	}
+	for _, tt := range tests {
+		if tt.got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if got := MustDecimal("1.5").StringFixed(2); got != "1.50" {
+		t.Errorf("StringFixed(2) = %s", got)
+	}
+	if MustDecimal("1").Cmp(MustDecimal("2")) != -1 || MustDecimal("-1").Sign() != -1 || !MustDecimal("0.0000").IsZero() {
+		t.Error("Cmp / Sign / IsZero 结果不正确")
+	}
+}
+
+func TestDecimalOverflow(t *testing.T) {
+	max := Decimal{units: math.MaxInt64}
+	min := Decimal{units: math.MinInt64}
+	one := DecimalFromInt(1)
+
+	checked := []struct {
+		name string
+		fn   func() (Decimal, error)
+	}{
+		{"CheckedAdd", func() (Decimal, error) { return max.CheckedAdd(one) }},
+		{"CheckedSub", func() (Decimal, error) { return min.CheckedSub(one) }},
+		{"CheckedMul", func() (Decimal, error) { return max.CheckedMul(DecimalFromInt(2)) }},
+		{"CheckedMulInt", func() (Decimal, error) { return max.CheckedMulInt(-2) }},
+		{"CheckedRound", func() (Decimal, error) { return max.CheckedRound(0) }},
+	}
+	for _, tt := range checked {
+		if _, err := tt.fn(); !errors.Is(err, ErrDecimalOverflow) {
+			t.Errorf("%s 应该返回 ErrDecimalOverflow, 实际为 %v", tt.name, err)
+		}
+	}
+	if d, err := max.CheckedSub(one); err != nil || d.Cmp(max) != -1 {
+		t.Errorf("没有溢出时 CheckedSub = %s, %v", d, err)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != ErrDecimalOverflow {
+				t.Errorf("Add 溢出时应该 panic, recover() = %v", r)
+			}
+		}()
+		max.Add(one)
+	}()
+
+	// 格式化取值范围边界上的值不会溢出
+	if got := max.StringFixed(0); got != "922337203685478" {
+		t.Errorf("StringFixed(0) = %s", got)
+	}
+}
+
+func TestDecimalScan(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{nil, "0"},
+		{int64(42), "42"},
+		{1.25, "1.25"},
+		{[]byte("199.9900"), "199.99"},
+		{"-0.5", "-0.5"},
+	}
+	for _, tt := range tests {
+		var d Decimal
+		if err := d.Scan(tt.in); err != nil || d.String() != tt.want {
+			t.Errorf("Scan(%v) = %s, %v", tt.in, d, err)
+		}
+	}
+	var d Decimal
+	if err := d.Scan(true); err == nil {
+		t.Error("Scan(bool) 应该返回错误")
+	}
+	if v, err := MustDecimal("1.5").Value(); err != nil || v != "1.5000" {
+		t.Errorf("Value() = %v, %v", v, err)
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	data, err := json.Marshal(MustDecimal("12.30"))
+	if err != nil || string(data) != `"12.3"` {
+		t.Errorf("MarshalJSON = %s, %v", data, err)
+	}
+	for _, in := range []string{`"12.3"`, `12.3`} {
+		var d Decimal
+		if err := json.Unmarshal([]byte(in), &d); err != nil || d.String() != "12.3" {
+			t.Errorf("UnmarshalJSON(%s) = %s, %v", in, d, err)
+		}
+	}
+	var d Decimal
+	if err := json.Unmarshal([]byte(`"-+1"`), &d); err == nil {
+		t.Error("UnmarshalJSON 应该拒绝两个符号")
+	}
+}
@@ -0,0 +1,134 @@
+package types
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Enum 描述一组合法的枚举值, 供自定义的字符串类型复用
+//
+//	type Role string
+//
+//	var roles = types.NewEnum[Role]("admin", "member")
+//
+//	func (r *Role) Scan(v interface{}) error       { return roles.Scan(r, v) }
+//	func (r Role) Value() (driver.Value, error)    { return roles.Value(r) }
+//	func (Role) GormDBDataType(db *gorm.DB, f *schema.Field) string { return roles.DataType(db, f) }
+type Enum[T ~string] struct {
+	values []T
+}
+
+// NewEnum 使用全部合法值构造枚举
+func NewEnum[T ~string](values ...T) Enum[T] {
+	return Enum[T]{values: values}
+}
+
+// Values 返回全部合法值
+func (e Enum[T]) Values() []T {
+	return append([]T(nil), e.values...)
+}
+
+// Valid 判断 v 是否为合法值
+func (e Enum[T]) Valid(v T) bool {
+	for _, value := range e.values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Check 校验 v 是否为合法值, 不合法时返回错误
+func (e Enum[T]) Check(v T) error {
+	if e.Valid(v) {
+		return nil
+	}
+	return fmt.Errorf("不合法的枚举值 %q, 可选值为: %s", v, e.joined(", "))
+}
+
+// Scan 供枚举类型的 Scan 方法调用, NULL 扫描为空字符串
+func (e Enum[T]) Scan(dst *T, v interface{}) error {
+	if v == nil {
+		*dst = ""
+		return nil
+	}
+	bs, ok := toBytes(v)
+	if !ok {
+		return fmt.Errorf("无法将 %T 扫描为枚举值", v)
+	}
+	value := T(bs)
+	if err := e.Check(value); err != nil {
+		return err
+	}
+	*dst = value
+	return nil
+}
+
+// Value 供枚举类型的 Value 方法调用, 空字符串存储为 NULL
+func (e Enum[T]) Value(v T) (driver.Value, error) {
+	if v == "" {
+		return nil, nil
+	}
+	if err := e.Check(v); err != nil {
+		return nil, err
+	}
+	return string(v), nil
+}
+
+// DataType 供枚举类型的 GormDBDataType 方法调用
+//
+// MySQL 使用原生的 ENUM 类型, 其它方言使用足够长度的 VARCHAR,
+// 需要约束时可以配合 gorm 的 check 标签使用
+func (e Enum[T]) DataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == MySQL {
+		quoted := make([]string, len(e.values))
+		for i, v := range e.values {
+			quoted[i] = "'" + strings.ReplaceAll(string(v), "'", "''") + "'"
+		}
+		return "ENUM(" + strings.Join(quoted, ",") + ")"
+	}
+
+	size := 1
+	for _, v := range e.values {
+		if len(v) > size {
+			size = len(v)
+		}
+	}
+	return fmt.Sprintf("VARCHAR(%d)", size)
+}
+
+// In 构造 "列的值属于指定枚举值之一" 的查询条件, 包含非法值时记录错误
+func (e Enum[T]) In(column string, values ...T) clause.Expression {
+	return enumIn[T]{enum: e, column: column, values: values}
+}
+
+func (e Enum[T]) joined(sep string) string {
+	values := make([]string, len(e.values))
+	for i, v := range e.values {
+		values[i] = string(v)
+	}
+	return strings.Join(values, sep)
+}
+
+type enumIn[T ~string] struct {
+	enum   Enum[T]
+	column string
+	values []T
+}
+
+func (c enumIn[T]) Build(builder clause.Builder) {
+	values := make([]interface{}, len(c.values))
+	for i, v := range c.values {
+		if err := c.enum.Check(v); err != nil {
+			builder.AddError(err)
+			return
+		}
+		values[i] = string(v)
+	}
+	clause.IN{Column: clause.Column{Name: c.column}, Values: values}.Build(builder)
+}
@@ -0,0 +1,184 @@
+package types
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/netip"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// IP 单个 IPv4 / IPv6 地址, 无效地址存储为 NULL
+type IP struct {
+	netip.Addr
+}
+
+// ParseIP 解析 IP 地址
+func ParseIP(s string) (IP, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return IP{}, fmt.Errorf("不合法的 IP 地址: %q", s)
+	}
+	return IP{Addr: addr}, nil
+}
+
+// Scan 实现 sql.Scanner 接口
+func (ip *IP) Scan(v interface{}) error {
+	if v == nil {
+		*ip = IP{}
+		return nil
+	}
+	bs, ok := toBytes(v)
+	if !ok {
+		return fmt.Errorf("无法将 %T 扫描为 IP", v)
+	}
+	// PostgreSQL 的 INET 类型可能带有 /32 这样的掩码后缀
+	if prefix, err := netip.ParsePrefix(string(bs)); err == nil {
+		*ip = IP{Addr: prefix.Addr()}
+		return nil
+	}
+	parsed, err := ParseIP(string(bs))
+	if err != nil {
+		return err
+	}
+	*ip = parsed
+	return nil
+}
+
+// Value 实现 driver.Valuer 接口
+func (ip IP) Value() (driver.Value, error) {
+	if !ip.IsValid() {
+		return nil, nil
+	}
+	return ip.String(), nil
+}
+
+// GormDataType 实现 schema.GormDataTypeInterface 接口
+func (IP) GormDataType() string {
+	return "inet"
+}
+
+// GormDBDataType 根据数据库方言指定列类型
+func (IP) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case Postgres:
+		return "INET"
+	case SQLite:
+		return "TEXT"
+	default:
+		return "VARCHAR(45)"
+	}
+}
+
+// CIDR 一个网段, 例如 10.0.0.0/8, 无效网段存储为 NULL
+type CIDR struct {
+	netip.Prefix
+}
+
+// ParseCIDR 解析网段, 主机位会被清零
+func ParseCIDR(s string) (CIDR, error) {
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return CIDR{}, fmt.Errorf("不合法的网段: %q", s)
+	}
+	return CIDR{Prefix: prefix.Masked()}, nil
+}
+
+// Scan 实现 sql.Scanner 接口
+func (c *CIDR) Scan(v interface{}) error {
+	if v == nil {
+		*c = CIDR{}
+		return nil
+	}
+	bs, ok := toBytes(v)
+	if !ok {
+		return fmt.Errorf("无法将 %T 扫描为 CIDR", v)
+	}
+	parsed, err := ParseCIDR(string(bs))
+	if err != nil {
+		return err
+	}
+	*c = parsed
+	return nil
+}
+
+// Value 实现 driver.Valuer 接口
+func (c CIDR) Value() (driver.Value, error) {
+	if !c.IsValid() {
+		return nil, nil
+	}
+	return c.String(), nil
+}
+
+// GormDataType 实现 schema.GormDataTypeInterface 接口
+func (CIDR) GormDataType() string {
+	return "cidr"
+}
+
+// GormDBDataType 根据数据库方言指定列类型
+func (CIDR) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case Postgres:
+		return "CIDR"
+	case SQLite:
+		return "TEXT"
+	default:
+		return "VARCHAR(49)"
+	}
+}
+
+// last 返回网段中的最后一个地址
+func (c CIDR) last() netip.Addr {
+	bs := c.Addr().AsSlice()
+	for bit := c.Bits(); bit < len(bs)*8; bit++ {
+		bs[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(bs)
+	return addr
+}
+
+// IPInCIDR 构造 "IP 列位于指定网段内" 的查询条件
+//
+//	db.Where(types.IPInCIDR("last_login_ip", cidr)).Find(&users)
+func IPInCIDR(column string, cidr CIDR) clause.Expression {
+	return ipInCIDR{column: column, cidr: cidr}
+}
+
+type ipInCIDR struct {
+	column string
+	cidr   CIDR
+}
+
+func (c ipInCIDR) Build(builder clause.Builder) {
+	if !c.cidr.IsValid() {
+		builder.AddError(fmt.Errorf("IPInCIDR(%q) 的网段无效", c.column))
+		return
+	}
+
+	switch dialect := dialectOf(builder); dialect {
+	case Postgres:
+		builder.WriteQuoted(c.column)
+		builder.WriteString(" <<= ")
+		builder.AddVar(builder, c.cidr.String())
+		builder.WriteString("::cidr")
+	case MySQL:
+		// INET6_ATON 同时支持 IPv4 与 IPv6, 比较前先限定地址族的长度
+		size := 16
+		if c.cidr.Addr().Is4() {
+			size = 4
+		}
+		builder.WriteString("(LENGTH(INET6_ATON(")
+		builder.WriteQuoted(c.column)
+		builder.WriteString(fmt.Sprintf(")) = %d AND INET6_ATON(", size))
+		builder.WriteQuoted(c.column)
+		builder.WriteString(") BETWEEN INET6_ATON(")
+		builder.AddVar(builder, c.cidr.Addr().String())
+		builder.WriteString(") AND INET6_ATON(")
+		builder.AddVar(builder, c.cidr.last().String())
+		builder.WriteString("))")
+	default:
+		builder.AddError(unsupported("IPInCIDR", dialect))
+	}
+}
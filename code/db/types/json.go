@@ -0,0 +1,219 @@
+package types
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// JSON 以 JSON 文档的形式存储任意类型的数据
+//
+//	type Profile struct { Tags []string; Level int }
+//	type User struct { Profile types.JSON[Profile] }
+type JSON[T any] struct {
+	Data T
+}
+
+// NewJSON 使用指定数据构造 JSON 列
+func NewJSON[T any](data T) JSON[T] {
+	return JSON[T]{Data: data}
+}
+
+// Scan 实现 sql.Scanner 接口, NULL 会被扫描为零值
+func (j *JSON[T]) Scan(v interface{}) error {
+	var zero T
+	if v == nil {
+		j.Data = zero
+		return nil
+	}
+	bs, ok := toBytes(v)
+	if !ok {
+		return fmt.Errorf("无法将 %T 扫描为 JSON", v)
+	}
+	data := zero
+	if err := json.Unmarshal(bs, &data); err != nil {
+		return fmt.Errorf("解析 JSON 列失败: %w", err)
+	}
+	j.Data = data
+	return nil
+}
+
+// Value 实现 driver.Valuer 接口, 零值或序列化为 null 的数据存储为 NULL
+func (j JSON[T]) Value() (driver.Value, error) {
+	if reflect.ValueOf(&j.Data).Elem().IsZero() {
+		return nil, nil
+	}
+	bs, err := json.Marshal(j.Data)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(bs, []byte("null")) {
+		return nil, nil
+	}
+	return string(bs), nil
+}
+
+// GormDataType 实现 schema.GormDataTypeInterface 接口
+func (JSON[T]) GormDataType() string {
+	return "json"
+}
+
+// GormDBDataType 根据数据库方言指定列类型
+func (JSON[T]) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDBDataType(db)
+}
+
+// MarshalJSON 实现 json.Marshaler 接口, 直接输出内部数据
+func (j JSON[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.Data)
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler 接口
+func (j *JSON[T]) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &j.Data)
+}
+
+func jsonDBDataType(db *gorm.DB) string {
+	switch db.Dialector.Name() {
+	case Postgres:
+		return "JSONB"
+	case SQLServer:
+		return "NVARCHAR(MAX)"
+	default:
+		return "JSON"
+	}
+}
+
+// JSONQueryExpression JSON 列的路径查询条件
+//
+//	db.Where(types.JSONQuery("profile").Equals("gold", "vip", "level")).Find(&users)
+//	db.Where(types.JSONQuery("profile").HasKey("tags")).Find(&users)
+type JSONQueryExpression struct {
+	column string
+	path   []string
+	equals bool
+	value  interface{}
+}
+
+// JSONQuery 针对指定的 JSON 列构造查询条件
+func JSONQuery(column string) *JSONQueryExpression {
+	return &JSONQueryExpression{column: column}
+}
+
+// HasKey 路径存在, 值为 JSON null 的键同样视为存在, 返回新的条件, 不会修改 q
+func (q *JSONQueryExpression) HasKey(path ...string) *JSONQueryExpression {
+	return &JSONQueryExpression{column: q.column, path: path}
+}
+
+// Equals 路径上的值等于 value, 返回新的条件, 不会修改 q
+func (q *JSONQueryExpression) Equals(value interface{}, path ...string) *JSONQueryExpression {
+	return &JSONQueryExpression{column: q.column, path: path, equals: true, value: value}
+}
+
+// Build 实现 clause.Expression 接口, 根据方言生成条件
+func (q *JSONQueryExpression) Build(builder clause.Builder) {
+	if len(q.path) == 0 {
+		builder.AddError(fmt.Errorf("JSONQuery(%q) 缺少查询路径", q.column))
+		return
+	}
+
+	dialect := dialectOf(builder)
+	if !q.equals {
+		q.buildHasKey(builder, dialect)
+		return
+	}
+	switch dialect {
+	case MySQL, SQLite, SQLServer:
+		_, isString := q.value.(string)
+		switch {
+		case dialect == SQLServer:
+			builder.WriteString("JSON_VALUE(")
+		case dialect == MySQL && isString:
+			builder.WriteString("JSON_UNQUOTE(JSON_EXTRACT(")
+		default:
+			builder.WriteString("JSON_EXTRACT(")
+		}
+		builder.WriteQuoted(q.column)
+		builder.WriteByte(',')
+		builder.AddVar(builder, jsonPath(q.path))
+		builder.WriteByte(')')
+		if dialect == MySQL && isString {
+			builder.WriteByte(')')
+		}
+	case Postgres:
+		builder.WriteByte('(')
+		builder.WriteQuoted(q.column)
+		builder.WriteString(" #>> ")
+		builder.AddVar(builder, "{"+strings.Join(q.path, ",")+"}")
+		builder.WriteByte(')')
+	default:
+		builder.AddError(unsupported("JSONQuery", dialect))
+		return
+	}
+
+	builder.WriteString(" = ")
+	if dialect == Postgres {
+		// #>> 的结果是文本, 统一以文本进行比较
+		builder.AddVar(builder, fmt.Sprint(q.value))
+		return
+	}
+	builder.AddVar(builder, q.value)
+}
+
+// buildHasKey 生成判断路径是否存在的条件
+//
+// JSON_EXTRACT 等函数在值为 JSON null 时同样返回 NULL, 因此使用各方言判断路径本身是否存在的函数
+func (q *JSONQueryExpression) buildHasKey(builder clause.Builder, dialect string) {
+	switch dialect {
+	case MySQL:
+		builder.WriteString("JSON_CONTAINS_PATH(")
+		builder.WriteQuoted(q.column)
+		builder.WriteString(",'one',")
+		builder.AddVar(builder, jsonPath(q.path))
+		builder.WriteByte(')')
+	case SQLite:
+		// json_type 对 JSON null 返回 'null', 路径不存在时返回 NULL
+		builder.WriteString("JSON_TYPE(")
+		builder.WriteQuoted(q.column)
+		builder.WriteByte(',')
+		builder.AddVar(builder, jsonPath(q.path))
+		builder.WriteString(") IS NOT NULL")
+	case SQLServer:
+		builder.WriteString("JSON_PATH_EXISTS(")
+		builder.WriteQuoted(q.column)
+		builder.WriteByte(',')
+		builder.AddVar(builder, jsonPath(q.path))
+		builder.WriteString(") = 1")
+	case Postgres:
+		// #> 对 JSON null 返回 'null'::jsonb, 只有路径不存在时返回 NULL
+		builder.WriteByte('(')
+		builder.WriteQuoted(q.column)
+		builder.WriteString(" #> ")
+		builder.AddVar(builder, "{"+strings.Join(q.path, ",")+"}")
+		builder.WriteString(") IS NOT NULL")
+	default:
+		builder.AddError(unsupported("JSONQuery", dialect))
+	}
+}
+
+// jsonPathEscaper 转义 JSON Path 中带引号的键
+var jsonPathEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// jsonPath 将路径转换为 $."a"."b" 形式的 JSON Path
+func jsonPath(keys []string) string {
+	var sb strings.Builder
+	sb.WriteByte('$')
+	for _, key := range keys {
+		sb.WriteString(`."`)
+		sb.WriteString(jsonPathEscaper.Replace(key))
+		sb.WriteByte('"')
+	}
+	return sb.String()
+}
@@ -0,0 +1,109 @@
+package types
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// dialect 只替换方言名称, 引号与占位符沿用 MySQL
+type dialect struct {
+	mysql.Dialector
+	name string
+}
+
+func (d dialect) Name() string {
+	return d.name
+}
+
+func TestJSONQuery(t *testing.T) {
+	tests := []struct {
+		dialect string
+		query   *JSONQueryExpression
+		sql     string
+	}{
+		{MySQL, JSONQuery("profile").HasKey("tags"), "JSON_CONTAINS_PATH(`profile`,'one',?)"},
+		{SQLite, JSONQuery("profile").HasKey("tags"), "JSON_TYPE(`profile`,?) IS NOT NULL"},
+		{SQLServer, JSONQuery("profile").HasKey("tags"), "JSON_PATH_EXISTS(`profile`,?) = 1"},
+		{Postgres, JSONQuery("profile").HasKey("a", "b"), "(`profile` #> ?) IS NOT NULL"},
+		{MySQL, JSONQuery("profile").Equals("gold", "level"), "JSON_UNQUOTE(JSON_EXTRACT(`profile`,?)) = ?"},
+		{MySQL, JSONQuery("profile").Equals(3, "level"), "JSON_EXTRACT(`profile`,?) = ?"},
+		{Postgres, JSONQuery("profile").Equals(3, "level"), "(`profile` #>> ?) = ?"},
+	}
+	for _, tt := range tests {
+		stmt := &gorm.Statement{DB: &gorm.DB{Config: &gorm.Config{Dialector: dialect{name: tt.dialect}}}}
+		tt.query.Build(stmt)
+		if stmt.Error != nil {
+			t.Errorf("%s: %v", tt.dialect, stmt.Error)
+			continue
+		}
+		if got := stmt.SQL.String(); got != tt.sql {
+			t.Errorf("%s: got %s, want %s", tt.dialect, got, tt.sql)
+		}
+	}
+}
+
+func TestJSONQueryCopy(t *testing.T) {
+	base := JSONQuery("profile")
+	hasKey := base.HasKey("tags")
+	equals := base.Equals("gold", "level")
+	if base.path != nil || base.equals {
+		t.Errorf("HasKey/Equals 修改了原条件: %+v", base)
+	}
+	if !reflect.DeepEqual(hasKey.path, []string{"tags"}) || hasKey.equals {
+		t.Errorf("HasKey 的条件为 %+v", hasKey)
+	}
+	if !reflect.DeepEqual(equals.path, []string{"level"}) || !equals.equals || equals.value != "gold" {
+		t.Errorf("Equals 的条件为 %+v", equals)
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	tests := []struct {
+		keys []string
+		path string
+	}{
+		{[]string{"a", "b"}, `$."a"."b"`},
+		{[]string{`a"b`}, `$."a\"b"`},
+		{[]string{`a\`}, `$."a\\"`},
+		{[]string{`a\"`}, `$."a\\\""`},
+	}
+	for _, tt := range tests {
+		if got := jsonPath(tt.keys); got != tt.path {
+			t.Errorf("jsonPath(%q) = %s, want %s", tt.keys, got, tt.path)
+		}
+	}
+}
+
+func TestJSONValue(t *testing.T) {
+	type profile struct {
+		Tags  []string
+		Level int
+	}
+	tests := []struct {
+		name  string
+		value driver.Valuer
+		want  driver.Value
+	}{
+		{"零值结构体", JSON[profile]{}, nil},
+		{"nil 切片", JSON[[]string]{}, nil},
+		{"nil map", JSON[map[string]int]{}, nil},
+		{"空切片", NewJSON([]string{}), "[]"},
+		{"结构体", NewJSON(profile{Level: 1}), `{"Tags":null,"Level":1}`},
+	}
+	for _, tt := range tests {
+		got, err := tt.value.Value()
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Value() = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	// NULL 扫描为零值
+	j := NewJSON(profile{Level: 1})
+	if err := j.Scan(nil); err != nil || !reflect.ValueOf(j.Data).IsZero() {
+		t.Errorf("扫描 NULL 之后为 %+v, %v", j, err)
+	}
+}
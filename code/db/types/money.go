@@ -0,0 +1,223 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrCurrencyMismatch 两个金额的币种不一致
+var ErrCurrencyMismatch = errors.New("币种不一致")
+
+// minorUnits 各币种的最小单位位数, 未列出的币种默认为 2 位
+var minorUnits = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"BHD": 3,
+	"KWD": 3,
+}
+
+// MinorUnits 返回币种的最小单位位数, 例如 CNY 为 2 (分), JPY 为 0
+func MinorUnits(currency string) int {
+	if n, ok := minorUnits[currency]; ok {
+		return n
+	}
+	return 2
+}
+
+// Money 带币种的金额
+//
+// 作为模型字段时需要配合 embedded 标签使用, 会生成 DECIMAL 与 CHAR(3) 两列:
+//
+//	Price types.Money `gorm:"embedded;embeddedPrefix:price_"` // price_amount, price_currency
+type Money struct {
+	Amount   Decimal
+	Currency string `gorm:"type:char(3)"`
+}
+
+// NewMoney 使用金额字符串以及 ISO 4217 币种代码构造金额
+func NewMoney(amount, currency string) (Money, error) {
+	if err := checkCurrency(currency); err != nil {
+		return Money{}, err
+	}
+	d, err := ParseDecimal(amount)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: d, Currency: currency}, nil
+}
+
+// MustMoney 与 NewMoney 相同, 失败时 panic, 适用于常量
+func MustMoney(amount, currency string) Money {
+	m, err := NewMoney(amount, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func checkCurrency(currency string) error {
+	if len(currency) != 3 || strings.ToUpper(currency) != currency {
+		return fmt.Errorf("不合法的币种代码: %q", currency)
+	}
+	for _, c := range currency {
+		if c < 'A' || c > 'Z' {
+			return fmt.Errorf("不合法的币种代码: %q", currency)
+		}
+	}
+	return nil
+}
+
+// IsZero 金额是否为 0
+func (m Money) IsZero() bool {
+	return m.Amount.IsZero()
+}
+
+func (m Money) sameCurrency(o Money) error {
+	if m.Currency != o.Currency {
+		return fmt.Errorf("%w: %s 与 %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return nil
+}
+
+// Add 加法, 币种不同时返回 ErrCurrencyMismatch, 溢出时返回 ErrDecimalOverflow
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	amount, err := m.Amount.CheckedAdd(o.Amount)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: m.Currency}, nil
+}
+
+// Sub 减法, 币种不同时返回 ErrCurrencyMismatch, 溢出时返回 ErrDecimalOverflow
+func (m Money) Sub(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	amount, err := m.Amount.CheckedSub(o.Amount)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: m.Currency}, nil
+}
+
+// Mul 乘以系数, 结果按币种的最小单位四舍五入, 溢出时返回 ErrDecimalOverflow
+func (m Money) Mul(factor Decimal) (Money, error) {
+	amount, err := m.Amount.CheckedMul(factor)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: m.Currency}.Round()
+}
+
+// Discount 按百分比打折, 例如 Discount(MustDecimal("15")) 表示减去 15%
+func (m Money) Discount(percent Decimal) (Money, error) {
+	rate, err := DecimalFromInt(100).CheckedSub(percent)
+	if err != nil {
+		return Money{}, err
+	}
+	if rate, err = rate.CheckedMul(MustDecimal("0.01")); err != nil {
+		return Money{}, err
+	}
+	return m.Mul(rate)
+}
+
+// Round 按币种的最小单位四舍五入, 溢出时返回 ErrDecimalOverflow
+func (m Money) Round() (Money, error) {
+	amount, err := m.Amount.CheckedRound(MinorUnits(m.Currency))
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: m.Currency}, nil
+}
+
+// Format 输出 "CNY 1,234.50" 格式的金额
+func (m Money) Format() string {
+	s := m.Amount.StringFixed(MinorUnits(m.Currency))
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, fracPart, hasFrac := strings.Cut(s, ".")
+
+	var sb strings.Builder
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteRune(c)
+	}
+	if hasFrac {
+		sb.WriteByte('.')
+		sb.WriteString(fracPart)
+	}
+	return strings.TrimSpace(m.Currency + " " + sign + sb.String())
+}
+
+func (m Money) String() string {
+	return m.Format()
+}
+
+// moneyJSON 金额在 JSON 中的结构
+type moneyJSON struct {
+	Amount   Decimal `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+// MarshalJSON 实现 json.Marshaler 接口, 输出 {"amount":"12.34","currency":"CNY"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON(m))
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler 接口
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var v moneyJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkCurrency(v.Currency); err != nil {
+		return err
+	}
+	*m = Money(v)
+	return nil
+}
+
+// MarshalText 实现 encoding.TextMarshaler 接口, 输出 "12.34 CNY"
+func (m Money) MarshalText() ([]byte, error) {
+	return []byte(m.Amount.String() + " " + m.Currency), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler 接口, 支持 "12.34 CNY" 与 "CNY 12.34"
+func (m *Money) UnmarshalText(text []byte) error {
+	parts := strings.Fields(string(text))
+	if len(parts) != 2 {
+		return fmt.Errorf("不合法的金额: %q, 格式应为 \"12.34 CNY\"", text)
+	}
+	amount, currency := parts[0], parts[1]
+	if checkCurrency(amount) == nil {
+		amount, currency = currency, amount
+	}
+	parsed, err := NewMoney(amount, currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// AmountExpr 生成原子调整金额列的表达式: column = ROUND(column * factor + delta, places)
+//
+// 参数会被显式转换为 DECIMAL, 避免数据库按浮点数进行运算
+//
+//	db.Model(&product).Update("price_amount", types.AmountExpr("price_amount", types.MustDecimal("0.9"), types.Decimal{}, 2))
+func AmountExpr(column string, factor, delta Decimal, places int) clause.Expr {
+	return gorm.Expr("ROUND(? * CAST(? AS DECIMAL(19,4)) + CAST(? AS DECIMAL(19,4)), ?)", clause.Column{Name: column}, factor, delta, places)
+}
@@ -0,0 +1,118 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMoneyArithmetic(t *testing.T) {
+	a, b := MustMoney("10.50", "CNY"), MustMoney("0.75", "CNY")
+	if sum, err := a.Add(b); err != nil || sum.Format() != "CNY 11.25" {
+		t.Errorf("Add = %s, %v", sum, err)
+	}
+	if diff, err := b.Sub(a); err != nil || diff.Format() != "CNY -9.75" {
+		t.Errorf("Sub = %s, %v", diff, err)
+	}
+	if _, err := a.Add(MustMoney("1", "USD")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("币种不同时 Add 返回 %v", err)
+	}
+
+	// 结果按币种的最小单位四舍五入
+	tests := []struct {
+		money  Money
+		factor string
+		want   string
+	}{
+		{MustMoney("10", "CNY"), "0.333", "CNY 3.33"},
+		{MustMoney("10", "CNY"), "0.3335", "CNY 3.34"},
+		{MustMoney("1000", "JPY"), "0.3335", "JPY 334"},
+		{MustMoney("1", "KWD"), "0.1235", "KWD 0.124"},
+	}
+	for _, tt := range tests {
+		if got, err := tt.money.Mul(MustDecimal(tt.factor)); err != nil || got.Format() != tt.want {
+			t.Errorf("%s * %s = %s, %v, want %s", tt.money, tt.factor, got, err, tt.want)
+		}
+	}
+
+	if got, err := MustMoney("199.99", "CNY").Discount(MustDecimal("15")); err != nil || got.Format() != "CNY 169.99" {
+		t.Errorf("Discount = %s, %v", got, err)
+	}
+}
+
+func TestMoneyOverflow(t *testing.T) {
+	max := Money{Amount: Decimal{units: math.MaxInt64}, Currency: "CNY"}
+	if _, err := max.Add(MustMoney("1", "CNY")); !errors.Is(err, ErrDecimalOverflow) {
+		t.Errorf("Add 溢出时返回 %v", err)
+	}
+	min := Money{Amount: Decimal{units: math.MinInt64}, Currency: "CNY"}
+	if _, err := min.Sub(MustMoney("1", "CNY")); !errors.Is(err, ErrDecimalOverflow) {
+		t.Errorf("Sub 溢出时返回 %v", err)
+	}
+	if _, err := max.Mul(DecimalFromInt(2)); !errors.Is(err, ErrDecimalOverflow) {
+		t.Errorf("Mul 溢出时返回 %v", err)
+	}
+	if _, err := max.Discount(DecimalFromInt(-100)); !errors.Is(err, ErrDecimalOverflow) {
+		t.Errorf("Discount 溢出时返回 %v", err)
+	}
+	yen := Money{Amount: max.Amount, Currency: "JPY"}
+	if _, err := yen.Round(); !errors.Is(err, ErrDecimalOverflow) {
+		t.Errorf("Round 溢出时返回 %v", err)
+	}
+	if got := yen.Format(); got != "JPY 922,337,203,685,478" {
+		t.Errorf("Format = %s", got)
+	}
+}
+
+func TestMoneyParse(t *testing.T) {
+	tests := []struct {
+		amount, currency string
+		ok               bool
+	}{
+		{"12.34", "CNY", true},
+		{"-1", "USD", true},
+		{"12.34", "cny", false},
+		{"12.34", "CN", false},
+		{"12.34", "C1Y", false},
+		{"-+1", "CNY", false},
+	}
+	for _, tt := range tests {
+		if _, err := NewMoney(tt.amount, tt.currency); (err == nil) != tt.ok {
+			t.Errorf("NewMoney(%q, %q) 错误为 %v", tt.amount, tt.currency, err)
+		}
+	}
+
+	if got := MustMoney("1234567.5", "CNY").Format(); got != "CNY 1,234,567.50" {
+		t.Errorf("Format = %s", got)
+	}
+	if got := MustMoney("-1234", "JPY").Format(); got != "JPY -1,234" {
+		t.Errorf("Format = %s", got)
+	}
+}
+
+func TestMoneyEncoding(t *testing.T) {
+	m := MustMoney("12.34", "CNY")
+	data, err := json.Marshal(m)
+	if err != nil || string(data) != `{"amount":"12.34","currency":"CNY"}` {
+		t.Errorf("MarshalJSON = %s, %v", data, err)
+	}
+	var decoded Money
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded != m {
+		t.Errorf("UnmarshalJSON = %v, %v", decoded, err)
+	}
+	if err := json.Unmarshal([]byte(`{"amount":"1","currency":"cny"}`), &decoded); err == nil {
+		t.Error("UnmarshalJSON 应该拒绝不合法的币种")
+	}
+
+	for _, text := range []string{"12.34 CNY", "CNY 12.34"} {
+		var parsed Money
+		if err := parsed.UnmarshalText([]byte(text)); err != nil || parsed != m {
+			t.Errorf("UnmarshalText(%q) = %v, %v", text, parsed, err)
+		}
+	}
+	var parsed Money
+	if err := parsed.UnmarshalText([]byte("12.34")); err == nil {
+		t.Error("缺少币种时 UnmarshalText 应该返回错误")
+	}
+}
@@ -0,0 +1,107 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Strings 以 JSON 数组的形式存储字符串切片
+//
+// nil 切片存储为 NULL, 空切片存储为 []
+type Strings []string
+
+// Scan 实现 sql.Scanner 接口
+func (s *Strings) Scan(v interface{}) error {
+	if v == nil {
+		*s = nil
+		return nil
+	}
+	bs, ok := toBytes(v)
+	if !ok {
+		return fmt.Errorf("无法将 %T 扫描为 Strings", v)
+	}
+	var values []string
+	if err := json.Unmarshal(bs, &values); err != nil {
+		return fmt.Errorf("解析字符串数组失败: %w", err)
+	}
+	*s = values
+	return nil
+}
+
+// Value 实现 driver.Valuer 接口
+func (s Strings) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+	bs, err := json.Marshal([]string(s))
+	return string(bs), err
+}
+
+// GormDataType 实现 schema.GormDataTypeInterface 接口
+func (Strings) GormDataType() string {
+	return "json"
+}
+
+// GormDBDataType 根据数据库方言指定列类型
+func (Strings) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDBDataType(db)
+}
+
+// Contains 判断切片中是否包含指定字符串
+func (s Strings) Contains(value string) bool {
+	for _, v := range s {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// StringsContains 构造 "数组列包含指定字符串" 的查询条件
+//
+//	db.Where(types.StringsContains("tags", "vip")).Find(&users)
+func StringsContains(column, value string) clause.Expression {
+	return stringsContains{column: column, value: value}
+}
+
+type stringsContains struct {
+	column string
+	value  string
+}
+
+func (c stringsContains) Build(builder clause.Builder) {
+	switch dialect := dialectOf(builder); dialect {
+	case MySQL:
+		bs, _ := json.Marshal(c.value)
+		builder.WriteString("JSON_CONTAINS(")
+		builder.WriteQuoted(c.column)
+		builder.WriteByte(',')
+		builder.AddVar(builder, string(bs))
+		builder.WriteByte(')')
+	case Postgres:
+		bs, _ := json.Marshal([]string{c.value})
+		builder.WriteQuoted(c.column)
+		builder.WriteString(" @> ")
+		builder.AddVar(builder, string(bs))
+		builder.WriteString("::jsonb")
+	case SQLite:
+		builder.WriteString("EXISTS (SELECT 1 FROM json_each(")
+		builder.WriteQuoted(c.column)
+		builder.WriteString(") WHERE value = ")
+		builder.AddVar(builder, c.value)
+		builder.WriteByte(')')
+	case SQLServer:
+		builder.WriteString("EXISTS (SELECT 1 FROM OPENJSON(")
+		builder.WriteQuoted(c.column)
+		builder.WriteString(") WHERE value = ")
+		builder.AddVar(builder, c.value)
+		builder.WriteByte(')')
+	default:
+		builder.AddError(unsupported("StringsContains", dialect))
+	}
+}
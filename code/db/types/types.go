@@ -0,0 +1,45 @@
+// 可复用的自定义字段类型
+//
+// 每个类型都按照 db.Location 的方式实现 sql.Scanner、driver.Valuer 以及
+// GormDataType / GormDBDataType, 根据不同的数据库方言生成对应的 DDL,
+// 并且统一约定: 数据库中的 NULL 会被扫描为类型的零值, 零值写入数据库时存储为 NULL
+package types
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 支持的数据库方言名称, 与 gorm.Dialector.Name() 的返回值一致
+const (
+	MySQL     = "mysql"
+	Postgres  = "postgres"
+	SQLite    = "sqlite"
+	SQLServer = "sqlserver"
+)
+
+// dialectOf 返回构造条件时所使用的数据库方言
+func dialectOf(builder clause.Builder) string {
+	if stmt, ok := builder.(*gorm.Statement); ok && stmt.DB != nil && stmt.DB.Dialector != nil {
+		return stmt.DB.Dialector.Name()
+	}
+	return ""
+}
+
+// unsupported 构造一个方言不支持的错误
+func unsupported(helper, dialect string) error {
+	return fmt.Errorf("%s 不支持数据库方言: %q", helper, dialect)
+}
+
+// toBytes 将数据库返回的字符串类数据统一转换为 []byte
+func toBytes(v interface{}) ([]byte, bool) {
+	switch v := v.(type) {
+	case []byte:
+		return v, true
+	case string:
+		return []byte(v), true
+	}
+	return nil, false
+}
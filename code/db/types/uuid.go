@@ -0,0 +1,128 @@
+package types
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// UUID RFC 4122 格式的通用唯一标识符, 零值存储为 NULL
+type UUID [16]byte
+
+// NewUUID 生成一个随机的 v4 UUID
+func NewUUID() UUID {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		panic(fmt.Sprintf("生成 UUID 失败: %v", err))
+	}
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return u
+}
+
+// ParseUUID 解析 xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx 格式的字符串
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, fmt.Errorf("不合法的 UUID: %q", s)
+	}
+	digits := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36]
+	if _, err := hex.Decode(u[:], []byte(digits)); err != nil {
+		return UUID{}, fmt.Errorf("不合法的 UUID: %q", s)
+	}
+	return u, nil
+}
+
+// IsZero 是否为零值
+func (u UUID) IsZero() bool {
+	return u == UUID{}
+}
+
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// Scan 实现 sql.Scanner 接口, 支持字符串格式以及 16 字节的二进制格式
+func (u *UUID) Scan(v interface{}) error {
+	if v == nil {
+		*u = UUID{}
+		return nil
+	}
+	bs, ok := toBytes(v)
+	if !ok {
+		return fmt.Errorf("无法将 %T 扫描为 UUID", v)
+	}
+	if len(bs) == 16 {
+		copy(u[:], bs)
+		return nil
+	}
+	parsed, err := ParseUUID(string(bs))
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
+
+// Value 实现 driver.Valuer 接口
+func (u UUID) Value() (driver.Value, error) {
+	if u.IsZero() {
+		return nil, nil
+	}
+	return u.String(), nil
+}
+
+// GormDataType 实现 schema.GormDataTypeInterface 接口
+func (UUID) GormDataType() string {
+	return "uuid"
+}
+
+// GormDBDataType 根据数据库方言指定列类型
+func (UUID) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case Postgres:
+		return "UUID"
+	case SQLServer:
+		return "UNIQUEIDENTIFIER"
+	case SQLite:
+		return "TEXT"
+	default:
+		return "CHAR(36)"
+	}
+}
+
+// MarshalText 实现 encoding.TextMarshaler 接口, 零值输出为空字符串
+func (u UUID) MarshalText() ([]byte, error) {
+	if u.IsZero() {
+		return []byte{}, nil
+	}
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler 接口
+func (u *UUID) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*u = UUID{}
+		return nil
+	}
+	parsed, err := ParseUUID(string(text))
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
@@ -0,0 +1,498 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm-learn/db/event"
+	"gorm-learn/db/optimistic"
+	"gorm-learn/db/softdelete"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// 校验冲突配置时返回的错误
+var (
+	// ErrNoConflictTarget 没有指定冲突字段
+	ErrNoConflictTarget = errors.New("upsert 需要指定冲突字段")
+	// ErrNoUniqueIndex 冲突字段上没有对应的唯一索引
+	ErrNoUniqueIndex = errors.New("冲突字段上没有对应的唯一索引")
+	// ErrUnknownColumn 字段不存在于模型中
+	ErrUnknownColumn = errors.New("字段不存在")
+)
+
+// Conflict 描述 upsert 时的冲突处理方式, 使用 OnConflict 构造
+type Conflict struct {
+	columns    []string
+	updates    []string
+	increments []string
+}
+
+// OnConflict 指定冲突字段, 这些字段必须恰好构成主键或者某个唯一索引
+//
+// MySQL 的 ON DUPLICATE KEY UPDATE 无法指定冲突字段, 插入的记录与任意一个唯一索引 (包括主键) 冲突时都会更新,
+// 因此在 MySQL 上冲突字段只用于校验与统计: 例如 products 的主键与 (code, deleted_at) 都是唯一索引,
+// 以 code 为冲突字段、但记录中带有已存在的主键时, 会按主键更新另一条记录, Inserted 与 Updated 的统计也不再准确.
+// 在 MySQL 上使用时, 插入的记录除冲突字段之外不应该与其他唯一索引冲突, 通常让主键保持零值由数据库生成
+func OnConflict(columns ...string) *Conflict {
+	return &Conflict{columns: columns}
+}
+
+// Update 冲突时将字段更新为新插入的值
+func (c *Conflict) Update(columns ...string) *Conflict {
+	c.updates = append(c.updates, columns...)
+	return c
+}
+
+// Increment 冲突时将字段累加上新插入的值, 只能用于数值字段
+func (c *Conflict) Increment(columns ...string) *Conflict {
+	c.increments = append(c.increments, columns...)
+	return c
+}
+
+// UpsertResult upsert 的执行结果
+type UpsertResult struct {
+	// Inserted 新插入的记录数
+	Inserted int64
+	// Updated 因冲突而被更新 (或忽略) 的记录数
+	Updated int64
+}
+
+// Upsert 批量插入记录, 冲突时按照 conflict 的配置更新已有的记录
+//
+// rows 为模型的指针或切片指针. 执行前会在同一个事务中锁定已存在的冲突记录,
+// 据此统计新插入与被更新的记录数, 并让 event 插件为被更新的记录生成 Updated 事件; 软删除的记录同样会参与冲突并被恢复, 带有 optimistic.Version 的记录版本号加 1.
+// 不同数据库生成的 SQL:
+//
+//	INSERT INTO ... AS `new` ON DUPLICATE KEY UPDATE `price`=`new`.`price`; MySQL 8.0.19+
+//	INSERT INTO ... ON CONFLICT ("code") DO UPDATE SET "price"="excluded"."price"; PostgreSQL / SQLite
+//	MERGE INTO ... WHEN MATCHED THEN UPDATE SET ...; SQL Server
+func Upsert(ctx context.Context, rows interface{}, conflict *Conflict) (UpsertResult, error) {
+	var result UpsertResult
+	err := Conn(ctx).Transaction(func(tx *gorm.DB) error {
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(rows); err != nil {
+			return err
+		}
+		expr, err := conflict.build(stmt.Schema)
+		if err != nil {
+			return err
+		}
+
+		values := reflect.Indirect(reflect.ValueOf(rows))
+		keys := conflictKeys(ctx, stmt.Schema, values, expr.target)
+		if len(keys) == 0 {
+			return nil
+		}
+		seen, err := existingKeys(tx, stmt.Schema, expr.target, keys)
+		if err != nil {
+			return err
+		}
+		updated := make([]bool, len(keys))
+		for i, key := range keys {
+			if key.zero {
+				result.Inserted++
+			} else if seen[key.id] {
+				result.Updated++
+				updated[i] = true
+			} else {
+				result.Inserted++
+				seen[key.id] = true
+			}
+		}
+		// 冲突的记录生成 Updated 事件而不是 Created
+		tx = event.WithUpsert(tx, event.Upsert{Updated: updated, Changed: expr.changed()})
+
+		var onConflict clause.Expression = expr
+		if tx.Dialector.Name() == "sqlserver" {
+			onConflict = expr.native(stmt.Table)
+		}
+		if err := tx.Clauses(onConflict).Create(rows).Error; err != nil {
+			return err
+		}
+
+		// MySQL 只能拿到第一条新插入记录的自增主键, GORM 依次递增回填的主键
+		// 在发生冲突时是错误的, 需要按冲突字段重新查询
+		if tx.Dialector.Name() == "mysql" && result.Updated > 0 && !sameFields(expr.target, stmt.Schema.PrimaryFields) {
+			return refreshPrimaryKeys(tx, stmt.Schema, values, expr.target, keys)
+		}
+		return nil
+	})
+	if err != nil {
+		return UpsertResult{}, err
+	}
+	return result, nil
+}
+
+// build 根据模型校验冲突配置并生成冲突子句
+func (c *Conflict) build(sch *schema.Schema) (upsertClause, error) {
+	if c == nil || len(c.columns) == 0 {
+		return upsertClause{}, ErrNoConflictTarget
+	}
+
+	lookup := func(name string) (*schema.Field, error) {
+		field := sch.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("%w: %s.%s", ErrUnknownColumn, sch.Table, name)
+		}
+		return field, nil
+	}
+
+	var expr upsertClause
+	for _, name := range c.columns {
+		field, err := lookup(name)
+		if err != nil {
+			return upsertClause{}, err
+		}
+		expr.target = append(expr.target, field)
+	}
+	if !hasUniqueIndex(sch, expr.target) {
+		return upsertClause{}, fmt.Errorf("%w: %s(%s)", ErrNoUniqueIndex, sch.Table, strings.Join(c.columns, ", "))
+	}
+
+	for _, name := range c.updates {
+		field, err := lookup(name)
+		if err != nil {
+			return upsertClause{}, err
+		}
+		if slices.Contains(expr.target, field) {
+			return upsertClause{}, fmt.Errorf("冲突字段 %s 不能被更新", field.DBName)
+		}
+		expr.updates = append(expr.updates, field)
+	}
+	for _, name := range c.increments {
+		field, err := lookup(name)
+		if err != nil {
+			return upsertClause{}, err
+		}
+		if slices.Contains(expr.target, field) || slices.Contains(expr.updates, field) {
+			return upsertClause{}, fmt.Errorf("字段 %s 不能同时被更新和累加", field.DBName)
+		}
+		if !isNumeric(field) {
+			return upsertClause{}, fmt.Errorf("字段 %s 不是数值类型, 无法累加", field.DBName)
+		}
+		expr.increments = append(expr.increments, field)
+	}
+
+	// 有实际的更新时, 同步维护更新时间并恢复被软删除的记录
+	if len(expr.updates)+len(expr.increments) > 0 {
+		for _, field := range sch.Fields {
+			// 软删除字段属于冲突字段时, 冲突的一定是未删除的记录, 不需要恢复
+			revive := softdelete.IsField(field) && !slices.Contains(expr.target, field)
+			if (field.AutoUpdateTime > 0 || revive) && !slices.Contains(expr.updates, field) {
+				expr.updates = append(expr.updates, field)
+			}
+		}
+		// 与 optimistic 插件相同, 更新已有的记录时版本号加 1, 持有旧版本的更新会发生冲突
+		if field := optimistic.Field(sch); field != nil && !slices.Contains(expr.target, field) && !slices.Contains(expr.updates, field) && !slices.Contains(expr.increments, field) {
+			expr.bumps = append(expr.bumps, field)
+		}
+	}
+	return expr, nil
+}
+
+// hasUniqueIndex 判断字段是否恰好构成主键或者某个唯一索引
+func hasUniqueIndex(sch *schema.Schema, fields []*schema.Field) bool {
+	if sameFields(sch.PrimaryFields, fields) {
+		return true
+	}
+	if len(fields) == 1 && fields[0].Unique {
+		return true
+	}
+	for _, index := range sch.ParseIndexes() {
+		if index.Class != "UNIQUE" || index.Where != "" {
+			continue
+		}
+		indexFields := make([]*schema.Field, 0, len(index.Fields))
+		for _, option := range index.Fields {
+			indexFields = append(indexFields, option.Field)
+		}
+		if sameFields(indexFields, fields) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameFields 判断两组字段是否相同, 不考虑顺序
+func sameFields(a, b []*schema.Field) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, field := range a {
+		if !slices.Contains(b, field) {
+			return false
+		}
+	}
+	return true
+}
+
+// isNumeric 判断字段是否为数值类型
+func isNumeric(field *schema.Field) bool {
+	switch field.DataType {
+	case schema.Int, schema.Uint, schema.Float:
+		return true
+	}
+	dataType := strings.ToUpper(string(field.DataType))
+	return strings.HasPrefix(dataType, "DECIMAL") || strings.HasPrefix(dataType, "NUMERIC")
+}
+
+// conflictKey 一条记录在冲突字段上的取值
+type conflictKey struct {
+	id     string
+	values []interface{}
+	// zero 冲突字段全部为零值, 例如尚未分配的自增主键, 这样的记录总是会被插入
+	zero bool
+}
+
+// conflictKeys 按顺序返回每条记录的冲突字段取值
+func conflictKeys(ctx context.Context, sch *schema.Schema, values reflect.Value, target []*schema.Field) []conflictKey {
+	var keys []conflictKey
+	add := func(row reflect.Value) {
+		row = reflect.Indirect(row)
+		key := conflictKey{values: make([]interface{}, 0, len(target)), zero: true}
+		for _, field := range target {
+			v, zero := field.ValueOf(ctx, row)
+			key.values = append(key.values, v)
+			key.zero = key.zero && zero
+		}
+		key.id = fmt.Sprint(key.values...)
+		keys = append(keys, key)
+	}
+
+	switch values.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < values.Len(); i++ {
+			add(values.Index(i))
+		}
+	case reflect.Struct:
+		add(values)
+	}
+	return keys
+}
+
+// existingKeys 锁定并返回数据库中已经存在的冲突字段取值, 包括被软删除的记录
+func existingKeys(tx *gorm.DB, sch *schema.Schema, target []*schema.Field, keys []conflictKey) (map[string]bool, error) {
+	found, err := findByKeys(tx, sch, target, keys, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, found.Len())
+	for _, key := range conflictKeys(tx.Statement.Context, sch, found, target) {
+		seen[key.id] = true
+	}
+	return seen, nil
+}
+
+// refreshPrimaryKeys 按冲突字段重新查询主键并回填到 values 中
+func refreshPrimaryKeys(tx *gorm.DB, sch *schema.Schema, values reflect.Value, target []*schema.Field, keys []conflictKey) error {
+	found, err := findByKeys(tx, sch, target, keys, sch.PrimaryFields, false)
+	if err != nil {
+		return err
+	}
+	ctx := tx.Statement.Context
+	rows := make(map[string]reflect.Value, found.Len())
+	for i, key := range conflictKeys(ctx, sch, found, target) {
+		rows[key.id] = found.Index(i)
+	}
+
+	set := func(i int, row reflect.Value) error {
+		src, ok := rows[keys[i].id]
+		if !ok {
+			return nil
+		}
+		for _, field := range sch.PrimaryFields {
+			v, _ := field.ValueOf(ctx, src)
+			if err := field.Set(ctx, reflect.Indirect(row), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if values.Kind() == reflect.Struct {
+		return set(0, values)
+	}
+	for i := 0; i < values.Len(); i++ {
+		if err := set(i, values.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findByKeys 按冲突字段查询记录, 返回模型类型的切片, 只包含冲突字段以及 extra 中的字段
+func findByKeys(tx *gorm.DB, sch *schema.Schema, target []*schema.Field, keys []conflictKey, extra []*schema.Field, lock bool) (reflect.Value, error) {
+	found := reflect.New(reflect.SliceOf(sch.ModelType)).Elem()
+	queryValues := make([][]interface{}, 0, len(keys))
+	for _, key := range keys {
+		if !key.zero {
+			queryValues = append(queryValues, key.values)
+		}
+	}
+	if len(queryValues) == 0 {
+		return found, nil
+	}
+
+	keyColumns := make([]string, 0, len(target))
+	for _, field := range target {
+		keyColumns = append(keyColumns, field.DBName)
+	}
+	columns := slices.Clone(keyColumns)
+	for _, field := range extra {
+		if !slices.Contains(columns, field.DBName) {
+			columns = append(columns, field.DBName)
+		}
+	}
+	column, values := schema.ToQueryValues(sch.Table, keyColumns, queryValues)
+
+	query := tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(reflect.New(sch.ModelType).Interface()).
+		Select(columns).
+		Where(clause.IN{Column: column, Values: values})
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	err := query.Find(found.Addr().Interface()).Error
+	return found, err
+}
+
+// upsertClause 按照数据库方言生成冲突处理子句
+type upsertClause struct {
+	target     []*schema.Field
+	updates    []*schema.Field
+	increments []*schema.Field
+	// bumps 冲突时在已有的值上加 1 的字段, 即版本号
+	bumps []*schema.Field
+}
+
+// changed 返回冲突时更新的字段名, 与更新语句的事件一样不包含自动更新的时间字段
+func (u upsertClause) changed() []string {
+	var names []string
+	for _, fields := range [][]*schema.Field{u.updates, u.increments, u.bumps} {
+		for _, field := range fields {
+			if field.AutoUpdateTime == 0 {
+				names = append(names, field.Name)
+			}
+		}
+	}
+	return names
+}
+
+// Name 实现 clause.Interface 接口, 与 clause.OnConflict 使用同一个子句名
+func (upsertClause) Name() string {
+	return "ON CONFLICT"
+}
+
+// MergeClause 实现 clause.Interface 接口, 子句的关键字由 Build 按方言自行生成
+func (u upsertClause) MergeClause(c *clause.Clause) {
+	c.Name = ""
+	c.Expression = u
+}
+
+// Build 实现 clause.Expression 接口
+func (u upsertClause) Build(builder clause.Builder) {
+	stmt, _ := builder.(*gorm.Statement)
+	if stmt != nil && stmt.Dialector.Name() == "mysql" {
+		u.buildMySQL(stmt)
+		return
+	}
+
+	builder.WriteString("ON CONFLICT (")
+	for i, field := range u.target {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteQuoted(field.DBName)
+	}
+	builder.WriteString(") ")
+	if len(u.updates)+len(u.increments) == 0 {
+		builder.WriteString("DO NOTHING")
+		return
+	}
+
+	builder.WriteString("DO UPDATE SET ")
+	table := ""
+	if stmt != nil {
+		table = stmt.Table
+	}
+	u.writeAssignments(builder, "excluded", table)
+}
+
+// buildMySQL 使用 MySQL 8.0.19 引入的行别名语法, 代替已经废弃的 VALUES() 函数
+func (u upsertClause) buildMySQL(stmt *gorm.Statement) {
+	const alias = "new"
+	stmt.WriteString("AS ")
+	stmt.WriteQuoted(alias)
+	stmt.WriteString(" ON DUPLICATE KEY UPDATE ")
+	if len(u.updates)+len(u.increments) == 0 {
+		// 没有需要更新的字段时, 把冲突字段赋值为自身以忽略冲突, 带上表名与别名区分
+		stmt.WriteQuoted(u.target[0].DBName)
+		stmt.WriteByte('=')
+		stmt.WriteQuoted(clause.Column{Table: stmt.Table, Name: u.target[0].DBName})
+		return
+	}
+	// 已有数据的列带上表名, 与新插入数据的别名区分
+	u.writeAssignments(stmt, alias, stmt.Table)
+}
+
+// writeAssignments 生成 SET 部分, source 为新插入数据的别名, table 为已有数据的表名
+func (u upsertClause) writeAssignments(builder clause.Builder, source, table string) {
+	n := 0
+	assign := func(field *schema.Field) {
+		if n > 0 {
+			builder.WriteByte(',')
+		}
+		n++
+		builder.WriteQuoted(field.DBName)
+		builder.WriteByte('=')
+	}
+	for _, field := range u.updates {
+		assign(field)
+		builder.WriteQuoted(clause.Column{Table: source, Name: field.DBName})
+	}
+	for _, field := range u.increments {
+		assign(field)
+		builder.WriteQuoted(clause.Column{Table: table, Name: field.DBName})
+		builder.WriteByte('+')
+		builder.WriteQuoted(clause.Column{Table: source, Name: field.DBName})
+	}
+	for _, field := range u.bumps {
+		assign(field)
+		builder.WriteQuoted(clause.Column{Table: table, Name: field.DBName})
+		builder.WriteString("+1")
+	}
+}
+
+// native 转换为 clause.OnConflict, 由 SQL Server 驱动生成 MERGE 语句
+func (u upsertClause) native(table string) clause.OnConflict {
+	onConflict := clause.OnConflict{DoNothing: len(u.updates)+len(u.increments) == 0}
+	for _, field := range u.target {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: field.DBName})
+	}
+	for _, field := range u.updates {
+		onConflict.DoUpdates = append(onConflict.DoUpdates, clause.Assignment{
+			Column: clause.Column{Name: field.DBName},
+			Value:  clause.Column{Table: "excluded", Name: field.DBName},
+		})
+	}
+	for _, field := range u.increments {
+		onConflict.DoUpdates = append(onConflict.DoUpdates, clause.Assignment{
+			Column: clause.Column{Name: field.DBName},
+			Value: clause.Expr{SQL: "? + ?", Vars: []interface{}{
+				clause.Column{Table: table, Name: field.DBName},
+				clause.Column{Table: "excluded", Name: field.DBName},
+			}},
+		})
+	}
+	for _, field := range u.bumps {
+		onConflict.DoUpdates = append(onConflict.DoUpdates, clause.Assignment{
+			Column: clause.Column{Name: field.DBName},
+			Value:  clause.Expr{SQL: "? + 1", Vars: []interface{}{clause.Column{Table: table, Name: field.DBName}}},
+		})
+	}
+	return onConflict
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm-learn/db/event"
+	"gorm-learn/db/types"
+)
+
+func TestUpsert(t *testing.T) {
+	d := testDB(t)
+	prefix := fmt.Sprintf("U%d", time.Now().UnixNano())
+	existing := Product{Code: prefix + "-A", Price: types.MustMoney("10", "CNY"), Stock: 5}
+	if err := d.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []Product{
+		{Code: prefix + "-A", Price: types.MustMoney("11", "CNY"), Stock: 3},
+		{Code: prefix + "-B", Price: types.MustMoney("20", "CNY"), Stock: 1},
+		{Code: prefix + "-C", Price: types.MustMoney("30", "CNY"), Stock: 2},
+	}
+	conflict := OnConflict("code", "deleted_at").Update("price_amount", "price_currency").Increment("stock")
+	result, err := Upsert(context.Background(), &rows, conflict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (UpsertResult{Inserted: 2, Updated: 1}) {
+		t.Errorf("UpsertResult = %+v", result)
+	}
+	// 冲突时回填的是已有记录的主键
+	if rows[0].ID != existing.ID {
+		t.Errorf("冲突记录的主键为 %d, 应该为 %d", rows[0].ID, existing.ID)
+	}
+	want := map[string]string{prefix + "-A": "CNY 11.00 8", prefix + "-B": "CNY 20.00 1", prefix + "-C": "CNY 30.00 2"}
+	for _, row := range rows {
+		var got Product
+		if err := d.First(&got, row.ID).Error; err != nil {
+			t.Fatalf("%s: %v", row.Code, err)
+		}
+		if s := fmt.Sprintf("%s %d", got.Price.Format(), got.Stock); got.Code != row.Code || s != want[row.Code] {
+			t.Errorf("%s: 主键 %d 对应的记录为 %s %s", row.Code, row.ID, got.Code, s)
+		}
+	}
+}
+
+func TestUpsertEvents(t *testing.T) {
+	d := testDB(t)
+	prefix := fmt.Sprintf("E%d", time.Now().UnixNano())
+	if err := d.Create(&Product{Code: prefix + "-A", Price: types.MustMoney("10", "CNY")}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	got := map[string]string{}
+	unsubscribe := Subscribe(func(ctx context.Context, e event.Event) {
+		if p, ok := e.Value.(*Product); ok && strings.HasPrefix(p.Code, prefix) {
+			mu.Lock()
+			got[p.Code] = fmt.Sprint(e.Kind, e.Changed)
+			mu.Unlock()
+		}
+	})
+	defer unsubscribe()
+
+	// 冲突的记录生成 Updated 事件, Changed 为冲突时更新的字段, 包括递增的版本号
+	rows := []Product{
+		{Code: prefix + "-A", Price: types.MustMoney("11", "CNY"), Stock: 1},
+		{Code: prefix + "-B", Price: types.MustMoney("20", "CNY"), Stock: 1},
+	}
+	if _, err := Upsert(context.Background(), &rows, OnConflict("code", "deleted_at").Increment("stock")); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{prefix + "-A": "updated[Stock Version]", prefix + "-B": "created[]"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("事件为 %v, 应该为 %v", got, want)
+	}
+
+	// 冲突时忽略的记录不生成事件
+	got = map[string]string{}
+	rows = []Product{
+		{Code: prefix + "-A", Price: types.MustMoney("12", "CNY")},
+		{Code: prefix + "-C", Price: types.MustMoney("30", "CNY")},
+	}
+	if _, err := Upsert(context.Background(), &rows, OnConflict("code", "deleted_at")); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{prefix + "-C": "created[]"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("忽略冲突时事件为 %v, 应该为 %v", got, want)
+	}
+}
+
+func TestUpsertConflictTarget(t *testing.T) {
+	testDB(t)
+	rows := []Product{{Code: fmt.Sprintf("U%d", time.Now().UnixNano()), Price: types.MustMoney("1", "CNY")}}
+	tests := []struct {
+		name     string
+		conflict *Conflict
+		err      error
+	}{
+		{name: "没有冲突字段", conflict: OnConflict(), err: ErrNoConflictTarget},
+		{name: "不存在的字段", conflict: OnConflict("sku"), err: ErrUnknownColumn},
+		{name: "没有唯一索引", conflict: OnConflict("stock").Update("price_amount"), err: ErrNoUniqueIndex},
+		// 唯一索引为 (code, deleted_at), 只有其中一部分字段不能作为冲突字段
+		{name: "唯一索引的一部分", conflict: OnConflict("code").Update("price_amount"), err: ErrNoUniqueIndex},
+		{name: "更新的字段不存在", conflict: OnConflict("code", "deleted_at").Update("sku"), err: ErrUnknownColumn},
+	}
+	for _, tt := range tests {
+		if _, err := Upsert(context.Background(), &rows, tt.conflict); !errors.Is(err, tt.err) {
+			t.Errorf("%s: 返回 %v, 应该为 %v", tt.name, err, tt.err)
+		}
+	}
+
+	// 冲突字段不能被更新, 非数值字段不能累加
+	for _, conflict := range []*Conflict{
+		OnConflict("code", "deleted_at").Update("code"),
+		OnConflict("code", "deleted_at").Increment("price_currency"),
+	} {
+		if _, err := Upsert(context.Background(), &rows, conflict); err == nil {
+			t.Errorf("%+v 应该返回错误", conflict)
+		}
+	}
+	if rows[0].ID != 0 {
+		t.Error("校验失败时不应该写入记录")
+	}
+}
+
+func TestUpsertVersion(t *testing.T) {
+	d := testDB(t)
+	code := fmt.Sprintf("U%d", time.Now().UnixNano())
+	product := Product{Code: code, Price: types.MustMoney("10", "CNY")}
+	if err := d.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []Product{{Code: code, Price: types.MustMoney("12", "CNY")}}
+	result, err := Upsert(context.Background(), &rows, OnConflict("code", "deleted_at").Update("price_amount", "price_currency"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Updated != 1 {
+		t.Errorf("UpsertResult = %+v", result)
+	}
+	var got Product
+	if err := d.First(&got, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 更新已有的记录时版本号加 1, 持有旧版本的更新会发生冲突
+	if got.Version != 2 || got.Price.Format() != "CNY 12.00" {
+		t.Errorf("upsert 之后 Version = %d, Price = %s", got.Version, got.Price)
+	}
+}
@@ -0,0 +1,141 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Lang 错误信息的语言
+type Lang string
+
+const (
+	// Chinese 中文, 默认语言
+	Chinese Lang = "zh"
+	// English 英文
+	English Lang = "en"
+)
+
+// ErrInvalid 校验失败, 可以通过 errors.Is 判断
+var ErrInvalid = errors.New("validate: 校验失败")
+
+// langKey 保存语言的 ctx key
+type langKey struct{}
+
+// WithLang 返回指定了错误信息语言的 ctx, 插件生成的 FieldError 使用该语言
+func WithLang(ctx context.Context, lang Lang) context.Context {
+	return context.WithValue(ctx, langKey{}, lang)
+}
+
+// langOf 返回 ctx 中指定的语言, 没有指定时为 Chinese
+func langOf(ctx context.Context) Lang {
+	if ctx != nil {
+		if lang, ok := ctx.Value(langKey{}).(Lang); ok {
+			return lang
+		}
+	}
+	return Chinese
+}
+
+// FieldError 一个字段的校验错误
+type FieldError struct {
+	// Model 模型名称, 例如 User
+	Model string
+	// Field 字段名, 例如 Age
+	Field string
+	// Column 列名, 例如 age
+	Column string
+	// Rule 不满足的规则, 例如 max
+	Rule string
+	// Param 规则的参数, 例如 150
+	Param string
+	// Value 字段的值
+	Value interface{}
+	// Index 批量写入时记录在切片中的下标, 从 0 开始, 单条记录时为 -1
+	Index int
+	// Lang Error 使用的语言
+	Lang Lang
+}
+
+// messages 每条规则的中英文信息, {field} 替换为列名, {param} 替换为规则的参数
+var messages = map[Lang]map[string]string{
+	Chinese: {
+		RuleRequired: "{field} 不能为空",
+		RuleMin:      "{field} 不能小于 {param}",
+		RuleMax:      "{field} 不能大于 {param}",
+		RuleLen:      "{field} 的长度必须为 {param}",
+		RuleRegexp:   "{field} 的格式不正确",
+		RuleOneOf:    "{field} 必须是 [{param}] 之一",
+	},
+	English: {
+		RuleRequired: "{field} is required",
+		RuleMin:      "{field} must not be less than {param}",
+		RuleMax:      "{field} must not be greater than {param}",
+		RuleLen:      "{field} must have a length of {param}",
+		RuleRegexp:   "{field} has an invalid format",
+		RuleOneOf:    "{field} must be one of [{param}]",
+	},
+}
+
+// Message 返回指定语言的错误信息, 不支持的语言使用中文
+func (e *FieldError) Message(lang Lang) string {
+	templates, ok := messages[lang]
+	if !ok {
+		lang, templates = Chinese, messages[Chinese]
+	}
+	name := e.Column
+	if name == "" {
+		name = e.Field
+	}
+	msg := strings.NewReplacer("{field}", name, "{param}", e.Param).Replace(templates[e.Rule])
+	if e.Index >= 0 {
+		if lang == English {
+			return fmt.Sprintf("record %d: %s", e.Index+1, msg)
+		}
+		return fmt.Sprintf("第 %d 条记录: %s", e.Index+1, msg)
+	}
+	return msg
+}
+
+func (e *FieldError) Error() string {
+	return e.Message(e.Lang)
+}
+
+// Is 使 errors.Is(err, ErrInvalid) 成立
+func (e *FieldError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+// FieldErrors 一次校验中的全部字段错误
+type FieldErrors []*FieldError
+
+// Messages 返回指定语言的全部错误信息
+func (e FieldErrors) Messages(lang Lang) []string {
+	messages := make([]string, 0, len(e))
+	for _, fe := range e {
+		messages = append(messages, fe.Message(lang))
+	}
+	return messages
+}
+
+func (e FieldErrors) Error() string {
+	if len(e) == 0 {
+		return ""
+	}
+	return strings.Join(e.Messages(e[0].Lang), "; ")
+}
+
+// Unwrap 返回每个字段的错误, 可以通过 errors.As 取出 *FieldError
+func (e FieldErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, fe := range e {
+		errs = append(errs, fe)
+	}
+	return errs
+}
+
+// Is 使 errors.Is(err, ErrInvalid) 成立
+func (e FieldErrors) Is(target error) bool {
+	return target == ErrInvalid
+}
@@ -0,0 +1,244 @@
+package validate
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Plugin 在创建与更新之前校验模型的 GORM 插件
+type Plugin struct{}
+
+// Name 实现 gorm.Plugin 接口
+func (Plugin) Name() string {
+	return "gorm-learn:validate"
+}
+
+// Initialize 实现 gorm.Plugin 接口
+//
+// 校验在模型的 BeforeSave / BeforeCreate / BeforeUpdate 钩子之后执行, 钩子中设置的值同样会被校验;
+// 并且在保存关联之前执行, 校验失败时不会写入任何数据
+func (Plugin) Initialize(db *gorm.DB) error {
+	create := db.Callback().Create()
+	if err := create.After("gorm:before_create").Before("gorm:save_before_associations").Register("validate:before_create", beforeCreate); err != nil {
+		return err
+	}
+	update := db.Callback().Update()
+	return update.After("gorm:before_update").Before("gorm:save_before_associations").Register("validate:before_update", beforeUpdate)
+}
+
+// Struct 校验 v 中全部带有 validate 标签的字段, v 可以是结构体、结构体指针或者它们的切片
+//
+// 用于写入数据库之前的预先校验, 例如导入数据时; 校验失败时返回 FieldErrors
+func Struct(ctx context.Context, v interface{}) error {
+	sch, err := schema.Parse(v, cacheStore, schema.NamingStrategy{})
+	if err != nil {
+		return err
+	}
+	c := &checker{ctx: ctx, sch: sch, lang: langOf(ctx), include: func(*schema.Field, bool) bool { return true }}
+	c.value(reflect.ValueOf(v))
+	return c.result()
+}
+
+// Fields 只校验 v 中 fields (字段名或列名) 指定的字段, v 的形式与 Struct 相同
+//
+// 用于不经过模型、而是以 SQL 表达式写入字段值的场景, 例如按主键批量更新; 校验失败时返回 FieldErrors
+func Fields(ctx context.Context, v interface{}, fields ...string) error {
+	sch, err := schema.Parse(v, cacheStore, schema.NamingStrategy{})
+	if err != nil {
+		return err
+	}
+	include := func(field *schema.Field, _ bool) bool {
+		return slices.Contains(fields, field.Name) || slices.Contains(fields, field.DBName)
+	}
+	c := &checker{ctx: ctx, sch: sch, lang: langOf(ctx), include: include}
+	c.value(reflect.ValueOf(v))
+	return c.result()
+}
+
+// cacheStore Struct 解析模型时使用的缓存
+var cacheStore = &sync.Map{}
+
+// beforeCreate 创建之前校验全部会被写入的字段
+func beforeCreate(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return
+	}
+	selected, restricted := stmt.SelectAndOmitColumns(true, false)
+	c := newChecker(stmt, func(field *schema.Field, _ bool) bool {
+		if !field.Creatable {
+			return false
+		}
+		v, ok := selected[field.DBName]
+		return (ok && v) || (!ok && !restricted)
+	})
+	if !c.maps(stmt.Dest) {
+		c.value(stmt.ReflectValue)
+	}
+	db.AddError(c.result())
+}
+
+// beforeUpdate 更新之前只校验会被写入的字段
+func beforeUpdate(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return
+	}
+	selected, restricted := stmt.SelectAndOmitColumns(false, true)
+	c := newChecker(stmt, func(field *schema.Field, zero bool) bool {
+		if !field.Updatable {
+			return false
+		}
+		// 与 GORM 生成 SET 子句的规则一致: 使用结构体更新时, 只有显式选中的字段才会写入零值
+		v, ok := selected[field.DBName]
+		return (ok && v) || (!ok && !restricted && !zero)
+	})
+	if c.maps(stmt.Dest) {
+		db.AddError(c.result())
+		return
+	}
+
+	// Updates 的参数与 Model 不是同一个对象时, 写入的是参数中的值
+	dest := reflect.Indirect(reflect.ValueOf(stmt.Dest))
+	if stmt.Dest == stmt.Model || dest.Kind() != reflect.Struct || dest.Type() != stmt.Schema.ModelType {
+		dest = stmt.ReflectValue
+	}
+	c.value(dest)
+	db.AddError(c.result())
+}
+
+// checker 一次校验的状态
+type checker struct {
+	ctx  context.Context
+	sch  *schema.Schema
+	lang Lang
+	// include 判断字段是否需要校验, zero 表示字段的值是否为零值
+	include func(field *schema.Field, zero bool) bool
+	errs    FieldErrors
+	err     error
+}
+
+func newChecker(stmt *gorm.Statement, include func(*schema.Field, bool) bool) *checker {
+	return &checker{ctx: stmt.Context, sch: stmt.Schema, lang: langOf(stmt.Context), include: include}
+}
+
+// result 返回校验结果, 标签无效时优先返回标签的错误
+func (c *checker) result() error {
+	if c.err != nil {
+		return c.err
+	}
+	if len(c.errs) > 0 {
+		return c.errs
+	}
+	return nil
+}
+
+// value 校验结构体或者结构体的切片
+func (c *checker) value(rv reflect.Value) {
+	rv = reflect.Indirect(rv)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if elem := reflect.Indirect(rv.Index(i)); elem.Kind() == reflect.Struct {
+				c.record(elem, i)
+			}
+		}
+	case reflect.Struct:
+		c.record(rv, -1)
+	}
+}
+
+// record 校验一条记录
+func (c *checker) record(rv reflect.Value, index int) {
+	for _, field := range c.sch.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		fv := field.ReflectValueOf(c.ctx, rv)
+		if !c.include(field, fv.IsZero()) {
+			continue
+		}
+		c.check(field, fv, index)
+	}
+}
+
+// maps 校验 map 形式的参数, 只校验 map 中存在的字段; dest 不是 map 时返回 false
+func (c *checker) maps(dest interface{}) bool {
+	switch dest := dest.(type) {
+	case map[string]interface{}:
+		c.mapRecord(dest, -1)
+	case *map[string]interface{}:
+		c.mapRecord(*dest, -1)
+	case []map[string]interface{}:
+		for i, m := range dest {
+			c.mapRecord(m, i)
+		}
+	case *[]map[string]interface{}:
+		for i, m := range *dest {
+			c.mapRecord(m, i)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// mapRecord 按字段顺序校验 map 中的值, SQL 表达式不做校验
+func (c *checker) mapRecord(m map[string]interface{}, index int) {
+	for _, field := range c.sch.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		v, ok := m[field.Name]
+		if !ok {
+			if v, ok = m[field.DBName]; !ok {
+				continue
+			}
+		}
+		switch v.(type) {
+		case clause.Expression, gorm.Valuer:
+			continue
+		}
+		// map 中的值总是会被写入, 零值也需要校验
+		if !c.include(field, false) {
+			continue
+		}
+		c.check(field, reflect.ValueOf(v), index)
+	}
+}
+
+// check 使用字段上的规则校验一个值
+func (c *checker) check(field *schema.Field, v reflect.Value, index int) {
+	rs, err := fieldRules(field)
+	if err != nil {
+		if c.err == nil {
+			c.err = err
+		}
+		return
+	}
+	if rs == nil {
+		return
+	}
+	if r, ok := rs.check(v); !ok {
+		var value interface{}
+		if v.IsValid() && v.CanInterface() {
+			value = v.Interface()
+		}
+		c.errs = append(c.errs, &FieldError{
+			Model:  c.sch.Name,
+			Field:  field.Name,
+			Column: field.DBName,
+			Rule:   r.name,
+			Param:  r.param,
+			Value:  value,
+			Index:  index,
+			Lang:   c.lang,
+		})
+	}
+}
@@ -0,0 +1,278 @@
+// 声明式的模型校验
+//
+// 通过结构体标签声明字段的校验规则, 多条规则以逗号分隔:
+//
+//	Name string `validate:"required,max=64"`
+//	Age  int    `validate:"min=0,max=150"`
+//	Code string `validate:"required,regexp=^[A-Z][0-9]+$"`
+//
+// 注册插件后, 创建与更新之前会自动校验, 校验失败时返回 FieldErrors:
+//
+//	d.Use(validate.Plugin{})
+//
+// 创建时校验全部字段; 更新时只校验实际会被写入的字段, 即 map 中的键、Select 选中的字段,
+// 以及使用结构体更新时的非零字段, gorm.Expr 等 SQL 表达式不做校验.
+// 因此 Updates(map[string]interface{}{"age": 20}) 不会因为 name 的 required 规则而失败
+package validate
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gorm.io/gorm/schema"
+)
+
+// TagName 声明校验规则的结构体标签名
+const TagName = "validate"
+
+// 内置的校验规则
+const (
+	// RuleRequired 不能为零值, 字符串不能只包含空白
+	RuleRequired = "required"
+	// RuleOmitEmpty 值为零值时跳过其余规则
+	RuleOmitEmpty = "omitempty"
+	// RuleMin 数字不能小于参数, 字符串、切片等长度不能小于参数
+	RuleMin = "min"
+	// RuleMax 数字不能大于参数, 字符串、切片等长度不能大于参数
+	RuleMax = "max"
+	// RuleLen 字符串、切片等长度必须等于参数
+	RuleLen = "len"
+	// RuleRegexp 字符串必须匹配参数中的正则表达式, 表达式中的逗号需要写为 \,
+	RuleRegexp = "regexp"
+	// RuleOneOf 必须是参数中以空格分隔的值之一
+	RuleOneOf = "oneof"
+)
+
+// rule 解析后的一条规则
+type rule struct {
+	name  string
+	param string
+	// number min / max / len 的参数
+	number float64
+	re     *regexp.Regexp
+	values []string
+}
+
+// rules 字段上的全部规则
+type rules struct {
+	omitEmpty bool
+	list      []rule
+}
+
+// parsed 已解析的字段规则, 字段没有规则时保存 nil
+var parsed sync.Map // map[*schema.Field]*rules
+
+// fieldRules 返回字段上声明的规则, 没有声明时返回 nil
+func fieldRules(field *schema.Field) (*rules, error) {
+	if v, ok := parsed.Load(field); ok {
+		return v.(*rules), nil
+	}
+	rs, err := parseTag(field.Tag.Get(TagName))
+	if err != nil {
+		return nil, fmt.Errorf("validate: %s.%s 的规则无效: %w", field.Schema.Name, field.Name, err)
+	}
+	parsed.Store(field, rs)
+	return rs, nil
+}
+
+// parseTag 解析标签, 标签为空时返回 nil
+func parseTag(tag string) (*rules, error) {
+	if strings.TrimSpace(tag) == "" {
+		return nil, nil
+	}
+	rs := &rules{}
+	for _, part := range splitTag(tag) {
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		r := rule{name: name, param: param}
+		switch name {
+		case "":
+			continue
+		case RuleOmitEmpty:
+			rs.omitEmpty = true
+			continue
+		case RuleRequired:
+		case RuleMin, RuleMax, RuleLen:
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s 的参数必须是数字: %q", name, param)
+			}
+			r.number = n
+		case RuleRegexp:
+			re, err := regexp.Compile(param)
+			if err != nil {
+				return nil, err
+			}
+			r.re = re
+		case RuleOneOf:
+			r.values = strings.Fields(param)
+			if len(r.values) == 0 {
+				return nil, fmt.Errorf("%s 至少需要一个值", name)
+			}
+		default:
+			return nil, fmt.Errorf("未知的规则 %q", name)
+		}
+		rs.list = append(rs.list, r)
+	}
+	return rs, nil
+}
+
+// splitTag 按逗号拆分标签, \, 表示逗号本身
+func splitTag(tag string) []string {
+	var parts []string
+	var b strings.Builder
+	for i := 0; i < len(tag); i++ {
+		switch {
+		case tag[i] == '\\' && i+1 < len(tag) && tag[i+1] == ',':
+			b.WriteByte(',')
+			i++
+		case tag[i] == ',':
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(tag[i])
+		}
+	}
+	return append(parts, b.String())
+}
+
+// check 使用规则校验一个值, 返回第一条不满足的规则
+func (rs *rules) check(v reflect.Value) (rule, bool) {
+	v = indirect(v)
+	empty := isEmpty(v)
+	if empty && rs.omitEmpty {
+		return rule{}, true
+	}
+	for _, r := range rs.list {
+		if r.name == RuleRequired {
+			if empty {
+				return r, false
+			}
+			continue
+		}
+		// 其余规则不检查 NULL, 需要时与 required 组合使用
+		if !v.IsValid() {
+			continue
+		}
+		if !r.match(v) {
+			return r, false
+		}
+	}
+	return rule{}, true
+}
+
+// match 判断值是否满足规则
+func (r rule) match(v reflect.Value) bool {
+	switch r.name {
+	case RuleMin:
+		return measure(v) >= r.number
+	case RuleMax:
+		return measure(v) <= r.number
+	case RuleLen:
+		return size(v) == r.number
+	case RuleRegexp:
+		return r.re.MatchString(text(v))
+	case RuleOneOf:
+		s := text(v)
+		for _, value := range r.values {
+			if s == value {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// indirect 解开指针、接口以及 driver.Valuer, 返回实际用于校验的值, NULL 返回无效的 reflect.Value
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+			continue
+		}
+		if !v.CanInterface() {
+			return v
+		}
+		if valuer, ok := v.Interface().(driver.Valuer); ok {
+			value, err := valuer.Value()
+			if err != nil || value == nil {
+				return reflect.Value{}
+			}
+			// 不是字符串类型, 但以数字字符串存储的值 (例如 Decimal) 按数值校验
+			if s, isString := value.(string); isString && v.Kind() != reflect.String {
+				if n, err := strconv.ParseFloat(s, 64); err == nil {
+					return reflect.ValueOf(n)
+				}
+			}
+			// Valuer 可能返回自身类型, 避免死循环
+			if next := reflect.ValueOf(value); next.Type() != v.Type() {
+				v = next
+				continue
+			}
+		}
+		return v
+	}
+	return v
+}
+
+// isEmpty 判断值是否为空, 字符串只包含空白时也视为空
+func isEmpty(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// measure 返回 min / max 比较的数值: 数字为数值本身, 其余为长度
+func measure(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return size(v)
+}
+
+// size 返回字符串的字符数或者切片、数组、map 的长度
+func size(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len())
+	}
+	return 0
+}
+
+// text 返回值的文本形式, 用于 regexp 与 oneof
+func text(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		return string(v.Bytes())
+	}
+	if !v.CanInterface() {
+		return ""
+	}
+	return fmt.Sprint(v.Interface())
+}
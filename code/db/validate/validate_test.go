@@ -0,0 +1,215 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm-learn/db/internal/dbtest"
+	"gorm-learn/db/types"
+
+	"gorm.io/gorm"
+)
+
+// testItem 测试使用的模型
+type testItem struct {
+	ID    uint
+	Name  string        `validate:"required,max=8"`
+	Age   int           `validate:"min=0,max=150"`
+	Code  string        `validate:"omitempty,regexp=^[A-Z]{2}[0-9]+$"`
+	Level string        `validate:"oneof=low high"`
+	Tags  []string      `gorm:"serializer:json" validate:"max=2"`
+	Price types.Decimal `validate:"min=0"`
+}
+
+func (testItem) TableName() string {
+	return "validate_test_items"
+}
+
+// valid 返回满足全部规则的记录
+func valid() testItem {
+	return testItem{Name: "item", Age: 18, Level: "low", Price: types.MustDecimal("1.5")}
+}
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		tag   string
+		rules []string
+		err   string
+	}{
+		{tag: "", rules: nil},
+		{tag: "required, max=64", rules: []string{"required", "max=64"}},
+		{tag: "omitempty,min=1", rules: []string{"min=1"}},
+		// \, 表示正则表达式中的逗号
+		{tag: `regexp=^a{1\,3}$,len=2`, rules: []string{"regexp=^a{1,3}$", "len=2"}},
+		{tag: "oneof=a b  c", rules: []string{"oneof=a b  c"}},
+		{tag: "max=abc", err: "max 的参数必须是数字"},
+		{tag: "oneof=", err: "oneof 至少需要一个值"},
+		{tag: "regexp=(", err: "missing closing )"},
+		{tag: "unique", err: `未知的规则 "unique"`},
+	}
+	for _, tt := range tests {
+		rs, err := parseTag(tt.tag)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseTag(%q) 的错误为 %v, 应该包含 %q", tt.tag, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTag(%q): %v", tt.tag, err)
+			continue
+		}
+		var got []string
+		if rs != nil {
+			for _, r := range rs.list {
+				s := r.name
+				if r.param != "" {
+					s += "=" + r.param
+				}
+				got = append(got, s)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.rules) {
+			t.Errorf("parseTag(%q) = %q, 应该为 %q", tt.tag, got, tt.rules)
+		}
+	}
+
+	rs, _ := parseTag("omitempty,min=1")
+	if !rs.omitEmpty {
+		t.Error("omitempty 没有被解析")
+	}
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*testItem)
+		errs   []string // 不满足的 列名:规则
+	}{
+		{name: "valid", modify: func(*testItem) {}},
+		{name: "required", modify: func(it *testItem) { it.Name = "  " }, errs: []string{"name:required"}},
+		{name: "max 按字符数计算", modify: func(it *testItem) { it.Name = "八个汉字八个汉字" }},
+		{name: "max", modify: func(it *testItem) { it.Name = "123456789" }, errs: []string{"name:max"}},
+		{name: "min", modify: func(it *testItem) { it.Age = -1 }, errs: []string{"age:min"}},
+		{name: "omitempty", modify: func(it *testItem) { it.Code = "" }},
+		{name: "regexp", modify: func(it *testItem) { it.Code = "ab1" }, errs: []string{"code:regexp"}},
+		{name: "oneof", modify: func(it *testItem) { it.Level = "mid" }, errs: []string{"level:oneof"}},
+		{name: "切片长度", modify: func(it *testItem) { it.Tags = []string{"a", "b", "c"} }, errs: []string{"tags:max"}},
+		{name: "Valuer 按数值比较", modify: func(it *testItem) { it.Price = types.MustDecimal("-0.01") }, errs: []string{"price:min"}},
+		{name: "多个字段", modify: func(it *testItem) { it.Name, it.Age = "", 200 }, errs: []string{"name:required", "age:max"}},
+	}
+	for _, tt := range tests {
+		item := valid()
+		tt.modify(&item)
+		err := Struct(context.Background(), &item)
+		var got []string
+		var errs FieldErrors
+		if errors.As(err, &errs) {
+			for _, fe := range errs {
+				got = append(got, fe.Column+":"+fe.Rule)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.errs) {
+			t.Errorf("%s: 错误为 %q, 应该为 %q", tt.name, got, tt.errs)
+		}
+		if len(tt.errs) > 0 && !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: errors.Is(err, ErrInvalid) 不成立", tt.name)
+		}
+	}
+
+	// 切片中的记录带有下标
+	items := []testItem{valid(), valid()}
+	items[1].Age = -1
+	var errs FieldErrors
+	if err := Struct(context.Background(), items); !errors.As(err, &errs) || errs[0].Index != 1 {
+		t.Errorf("切片校验返回 %v", err)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	item := valid()
+	item.Name, item.Level = "", "mid"
+	err := Struct(WithLang(context.Background(), English), &item)
+	if got := err.Error(); got != "name is required; level must be one of [low high]" {
+		t.Errorf("英文信息为 %q", got)
+	}
+
+	var errs FieldErrors
+	errors.As(err, &errs)
+	if got := errs.Messages(Chinese); !reflect.DeepEqual(got, []string{"name 不能为空", "level 必须是 [low high] 之一"}) {
+		t.Errorf("中文信息为 %q", got)
+	}
+	// 不支持的语言使用中文
+	if got := errs[0].Message("fr"); got != "name 不能为空" {
+		t.Errorf("不支持的语言返回 %q", got)
+	}
+
+	fe := &FieldError{Column: "age", Rule: RuleMin, Param: "0", Index: 2}
+	if got := fe.Message(Chinese); got != "第 3 条记录: age 不能小于 0" {
+		t.Errorf("批量写入的中文信息为 %q", got)
+	}
+	if got := fe.Message(English); got != "record 3: age must not be less than 0" {
+		t.Errorf("批量写入的英文信息为 %q", got)
+	}
+	// 默认语言为中文
+	if got := fe.Error(); !strings.HasPrefix(got, "第 3 条记录") {
+		t.Errorf("默认信息为 %q", got)
+	}
+}
+
+func TestFields(t *testing.T) {
+	item := valid()
+	item.Name, item.Age = "", -1
+	var errs FieldErrors
+	if err := Fields(context.Background(), &item, "Age"); !errors.As(err, &errs) || len(errs) != 1 || errs[0].Column != "age" {
+		t.Errorf("只校验 Age 时返回 %v", err)
+	}
+	// 列名同样可以
+	if err := Fields(context.Background(), &item, "level", "code"); err != nil {
+		t.Errorf("校验 level 与 code 时返回 %v", err)
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	d := dbtest.Open(t, Plugin{})
+	dbtest.Migrate(t, d, &testItem{})
+
+	invalid := valid()
+	invalid.Age = -1
+	if err := d.Create(&invalid).Error; !errors.Is(err, ErrInvalid) {
+		t.Fatalf("创建不满足规则的记录返回 %v", err)
+	}
+	item := valid()
+	if err := d.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		update func(tx *gorm.DB) error
+		ok     bool
+	}{
+		{name: "map 只校验其中的字段", update: func(tx *gorm.DB) error { return tx.Updates(map[string]interface{}{"age": 20}).Error }, ok: true},
+		{name: "map 中的零值", update: func(tx *gorm.DB) error { return tx.Updates(map[string]interface{}{"name": ""}).Error }},
+		{name: "结构体跳过零值", update: func(tx *gorm.DB) error { return tx.Updates(testItem{Age: 30}).Error }, ok: true},
+		{name: "结构体", update: func(tx *gorm.DB) error { return tx.Updates(testItem{Age: 200}).Error }},
+		{name: "Select 选中的零值", update: func(tx *gorm.DB) error { return tx.Select("name").Updates(testItem{}).Error }},
+		{name: "Update", update: func(tx *gorm.DB) error { return tx.Update("level", "mid").Error }},
+		{name: "SQL 表达式不做校验", update: func(tx *gorm.DB) error { return tx.Update("age", gorm.Expr("age + ?", 1)).Error }, ok: true},
+	}
+	for _, tt := range tests {
+		err := tt.update(d.Model(&testItem{ID: item.ID}))
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: 应该返回校验错误, 实际为 %v", tt.name, err)
+		}
+	}
+}
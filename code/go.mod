@@ -3,12 +3,12 @@ module gorm-learn
 go 1.21.4
 
 require (
+	github.com/go-sql-driver/mysql v1.7.1
 	gorm.io/driver/mysql v1.5.4
 	gorm.io/gorm v1.25.7
 )
 
 require (
-	github.com/go-sql-driver/mysql v1.7.1 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
 )